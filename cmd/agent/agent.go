@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net/http"
@@ -15,11 +16,16 @@ import (
 	"github.com/freepaddler/yap-metrics/internal/app/agent"
 	"github.com/freepaddler/yap-metrics/internal/app/agent/collector"
 	"github.com/freepaddler/yap-metrics/internal/app/agent/config"
+	"github.com/freepaddler/yap-metrics/internal/app/agent/reporter/grpcreporter"
 	"github.com/freepaddler/yap-metrics/internal/app/agent/reporter/httpbatchreporter"
+	"github.com/freepaddler/yap-metrics/internal/app/agent/spool"
 	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ipfilter"
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store/memory"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tlsconf"
+	"github.com/freepaddler/yap-metrics/pkg/retry"
 )
 
 var (
@@ -66,6 +72,18 @@ Build commit %s
 		}
 	}
 
+	// tls configuration
+	var tlsConf *tls.Config
+	if conf.TLSEnabled() {
+		var err error
+		tlsConf, err = tlsconf.Client(conf.TLSCA, conf.TLSCert, conf.TLSKey, conf.TLSServerName)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup tls")
+			exitCode = 1
+			return
+		}
+	}
+
 	// notify context
 	nCtx, nStop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer nStop()
@@ -98,16 +116,58 @@ Build commit %s
 		}()
 	}
 
+	// agent address to be checked by server trusted subnets
+	var realIP string
+	if ip, err := ipfilter.OutboundIP(conf.ServerAddress); err != nil {
+		logger.Log().Warn().Err(err).Msg("unable to detect outbound address")
+	} else {
+		realIP = ip.String()
+	}
+
 	// setup reporter
-	reporter := httpbatchreporter.New(
-		httpbatchreporter.WithAddress(conf.ServerAddress),
-		httpbatchreporter.WithHTTPTimeout(conf.HTTPTimeout),
-		httpbatchreporter.WithSignKey(conf.Key),
-		httpbatchreporter.WithPublicKey(pubKey),
-	)
+	var reporter agent.Reporter
+	isRetryErr := retry.IsNetErr
+	var isRejected func(error) bool
+	switch conf.Transport {
+	case config.TransportGRPC:
+		grpcReporter, err := grpcreporter.New(
+			grpcreporter.WithAddress(conf.ServerAddress),
+			grpcreporter.WithTimeout(conf.HTTPTimeout),
+			grpcreporter.WithSignKey(conf.Key),
+			grpcreporter.WithPublicKey(pubKey),
+			grpcreporter.WithTLS(tlsConf),
+			grpcreporter.WithRealIP(realIP),
+			grpcreporter.WithAPIKey(conf.APIKey),
+			grpcreporter.WithTenant(conf.Tenant),
+			grpcreporter.WithAgentID(conf.AgentID),
+		)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup grpc reporter")
+			exitCode = 1
+			return
+		}
+		defer grpcReporter.Close()
+		reporter = grpcReporter
+		isRetryErr = grpcreporter.IsRetryable
+		isRejected = grpcreporter.IsRejected
+	default:
+		reporter = httpbatchreporter.New(
+			httpbatchreporter.WithAddress(conf.ServerAddress),
+			httpbatchreporter.WithHTTPTimeout(conf.HTTPTimeout),
+			httpbatchreporter.WithSignKey(conf.Key),
+			httpbatchreporter.WithPublicKey(pubKey),
+			httpbatchreporter.WithTLS(tlsConf),
+			httpbatchreporter.WithRealIP(realIP),
+			httpbatchreporter.WithAPIKey(conf.APIKey),
+			httpbatchreporter.WithTenant(conf.Tenant),
+			httpbatchreporter.WithAgentID(conf.AgentID),
+		)
+		isRetryErr = httpbatchreporter.IsRetryable
+		isRejected = httpbatchreporter.IsRejected
+	}
 
 	// init and run agent
-	app := agent.NewAgent(
+	opts := []func(*agent.Agent){
 		agent.WithStore(store.NewStorageController(memory.NewMemoryStore())),
 		agent.WithCollectorFunc(collector.Simple),
 		agent.WithCollectorFunc(collector.MemStats),
@@ -116,8 +176,21 @@ Build commit %s
 		agent.WithReporter(reporter),
 		agent.WithReportInterval(conf.ReportInterval),
 		agent.WithRetries(1, 3, 5),
+		agent.WithRetryCheck(isRetryErr),
+		agent.WithRejectCheck(isRejected),
 		agent.WithRateLimit(2),
-	)
+	}
+	// optional spool of unsent reports
+	if conf.SpoolDir != "" {
+		sp, err := spool.Open(conf.SpoolDir, spool.WithMaxBytes(conf.SpoolMaxBytes))
+		if err != nil {
+			logger.Log().Error().Err(err).Msgf("unable to open spool: %s", conf.SpoolDir)
+			exitCode = 1
+			return
+		}
+		opts = append(opts, agent.WithSpool(sp))
+	}
+	app := agent.NewAgent(opts...)
 	err := app.Run(nCtx)
 	if err != nil {
 		logger.Log().Error().Err(err).Msg("unclean exit")
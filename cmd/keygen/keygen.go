@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
 	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
 )
 
@@ -14,11 +17,33 @@ func exitOnErr(str string, a ...any) {
 	os.Exit(1)
 }
 
+// genAPIKey prints new API key and its record for server API keys file
+func genAPIKey(name, scopes string) {
+	secret, err := apikey.Generate()
+	if err != nil {
+		exitOnErr("Unable to generate API key: %s", err)
+	}
+	key := apikey.Key{Name: name, Hash: apikey.Hash(secret), Scopes: strings.Split(scopes, ",")}
+	if err := key.Validate(); err != nil {
+		exitOnErr("Invalid API key: %s", err)
+	}
+	record, _ := json.Marshal(key)
+	fmt.Println("API key: " + secret)
+	fmt.Println("API keys file record: " + string(record))
+}
+
 func main() {
 	keySize := flag.Int("n", 1024, "keys size bytes")
 	outPath := flag.String("o", ".", "output directory")
+	apiKeyName := flag.String("a", "", "generate API key with name instead of RSA keys")
+	apiKeyScopes := flag.String("s", apikey.ScopeRead, "comma separated API key scopes (read, write, delete, admin)")
 	flag.Parse()
 
+	if *apiKeyName != "" {
+		genAPIKey(*apiKeyName, *apiKeyScopes)
+		return
+	}
+
 	dir, err := os.Stat(*outPath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -47,11 +72,12 @@ func main() {
 	}
 	defer privFile.Close()
 
-	err = crypt.WritePair(pubFile, privFile, *keySize)
+	keyID, err := crypt.WritePair(pubFile, privFile, *keySize)
 	if err != nil {
 		exitOnErr("Error %w", err)
 	}
 
 	fmt.Println("Private key is written to: " + privFilePath)
 	fmt.Println("Public key is written to: " + pubFilePath)
+	fmt.Println("Key fingerprint (key id): " + keyID)
 }
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/tls"
 	"fmt"
 	_ "net/http/pprof"
 	"os"
@@ -11,19 +11,32 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip"
 
 	"github.com/freepaddler/yap-metrics/internal/app/server"
 	"github.com/freepaddler/yap-metrics/internal/app/server/config"
+	"github.com/freepaddler/yap-metrics/internal/app/server/graphite"
 	"github.com/freepaddler/yap-metrics/internal/app/server/handler"
 	"github.com/freepaddler/yap-metrics/internal/app/server/router"
+	"github.com/freepaddler/yap-metrics/internal/app/server/statsd"
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
 	"github.com/freepaddler/yap-metrics/internal/pkg/compress"
 	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ipfilter"
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/otlp"
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ratelimit"
 	"github.com/freepaddler/yap-metrics/internal/pkg/sign"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store/filedump"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store/memory"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store/postgres"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tlsconf"
 )
 
 var (
@@ -56,17 +69,75 @@ Build commit %s
 	nCtx, nStop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer nStop()
 
-	var privateKey *rsa.PrivateKey
-	if conf.PrivateKeyFile != "" {
-		f, err := os.Open(conf.PrivateKeyFile)
+	// private keys to decrypt requests
+	var keys *crypt.KeySet
+	if paths := conf.PrivateKeyPaths(); len(paths) > 0 {
+		var err error
+		keys, err = crypt.ReadKeySet(paths...)
 		if err != nil {
-			logger.Log().Error().Err(err).Msgf("unable to open private key file: %s", conf.PrivateKeyFile)
+			logger.Log().Error().Err(err).Msgf("unable to read private keys from: %v", paths)
 			exitCode = 2
 			return
 		}
-		privateKey, err = crypt.ReadPrivateKey(f)
+	}
+
+	// tls configuration, shared by http and grpc servers
+	var tlsConf *tls.Config
+	if conf.TLSEnabled() {
+		var err error
+		tlsConf, err = tlsconf.Server(conf.TLSCert, conf.TLSKey, conf.TLSClientCA)
 		if err != nil {
-			logger.Log().Error().Err(err).Msgf("unable to read public key from file: %s", conf.PrivateKeyFile)
+			logger.Log().Error().Err(err).Msg("unable to setup tls")
+			exitCode = 2
+			return
+		}
+	}
+
+	// trusted subnets
+	var filter *ipfilter.Filter
+	if len(conf.TrustedSubnets) > 0 {
+		var err error
+		filter, err = ipfilter.New(conf.TrustedSubnets...)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup trusted subnets")
+			exitCode = 2
+			return
+		}
+	}
+
+	// api keys
+	var keyStore apikey.Store
+	switch {
+	case conf.APIKeysFile != "":
+		fs, err := apikey.ReadFile(conf.APIKeysFile)
+		if err != nil {
+			logger.Log().Error().Err(err).Msgf("unable to read api keys from: %s", conf.APIKeysFile)
+			exitCode = 2
+			return
+		}
+		keyStore = fs
+	case conf.APIKeysDB:
+		ps, err := apikey.NewPostgresStore(conf.DBURL, 2*time.Second)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup api keys db storage")
+			exitCode = 2
+			return
+		}
+		defer ps.Close()
+		keyStore = ps
+	}
+	var auth *apikey.Authorizer
+	if keyStore != nil {
+		auth = apikey.NewAuthorizer(keyStore)
+	}
+
+	// client requests rate limit
+	var limiter *ratelimit.Limiter
+	if conf.RateLimit > 0 {
+		var err error
+		limiter, err = ratelimit.New(conf.RateLimit, conf.RateBurst)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup rate limit")
 			exitCode = 2
 			return
 		}
@@ -84,52 +155,222 @@ Build commit %s
 		}
 	}
 
-	// define storage
-	var metricsStore store.Store
+	// define storage, every tenant has its own storage
+	var factory store.TenantFactory
 	if conf.DBURL != "" {
 		var err error
 		pgstore, err := postgres.NewPostgresStorage(conf.DBURL,
 			postgres.WithTimeout(2*time.Second),
 			postgres.WithRetry(1),
+			postgres.WithRetention(conf.Retention),
 		)
 		if err != nil {
 			logger.Log().Err(err).Msg("unable to setup db storage")
-			metricsStore = memory.NewMemoryStore()
 		} else {
 			defer pgstore.Close()
-			metricsStore = pgstore
+			factory = pgstore
 			// disable file dump if db is ok
 			dump = nil
 		}
 	}
-	if metricsStore == nil {
-		metricsStore = memory.NewMemoryStore()
+	if factory == nil {
+		factory = store.NewStoreFunc(func() store.Store { return memory.NewMemoryStore() })
+	}
+	tenants := store.NewTenants(factory,
+		store.WithBatchWindow(conf.BatchWindow),
+		store.WithTTL(models.Counter, conf.CounterTTL),
+		store.WithTTL(models.Gauge, conf.GaugeTTL),
+		store.WithTTL(models.Histogram, conf.HistogramTTL),
+		store.WithSubscriberBuffer(conf.StreamBuffer),
+	)
+	tenants.Restrict(conf.Tenants...)
+	// server own metrics are kept by default tenant
+	storage := tenants.Default()
+
+	if conf.InfluxIntegers != models.Counter && conf.InfluxIntegers != models.Gauge {
+		logger.Log().Error().Msgf("invalid influx integer type '%s', should be counter or gauge", conf.InfluxIntegers)
+		exitCode = 2
+		return
 	}
-	storage := store.NewStorageController(metricsStore)
 
 	// define http handlers
-	httpHandlers := handler.NewHTTPHandlers(storage)
+	httpHandlers := handler.NewHTTPHandlers(storage,
+		handler.WithTenants(handler.StoreTenants(tenants)),
+		handler.WithMaxBatch(conf.MaxBatch),
+		handler.WithInfluxIntegers(conf.InfluxIntegers),
+		handler.WithOTLP(otlp.NewConverter(
+			otlp.WithResourceLabels(conf.OTLPLabels...),
+			otlp.WithNameAttribute(conf.OTLPNameAttr),
+		)),
+		handler.WithHeartbeat(conf.StreamHeartbeat),
+	)
+
+	// request signature verification, rejected requests are counted in metrics
+	verifier := sign.NewVerifier(conf.Key,
+		sign.WithSkew(conf.SignSkew),
+		sign.WithNonceCache(conf.NonceCache),
+		sign.WithRequireStamp(conf.SignRequireStamp),
+		sign.WithRejectHook(func(reason string) {
+			storage.CollectCounter("sign_rejected_requests", models.Labels{"reason": reason}, 1)
+		}),
+	)
 
 	// setup router
-	httpRouter := router.New(
+	routerOpts := []func(*router.Router){
 		router.WithHandler(httpHandlers),
 		router.WithLog(logger.LogRequestResponse),
 		router.WithGunzip(compress.GunzipMiddleware),
-		router.WithGzip(middleware.Compress(4, "application/json", "text/html")),
-		router.WithCrypt(crypt.DecryptMiddleware(privateKey)),
-		router.WithSign(sign.Middleware(conf.Key)),
+		router.WithGzip(middleware.Compress(4, "application/json", "text/html", "text/plain")),
+		router.WithCrypt(crypt.DecryptMiddleware(keys)),
+		router.WithSign(verifier.Middleware),
+		router.WithTenant(tenant.Middleware),
 		router.WithProfilerAt("/debug/"),
-	)
+	}
+	// route policies are applied in order: trusted subnets, then required signature
+	if filter != nil {
+		routerOpts = append(routerOpts, router.WithWritePolicy(filter.Middleware))
+		if conf.TrustedReads {
+			routerOpts = append(routerOpts, router.WithReadPolicy(filter.Middleware))
+		}
+	}
+	if conf.SignStrict {
+		routerOpts = append(routerOpts, router.WithWritePolicy(verifier.Require))
+	}
+	if conf.SignStrictReads {
+		routerOpts = append(routerOpts, router.WithReadPolicy(verifier.Require))
+	}
+	if auth != nil {
+		routerOpts = append(routerOpts, router.WithAuth(auth.Require))
+	}
+	if conf.MaxBodySize > 0 {
+		routerOpts = append(routerOpts, router.WithMaxBody(ratelimit.MaxBytes(conf.MaxBodySize)))
+	}
+	if limiter != nil {
+		routerOpts = append(routerOpts, router.WithRateLimit(limiter.Middleware))
+	}
+	httpRouter := router.New(routerOpts...)
+
+	// setup grpc server, method policies are applied in the same order as route policies
+	writeMethods := []string{
+		pb.Metrics_Update_FullMethodName,
+		pb.Metrics_UpdateBatch_FullMethodName,
+		pb.Metrics_Push_FullMethodName,
+	}
+	readMethods := []string{
+		pb.Metrics_Get_FullMethodName,
+		pb.Metrics_List_FullMethodName,
+	}
+	unary := []grpc.UnaryServerInterceptor{logger.UnaryServerInterceptor}
+	stream := []grpc.StreamServerInterceptor{logger.StreamServerInterceptor}
+	if filter != nil {
+		// restrict only methods updating metrics, unless reads are restricted too
+		var methods []string
+		if !conf.TrustedReads {
+			methods = writeMethods
+		}
+		unary = append(unary, filter.UnaryServerInterceptor(methods...))
+		stream = append(stream, filter.StreamServerInterceptor(methods...))
+	}
+	var signed []string
+	if conf.SignStrict {
+		signed = append(signed, writeMethods...)
+	}
+	if conf.SignStrictReads {
+		signed = append(signed, readMethods...)
+	}
+	if len(signed) > 0 {
+		unary = append(unary, verifier.RequireUnaryServerInterceptor(signed...))
+		stream = append(stream, verifier.RequireStreamServerInterceptor(signed...))
+	}
+	unary = append(unary, tenant.UnaryServerInterceptor)
+	stream = append(stream, tenant.StreamServerInterceptor)
+	// unauthorized calls are rate limited too
+	if limiter != nil {
+		unary = append(unary, limiter.UnaryServerInterceptor)
+		stream = append(stream, limiter.StreamServerInterceptor)
+	}
+	if auth != nil {
+		scopes := map[string]string{
+			pb.Metrics_Update_FullMethodName:      apikey.ScopeWrite,
+			pb.Metrics_UpdateBatch_FullMethodName: apikey.ScopeWrite,
+			pb.Metrics_Push_FullMethodName:        apikey.ScopeWrite,
+			pb.Metrics_Get_FullMethodName:         apikey.ScopeRead,
+			pb.Metrics_List_FullMethodName:        apikey.ScopeRead,
+		}
+		unary = append(unary, auth.UnaryServerInterceptor(scopes))
+		stream = append(stream, auth.StreamServerInterceptor(scopes))
+	}
+	grpcOpts := []grpc.ServerOption{
+		grpc.ForceServerCodec(crypt.NewServerCodec(keys)),
+		grpc.ChainUnaryInterceptor(append(unary, verifier.UnaryServerInterceptor)...),
+		grpc.ChainStreamInterceptor(append(stream, verifier.StreamServerInterceptor)...),
+	}
+	if conf.MaxBodySize > 0 {
+		grpcOpts = append(grpcOpts, grpc.MaxRecvMsgSize(int(conf.MaxBodySize)))
+	}
+	if tlsConf != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConf)))
+	}
+	grpcServer := grpc.NewServer(grpcOpts...)
+	pb.RegisterMetricsServer(grpcServer, handler.NewGRPCHandlers(storage,
+		handler.WithGRPCTenants(handler.StoreTenants(tenants)),
+		handler.WithGRPCMaxBatch(conf.MaxBatch),
+	))
 
 	// init and run server
-	app := server.NewServer(
+	serverOpts := []func(*server.Server){
 		server.WithAddress(conf.Address),
 		server.WithRouter(httpRouter),
+		server.WithShutdownHook(httpHandlers.StopStreams),
+		server.WithTLS(tlsConf),
 		server.WithDump(dump),
-		server.WithStorage(storage),
+		server.WithStorage(tenants),
 		server.WithDumpInterval(conf.StoreInterval),
 		server.WithRestore(conf.Restore),
-	)
+		server.WithStaleSweep(tenants, conf.StaleSweepInterval()),
+		server.WithGRPC(grpcServer, conf.GRPCAddress),
+	}
+	// StatsD metrics go to default tenant
+	if conf.StatsDAddress != "" || conf.StatsDTCPAddress != "" {
+		l, err := statsd.New(storage,
+			statsd.WithUDP(conf.StatsDAddress),
+			statsd.WithTCP(conf.StatsDTCPAddress),
+			statsd.WithFlushInterval(conf.StatsDFlush),
+			statsd.WithTimingBounds(conf.StatsDBounds),
+		)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup statsd listener")
+			exitCode = 2
+			return
+		}
+		serverOpts = append(serverOpts, server.WithListener(l))
+	}
+	// Graphite metrics go to default tenant
+	if conf.GraphiteAddress != "" {
+		var rules graphite.Rules
+		if conf.GraphiteRules != "" {
+			var err error
+			rules, err = graphite.ReadRules(conf.GraphiteRules)
+			if err != nil {
+				logger.Log().Error().Err(err).Msgf("unable to read graphite rules from: %s", conf.GraphiteRules)
+				exitCode = 2
+				return
+			}
+		}
+		l, err := graphite.New(storage,
+			graphite.WithAddress(conf.GraphiteAddress),
+			graphite.WithRules(rules),
+			graphite.WithDefaultType(conf.GraphiteDefault),
+			graphite.WithMaxBatch(conf.MaxBatch),
+		)
+		if err != nil {
+			logger.Log().Error().Err(err).Msg("unable to setup graphite listener")
+			exitCode = 2
+			return
+		}
+		serverOpts = append(serverOpts, server.WithListener(l))
+	}
+	app := server.NewServer(serverOpts...)
 	err := app.Run(nCtx)
 	if err != nil {
 		logger.Log().Error().Err(err).Msg("unclean exit")
@@ -2,17 +2,27 @@
 //
 // Runs collectors every pollInterval.
 //
-// Sends reports every reportInterval.
-// In case of failed send restores unreported values back to store.
+// Sends reports every reportInterval. Every report is sent as a batch with unique id.
+// In case of failed send restores unreported gauges back to store.
+// Unreported counters and histograms are kept with the batch id and resent on the next report,
+// so server is able to skip them if they were already applied. Number of kept batches is limited,
+// the oldest ones are dropped when the limit is exceeded: batch ids are never changed, as server
+// may have already applied the batch and would count its values twice.
+// Once send fails, other batches are not sent till the next report.
 //
 // Sending reports supports retries with predefined intervals.
 //
+// Optional spool persists failed batches on disk instead of keeping them in memory.
+// Spooled batches are replayed in order before the next report, also after agent restart.
+//
 // rateLimit limits the maximum number of simultaneous report processes.
 
 package agent
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"sync"
@@ -24,16 +34,21 @@ import (
 	"github.com/freepaddler/yap-metrics/pkg/wpool"
 )
 
+const defaultMaxPending = 10
+
 var (
 	ErrPostShutdown = errors.New("post-shutdown routine failed")
+	ErrSpool        = errors.New("spool failed")
 )
 
 //go:generate mockgen -source $GOFILE -package=mocks -destination ../../../mocks/AgentStorage_mock.go
 
-// CollectorStorage allows collectors to access store with required methods
+// CollectorStorage allows collectors to access store with required methods.
+// Labels are optional and may be nil.
 type CollectorStorage interface {
-	CollectCounter(name string, val int64)
-	CollectGauge(name string, val float64)
+	CollectCounter(name string, labels models.Labels, val int64)
+	CollectGauge(name string, labels models.Labels, val float64)
+	CollectHistogram(name string, labels models.Labels, bounds []float64, val float64)
 }
 
 // CollectorFunc defines function type for collectors
@@ -45,9 +60,15 @@ type ReporterStorage interface {
 	RestoreLatest(metrics []models.Metrics, ts time.Time)
 }
 
-// Reporter is used to report metrics
+// Reporter is used to report metrics batch with unique id
 type Reporter interface {
-	Send([]models.Metrics) error
+	Send(id string, metrics []models.Metrics) error
+}
+
+// Spool is a durable queue of failed batches
+type Spool interface {
+	Push(id string, ts time.Time, metrics []models.Metrics) error
+	Replay(send func(id string, ts time.Time, metrics []models.Metrics) error) error
 }
 
 // AgentStorage interface for agent App
@@ -56,6 +77,13 @@ type AgentStorage interface {
 	ReporterStorage
 }
 
+// batch is a report identified by unique id
+type batch struct {
+	id      string
+	metrics []models.Metrics
+	ts      time.Time
+}
+
 // Agent is agent application config
 type Agent struct {
 	storage        AgentStorage
@@ -65,7 +93,13 @@ type Agent struct {
 	reportInterval time.Duration
 	wg             sync.WaitGroup
 	retries        []int
+	isRetryErr     func(error) bool
+	isRejected     func(error) bool
 	rateLimit      int
+	muPending      sync.Mutex
+	pending        []batch // unreported counters batches
+	maxPending     int     // pending batches limit
+	spool          Spool
 }
 
 // NewAgent is an Agent constructor
@@ -74,6 +108,9 @@ func NewAgent(options ...func(*Agent)) *Agent {
 		pollInterval:   10 * time.Second,
 		reportInterval: 10 * time.Second,
 		rateLimit:      1,
+		isRetryErr:     retry.IsNetErr,
+		isRejected:     func(error) bool { return false },
+		maxPending:     defaultMaxPending,
 	}
 	for _, opt := range options {
 		opt(agent)
@@ -123,6 +160,44 @@ func WithRetries(r ...int) func(*Agent) {
 	}
 }
 
+// WithRetryCheck sets function to check report error is transient and report should be retried.
+// Default is retry.IsNetErr.
+func WithRetryCheck(fn func(error) bool) func(*Agent) {
+	return func(agt *Agent) {
+		if fn != nil {
+			agt.isRetryErr = fn
+		}
+	}
+}
+
+// WithRejectCheck sets function to check batch is rejected by server and will never be accepted.
+// Rejected batches are dropped, otherwise they would block sending of the next ones.
+// By default batches are never rejected.
+func WithRejectCheck(fn func(error) bool) func(*Agent) {
+	return func(agt *Agent) {
+		if fn != nil {
+			agt.isRejected = fn
+		}
+	}
+}
+
+// WithSpool sets durable queue for failed batches
+func WithSpool(s Spool) func(*Agent) {
+	return func(agt *Agent) {
+		agt.spool = s
+	}
+}
+
+// WithMaxPending sets limit of unreported batches kept in memory, default is 10.
+// The oldest batches over the limit are dropped, use spool to keep them all.
+func WithMaxPending(n int) func(*Agent) {
+	return func(agt *Agent) {
+		if n > 0 {
+			agt.maxPending = n
+		}
+	}
+}
+
 // WithRateLimit sets parallel sending processes count
 func WithRateLimit(rl int) func(*Agent) {
 	return func(agt *Agent) {
@@ -141,6 +216,123 @@ func checkCtxCancel(ctx context.Context) {
 	}
 }
 
+// newBatchID returns random batch id
+func newBatchID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		logger.Log().Warn().Err(err).Msg("unable to generate batch id")
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// newBatch creates batch with new id from store report
+func (agt *Agent) newBatch() batch {
+	metrics, ts := agt.storage.ReportAll()
+	return batch{id: newBatchID(), metrics: metrics, ts: ts}
+}
+
+// takePending returns unreported batches and clears the pending list
+func (agt *Agent) takePending() []batch {
+	agt.muPending.Lock()
+	defer agt.muPending.Unlock()
+	pending := agt.pending
+	agt.pending = nil
+	return pending
+}
+
+// restore returns unreported gauges back to store.
+// Counters and histograms are kept in pending batch with the same id: in case server has already
+// applied the batch (i.e. response timed out), it will skip it on resend.
+func (agt *Agent) restore(b batch) {
+	gauges := make([]models.Metrics, 0, len(b.metrics))
+	additive := make([]models.Metrics, 0, len(b.metrics))
+	for _, m := range b.metrics {
+		if m.Type == models.Counter || m.Type == models.Histogram {
+			additive = append(additive, m)
+		} else {
+			gauges = append(gauges, m)
+		}
+	}
+	if len(gauges) > 0 {
+		logger.Log().Info().Msg("restore unsent gauges to store")
+		agt.storage.RestoreLatest(gauges, b.ts)
+	}
+	if len(additive) > 0 {
+		logger.Log().Info().Msgf("keep unsent counters and histograms of batch '%s' to resend", b.id)
+		agt.muPending.Lock()
+		agt.pending = append(agt.pending, batch{id: b.id, metrics: additive, ts: b.ts})
+		if len(agt.pending) > agt.maxPending {
+			dropped := agt.pending[0]
+			logger.Log().Error().Msgf("too many unsent batches, drop the oldest batch '%s' of %d metrics: its values are lost",
+				dropped.id, len(dropped.metrics))
+			agt.pending = agt.pending[1:]
+		}
+		agt.muPending.Unlock()
+	}
+}
+
+// send sends batch with retries, batch rejected by server is dropped
+func (agt *Agent) send(ctx context.Context, id string, metrics []models.Metrics) error {
+	// server should not delay retries beyond the next report
+	err := retry.WithStrategy(retry.WithMaxDelay(ctx, agt.reportInterval), func(context.Context) error {
+		return agt.reporter.Send(id, metrics)
+	}, agt.isRetryErr, agt.retries...)
+	if err != nil && agt.isRejected(err) {
+		logger.Log().Error().Err(err).Msgf("batch '%s' of %d metrics is rejected by server, drop it", id, len(metrics))
+		return nil
+	}
+	return err
+}
+
+// toSpool puts failed batch to spool, returns false if batch was not spooled
+func (agt *Agent) toSpool(b batch) bool {
+	if agt.spool == nil {
+		return false
+	}
+	if err := agt.spool.Push(b.id, b.ts, b.metrics); err != nil {
+		logger.Log().Error().Err(err).Msgf("unable to spool batch '%s'", b.id)
+		return false
+	}
+	logger.Log().Info().Msgf("batch '%s' is spooled to resend", b.id)
+	return true
+}
+
+// replay sends spooled batches, returns false if some batches are left in spool
+func (agt *Agent) replay(send func(id string, metrics []models.Metrics) error) bool {
+	if agt.spool == nil {
+		return true
+	}
+	err := agt.spool.Replay(func(id string, _ time.Time, metrics []models.Metrics) error {
+		return send(id, metrics)
+	})
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("unable to send spooled batches")
+		return false
+	}
+	return true
+}
+
+// report sends spooled and pending batches and new report with retries.
+// If spool replay or any send fails, other batches are spooled or kept without sending to keep the order.
+func (agt *Agent) report(ctx context.Context) {
+	sending := agt.replay(func(id string, metrics []models.Metrics) error {
+		return agt.send(ctx, id, metrics)
+	})
+	for _, b := range append(agt.takePending(), agt.newBatch()) {
+		if sending {
+			if err := agt.send(ctx, b.id, b.metrics); err == nil {
+				continue
+			}
+			// server is unavailable, do not wait for retries of every batch
+			sending = false
+		}
+		if !agt.toSpool(b) {
+			agt.restore(b)
+		}
+	}
+}
+
 func (agt *Agent) Run(ctx context.Context) error {
 	checkCtxCancel(ctx)
 	logger.Log().Info().Msg("starting agent")
@@ -181,19 +373,7 @@ func (agt *Agent) Run(ctx context.Context) error {
 			logger.Log().Info().Msg("new report cycle")
 
 			if err := wp.Task(func() {
-				report, ts := agt.storage.ReportAll()
-
-				err := retry.WithStrategy(ctx, func(context.Context) error {
-					err := func() (err error) {
-						return agt.reporter.Send(report)
-					}()
-					return err
-				}, retry.IsNetErr, agt.retries...)
-
-				if err != nil {
-					logger.Log().Info().Msg("restore unsent report to store")
-					agt.storage.RestoreLatest(report, ts)
-				}
+				agt.report(ctx)
 			}); err != nil {
 				logger.Log().Warn().Err(err).Msg("unable to add reporting task to wpool")
 			}
@@ -222,10 +402,18 @@ func (agt *Agent) Run(ctx context.Context) error {
 
 	// report all metrics to server
 	logger.Log().Info().Msg("report metrics to server")
-	report, _ := agt.storage.ReportAll()
-	err := agt.reporter.Send(report)
-	if err != nil {
-		return fmt.Errorf("%w: %w", ErrPostShutdown, err)
+	replayed := agt.replay(agt.reporter.Send)
+	for _, b := range append(agt.takePending(), agt.newBatch()) {
+		var err error
+		if replayed {
+			err = agt.reporter.Send(b.id, b.metrics)
+		}
+		if (!replayed || err != nil) && !agt.toSpool(b) {
+			if err == nil {
+				err = ErrSpool
+			}
+			return fmt.Errorf("%w: %w", ErrPostShutdown, err)
+		}
 	}
 	logger.Log().Info().Msg("post-shutdown routines done")
 	return nil
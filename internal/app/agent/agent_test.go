@@ -20,7 +20,9 @@ func TestAgent_Run(t *testing.T) {
 	store := mocks.NewMockAgentStorage(mockController)
 	reporter := mocks.NewMockReporter(mockController)
 
-	metrics := []models.Metrics{{Name: "name", Type: models.Counter, IValue: new(int64)}}
+	counters := []models.Metrics{{Name: "name", Type: models.Counter, IValue: new(int64)}}
+	gauges := []models.Metrics{{Name: "name", Type: models.Gauge, FValue: new(float64)}}
+	metrics := append(append([]models.Metrics{}, counters...), gauges...)
 	tests := []struct {
 		name           string
 		runningTime    time.Duration
@@ -72,18 +74,28 @@ func TestAgent_Run(t *testing.T) {
 			defer cancel()
 			ts := time.Now()
 			store.EXPECT().ReportAll().Times(tt.reporterRuns).Return(metrics, ts)
-			//reporter.EXPECT().Send(metrics).Times(tt.reporterRuns)
-			//store.EXPECT().RestoreLatest(metrics, ts).Times(tt.restoreCalls)
+			// failed batch id is remembered to check it is resent
+			var failedID string
+			failSend := func(id string, _ []models.Metrics) error {
+				failedID = id
+				return errors.New("some error")
+			}
+			resendSend := func(id string, _ []models.Metrics) error {
+				assert.Equal(t, failedID, id, "Expect unsent counters resent with the same batch id")
+				return nil
+			}
 			gomock.InOrder(
-				reporter.EXPECT().Send(metrics).Return(nil),
-				reporter.EXPECT().Send(metrics).Return(nil),
-				reporter.EXPECT().Send(metrics).Return(errors.New("some error")),
-				store.EXPECT().RestoreLatest(metrics, ts),
-				reporter.EXPECT().Send(metrics).Return(nil),
-				reporter.EXPECT().Send(metrics).Return(errors.New("some error")),
-				store.EXPECT().RestoreLatest(metrics, ts),
-				reporter.EXPECT().Send(metrics).Return(nil),
-				reporter.EXPECT().Send(metrics).Return(tt.lastResult),
+				reporter.EXPECT().Send(gomock.Any(), metrics).Return(nil),
+				reporter.EXPECT().Send(gomock.Any(), metrics).Return(nil),
+				reporter.EXPECT().Send(gomock.Any(), metrics).DoAndReturn(failSend),
+				store.EXPECT().RestoreLatest(gauges, ts),
+				reporter.EXPECT().Send(gomock.Any(), counters).DoAndReturn(resendSend),
+				reporter.EXPECT().Send(gomock.Any(), metrics).Return(nil),
+				reporter.EXPECT().Send(gomock.Any(), metrics).DoAndReturn(failSend),
+				store.EXPECT().RestoreLatest(gauges, ts),
+				reporter.EXPECT().Send(gomock.Any(), counters).DoAndReturn(resendSend),
+				reporter.EXPECT().Send(gomock.Any(), metrics).Return(nil),
+				reporter.EXPECT().Send(gomock.Any(), metrics).Return(tt.lastResult),
 			)
 			err := app.Run(ctx)
 			if tt.wantErr != nil {
@@ -94,3 +106,132 @@ func TestAgent_Run(t *testing.T) {
 	}
 
 }
+
+func TestAgent_reportSpool(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	store := mocks.NewMockAgentStorage(mockController)
+	reporter := mocks.NewMockReporter(mockController)
+	spool := mocks.NewMockSpool(mockController)
+
+	metrics := []models.Metrics{{Name: "name", Type: models.Gauge, FValue: new(float64)}}
+	ts := time.Now()
+	sendErr := errors.New("send error")
+	app := NewAgent(
+		WithStore(store),
+		WithReporter(reporter),
+		WithSpool(spool),
+	)
+	spooled := func(id string, metrics []models.Metrics) func(func(string, time.Time, []models.Metrics) error) error {
+		return func(send func(string, time.Time, []models.Metrics) error) error {
+			return send(id, ts, metrics)
+		}
+	}
+
+	t.Run("failed batch is spooled", func(t *testing.T) {
+		gomock.InOrder(
+			spool.EXPECT().Replay(gomock.Any()).Return(nil),
+			store.EXPECT().ReportAll().Return(metrics, ts),
+			reporter.EXPECT().Send(gomock.Any(), metrics).Return(sendErr),
+			spool.EXPECT().Push(gomock.Any(), ts, metrics).Return(nil),
+		)
+		app.report(context.Background())
+	})
+
+	t.Run("new batch is spooled after failed replay", func(t *testing.T) {
+		gomock.InOrder(
+			spool.EXPECT().Replay(gomock.Any()).DoAndReturn(spooled("b1", metrics)),
+			reporter.EXPECT().Send("b1", metrics).Return(sendErr),
+			store.EXPECT().ReportAll().Return(metrics, ts),
+			spool.EXPECT().Push(gomock.Any(), ts, metrics).Return(nil),
+		)
+		app.report(context.Background())
+	})
+
+	t.Run("restore if spool failed", func(t *testing.T) {
+		gomock.InOrder(
+			spool.EXPECT().Replay(gomock.Any()).DoAndReturn(spooled("b1", metrics)),
+			reporter.EXPECT().Send("b1", metrics).Return(nil),
+			store.EXPECT().ReportAll().Return(metrics, ts),
+			reporter.EXPECT().Send(gomock.Any(), metrics).Return(sendErr),
+			spool.EXPECT().Push(gomock.Any(), ts, metrics).Return(sendErr),
+			store.EXPECT().RestoreLatest(metrics, ts),
+		)
+		app.report(context.Background())
+	})
+}
+
+func TestAgent_reportRejected(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	store := mocks.NewMockAgentStorage(mockController)
+	reporter := mocks.NewMockReporter(mockController)
+	spool := mocks.NewMockSpool(mockController)
+
+	metrics := []models.Metrics{{Name: "name", Type: models.Gauge, FValue: new(float64)}}
+	ts := time.Now()
+	rejectErr := errors.New("rejected")
+	app := NewAgent(
+		WithStore(store),
+		WithReporter(reporter),
+		WithSpool(spool),
+		WithRejectCheck(func(err error) bool { return errors.Is(err, rejectErr) }),
+	)
+
+	// rejected batches are dropped and do not block the next ones
+	gomock.InOrder(
+		spool.EXPECT().Replay(gomock.Any()).DoAndReturn(func(send func(string, time.Time, []models.Metrics) error) error {
+			if err := send("b1", ts, metrics); err != nil {
+				return err
+			}
+			return send("b2", ts, metrics)
+		}),
+		reporter.EXPECT().Send("b1", metrics).Return(rejectErr),
+		reporter.EXPECT().Send("b2", metrics).Return(nil),
+		store.EXPECT().ReportAll().Return(metrics, ts),
+		reporter.EXPECT().Send(gomock.Any(), metrics).Return(rejectErr),
+	)
+	app.report(context.Background())
+	assert.Empty(t, app.pending)
+}
+
+func TestAgent_reportPending(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	store := mocks.NewMockAgentStorage(mockController)
+	reporter := mocks.NewMockReporter(mockController)
+
+	ts := time.Now()
+	sendErr := errors.New("send error")
+	counter := func(v int64) []models.Metrics {
+		return []models.Metrics{{Name: "c1", Type: models.Counter, IValue: &v}}
+	}
+	app := NewAgent(
+		WithStore(store),
+		WithReporter(reporter),
+		WithMaxPending(2),
+	)
+
+	t.Run("oldest batch is dropped", func(t *testing.T) {
+		app.restore(batch{id: "b1", metrics: counter(1), ts: ts})
+		app.restore(batch{id: "b2", metrics: counter(2), ts: ts})
+		app.restore(batch{id: "b3", metrics: counter(3), ts: ts})
+		require.Len(t, app.pending, 2)
+		assert.Equal(t, "b2", app.pending[0].id)
+		assert.Equal(t, counter(2), app.pending[0].metrics)
+		assert.Equal(t, "b3", app.pending[1].id)
+		assert.Equal(t, counter(3), app.pending[1].metrics)
+	})
+
+	t.Run("batches are not sent after failure", func(t *testing.T) {
+		gomock.InOrder(
+			store.EXPECT().ReportAll().Return(counter(4), ts),
+			reporter.EXPECT().Send("b2", counter(2)).Return(sendErr),
+		)
+		app.report(context.Background())
+		require.Len(t, app.pending, 2)
+		assert.Equal(t, "b3", app.pending[0].id, "batch ids should be kept")
+		assert.Equal(t, counter(3), app.pending[0].metrics)
+		assert.Equal(t, counter(4), app.pending[1].metrics, "new batch should be kept")
+	})
+}
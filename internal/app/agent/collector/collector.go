@@ -2,23 +2,24 @@ package collector
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
 	"runtime"
+	"strconv"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 
 	"github.com/freepaddler/yap-metrics/internal/app/agent"
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
 )
 
 func Simple(_ context.Context, store agent.CollectorStorage) {
 	logger.Log().Debug().Msg("collect simple start")
 	// update PollCount metric
-	store.CollectCounter("PollCount", 1)
+	store.CollectCounter("PollCount", nil, 1)
 	// update RandomValue
-	store.CollectGauge("RandomValue", rand.Float64())
+	store.CollectGauge("RandomValue", nil, rand.Float64())
 	logger.Log().Debug().Msg("collect simple done")
 }
 
@@ -26,33 +27,33 @@ func MemStats(_ context.Context, store agent.CollectorStorage) {
 	logger.Log().Debug().Msg("collect memStats start")
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
-	store.CollectGauge("Alloc", float64(memStats.Alloc))
-	store.CollectGauge("BuckHashSys", float64(memStats.BuckHashSys))
-	store.CollectGauge("Frees", float64(memStats.Frees))
-	store.CollectGauge("GCCPUFraction", memStats.GCCPUFraction)
-	store.CollectGauge("GCSys", float64(memStats.GCSys))
-	store.CollectGauge("HeapAlloc", float64(memStats.HeapAlloc))
-	store.CollectGauge("HeapIdle", float64(memStats.HeapIdle))
-	store.CollectGauge("HeapInuse", float64(memStats.HeapInuse))
-	store.CollectGauge("HeapObjects", float64(memStats.HeapObjects))
-	store.CollectGauge("HeapReleased", float64(memStats.HeapReleased))
-	store.CollectGauge("HeapSys", float64(memStats.HeapSys))
-	store.CollectGauge("LastGC", float64(memStats.LastGC))
-	store.CollectGauge("Lookups", float64(memStats.Lookups))
-	store.CollectGauge("MCacheInuse", float64(memStats.MCacheInuse))
-	store.CollectGauge("MCacheSys", float64(memStats.MCacheSys))
-	store.CollectGauge("MSpanInuse", float64(memStats.MSpanInuse))
-	store.CollectGauge("MSpanSys", float64(memStats.MSpanSys))
-	store.CollectGauge("Mallocs", float64(memStats.Mallocs))
-	store.CollectGauge("NextGC", float64(memStats.NextGC))
-	store.CollectGauge("NumForcedGC", float64(memStats.NumForcedGC))
-	store.CollectGauge("NumGC", float64(memStats.NumGC))
-	store.CollectGauge("OtherSys", float64(memStats.OtherSys))
-	store.CollectGauge("PauseTotalNs", float64(memStats.PauseTotalNs))
-	store.CollectGauge("StackInuse", float64(memStats.StackInuse))
-	store.CollectGauge("StackSys", float64(memStats.StackSys))
-	store.CollectGauge("Sys", float64(memStats.Sys))
-	store.CollectGauge("TotalAlloc", float64(memStats.TotalAlloc))
+	store.CollectGauge("Alloc", nil, float64(memStats.Alloc))
+	store.CollectGauge("BuckHashSys", nil, float64(memStats.BuckHashSys))
+	store.CollectGauge("Frees", nil, float64(memStats.Frees))
+	store.CollectGauge("GCCPUFraction", nil, memStats.GCCPUFraction)
+	store.CollectGauge("GCSys", nil, float64(memStats.GCSys))
+	store.CollectGauge("HeapAlloc", nil, float64(memStats.HeapAlloc))
+	store.CollectGauge("HeapIdle", nil, float64(memStats.HeapIdle))
+	store.CollectGauge("HeapInuse", nil, float64(memStats.HeapInuse))
+	store.CollectGauge("HeapObjects", nil, float64(memStats.HeapObjects))
+	store.CollectGauge("HeapReleased", nil, float64(memStats.HeapReleased))
+	store.CollectGauge("HeapSys", nil, float64(memStats.HeapSys))
+	store.CollectGauge("LastGC", nil, float64(memStats.LastGC))
+	store.CollectGauge("Lookups", nil, float64(memStats.Lookups))
+	store.CollectGauge("MCacheInuse", nil, float64(memStats.MCacheInuse))
+	store.CollectGauge("MCacheSys", nil, float64(memStats.MCacheSys))
+	store.CollectGauge("MSpanInuse", nil, float64(memStats.MSpanInuse))
+	store.CollectGauge("MSpanSys", nil, float64(memStats.MSpanSys))
+	store.CollectGauge("Mallocs", nil, float64(memStats.Mallocs))
+	store.CollectGauge("NextGC", nil, float64(memStats.NextGC))
+	store.CollectGauge("NumForcedGC", nil, float64(memStats.NumForcedGC))
+	store.CollectGauge("NumGC", nil, float64(memStats.NumGC))
+	store.CollectGauge("OtherSys", nil, float64(memStats.OtherSys))
+	store.CollectGauge("PauseTotalNs", nil, float64(memStats.PauseTotalNs))
+	store.CollectGauge("StackInuse", nil, float64(memStats.StackInuse))
+	store.CollectGauge("StackSys", nil, float64(memStats.StackSys))
+	store.CollectGauge("Sys", nil, float64(memStats.Sys))
+	store.CollectGauge("TotalAlloc", nil, float64(memStats.TotalAlloc))
 
 	logger.Log().Debug().Msg("collect memStats done")
 }
@@ -64,8 +65,8 @@ func GoPS(ctx context.Context, store agent.CollectorStorage) {
 	if err != nil {
 		logger.Log().Warn().Msg("unable to get VirtualMemory metrics")
 	} else {
-		store.CollectGauge("TotalMemory", float64(vm.Total))
-		store.CollectGauge("FreeMemory", float64(vm.Free))
+		store.CollectGauge("TotalMemory", nil, float64(vm.Total))
+		store.CollectGauge("FreeMemory", nil, float64(vm.Free))
 	}
 
 	cpuP, err := cpu.PercentWithContext(ctx, 0, true)
@@ -73,7 +74,7 @@ func GoPS(ctx context.Context, store agent.CollectorStorage) {
 		logger.Log().Warn().Msg("unable to get CPUutilization metrics")
 	} else {
 		for i, v := range cpuP {
-			store.CollectGauge(fmt.Sprintf("CPUutilization%d", i+1), v)
+			store.CollectGauge("CPUutilization", models.Labels{"cpu": strconv.Itoa(i + 1)}, v)
 		}
 	}
 
@@ -2,12 +2,13 @@ package collector
 
 import (
 	"context"
-	"fmt"
 	"runtime"
+	"strconv"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
 	"github.com/freepaddler/yap-metrics/mocks"
 )
 
@@ -15,8 +16,8 @@ func TestSimple(t *testing.T) {
 	var mockController = gomock.NewController(t)
 	defer mockController.Finish()
 	m := mocks.NewMockAgentStorage(mockController)
-	m.EXPECT().CollectCounter("PollCount", int64(1)).Times(2)
-	m.EXPECT().CollectGauge("RandomValue", gomock.Any()).Times(2)
+	m.EXPECT().CollectCounter("PollCount", nil, int64(1)).Times(2)
+	m.EXPECT().CollectGauge("RandomValue", nil, gomock.Any()).Times(2)
 	Simple(context.Background(), m)
 	Simple(context.Background(), m)
 }
@@ -25,33 +26,33 @@ func TestMemStats(t *testing.T) {
 	var mockController = gomock.NewController(t)
 	defer mockController.Finish()
 	m := mocks.NewMockAgentStorage(mockController)
-	m.EXPECT().CollectGauge("Alloc", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("BuckHashSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("Frees", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("GCCPUFraction", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("GCSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("HeapAlloc", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("HeapIdle", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("HeapInuse", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("HeapObjects", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("HeapReleased", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("HeapSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("LastGC", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("Lookups", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("MCacheInuse", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("MCacheSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("MSpanInuse", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("MSpanSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("Mallocs", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("NextGC", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("NumForcedGC", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("NumGC", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("OtherSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("PauseTotalNs", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("StackInuse", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("StackSys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("Sys", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("TotalAlloc", gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("Alloc", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("BuckHashSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("Frees", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("GCCPUFraction", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("GCSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("HeapAlloc", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("HeapIdle", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("HeapInuse", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("HeapObjects", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("HeapReleased", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("HeapSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("LastGC", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("Lookups", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("MCacheInuse", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("MCacheSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("MSpanInuse", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("MSpanSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("Mallocs", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("NextGC", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("NumForcedGC", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("NumGC", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("OtherSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("PauseTotalNs", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("StackInuse", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("StackSys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("Sys", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("TotalAlloc", nil, gomock.Any()).Times(2)
 	MemStats(context.Background(), m)
 	MemStats(context.Background(), m)
 }
@@ -60,12 +61,11 @@ func TestGoPS(t *testing.T) {
 	var mockController = gomock.NewController(t)
 	defer mockController.Finish()
 	m := mocks.NewMockAgentStorage(mockController)
-	m.EXPECT().CollectGauge("TotalMemory", gomock.Any()).Times(2)
-	m.EXPECT().CollectGauge("FreeMemory", gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("TotalMemory", nil, gomock.Any()).Times(2)
+	m.EXPECT().CollectGauge("FreeMemory", nil, gomock.Any()).Times(2)
 	for i := 0; i < runtime.NumCPU(); i++ {
-		j := i + 1
-		cpuMetric := fmt.Sprintf("CPUutilization%d", j)
-		m.EXPECT().CollectGauge(cpuMetric, gomock.Any()).Times(2)
+		labels := models.Labels{"cpu": strconv.Itoa(i + 1)}
+		m.EXPECT().CollectGauge("CPUutilization", labels, gomock.Any()).Times(2)
 	}
 	GoPS(context.Background(), m)
 	GoPS(context.Background(), m)
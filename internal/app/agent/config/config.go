@@ -23,11 +23,20 @@ const (
 	defaultLogLevel    = "info"
 	defaultKey         = ""
 	defaultRateLimit   = 1
+	defaultTransport   = TransportHTTP
+	defaultSpoolSize   = 64 << 20
+)
+
+// Report transports
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
 )
 
 // Config implements agent configuration
 type Config struct {
 	ServerAddress  string `env:"ADDRESS" json:"address"`
+	Transport      string `env:"TRANSPORT" json:"transport"`
 	ReportInterval uint32 `env:"REPORT_INTERVAL"`
 	PollInterval   uint32 `env:"POLL_INTERVAL"`
 	PublicKeyFile  string `env:"CRYPTO_KEY" json:"crypto_key"`
@@ -35,8 +44,18 @@ type Config struct {
 	HTTPTimeout     time.Duration `env:"HTTP_TIMEOUT"`
 	LogLevel        string        `env:"LOG_LEVEL"`
 	Key             string        `env:"KEY"`
+	APIKey          string        `env:"API_KEY" json:"api_key"`
+	Tenant          string        `env:"TENANT" json:"tenant"`
+	AgentID         string        `env:"AGENT_ID" json:"agent_id"`
 	ReportRateLimit int           `env:"RATE_LIMIT"`
 	PprofAddress    string        `env:"PPROF_ADDRESS"`
+	SpoolDir        string        `env:"SPOOL_DIR" json:"spool_dir"`
+	SpoolMaxBytes   int64         `env:"SPOOL_MAX_BYTES" json:"spool_max_bytes"`
+	TLS             bool          `env:"TLS" json:"tls"`
+	TLSCA           string        `env:"TLS_CA" json:"tls_ca"`
+	TLSCert         string        `env:"TLS_CERT" json:"tls_cert"`
+	TLSKey          string        `env:"TLS_KEY" json:"tls_key"`
+	TLSServerName   string        `env:"TLS_SERVER_NAME" json:"tls_server_name"`
 
 	ConfigFile string `env:"CONFIG"`
 }
@@ -67,6 +86,12 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// TLSEnabled reports whether agent should connect to server with TLS.
+// TLS is enabled explicitly or by any TLS option set.
+func (c *Config) TLSEnabled() bool {
+	return c.TLS || c.TLSCA != "" || c.TLSCert != "" || c.TLSKey != "" || c.TLSServerName != ""
+}
+
 func parseConfigFile(c *Config) error {
 	if c.ConfigFile != "" {
 		f, err := os.Open(c.ConfigFile)
@@ -85,7 +110,18 @@ func parseConfigFile(c *Config) error {
 	return nil
 }
 
+// mask hides secret value
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "***"
+}
+
+// printConfig prints configuration with secrets masked
 func printConfig(c Config) {
+	c.Key = mask(c.Key)
+	c.APIKey = mask(c.APIKey)
 	fmt.Println("Startup configuration:")
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
@@ -112,6 +148,13 @@ func NewConfig() *Config {
 		defaultServerAddress,
 		"metrics collector server address `HOST:PORT`",
 	)
+	flag.StringVarP(
+		&c.Transport,
+		"transport",
+		"",
+		defaultTransport,
+		"report `transport` (http, grpc), server address should be of the selected transport",
+	)
 	flag.Uint32VarP(
 		&c.ReportInterval,
 		"reportInterval",
@@ -147,6 +190,27 @@ func NewConfig() *Config {
 		defaultKey,
 		"key for integrity hash calculation `secretkey`",
 	)
+	flag.StringVarP(
+		&c.APIKey,
+		"apiKey",
+		"",
+		"",
+		"API `key` to access server",
+	)
+	flag.StringVarP(
+		&c.Tenant,
+		"tenant",
+		"",
+		"",
+		"`tenant` to report metrics to, empty uses API key tenant or default",
+	)
+	flag.StringVarP(
+		&c.AgentID,
+		"agentID",
+		"",
+		"",
+		"agent `id` to identify agent by server rate limit, API key takes precedence",
+	)
 	flag.IntVarP(
 		&c.ReportRateLimit,
 		"rateLimit",
@@ -161,6 +225,55 @@ func NewConfig() *Config {
 		"",
 		"enable an run pprof http server on `host:port`",
 	)
+	flag.StringVarP(
+		&c.SpoolDir,
+		"spoolDir",
+		"s",
+		"",
+		"`path` to directory to keep unsent reports, empty keeps them in memory",
+	)
+	flag.Int64VarP(
+		&c.SpoolMaxBytes,
+		"spoolMaxBytes",
+		"",
+		defaultSpoolSize,
+		"max spool size in `bytes`, the oldest reports are dropped",
+	)
+	flag.BoolVarP(
+		&c.TLS,
+		"tls",
+		"",
+		false,
+		"connect to server with TLS, server certificate is verified with system CAs: `=true/false`",
+	)
+	flag.StringVarP(
+		&c.TLSCA,
+		"tlsCA",
+		"",
+		"",
+		"`path` to CA bundle in PEM format to verify server certificate, enables TLS",
+	)
+	flag.StringVarP(
+		&c.TLSCert,
+		"tlsCert",
+		"",
+		"",
+		"`path` to client certificate file in PEM format for mutual TLS, enables TLS",
+	)
+	flag.StringVarP(
+		&c.TLSKey,
+		"tlsKey",
+		"",
+		"",
+		"`path` to client certificate private key file in PEM format",
+	)
+	flag.StringVarP(
+		&c.TLSServerName,
+		"tlsServerName",
+		"",
+		"",
+		"server `name` to verify server certificate, host of server address if empty",
+	)
 	flag.StringVarP(
 		&c.PublicKeyFile,
 		"-crypto-key",
@@ -213,6 +326,13 @@ func NewConfig() *Config {
 		c.HTTPTimeout = defaultHTTPTimeout
 	}
 
+	switch c.Transport {
+	case TransportHTTP, TransportGRPC:
+	default:
+		logger.Log().Warn().Msgf("invalid transport '%s'. Using default %s", c.Transport, defaultTransport)
+		c.Transport = defaultTransport
+	}
+
 	// print config
 	printConfig(c)
 
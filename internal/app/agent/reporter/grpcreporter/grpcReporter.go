@@ -0,0 +1,278 @@
+// Package grpcreporter implements agent reporter sending metrics batches to gRPC server
+package grpcreporter
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ipfilter"
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ratelimit"
+	"github.com/freepaddler/yap-metrics/internal/pkg/sign"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+	"github.com/freepaddler/yap-metrics/pkg/retry"
+)
+
+// RateLimitError is returned when server rejected call with ResourceExhausted having RetryInfo detail.
+// Delay is a period from RetryInfo, see retry.Delayer.
+type RateLimitError struct {
+	Delay time.Duration
+	err   error
+}
+
+func (e *RateLimitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter returns period to wait before retry
+func (e *RateLimitError) RetryAfter() time.Duration {
+	return e.Delay
+}
+
+// GRPCStatus returns status of rate limited call
+func (e *RateLimitError) GRPCStatus() *status.Status {
+	return status.Convert(e.err)
+}
+
+// rateLimitError returns *RateLimitError if call is rate limited by server, otherwise err itself
+func rateLimitError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.ResourceExhausted {
+		return err
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return &RateLimitError{Delay: info.GetRetryDelay().AsDuration(), err: err}
+		}
+	}
+	return err
+}
+
+type Reporter struct {
+	address   string
+	timeout   time.Duration
+	key       string
+	publicKey *rsa.PublicKey
+	tlsConf   *tls.Config
+	realIP    string
+	apiKey    string
+	tenant    string
+	agentID   string
+	dialOpts  []grpc.DialOption
+	conn      *grpc.ClientConn
+	client    pb.MetricsClient
+}
+
+// New creates reporter and its connection to server. Connection is established on the first Send.
+func New(opts ...func(r *Reporter)) (*Reporter, error) {
+	reporter := &Reporter{timeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(reporter)
+	}
+	creds := insecure.NewCredentials()
+	if reporter.tlsConf != nil {
+		creds = credentials.NewTLS(reporter.tlsConf)
+	}
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(
+			grpc.UseCompressor(gzip.Name),
+			grpc.ForceCodec(crypt.NewClientCodec(reporter.publicKey)),
+		),
+	}, reporter.dialOpts...)
+	conn, err := grpc.Dial(reporter.address, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	reporter.conn = conn
+	reporter.client = pb.NewMetricsClient(conn)
+	return reporter, nil
+}
+
+func WithAddress(a string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.address = a
+	}
+}
+
+// WithTimeout sets deadline of every Send call
+func WithTimeout(d time.Duration) func(*Reporter) {
+	return func(r *Reporter) {
+		r.timeout = d
+	}
+}
+
+func WithSignKey(k string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.key = k
+	}
+}
+
+func WithPublicKey(pk *rsa.PublicKey) func(*Reporter) {
+	return func(r *Reporter) {
+		r.publicKey = pk
+	}
+}
+
+// WithAPIKey sets API key sent in `authorization` metadata
+func WithAPIKey(k string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.apiKey = k
+	}
+}
+
+// WithTenant sets tenant sent in `x-tenant` metadata
+func WithTenant(t string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.tenant = t
+	}
+}
+
+// WithAgentID sets agent id sent in `x-agent-id` metadata to identify agent by server rate limit
+func WithAgentID(id string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.agentID = id
+	}
+}
+
+// WithRealIP sets agent address sent in `x-real-ip` metadata
+func WithRealIP(ip string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.realIP = ip
+	}
+}
+
+// WithTLS makes reporter connect to server with TLS configuration, nil keeps insecure connection
+func WithTLS(conf *tls.Config) func(*Reporter) {
+	return func(r *Reporter) {
+		r.tlsConf = conf
+	}
+}
+
+// WithDialOptions adds grpc connection options, they override defaults
+func WithDialOptions(opts ...grpc.DialOption) func(*Reporter) {
+	return func(r *Reporter) {
+		r.dialOpts = append(r.dialOpts, opts...)
+	}
+}
+
+// Close closes server connection
+func (r *Reporter) Close() error {
+	return r.conn.Close()
+}
+
+// Send streams metrics batch to server with Push call. Batch id makes server skip
+// already applied batches on resend.
+func (r *Reporter) Send(id string, m []models.Metrics) error {
+	log := logger.Log().With().Str("module", "grpcReporter").Logger()
+	if len(m) == 0 {
+		log.Info().Msg("skip sending: empty report")
+		return nil
+	}
+	log.Debug().Msgf("sending %d metrics in batch", len(m))
+	req := &pb.UpdateBatchRequest{
+		BatchId: id,
+		Metrics: make([]*pb.Metric, 0, len(m)),
+	}
+	for _, v := range m {
+		req.Metrics = append(req.Metrics, pb.FromMetrics(v))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if r.realIP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, ipfilter.MetadataKey, r.realIP)
+	}
+	if r.apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, apikey.MetadataKey, apikey.Bearer(r.apiKey))
+	}
+	if r.tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, r.tenant)
+	}
+	if r.agentID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, ratelimit.AgentMetadataKey, r.agentID)
+	}
+	if r.key != "" {
+		ts, nonce := sign.NewStamp()
+		msgSign, err := sign.GetStampedMessage(req, ts, nonce, r.key)
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to sign batch")
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			sign.MetadataKey, msgSign,
+			sign.TimestampMetadataKey, ts,
+			sign.NonceMetadataKey, nonce,
+		)
+	}
+
+	stream, err := r.client.Push(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to open stream")
+		return rateLimitError(err)
+	}
+	if err := stream.Send(req); err != nil {
+		// real error is returned by CloseAndRecv
+		log.Debug().Err(err).Msg("stream send failed")
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		log.Warn().Err(err).Msg("failed to send batch")
+		return rateLimitError(err)
+	}
+	return nil
+}
+
+// IsRetryable checks error is transient and request may be retried.
+// ResourceExhausted is retried only if it is a rate limit (see RateLimitError): without
+// RetryInfo detail it means message size limit, which is exceeded again on retry.
+// May be used as isRetryError function for retry.WithStrategy.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return true
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return retry.IsNetErr(err)
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRejected checks batch is rejected by server and will never be accepted: batch is marked
+// with pb.BatchRejected detail by server handler, or message exceeds server size limit
+// (ResourceExhausted without RetryInfo). Other errors keep batch to be resent.
+func IsRejected(err error) bool {
+	if pb.IsBatchRejected(err) {
+		return true
+	}
+	var rl *RateLimitError
+	return status.Code(err) == codes.ResourceExhausted && !errors.As(err, &rl)
+}
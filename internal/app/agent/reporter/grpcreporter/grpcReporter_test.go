@@ -0,0 +1,194 @@
+package grpcreporter
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+	"github.com/freepaddler/yap-metrics/internal/pkg/sign"
+	"github.com/freepaddler/yap-metrics/pkg/retry"
+)
+
+// testServer stores received batches or fails with err
+type testServer struct {
+	pb.UnimplementedMetricsServer
+	batches []*pb.UpdateBatchRequest
+	err     error
+	delay   time.Duration
+}
+
+func (s *testServer) Push(stream pb.Metrics_PushServer) error {
+	time.Sleep(s.delay)
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.PushResponse{Batches: uint32(len(s.batches))})
+		}
+		if err != nil {
+			return err
+		}
+		if s.err != nil {
+			return s.err
+		}
+		s.batches = append(s.batches, req)
+	}
+}
+
+// newTestReporter starts server on buffered connection and returns reporter connected to it
+func newTestReporter(t *testing.T, srv *testServer, serverOpts []grpc.ServerOption, opts ...func(*Reporter)) *Reporter {
+	t.Helper()
+	listen := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(serverOpts...)
+	pb.RegisterMetricsServer(s, srv)
+	go s.Serve(listen)
+	t.Cleanup(s.Stop)
+	opts = append(opts, WithAddress("bufnet"), WithDialOptions(
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listen.DialContext(ctx)
+		}),
+	))
+	r, err := New(opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestReporter_Send(t *testing.T) {
+	delta, value := int64(1), 0.5
+	report := []models.Metrics{
+		{Name: "c1", Type: models.Counter, IValue: &delta},
+		{Name: "g1", Type: models.Gauge, Labels: models.Labels{"cpu": "1"}, FValue: &value},
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		srv        *testServer
+		serverOpts []grpc.ServerOption
+		opts       []func(*Reporter)
+		report     []models.Metrics
+		wantCode   codes.Code
+		wantSent   int
+	}{
+		{name: "empty report", srv: &testServer{}},
+		{name: "success report", srv: &testServer{}, report: report, wantSent: 1},
+		{
+			name:       "signed and encrypted report",
+			srv:        &testServer{},
+			serverOpts: []grpc.ServerOption{grpc.ForceServerCodec(crypt.NewServerCodec(crypt.NewKeySet(key))), grpc.StreamInterceptor(sign.NewVerifier("key", sign.WithRequireStamp(true)).StreamServerInterceptor)},
+			opts:       []func(*Reporter){WithSignKey("key"), WithPublicKey(&key.PublicKey)},
+			report:     report,
+			wantSent:   1,
+		},
+		{
+			name:       "invalid sign",
+			srv:        &testServer{},
+			serverOpts: []grpc.ServerOption{grpc.StreamInterceptor(sign.StreamServerInterceptor("key"))},
+			opts:       []func(*Reporter){WithSignKey("otherKey")},
+			report:     report,
+			wantCode:   codes.Unauthenticated,
+		},
+		{
+			name:     "server error",
+			srv:      &testServer{err: status.Error(codes.Unavailable, "unavailable")},
+			report:   report,
+			wantCode: codes.Unavailable,
+		},
+		{
+			name:     "deadline",
+			srv:      &testServer{delay: 200 * time.Millisecond},
+			opts:     []func(*Reporter){WithTimeout(50 * time.Millisecond)},
+			report:   report,
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReporter(t, tt.srv, tt.serverOpts, tt.opts...)
+			err := r.Send("b1", tt.report)
+			require.Equal(t, tt.wantCode, status.Code(err))
+			require.Len(t, tt.srv.batches, tt.wantSent)
+			if tt.wantSent > 0 {
+				assert.Equal(t, "b1", tt.srv.batches[0].GetBatchId())
+				got, err := pb.ToMetricsSlice(tt.srv.batches[0].GetMetrics())
+				require.NoError(t, err)
+				assert.Equal(t, tt.report, got)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{name: "unavailable", err: status.Error(codes.Unavailable, ""), want: true},
+		{name: "deadline", err: status.Error(codes.DeadlineExceeded, ""), want: true},
+		{name: "message too large", err: status.Error(codes.ResourceExhausted, "")},
+		{name: "rate limited", err: rateLimitError(limitStatus(t, time.Second)), want: true},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, "")},
+		{name: "internal", err: status.Error(codes.Internal, "")},
+		{name: "connection refused", err: syscall.ECONNREFUSED, want: true},
+		{name: "other error", err: errors.New("other")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+// limitStatus returns rate limit error with RetryInfo detail
+func limitStatus(t *testing.T, d time.Duration) error {
+	t.Helper()
+	s, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(d)})
+	require.NoError(t, err)
+	return s.Err()
+}
+
+func TestReporter_RateLimited(t *testing.T) {
+	report := []models.Metrics{{Name: "c1", Type: models.Counter, IValue: new(int64)}}
+	srv := &testServer{err: limitStatus(t, 3*time.Second)}
+	r := newTestReporter(t, srv, nil)
+	err := r.Send("b1", report)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.True(t, IsRetryable(err))
+	assert.False(t, IsRejected(err))
+	d, ok := retry.After(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+}
+
+func TestIsRejected(t *testing.T) {
+	assert.True(t, IsRejected(pb.RejectBatch("empty batch")))
+	// not marked InvalidArgument may be returned by middleware, batch is kept
+	assert.False(t, IsRejected(status.Error(codes.InvalidArgument, "")))
+	assert.False(t, IsRejected(status.Error(codes.Unauthenticated, "")))
+	assert.False(t, IsRejected(status.Error(codes.Unavailable, "")))
+	assert.True(t, IsRejected(status.Error(codes.ResourceExhausted, "message too large")))
+	assert.False(t, IsRejected(rateLimitError(limitStatus(t, time.Second))))
+	assert.False(t, IsRejected(errors.New("other")))
+	assert.False(t, IsRejected(nil))
+}
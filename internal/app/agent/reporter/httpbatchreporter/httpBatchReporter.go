@@ -2,41 +2,147 @@ package httpbatchreporter
 
 import (
 	"crypto/rsa"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
 	"github.com/freepaddler/yap-metrics/internal/pkg/compress"
 	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ipfilter"
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ratelimit"
 	"github.com/freepaddler/yap-metrics/internal/pkg/sign"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+	"github.com/freepaddler/yap-metrics/pkg/retry"
 )
 
 var (
 	ErrBadResponse = errors.New("unexpected server response")
+	ErrRateLimited = errors.New("rate limited by server")
+	ErrRejected    = errors.New("batch rejected by server")
 )
 
+// RateLimitError is returned when server rejected request with 429/TooManyRequests.
+// Delay is a period from `Retry-After` response header, see retry.Delayer.
+type RateLimitError struct {
+	Delay time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.Delay)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// RetryAfter returns period to wait before retry
+func (e *RateLimitError) RetryAfter() time.Duration {
+	return e.Delay
+}
+
+// IsRetryable checks error is transient and request may be retried.
+// May be used as isRetryError function for retry.WithStrategy.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || retry.IsNetErr(err)
+}
+
+// IsRejected checks batch is invalid or too large for server and will never be accepted
+func IsRejected(err error) bool {
+	return errors.Is(err, ErrRejected)
+}
+
+// parseRetryAfter parses `Retry-After` header value in seconds or http date, 0 if value is invalid
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		if s < 0 {
+			return 0
+		}
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
 type Reporter struct {
+	address   string
+	scheme    string
 	url       string
 	client    http.Client
 	key       string
 	publicKey *rsa.PublicKey
+	keyID     string
+	realIP    string
+	apiKey    string
+	tenant    string
+	agentID   string
 }
 
 func New(opts ...func(r *Reporter)) *Reporter {
-	reporter := &Reporter{client: http.Client{}}
+	reporter := &Reporter{client: http.Client{}, scheme: "http"}
 	for _, opt := range opts {
 		opt(reporter)
 	}
+	reporter.url = fmt.Sprintf("%s://%s/updates/", reporter.scheme, reporter.address)
 	return reporter
 }
 
 func WithAddress(a string) func(*Reporter) {
 	return func(r *Reporter) {
-		r.url = fmt.Sprintf("http://%s/updates/", a)
+		r.address = a
+	}
+}
+
+// WithAPIKey sets API key sent in `Authorization` header
+func WithAPIKey(k string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.apiKey = k
+	}
+}
+
+// WithTenant sets tenant sent in `X-Tenant` header
+func WithTenant(t string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.tenant = t
+	}
+}
+
+// WithAgentID sets agent id sent in `X-Agent-ID` header to identify agent by server rate limit
+func WithAgentID(id string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.agentID = id
+	}
+}
+
+// WithRealIP sets agent address sent in `X-Real-IP` header
+func WithRealIP(ip string) func(*Reporter) {
+	return func(r *Reporter) {
+		r.realIP = ip
+	}
+}
+
+// WithTLS makes reporter send metrics over https with TLS configuration, nil keeps plain http
+func WithTLS(conf *tls.Config) func(*Reporter) {
+	return func(r *Reporter) {
+		if conf == nil {
+			return
+		}
+		r.scheme = "https"
+		r.client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: conf,
+		}
 	}
 }
 
@@ -55,10 +161,18 @@ func WithSignKey(k string) func(*Reporter) {
 func WithPublicKey(pk *rsa.PublicKey) func(*Reporter) {
 	return func(r *Reporter) {
 		r.publicKey = pk
+		if pk != nil {
+			r.keyID = crypt.Fingerprint(pk)
+		}
 	}
 }
 
-func (r Reporter) Send(m []models.Metrics) (err error) {
+// Send reports metrics batch to server. Non-empty batch id is sent in `X-Batch-ID` header
+// to let server skip already applied batches on resend.
+// Rate limited request returns *RateLimitError with delay requested by server.
+// Batch rejected by server handler (response has `X-Batch-Rejected: true` header) returns ErrRejected,
+// any other failed request keeps batch to be resent.
+func (r Reporter) Send(id string, m []models.Metrics) (err error) {
 	log := logger.Log().With().Str("module", "httpBatchReporter").Logger()
 	if len(m) == 0 {
 		log.Info().Msg("skip sending: empty report")
@@ -71,19 +185,22 @@ func (r Reporter) Send(m []models.Metrics) (err error) {
 		return
 	}
 
-	// calculate hash
-	var HashSHA256 string
+	// calculate hash of stamped request
+	var HashSHA256, ts, nonce string
 	if r.key != "" {
-		HashSHA256 = sign.Get(body, r.key)
+		ts, nonce = sign.NewStamp()
+		HashSHA256 = sign.GetStamped(body, ts, nonce, r.key)
 	}
 
 	// encrypt body
 	encBody := body
+	var encrypted bool
 	if r.publicKey != nil {
 		encBody, err = crypt.EncryptBody(&body, r.publicKey)
 		if err != nil {
 			log.Error().Err(err).Msg("unable to encrypt http request")
 		}
+		encrypted = err == nil
 	}
 
 	// compress body
@@ -97,6 +214,26 @@ func (r Reporter) Send(m []models.Metrics) (err error) {
 	// set hash header
 	if HashSHA256 != "" {
 		req.Header.Set("HashSHA256", HashSHA256)
+		req.Header.Set(sign.TimestampHeader, ts)
+		req.Header.Set(sign.NonceHeader, nonce)
+	}
+	if id != "" {
+		req.Header.Set("X-Batch-ID", id)
+	}
+	if encrypted {
+		req.Header.Set(crypt.KeyIDHeader, r.keyID)
+	}
+	if r.realIP != "" {
+		req.Header.Set(ipfilter.Header, r.realIP)
+	}
+	if r.apiKey != "" {
+		req.Header.Set(apikey.Header, apikey.Bearer(r.apiKey))
+	}
+	if r.tenant != "" {
+		req.Header.Set(tenant.Header, r.tenant)
+	}
+	if r.agentID != "" {
+		req.Header.Set(ratelimit.AgentHeader, r.agentID)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept-Encoding", "gzip")
@@ -110,6 +247,15 @@ func (r Reporter) Send(m []models.Metrics) (err error) {
 		return
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err = &RateLimitError{Delay: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+		log.Warn().Err(err).Msg("report rejected")
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.Header.Get("X-Batch-Rejected") == "true" {
+		log.Warn().Msgf("batch rejected with status: %s", resp.Status)
+		return fmt.Errorf("%w: %s", ErrRejected, resp.Status)
+	}
 	if resp.StatusCode != http.StatusOK {
 		// request failed
 		log.Warn().Msgf("wrong http response status: %s", resp.Status)
@@ -1,6 +1,10 @@
 package httpbatchreporter
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,10 +14,19 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/crypt"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ipfilter"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ratelimit"
+	"github.com/freepaddler/yap-metrics/internal/pkg/sign"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+	"github.com/freepaddler/yap-metrics/pkg/retry"
 )
 
 func TestHTTPReporter_ReportBatchJSON(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
 
 	report := []models.Metrics{
 		{
@@ -34,6 +47,7 @@ func TestHTTPReporter_ReportBatchJSON(t *testing.T) {
 		serverReachable bool
 		respCode        int
 		key             string
+		publicKey       *rsa.PublicKey
 		mocks           func()
 	}{
 		{
@@ -53,6 +67,13 @@ func TestHTTPReporter_ReportBatchJSON(t *testing.T) {
 			key:             "someKey",
 			respCode:        http.StatusOK,
 		},
+		{
+			name:            "encrypted report",
+			httpRequest:     true,
+			serverReachable: true,
+			publicKey:       &privateKey.PublicKey,
+			respCode:        http.StatusOK,
+		},
 		{
 			name:            "server bad response",
 			httpRequest:     true,
@@ -75,9 +96,20 @@ func TestHTTPReporter_ReportBatchJSON(t *testing.T) {
 				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
 				assert.Equal(t, "gzip", req.Header.Get("Accept-Encoding"))
 				assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+				assert.Equal(t, "batch1", req.Header.Get("X-Batch-ID"))
 				if tt.key != "" {
 					require.NotEmpty(t, req.Header.Get("HashSHA256"), "Expected sign header 'HashSHA256'")
+					require.NotEmpty(t, req.Header.Get(sign.TimestampHeader), "Expected stamp header")
+					require.NotEmpty(t, req.Header.Get(sign.NonceHeader), "Expected nonce header")
 				}
+				if tt.publicKey != nil {
+					assert.Equal(t, crypt.Fingerprint(tt.publicKey), req.Header.Get(crypt.KeyIDHeader))
+				} else {
+					assert.Empty(t, req.Header.Get(crypt.KeyIDHeader))
+				}
+				assert.Equal(t, "10.0.0.1", req.Header.Get(ipfilter.Header))
+				assert.Equal(t, apikey.Bearer("apikey"), req.Header.Get(apikey.Header))
+				assert.Equal(t, "team1", req.Header.Get(tenant.Header))
 				rw.WriteHeader(tt.respCode)
 			}))
 			// Close the server when test finishes
@@ -92,9 +124,108 @@ func TestHTTPReporter_ReportBatchJSON(t *testing.T) {
 				WithAddress(address),
 				WithHTTPTimeout(time.Second),
 				WithSignKey(tt.key),
+				WithPublicKey(tt.publicKey),
+				WithRealIP("10.0.0.1"),
+				WithAPIKey("apikey"),
+				WithTenant("team1"),
 			)
 
-			h.Send(report)
+			h.Send("batch1", report)
 		})
 	}
 }
+
+func TestHTTPReporter_TLS(t *testing.T) {
+	report := []models.Metrics{{Name: "c1", Type: models.Counter, IValue: new(int64)}}
+	var requests int
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		assert.NotNil(t, req.TLS, "Expected TLS connection")
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err, "Failed to parse test httpserver address")
+
+	// server certificate is trusted
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	h := New(
+		WithAddress(serverURL.Host),
+		WithHTTPTimeout(time.Second),
+		WithTLS(&tls.Config{RootCAs: pool}),
+	)
+	assert.NoError(t, h.Send("batch1", report))
+	assert.Equal(t, 1, requests)
+
+	// server certificate is unknown
+	h = New(
+		WithAddress(serverURL.Host),
+		WithHTTPTimeout(time.Second),
+		WithTLS(&tls.Config{}),
+	)
+	assert.Error(t, h.Send("batch2", report))
+	assert.Equal(t, 1, requests)
+}
+
+func TestHTTPReporter_RateLimited(t *testing.T) {
+	report := []models.Metrics{{Name: "c1", Type: models.Counter, IValue: new(int64)}}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "agent1", req.Header.Get(ratelimit.AgentHeader))
+		rw.Header().Set("Retry-After", "3")
+		rw.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err, "Failed to parse test httpserver address")
+
+	h := New(
+		WithAddress(serverURL.Host),
+		WithHTTPTimeout(time.Second),
+		WithAgentID("agent1"),
+	)
+	err = h.Send("batch1", report)
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.True(t, IsRetryable(err))
+	d, ok := retry.After(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+}
+
+func TestHTTPReporter_Rejected(t *testing.T) {
+	report := []models.Metrics{{Name: "c1", Type: models.Counter, IValue: new(int64)}}
+	code := http.StatusBadRequest
+	rejected := true
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if rejected {
+			rw.Header().Set("X-Batch-Rejected", "true")
+		}
+		rw.WriteHeader(code)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err, "Failed to parse test httpserver address")
+
+	h := New(WithAddress(serverURL.Host), WithHTTPTimeout(time.Second))
+	for _, code = range []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge} {
+		err = h.Send("batch1", report)
+		assert.True(t, IsRejected(err), "status %d", code)
+		assert.False(t, IsRetryable(err), "status %d", code)
+	}
+	// signature, tenant and other middleware failures keep batch to be resent
+	rejected = false
+	for _, code = range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError} {
+		err = h.Send("batch1", report)
+		assert.ErrorIs(t, err, ErrBadResponse, "status %d", code)
+		assert.False(t, IsRejected(err), "status %d", code)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
@@ -0,0 +1,229 @@
+// Package spool implements durable on-disk queue of unsent agent reports.
+//
+// Every batch is stored in a separate file in spool directory, file names keep batches order.
+// Spool survives agent restarts: existing files are replayed after open.
+// Total size of spool files is limited, the oldest batches are dropped to fit the limit.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const (
+	fileExt         = ".batch"
+	tmpExt          = ".tmp"
+	defaultMaxBytes = 64 << 20
+)
+
+var (
+	ErrTooLarge = errors.New("batch exceeds spool size limit")
+)
+
+// record is a spooled batch file content
+type record struct {
+	ID      string           `json:"id"`
+	TS      time.Time        `json:"ts"`
+	Metrics []models.Metrics `json:"metrics"`
+}
+
+// entry is a spooled batch file
+type entry struct {
+	seq  uint64
+	name string
+	size int64
+}
+
+type Spool struct {
+	dir      string
+	maxBytes int64
+	replayMu sync.Mutex // serializes replays, mu is not held while sending
+	mu       sync.Mutex
+	entries  []entry // ordered by seq
+	size     int64
+	seq      uint64 // last used sequence number
+}
+
+// Open opens spool in dir, creating dir if it does not exist
+func Open(dir string, opts ...func(*Spool)) (*Spool, error) {
+	s := &Spool{
+		dir:      dir,
+		maxBytes: defaultMaxBytes,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		name := f.Name()
+		switch {
+		case f.IsDir():
+		case strings.HasSuffix(name, tmpExt):
+			// unfinished write
+			os.Remove(filepath.Join(dir, name))
+		case strings.HasSuffix(name, fileExt):
+			seq, err := strconv.ParseUint(strings.TrimSuffix(name, fileExt), 10, 64)
+			if err != nil {
+				continue
+			}
+			info, err := f.Info()
+			if err != nil {
+				return nil, err
+			}
+			s.entries = append(s.entries, entry{seq: seq, name: name, size: info.Size()})
+			s.size += info.Size()
+			if seq > s.seq {
+				s.seq = seq
+			}
+		}
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].seq < s.entries[j].seq })
+	if len(s.entries) > 0 {
+		logger.Log().Info().Msgf("spool has %d unsent batches", len(s.entries))
+	}
+	return s, nil
+}
+
+// WithMaxBytes limits total size of spool files, limit <= 0 is ignored
+func WithMaxBytes(n int64) func(*Spool) {
+	return func(s *Spool) {
+		if n > 0 {
+			s.maxBytes = n
+		}
+	}
+}
+
+// Len returns number of spooled batches
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Push stores batch to the end of spool. If spool size limit is reached, the oldest batches are dropped.
+func (s *Spool) Push(id string, ts time.Time, metrics []models.Metrics) error {
+	data, err := json.Marshal(record{ID: id, TS: ts, Metrics: metrics})
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+	if size > s.maxBytes {
+		return ErrTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.size+size > s.maxBytes && len(s.entries) > 0 {
+		logger.Log().Warn().Msgf("spool is full, drop the oldest batch %s", s.entries[0].name)
+		s.remove()
+	}
+
+	e := entry{seq: s.seq + 1, size: size}
+	e.name = fmt.Sprintf("%020d%s", e.seq, fileExt)
+	if err := s.write(e.name, data); err != nil {
+		return err
+	}
+	s.seq = e.seq
+	s.entries = append(s.entries, e)
+	s.size += size
+	logger.Log().Debug().Msgf("batch %s spooled to %s", id, e.name)
+	return nil
+}
+
+// write writes file atomically
+func (s *Spool) write(name string, data []byte) error {
+	tmp := filepath.Join(s.dir, name+tmpExt)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(s.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// remove deletes the first spool entry
+func (s *Spool) remove() {
+	e := s.entries[0]
+	if err := os.Remove(filepath.Join(s.dir, e.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Log().Warn().Err(err).Msgf("unable to remove spool file %s", e.name)
+	}
+	s.entries = s.entries[1:]
+	s.size -= e.size
+}
+
+// removeSeq deletes the first spool entry if it has sequence number seq,
+// entry may be already dropped by Push
+func (s *Spool) removeSeq(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) > 0 && s.entries[0].seq == seq {
+		s.remove()
+	}
+}
+
+// first returns the first spool entry, false if spool is empty
+func (s *Spool) first() (entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) == 0 {
+		return entry{}, false
+	}
+	return s.entries[0], true
+}
+
+// Replay sends spooled batches in order. Batch is removed from spool after successful send.
+// Replay stops on the first send error and returns it, the rest of batches stay in spool.
+// Unreadable batches are dropped. Batches may be pushed while replay is sending.
+func (s *Spool) Replay(send func(id string, ts time.Time, metrics []models.Metrics) error) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+	for {
+		e, ok := s.first()
+		if !ok {
+			return nil
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, e.name))
+		var r record
+		if err == nil {
+			err = json.Unmarshal(data, &r)
+		}
+		if err != nil {
+			logger.Log().Warn().Err(err).Msgf("drop unreadable spool file %s", e.name)
+			s.removeSeq(e.seq)
+			continue
+		}
+		if err := send(r.ID, r.TS, r.Metrics); err != nil {
+			return err
+		}
+		logger.Log().Debug().Msgf("spooled batch %s sent", r.ID)
+		s.removeSeq(e.seq)
+	}
+}
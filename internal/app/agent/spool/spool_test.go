@@ -0,0 +1,124 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+func testBatch(n int64) []models.Metrics {
+	return []models.Metrics{{Name: "c1", Type: models.Counter, IValue: &n}}
+}
+
+// collect replays spool and returns sent batches ids
+func collect(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var ids []string
+	require.NoError(t, s.Replay(func(id string, _ time.Time, _ []models.Metrics) error {
+		ids = append(ids, id)
+		return nil
+	}))
+	return ids
+}
+
+func TestSpool_ReplayOrderAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	ts := time.Now().Truncate(time.Second)
+	s, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Push("b1", ts, testBatch(1)))
+	require.NoError(t, s.Push("b2", ts.Add(time.Second), testBatch(2)))
+
+	// failed replay keeps batches
+	sendErr := errors.New("send failed")
+	n := 0
+	err = s.Replay(func(id string, gotTS time.Time, metrics []models.Metrics) error {
+		n++
+		assert.Equal(t, "b1", id)
+		assert.True(t, ts.Equal(gotTS))
+		assert.Equal(t, testBatch(1), metrics)
+		return sendErr
+	})
+	require.ErrorIs(t, err, sendErr)
+	assert.Equal(t, 1, n)
+
+	// spool survives restart
+	s, err = Open(dir)
+	require.NoError(t, err)
+	require.Equal(t, 2, s.Len())
+	require.NoError(t, s.Push("b3", ts, testBatch(3)))
+	assert.Equal(t, []string{"b1", "b2", "b3"}, collect(t, s))
+	assert.Equal(t, 0, s.Len())
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestSpool_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Push("b1", time.Now(), testBatch(1)))
+	size := s.size
+
+	// fits two batches only
+	s, err = Open(dir, WithMaxBytes(2*size+1))
+	require.NoError(t, err)
+	require.NoError(t, s.Push("b2", time.Now(), testBatch(2)))
+	require.NoError(t, s.Push("b3", time.Now(), testBatch(3)))
+	assert.Equal(t, []string{"b2", "b3"}, collect(t, s))
+
+	s, err = Open(dir, WithMaxBytes(size/2))
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Push("b4", time.Now(), testBatch(4)), ErrTooLarge)
+}
+
+func TestSpool_DropUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Push("b1", time.Now(), testBatch(1)))
+	require.NoError(t, s.Push("b2", time.Now(), testBatch(2)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, s.entries[0].name), []byte("{broken"), 0o600))
+	// unfinished write is removed on open
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000009.batch.tmp"), nil, 0o600))
+
+	s, err = Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b2"}, collect(t, s))
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestSpool_PushWhileReplay(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	require.NoError(t, err)
+	// batches of the same size: fixed timestamp and value length
+	ts := time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.Push("b1", ts, testBatch(1)))
+	size := s.size
+
+	// fits one batch only: push drops the batch being sent
+	s, err = Open(dir, WithMaxBytes(size))
+	require.NoError(t, err)
+	var ids []string
+	require.NoError(t, s.Replay(func(id string, _ time.Time, _ []models.Metrics) error {
+		ids = append(ids, id)
+		if id == "b1" {
+			require.NoError(t, s.Push("b2", ts, testBatch(2)))
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"b1", "b2"}, ids)
+	assert.Equal(t, 0, s.Len())
+}
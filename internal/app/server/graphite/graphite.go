@@ -0,0 +1,240 @@
+// Package graphite implements listener of Graphite plaintext protocol `path.to.metric value [timestamp]`.
+//
+// Paths are mapped to gauges or counters with Rules, counter value is a delta and it is rounded.
+// Timestamps are accepted, but ignored: metrics are stored as received.
+// Lines received at once are updated in storage as a single batch.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const (
+	defaultMaxBatch = 1000
+	// maxLine is the max length of line
+	maxLine = 4096
+)
+
+var (
+	ErrInvalidLine = errors.New("invalid graphite line")
+	ErrNoRule      = errors.New("no matching rule")
+	ErrNoAddress   = errors.New("no listen address")
+)
+
+// Storage updates batch of metrics
+type Storage interface {
+	UpdateMany(metrics []models.Metrics) error
+}
+
+// Listener accepts Graphite plaintext lines over tcp
+type Listener struct {
+	address     string
+	rules       Rules
+	defaultType string
+	maxBatch    int
+	storage     Storage
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	closed      bool
+}
+
+// New creates Graphite listener updating metrics in storage
+func New(storage Storage, opts ...func(l *Listener)) (*Listener, error) {
+	l := &Listener{
+		storage:     storage,
+		defaultType: models.Gauge,
+		maxBatch:    defaultMaxBatch,
+		conns:       make(map[net.Conn]struct{}),
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.address == "" {
+		return nil, ErrNoAddress
+	}
+	if l.defaultType != "" && l.defaultType != models.Gauge && l.defaultType != models.Counter {
+		return nil, fmt.Errorf("%w: default type should be gauge or counter", ErrInvalidRule)
+	}
+	return l, nil
+}
+
+// WithAddress sets tcp listen address
+func WithAddress(address string) func(l *Listener) {
+	return func(l *Listener) {
+		l.address = address
+	}
+}
+
+// WithRules sets rules table
+func WithRules(rules Rules) func(l *Listener) {
+	return func(l *Listener) {
+		l.rules = rules
+	}
+}
+
+// WithDefaultType sets type of metrics, which paths do not match any rule. Empty type drops such metrics.
+// Default is gauge.
+func WithDefaultType(t string) func(l *Listener) {
+	return func(l *Listener) {
+		l.defaultType = t
+	}
+}
+
+// WithMaxBatch limits number of metrics updated at once
+func WithMaxBatch(n int) func(l *Listener) {
+	return func(l *Listener) {
+		if n > 0 {
+			l.maxBatch = n
+		}
+	}
+}
+
+// Serve receives metrics until context is cancelled
+func (l *Listener) Serve(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.address)
+	if err != nil {
+		return err
+	}
+	logger.Log().Info().Msgf("starting graphite listener at %s", ln.Addr())
+	l.wg.Add(1)
+	go l.accept(ln)
+
+	<-ctx.Done()
+	logger.Log().Info().Msg("stopping graphite listener")
+	ln.Close()
+	l.mu.Lock()
+	l.closed = true
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	logger.Log().Info().Msg("graphite listener stopped")
+	return nil
+}
+
+// ParseLine converts line to metric with rules
+func (l *Listener) ParseLine(line string) (m models.Metrics, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return m, fmt.Errorf("%w: expected path, value and timestamp", ErrInvalidLine)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return m, fmt.Errorf("%w: invalid value '%s'", ErrInvalidLine, fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return m, fmt.Errorf("%w: invalid timestamp '%s'", ErrInvalidLine, fields[2])
+		}
+	}
+	path := strings.Split(fields[0], ".")
+	for _, s := range path {
+		if s == "" {
+			return m, fmt.Errorf("%w: empty path segment '%s'", ErrInvalidLine, fields[0])
+		}
+	}
+
+	m.Name, m.Type = fields[0], l.defaultType
+	if rule, ok := l.rules.Match(path); ok {
+		m.Type = rule.Type
+		m.Name, m.Labels = rule.apply(path)
+	} else if m.Type == "" {
+		return m, ErrNoRule
+	}
+	switch m.Type {
+	case models.Counter:
+		v := int64(math.Round(value))
+		m.IValue = &v
+	default:
+		m.FValue = &value
+	}
+	return m, m.Validate()
+}
+
+// update stores batch of metrics
+func (l *Listener) update(batch []models.Metrics) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := l.storage.UpdateMany(batch); err != nil {
+		logger.Log().Warn().Err(err).Msgf("unable to update graphite batch of %d metrics", len(batch))
+		return
+	}
+	logger.Log().Debug().Msgf("graphite batch of %d metrics updated", len(batch))
+}
+
+func (l *Listener) accept(ln net.Listener) {
+	defer l.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Log().Warn().Err(err).Msg("graphite accept failed")
+				continue
+			}
+			return
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+		go l.serveConn(conn)
+	}
+}
+
+// serveConn reads lines from connection. Batch is updated when there is no more buffered data
+// or batch reaches max size.
+func (l *Listener) serveConn(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReaderSize(conn, maxLine)
+	batch := make([]models.Metrics, 0, l.maxBatch)
+	for {
+		data, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// skip too long line
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = r.ReadSlice('\n')
+			}
+			logger.Log().Debug().Msgf("skip graphite line longer than %d bytes", maxLine)
+			data = nil
+		}
+		if line := strings.TrimSpace(string(data)); line != "" {
+			if m, perr := l.ParseLine(line); perr != nil {
+				logger.Log().Debug().Err(perr).Msgf("skip graphite line '%s'", line)
+			} else {
+				batch = append(batch, m)
+			}
+		}
+		if err != nil || r.Buffered() == 0 || len(batch) >= l.maxBatch {
+			l.update(batch)
+			batch = batch[:0]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
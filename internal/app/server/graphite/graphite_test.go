@@ -0,0 +1,174 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store/memory"
+)
+
+func pointer[T any](val T) *T {
+	return &val
+}
+
+func TestNewRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "empty pattern", rule: Rule{Type: models.Gauge}},
+		{name: "invalid type", rule: Rule{Pattern: "a.b", Type: models.Histogram}},
+		{name: "empty segment", rule: Rule{Pattern: "a..b", Type: models.Gauge}},
+		{name: "tail in the middle", rule: Rule{Pattern: "a.**.b", Type: models.Gauge}},
+		{name: "label out of pattern", rule: Rule{Pattern: "a.*", Type: models.Gauge, Labels: map[string]int{"l": 2}}},
+		{name: "label of tail", rule: Rule{Pattern: "a.**", Type: models.Gauge, Labels: map[string]int{"l": 1}}},
+		{name: "invalid label", rule: Rule{Pattern: "a.*", Type: models.Gauge, Labels: map[string]int{"l-1": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRules(tt.rule)
+			assert.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"pattern": "servers.*.cpu.*", "type": "gauge", "labels": {"host": 1, "cpu": 3}},
+		{"pattern": "apps.*.**", "type": "counter", "name": "app_events", "labels": {"app": 1}}
+	]`), 0o600))
+	rules, err := ReadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	rule, ok := rules.Match([]string{"apps", "web", "requests", "ok"})
+	require.True(t, ok)
+	assert.Equal(t, "app_events", rule.Name)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"pattern": "a", "type": "histogram"}]`), 0o600))
+	_, err = ReadRules(path)
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
+
+func TestListener_ParseLine(t *testing.T) {
+	rules, err := NewRules(
+		Rule{Pattern: "servers.*.cpu.*", Type: models.Gauge, Labels: map[string]int{"host": 1, "cpu": 3}},
+		Rule{Pattern: "apps.*.requests", Type: models.Counter, Labels: map[string]int{"app": 1}},
+		Rule{Pattern: "apps.**", Type: models.Gauge, Name: "apps"},
+	)
+	require.NoError(t, err)
+	l, err := New(nil, WithAddress(":0"), WithRules(rules))
+	require.NoError(t, err)
+	drop, err := New(nil, WithAddress(":0"), WithRules(rules), WithDefaultType(""))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		listener *Listener
+		line     string
+		want     models.Metrics
+		wantErr  error
+	}{
+		{
+			name:     "gauge with labels",
+			listener: l,
+			line:     "servers.h1.cpu.0 12.5 1700000000",
+			want:     models.Metrics{Name: "servers.cpu", Type: models.Gauge, Labels: models.Labels{"host": "h1", "cpu": "0"}, FValue: pointer(12.5)},
+		},
+		{
+			name:     "counter is rounded",
+			listener: l,
+			line:     "apps.web.requests 10.6 1700000000",
+			want:     models.Metrics{Name: "apps.requests", Type: models.Counter, Labels: models.Labels{"app": "web"}, IValue: pointer(int64(11))},
+		},
+		{
+			name:     "rule name",
+			listener: l,
+			line:     "apps.web.latency.p99 0.3",
+			want:     models.Metrics{Name: "apps", Type: models.Gauge, FValue: pointer(0.3)},
+		},
+		{
+			name:     "default type",
+			listener: l,
+			line:     "servers.h1.mem 1024 -1",
+			want:     models.Metrics{Name: "servers.h1.mem", Type: models.Gauge, FValue: pointer(1024.0)},
+		},
+		{
+			name:     "no rule",
+			listener: drop,
+			line:     "servers.h1.mem 1024 1700000000",
+			wantErr:  ErrNoRule,
+		},
+		{name: "no value", listener: l, line: "servers.h1.mem", wantErr: ErrInvalidLine},
+		{name: "invalid value", listener: l, line: "servers.h1.mem abc 1700000000", wantErr: ErrInvalidLine},
+		{name: "nan value", listener: l, line: "servers.h1.mem NaN 1700000000", wantErr: ErrInvalidLine},
+		{name: "invalid timestamp", listener: l, line: "servers.h1.mem 1 now", wantErr: ErrInvalidLine},
+		{name: "empty segment", listener: l, line: "servers..mem 1 1700000000", wantErr: ErrInvalidLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.listener.ParseLine(tt.line)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestListener_Serve(t *testing.T) {
+	storage := store.NewStorageController(memory.NewMemoryStore())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	ln.Close()
+	rules, err := NewRules(Rule{Pattern: "apps.*.requests", Type: models.Counter, Labels: map[string]int{"app": 1}})
+	require.NoError(t, err)
+	l, err := New(storage, WithAddress(address), WithRules(rules), WithMaxBatch(2))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, l.Serve(ctx))
+	}()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("tcp", address)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = fmt.Fprint(conn, "apps.web.requests 2 1700000000\ninvalid line\napps.web.requests 3 1700000000\nservers.h1.mem 1024 1700000000\n")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	get := func(name, mType string, labels models.Labels) (models.Metrics, error) {
+		return storage.GetOne(models.MetricRequest{Name: name, Type: mType, Labels: labels})
+	}
+	require.Eventually(t, func() bool {
+		m, err := get("apps.requests", models.Counter, models.Labels{"app": "web"})
+		if err != nil || *m.IValue != 5 {
+			return false
+		}
+		_, err = get("servers.h1.mem", models.Gauge, nil)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,146 @@
+package graphite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const (
+	// anySegment matches one path segment
+	anySegment = "*"
+	// anyTail matches the rest of path, it should be the last pattern segment
+	anyTail = "**"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid graphite rule")
+)
+
+// Rule maps paths matching pattern to metric type. Pattern is a dot separated path, where `*` matches any segment
+// and trailing `**` matches the rest of path. Labels are taken from path segments by their zero-based position.
+// Metric name is Name or the path without segments used as labels.
+//
+// Example: rule {"pattern": "servers.*.cpu.*", "type": "gauge", "labels": {"host": 1, "cpu": 3}}
+// makes gauge `servers.cpu{cpu="0",host="h1"}` of path `servers.h1.cpu.0`.
+type Rule struct {
+	Pattern string         `json:"pattern"`
+	Type    string         `json:"type"`
+	Name    string         `json:"name,omitempty"`
+	Labels  map[string]int `json:"labels,omitempty"`
+
+	segments []string
+}
+
+// compile validates rule and prepares it for matching
+func (r *Rule) compile() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("%w: empty pattern", ErrInvalidRule)
+	}
+	if r.Type != models.Gauge && r.Type != models.Counter {
+		return fmt.Errorf("%w %q: type should be gauge or counter", ErrInvalidRule, r.Pattern)
+	}
+	r.segments = strings.Split(r.Pattern, ".")
+	for i, s := range r.segments {
+		if s == "" {
+			return fmt.Errorf("%w %q: empty segment", ErrInvalidRule, r.Pattern)
+		}
+		if s == anyTail && i != len(r.segments)-1 {
+			return fmt.Errorf("%w %q: %s should be the last segment", ErrInvalidRule, r.Pattern, anyTail)
+		}
+	}
+	labels := make(models.Labels, len(r.Labels))
+	for name, pos := range r.Labels {
+		if pos < 0 || pos >= len(r.segments) || r.segments[pos] == anyTail {
+			return fmt.Errorf("%w %q: label %s position %d is out of pattern", ErrInvalidRule, r.Pattern, name, pos)
+		}
+		labels[name] = ""
+	}
+	if err := labels.Validate(); err != nil {
+		return fmt.Errorf("%w %q: %s", ErrInvalidRule, r.Pattern, err)
+	}
+	return nil
+}
+
+// match checks path segments match rule pattern
+func (r *Rule) match(path []string) bool {
+	for i, s := range r.segments {
+		switch {
+		case s == anyTail:
+			return true
+		case i >= len(path):
+			return false
+		case s != anySegment && s != path[i]:
+			return false
+		}
+	}
+	return len(path) == len(r.segments)
+}
+
+// apply returns metric name and labels of matched path
+func (r *Rule) apply(path []string) (string, models.Labels) {
+	if len(r.Labels) == 0 {
+		if r.Name != "" {
+			return r.Name, nil
+		}
+		return strings.Join(path, "."), nil
+	}
+	labels := make(models.Labels, len(r.Labels))
+	used := make(map[int]bool, len(r.Labels))
+	for name, pos := range r.Labels {
+		labels[name] = path[pos]
+		used[pos] = true
+	}
+	if r.Name != "" {
+		return r.Name, labels
+	}
+	name := make([]string, 0, len(path)-len(used))
+	for i, s := range path {
+		if !used[i] {
+			name = append(name, s)
+		}
+	}
+	return strings.Join(name, "."), labels
+}
+
+// Rules is an ordered table of rules, the first matching rule is applied
+type Rules []Rule
+
+// NewRules validates rules table
+func NewRules(rules ...Rule) (Rules, error) {
+	rs := make(Rules, len(rules))
+	copy(rs, rules)
+	for i := range rs {
+		if err := rs[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// ReadRules reads rules table from file in JSON format
+func ReadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRule, err)
+	}
+	return NewRules(rules...)
+}
+
+// Match returns the first rule matching path segments
+func (rs Rules) Match(path []string) (*Rule, bool) {
+	for i := range rs {
+		if rs[i].match(path) {
+			return &rs[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+)
+
+// GRPCHandlers implements metrics gRPC service, it shares storage with HTTPHandlers
+type GRPCHandlers struct {
+	pb.UnimplementedMetricsServer
+	storage  HTTPHandlerStorage
+	tenants  TenantStorage // storages of tenants, storage is used if not set
+	maxBatch int           // max number of metrics in batch, 0 is unlimited
+}
+
+// NewGRPCHandlers is GRPCHandlers constructor
+func NewGRPCHandlers(storage HTTPHandlerStorage, opts ...func(h *GRPCHandlers)) *GRPCHandlers {
+	h := &GRPCHandlers{
+		storage: storage,
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// WithGRPCMaxBatch limits number of metrics in update batch, 0 is unlimited
+func WithGRPCMaxBatch(n int) func(h *GRPCHandlers) {
+	return func(h *GRPCHandlers) {
+		h.maxBatch = n
+	}
+}
+
+// store returns storage of existing call tenant, NotFound error if tenant does not exist
+func (h *GRPCHandlers) store(ctx context.Context) (HTTPHandlerStorage, error) {
+	s, ok := tenantStorage(ctx, h.storage, h.tenants)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown tenant")
+	}
+	return s, nil
+}
+
+// updateStore returns storage of call tenant to be updated, tenant is created if it does not exist.
+// Returns PermissionDenied error if tenant may not be created.
+func (h *GRPCHandlers) updateStore(ctx context.Context) (HTTPHandlerStorage, error) {
+	s, err := updateStorage(ctx, h.storage, h.tenants)
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return s, nil
+}
+
+// grpcError converts storage error to gRPC status error
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidMetric):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, store.ErrMetricNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// batchError converts storage error of batch update to gRPC status error,
+// invalid batch is marked as rejected with pb.RejectBatch
+func batchError(err error) error {
+	if errors.Is(err, models.ErrInvalidMetric) {
+		return pb.RejectBatch(err.Error())
+	}
+	return grpcError(err)
+}
+
+// Update updates single metric and returns its new value
+//
+// # Codes
+//   - OK
+//   - InvalidArgument if metric is invalid
+//   - PermissionDenied if tenant may not be created
+//   - Internal if any other error occurred
+func (h *GRPCHandlers) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	logger.Log().Debug().Msg("gRPC Update: request received")
+	m, err := pb.ToMetrics(req.GetMetric())
+	if err != nil {
+		logger.Log().Debug().Err(err).Msg("gRPC Update: invalid metric")
+		return nil, grpcError(err)
+	}
+	storage, err := h.updateStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.UpdateOne(&m); err != nil {
+		logger.Log().Warn().Err(err).Msg("gRPC Update: unable to update metric")
+		return nil, grpcError(err)
+	}
+	return &pb.UpdateResponse{Metric: pb.FromMetrics(m)}, nil
+}
+
+// UpdateBatch updates metrics batch. Optional batch id makes request idempotent the same
+// way as `X-Batch-ID` header of HTTP request.
+//
+// # Codes
+//   - OK
+//   - InvalidArgument if batch is empty, exceeds limit or has invalid metrics, error has pb.BatchRejected detail
+//   - PermissionDenied if tenant may not be created
+//   - Internal if any other error occurred
+func (h *GRPCHandlers) UpdateBatch(ctx context.Context, req *pb.UpdateBatchRequest) (*pb.UpdateBatchResponse, error) {
+	logger.Log().Debug().Msg("gRPC UpdateBatch: request received")
+	if err := h.updateBatch(ctx, req); err != nil {
+		return nil, err
+	}
+	return &pb.UpdateBatchResponse{}, nil
+}
+
+func (h *GRPCHandlers) updateBatch(ctx context.Context, req *pb.UpdateBatchRequest) error {
+	if len(req.GetMetrics()) == 0 {
+		return pb.RejectBatch("empty batch")
+	}
+	if h.maxBatch > 0 && len(req.GetMetrics()) > h.maxBatch {
+		logger.Log().Warn().Msgf("gRPC UpdateBatch: batch of %d metrics exceeds limit %d", len(req.GetMetrics()), h.maxBatch)
+		return pb.RejectBatch(fmt.Sprintf("batch of %d metrics exceeds limit %d", len(req.GetMetrics()), h.maxBatch))
+	}
+	metrics, err := pb.ToMetricsSlice(req.GetMetrics())
+	if err != nil {
+		logger.Log().Debug().Err(err).Msg("gRPC UpdateBatch: invalid metrics")
+		return batchError(err)
+	}
+	storage, err := h.updateStore(ctx)
+	if err != nil {
+		return err
+	}
+	err = storage.UpdateBatch(req.GetBatchId(), metrics)
+	if err != nil && !errors.Is(err, store.ErrBatchApplied) {
+		logger.Log().Warn().Err(err).Msg("gRPC UpdateBatch: unable to update metrics")
+		return batchError(err)
+	}
+	return nil
+}
+
+// Get returns metric value
+//
+// # Codes
+//   - OK
+//   - InvalidArgument if request is invalid
+//   - NotFound if metric or tenant does not exist
+//   - Internal if any other error occurred
+func (h *GRPCHandlers) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	logger.Log().Debug().Msg("gRPC Get: request received")
+	r, err := pb.ToMetricRequest(req.GetMetric())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	storage, err := h.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m, err := storage.GetOne(r)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.GetResponse{Metric: pb.FromMetrics(m)}, nil
+}
+
+// List returns metrics list with the same filters, sorting and pagination as ListMetricsHandler
+//
+// # Codes
+//   - OK
+//   - InvalidArgument if request params are invalid
+//   - NotFound if tenant does not exist
+func (h *GRPCHandlers) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	logger.Log().Debug().Msg("gRPC List: request received")
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("type", pb.ToType(req.GetType()))
+	set("prefix", req.GetPrefix())
+	set("match", req.GetMatch())
+	set("regex", req.GetRegex())
+	set("cursor", req.GetCursor())
+	if req.GetSortByType() {
+		q.Set("sort", "type")
+	}
+	if req.GetDesc() {
+		q.Set("order", "desc")
+	}
+	if req.GetLimit() > 0 {
+		q.Set("limit", strconv.FormatUint(uint64(req.GetLimit()), 10))
+	}
+	p, err := parseListParams(q)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	storage, err := h.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics, next := list(allowed(ctx, storage.GetAll()), p)
+	res := &pb.ListResponse{
+		Metrics:    make([]*pb.Metric, 0, len(metrics)),
+		NextCursor: next,
+	}
+	for _, m := range metrics {
+		res.Metrics = append(res.Metrics, pb.FromMetrics(m))
+	}
+	return res, nil
+}
+
+// Push receives stream of metrics batches, every batch is applied as UpdateBatch request.
+// Stream is terminated on the first failed batch, response has number of applied batches.
+//
+// # Codes
+//   - OK
+//   - InvalidArgument if batch is empty, exceeds limit or has invalid metrics, error has pb.BatchRejected detail
+//   - PermissionDenied if tenant may not be created
+//   - Internal if any other error occurred
+func (h *GRPCHandlers) Push(stream pb.Metrics_PushServer) error {
+	logger.Log().Debug().Msg("gRPC Push: stream opened")
+	ctx := stream.Context()
+	var n uint32
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			logger.Log().Debug().Msgf("gRPC Push: stream closed, %d batches received", n)
+			return stream.SendAndClose(&pb.PushResponse{Batches: n})
+		}
+		if err != nil {
+			return err
+		}
+		if err := h.updateBatch(ctx, req); err != nil {
+			return err
+		}
+		n++
+	}
+}
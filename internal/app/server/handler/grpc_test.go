@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+// grpcClient starts grpc server with handlers on buffered connection and returns its client
+func grpcClient(t *testing.T, h *GRPCHandlers) pb.MetricsClient {
+	t.Helper()
+	listen := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterMetricsServer(srv, h)
+	go srv.Serve(listen)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listen.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsClient(conn)
+}
+
+func TestGRPCHandlers_Update(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	client := grpcClient(t, NewGRPCHandlers(m))
+
+	tests := []struct {
+		name     string
+		metric   *pb.Metric
+		storeErr error
+		wantCall int
+		wantCode codes.Code
+	}{
+		{
+			name:     "counter",
+			metric:   &pb.Metric{Name: "c1", Type: pb.Type_TYPE_COUNTER, Value: &pb.Metric_Delta{Delta: 5}},
+			wantCall: 1,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "gauge with labels",
+			metric:   &pb.Metric{Name: "g1", Type: pb.Type_TYPE_GAUGE, Labels: map[string]string{"cpu": "1"}, Value: &pb.Metric_Gauge{Gauge: 0.5}},
+			wantCall: 1,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "value type mismatch",
+			metric:   &pb.Metric{Name: "g1", Type: pb.Type_TYPE_GAUGE, Value: &pb.Metric_Delta{Delta: 5}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "no type",
+			metric:   &pb.Metric{Name: "g1", Value: &pb.Metric_Gauge{Gauge: 1}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "storage error",
+			metric:   &pb.Metric{Name: "c1", Type: pb.Type_TYPE_COUNTER, Value: &pb.Metric_Delta{Delta: 5}},
+			storeErr: assert.AnError,
+			wantCall: 1,
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.EXPECT().UpdateOne(gomock.Any()).Return(tt.storeErr).Times(tt.wantCall)
+			resp, err := client.Update(context.Background(), &pb.UpdateRequest{Metric: tt.metric})
+			require.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, tt.metric.GetName(), resp.GetMetric().GetName())
+				assert.Equal(t, tt.metric.GetLabels(), resp.GetMetric().GetLabels())
+			}
+		})
+	}
+}
+
+func TestGRPCHandlers_UpdateBatch(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	client := grpcClient(t, NewGRPCHandlers(m, WithGRPCMaxBatch(2)))
+
+	metrics := []*pb.Metric{
+		{Name: "c1", Type: pb.Type_TYPE_COUNTER, Value: &pb.Metric_Delta{Delta: 1}},
+		{Name: "h1", Type: pb.Type_TYPE_HISTOGRAM, Value: &pb.Metric_Histogram{Histogram: &pb.Histogram{
+			Bounds: []float64{1}, Counts: []int64{1, 0}, Count: 1, Sum: 0.5,
+		}}},
+	}
+	tests := []struct {
+		name     string
+		req      *pb.UpdateBatchRequest
+		storeErr error
+		wantCall int
+		wantCode codes.Code
+		rejected bool
+	}{
+		{name: "batch", req: &pb.UpdateBatchRequest{BatchId: "b1", Metrics: metrics}, wantCall: 1, wantCode: codes.OK},
+		{name: "replay", req: &pb.UpdateBatchRequest{BatchId: "b1", Metrics: metrics}, storeErr: store.ErrBatchApplied, wantCall: 1, wantCode: codes.OK},
+		{name: "empty", req: &pb.UpdateBatchRequest{}, wantCode: codes.InvalidArgument, rejected: true},
+		{name: "exceeds limit", req: &pb.UpdateBatchRequest{Metrics: append(metrics, metrics[0])}, wantCode: codes.InvalidArgument, rejected: true},
+		{name: "store invalid", req: &pb.UpdateBatchRequest{BatchId: "b2", Metrics: metrics}, storeErr: models.ErrInvalidMetric, wantCall: 1, wantCode: codes.InvalidArgument, rejected: true},
+		{name: "store failed", req: &pb.UpdateBatchRequest{BatchId: "b3", Metrics: metrics}, storeErr: errors.New("connection refused"), wantCall: 1, wantCode: codes.Internal},
+		{
+			name: "invalid histogram",
+			req: &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Name: "h1", Type: pb.Type_TYPE_HISTOGRAM, Value: &pb.Metric_Histogram{Histogram: &pb.Histogram{
+				Bounds: []float64{1}, Counts: []int64{1}, Count: 1,
+			}}}}},
+			wantCode: codes.InvalidArgument,
+			rejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.EXPECT().UpdateBatch(tt.req.GetBatchId(), gomock.Len(len(tt.req.GetMetrics()))).Return(tt.storeErr).Times(tt.wantCall)
+			_, err := client.UpdateBatch(context.Background(), tt.req)
+			require.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.rejected, pb.IsBatchRejected(err))
+		})
+	}
+}
+
+func TestGRPCHandlers_Get(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	client := grpcClient(t, NewGRPCHandlers(m))
+
+	v := 2.5
+	m.EXPECT().GetOne(models.MetricRequest{Name: "g1", Type: models.Gauge}).
+		Return(models.Metrics{Name: "g1", Type: models.Gauge, FValue: &v}, nil)
+	resp, err := client.Get(context.Background(), &pb.GetRequest{Metric: &pb.MetricRequest{Name: "g1", Type: pb.Type_TYPE_GAUGE}})
+	require.NoError(t, err)
+	assert.Equal(t, v, resp.GetMetric().GetGauge())
+
+	m.EXPECT().GetOne(gomock.Any()).Return(models.Metrics{}, store.ErrMetricNotFound)
+	_, err = client.Get(context.Background(), &pb.GetRequest{Metric: &pb.MetricRequest{Name: "g2", Type: pb.Type_TYPE_GAUGE}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Get(context.Background(), &pb.GetRequest{Metric: &pb.MetricRequest{Name: "g2"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCHandlers_List(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	client := grpcClient(t, NewGRPCHandlers(m))
+
+	set := []models.Metrics{
+		{Name: "HeapAlloc", Type: models.Gauge, FValue: pointer(1.0)},
+		{Name: "PollCount", Type: models.Counter, IValue: pointer(int64(5))},
+		{Name: "HeapInuse", Type: models.Gauge, FValue: pointer(2.0)},
+	}
+	m.EXPECT().GetAll().Return(set).Times(2)
+
+	resp, err := client.List(context.Background(), &pb.ListRequest{Type: pb.Type_TYPE_GAUGE, Desc: true, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, resp.GetMetrics(), 1)
+	assert.Equal(t, "HeapInuse", resp.GetMetrics()[0].GetName())
+	require.NotEmpty(t, resp.GetNextCursor())
+
+	resp, err = client.List(context.Background(), &pb.ListRequest{Type: pb.Type_TYPE_GAUGE, Desc: true, Cursor: resp.GetNextCursor()})
+	require.NoError(t, err)
+	require.Len(t, resp.GetMetrics(), 1)
+	assert.Equal(t, "HeapAlloc", resp.GetMetrics()[0].GetName())
+	assert.Empty(t, resp.GetNextCursor())
+
+	_, err = client.List(context.Background(), &pb.ListRequest{Regex: "(a"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCHandlers_Push(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	client := grpcClient(t, NewGRPCHandlers(m))
+
+	batch := func(id string) *pb.UpdateBatchRequest {
+		return &pb.UpdateBatchRequest{BatchId: id, Metrics: []*pb.Metric{
+			{Name: "c1", Type: pb.Type_TYPE_COUNTER, Value: &pb.Metric_Delta{Delta: 1}},
+		}}
+	}
+
+	t.Run("all batches applied", func(t *testing.T) {
+		gomock.InOrder(
+			m.EXPECT().UpdateBatch("b1", gomock.Len(1)).Return(nil),
+			m.EXPECT().UpdateBatch("b2", gomock.Len(1)).Return(store.ErrBatchApplied),
+		)
+		stream, err := client.Push(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(batch("b1")))
+		require.NoError(t, stream.Send(batch("b2")))
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), resp.GetBatches())
+	})
+
+	t.Run("stop on invalid batch", func(t *testing.T) {
+		m.EXPECT().UpdateBatch("b3", gomock.Len(1)).Return(nil)
+		stream, err := client.Push(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(batch("b3")))
+		require.NoError(t, stream.Send(&pb.UpdateBatchRequest{BatchId: "b4"}))
+		_, err = stream.CloseAndRecv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		assert.True(t, pb.IsBatchRejected(err))
+	})
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+)
+
+const (
+	defaultHistoryPeriod = time.Hour
+	defaultHistoryPoints = 60
+	maxHistoryPoints     = 11000
+)
+
+var errHistoryParams = errors.New("invalid history params")
+
+// parseTime parses time in RFC3339 format or as unix timestamp in seconds
+func parseTime(s string) (time.Time, error) {
+	if ts, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := int64(ts), ts-float64(int64(ts))
+		return time.Unix(sec, int64(frac*float64(time.Second))), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// parseStep parses step as duration (i.e. 30s, 5m) or as number of seconds
+func parseStep(s string) (time.Duration, error) {
+	if sec, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(sec * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// historyParams returns history period and step from url query params.
+// By default, period is the last hour and step splits it to 60 points.
+func historyParams(r *http.Request) (from, to time.Time, step time.Duration, err error) {
+	q := r.URL.Query()
+	to = time.Now()
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTime(v); err != nil {
+			return
+		}
+	}
+	from = to.Add(-defaultHistoryPeriod)
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTime(v); err != nil {
+			return
+		}
+	}
+	if !from.Before(to) {
+		err = errHistoryParams
+		return
+	}
+	step = to.Sub(from) / defaultHistoryPoints
+	if v := q.Get("step"); v != "" {
+		if step, err = parseStep(v); err != nil {
+			return
+		}
+	}
+	if step < time.Second {
+		step = time.Second
+		if q.Has("step") {
+			err = errHistoryParams
+			return
+		}
+	}
+	if to.Sub(from)/step > maxHistoryPoints {
+		err = errHistoryParams
+	}
+	return
+}
+
+// HistoryHandler returns metric values history as JSON array of samples `{"ts":"...","value":1.5}`.
+// Query params `from` and `to` set history period as RFC3339 time or unix timestamp, default is the last hour.
+// Query param `step` sets downsampling interval as duration or seconds, default splits period to 60 samples.
+// Other query params are metric labels.
+//
+// # Responses
+//   - 200/OK and samples in body
+//   - 400/BadRequest if request is invalid
+//   - 500/InternalServerError if any other error occurred
+//   - 501/NotImplemented if store does not keep history
+//
+// # Example
+//
+//	curl -i 'http://localhost:8080/history/gauge/Alloc?from=2024-01-02T15:00:00Z&to=2024-01-02T16:00:00Z&step=5m'
+//	curl -i 'http://localhost:8080/history/gauge/CPUutilization?cpu=1&step=30'
+func (h *HTTPHandlers) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msgf("HistoryHandler: Request received  URL=%v", r.URL)
+	req, err := models.NewMetricRequest(chi.URLParam(r, "name"), chi.URLParam(r, "type"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if req.Labels, err = labelsFromQuery(r, "from", "to", "step"); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	from, to, step, err := historyParams(r)
+	if err != nil {
+		logger.Log().Debug().Err(err).Msg("HistoryHandler: invalid params")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	storage, ok := h.store(w, r)
+	if !ok {
+		return
+	}
+	samples, err := storage.History(req, from, to, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidMetric):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, store.ErrNoHistory):
+			w.WriteHeader(http.StatusNotImplemented)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	if samples == nil {
+		samples = make([]models.Sample, 0)
+	}
+	res, err := json.Marshal(samples)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("HistoryHandler: unable to marshal response JSON")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
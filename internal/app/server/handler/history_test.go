@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+func TestHTTPHandlers_History(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+
+	h := NewHTTPHandlers(m)
+
+	from := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	samples := []models.Sample{
+		{TS: from, Value: 1.5},
+		{TS: from.Add(5 * time.Minute), Value: 2},
+	}
+
+	tests := []struct {
+		name        string
+		mType       string
+		query       string
+		labels      models.Labels
+		wantFrom    time.Time
+		wantTo      time.Time
+		wantStep    time.Duration
+		returnError error
+		wantBody    string
+		wantCode    int
+		wantCall    int
+	}{
+		{
+			name:     "rfc3339 period",
+			mType:    "gauge",
+			query:    "?from=2024-01-02T15:00:00Z&to=2024-01-02T16:00:00Z&step=5m",
+			wantFrom: from,
+			wantTo:   to,
+			wantStep: 5 * time.Minute,
+			wantBody: `[{"ts":"2024-01-02T15:00:00Z","value":1.5},{"ts":"2024-01-02T15:05:00Z","value":2}]`,
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:     "unix period with labels and default step",
+			mType:    "counter",
+			query:    "?from=1704207600&to=1704211200&cpu=1",
+			labels:   models.Labels{"cpu": "1"},
+			wantFrom: from,
+			wantTo:   to,
+			wantStep: time.Minute,
+			wantBody: `[{"ts":"2024-01-02T15:00:00Z","value":1.5},{"ts":"2024-01-02T15:05:00Z","value":2}]`,
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:        "no history",
+			mType:       "gauge",
+			query:       "?from=1704207600&to=1704211200&step=300",
+			wantFrom:    from,
+			wantTo:      to,
+			wantStep:    5 * time.Minute,
+			returnError: store.ErrNoHistory,
+			wantCode:    http.StatusNotImplemented,
+			wantCall:    1,
+		},
+		{
+			name:        "histogram",
+			mType:       "histogram",
+			query:       "?from=1704207600&to=1704211200&step=300",
+			wantFrom:    from,
+			wantTo:      to,
+			wantStep:    5 * time.Minute,
+			returnError: models.ErrInvalidMetric,
+			wantCode:    http.StatusBadRequest,
+			wantCall:    1,
+		},
+		{
+			name:     "from after to",
+			mType:    "gauge",
+			query:    "?from=1704211200&to=1704207600",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too small step",
+			mType:    "gauge",
+			query:    "?from=1704207600&to=1704211200&step=1ms",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too many points",
+			mType:    "gauge",
+			query:    "?from=0&to=1704211200&step=1s",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid time",
+			mType:    "gauge",
+			query:    "?from=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/history/{type}/{name}"+tt.query, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("type", tt.mType)
+			rctx.URLParams.Add("name", "m1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			m.EXPECT().History(models.MetricRequest{Name: "m1", Type: tt.mType, Labels: tt.labels}, gomock.Any(), gomock.Any(), tt.wantStep).
+				Times(tt.wantCall).
+				DoAndReturn(func(_ models.MetricRequest, from, to time.Time, _ time.Duration) ([]models.Sample, error) {
+					assert.True(t, tt.wantFrom.Equal(from), "unexpected from %s", from)
+					assert.True(t, tt.wantTo.Equal(to), "unexpected to %s", to)
+					return samples, tt.returnError
+				})
+			h.HistoryHandler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if res.StatusCode == http.StatusOK {
+				assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+				resBody, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.wantBody, string(resBody))
+			}
+		})
+	}
+}
@@ -2,19 +2,25 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"html/template"
 	"net/http"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/otlp"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store/broker"
 )
 
 //go:generate mockgen -source $GOFILE -package=mocks -destination ../../../../mocks/HTTPHandlerStorage_mock.go
@@ -24,7 +30,12 @@ type HTTPHandlerStorage interface {
 	GetOne(request models.MetricRequest) (models.Metrics, error)
 	UpdateOne(metric *models.Metrics) error
 	UpdateMany(metrics []models.Metrics) error
+	UpdateBatch(id string, metrics []models.Metrics) error
+	DeleteOne(request models.MetricRequest) error
+	DeleteMany(requests []models.MetricRequest) error
+	History(request models.MetricRequest, from, to time.Time, step time.Duration) ([]models.Sample, error)
 	Ping() error
+	Subscribe(filter func(m models.Metrics) bool) *broker.Subscription
 }
 
 const indexTmpl = `
@@ -32,10 +43,11 @@ const indexTmpl = `
 <body>
 	<h2>Metrics Index</h2>
 	<table border=1>
-	<tr><th>Name</th><th>Type</th><th>Value</th></tr>
+	<tr><th>Name</th><th>Labels</th><th>Type</th><th>Value</th></tr>
 	{{ range . }}
 	<tr>
 		<td>{{ .Name }}</td>
+		<td>{{ .Labels }}</td>
 		<td>{{ .Type }}</td>
 		<td>{{ value . }}</td>
 	</tr>
@@ -47,20 +59,104 @@ const indexTmpl = `
 `
 
 type HTTPHandlers struct {
-	storage HTTPHandlerStorage // server handler methods
+	storage   HTTPHandlerStorage // server handler methods
+	tenants   TenantStorage      // storages of tenants, storage is used if not set
+	maxBatch  int                // max number of metrics in batch, 0 is unlimited
+	influxInt string             // type of metrics of line protocol integer fields
+	otlp      *otlp.Converter    // converter of OTLP metrics, keeps cumulative sums states
+	heartbeat time.Duration      // period of stream heartbeat
+	streams   chan struct{}      // closed to stop streams
+	stopOnce  sync.Once
 }
 
 // NewHTTPHandlers is HTTPHandlers constructor
-func NewHTTPHandlers(storage HTTPHandlerStorage) *HTTPHandlers {
-	return &HTTPHandlers{
-		storage: storage,
+func NewHTTPHandlers(storage HTTPHandlerStorage, opts ...func(h *HTTPHandlers)) *HTTPHandlers {
+	h := &HTTPHandlers{
+		storage:   storage,
+		heartbeat: defaultHeartbeat,
+		streams:   make(chan struct{}),
 	}
+	for _, o := range opts {
+		o(h)
+	}
+	if h.otlp == nil {
+		h.otlp = otlp.NewConverter()
+	}
+	return h
+}
+
+// WithMaxBatch limits number of metrics in update batch, 0 is unlimited
+func WithMaxBatch(n int) func(h *HTTPHandlers) {
+	return func(h *HTTPHandlers) {
+		h.maxBatch = n
+	}
+}
+
+// decodeStatus returns response code of request body decoding error
+func decodeStatus(err error) int {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// rejectBatch responds with code and `X-Batch-Rejected` header to tell client that batch
+// will never be accepted and should not be resent
+func rejectBatch(w http.ResponseWriter, code int) {
+	w.Header().Set("X-Batch-Rejected", "true")
+	w.WriteHeader(code)
+}
+
+// store returns storage of existing request tenant, responds with 404/NotFound if tenant does not exist
+func (h *HTTPHandlers) store(w http.ResponseWriter, r *http.Request) (HTTPHandlerStorage, bool) {
+	s, ok := tenantStorage(r.Context(), h.storage, h.tenants)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	return s, ok
+}
+
+// updateStore returns storage of request tenant to be updated, tenant is created if it does not exist.
+// Responds with 403/Forbidden if tenant may not be created.
+func (h *HTTPHandlers) updateStore(w http.ResponseWriter, r *http.Request) (HTTPHandlerStorage, bool) {
+	s, err := updateStorage(r.Context(), h.storage, h.tenants)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return nil, false
+	}
+	return s, true
+}
+
+// getAll returns all metrics of request tenant, which API key from context has access to.
+// Responds with 404/NotFound if tenant does not exist.
+func (h *HTTPHandlers) getAll(w http.ResponseWriter, r *http.Request) ([]models.Metrics, bool) {
+	s, ok := h.store(w, r)
+	if !ok {
+		return nil, false
+	}
+	return allowed(r.Context(), s.GetAll()), true
+}
+
+// allowed returns metrics, which API key from context has access to
+func allowed(ctx context.Context, set []models.Metrics) []models.Metrics {
+	prefix := apikey.Prefix(ctx)
+	if prefix == "" {
+		return set
+	}
+	allowed := make([]models.Metrics, 0, len(set))
+	for _, m := range set {
+		if strings.HasPrefix(m.Name, prefix) {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed
 }
 
 // IndexMetricHandler returns webpage with all metrics
 //
 //	curl -i http://localhost:8080/
-func (h *HTTPHandlers) IndexMetricHandler(w http.ResponseWriter, _ *http.Request) {
+func (h *HTTPHandlers) IndexMetricHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	funcMap := template.FuncMap{
 		"value": func(m models.Metrics) (s string) {
@@ -69,6 +165,8 @@ func (h *HTTPHandlers) IndexMetricHandler(w http.ResponseWriter, _ *http.Request
 				return strconv.FormatInt(*m.IValue, 10)
 			case models.Gauge:
 				return strconv.FormatFloat(*m.FValue, 'f', -1, 64)
+			case models.Histogram:
+				return m.HValue.String()
 			default:
 				return
 			}
@@ -81,8 +179,14 @@ func (h *HTTPHandlers) IndexMetricHandler(w http.ResponseWriter, _ *http.Request
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	set := h.storage.GetAll()
+	set, ok := h.getAll(w, r)
+	if !ok {
+		return
+	}
 	sort.Slice(set, func(i, j int) bool {
+		if set[i].Name == set[j].Name {
+			return set[i].Labels.String() < set[j].Labels.String()
+		}
 		return set[i].Name < set[j].Name
 	})
 	err = tmpl.Execute(w, set)
@@ -93,7 +197,28 @@ func (h *HTTPHandlers) IndexMetricHandler(w http.ResponseWriter, _ *http.Request
 	}
 }
 
+// labelsFromQuery returns metric labels passed as url query params, i.e. ?cpu=3
+// Reserved query params are not treated as labels.
+func labelsFromQuery(r *http.Request, reserved ...string) (models.Labels, error) {
+	q := r.URL.Query()
+	for _, name := range reserved {
+		q.Del(name)
+	}
+	if len(q) == 0 {
+		return nil, nil
+	}
+	labels := make(models.Labels, len(q))
+	for name, values := range q {
+		if len(values) != 1 {
+			return nil, models.ErrInvalidLabel
+		}
+		labels[name] = values[0]
+	}
+	return labels, labels.Validate()
+}
+
 // GetMetricHandler returns requested metric value in plain text.
+// Optional metric labels are passed as url query params.
 //
 // # Responses
 //   - 200/OK and value in plain text if metric found
@@ -103,6 +228,7 @@ func (h *HTTPHandlers) IndexMetricHandler(w http.ResponseWriter, _ *http.Request
 // # Example
 //
 //	curl -i http://localhost:8080/value/counter/c1
+//	curl -i 'http://localhost:8080/value/gauge/CPUutilization?cpu=1'
 func (h *HTTPHandlers) GetMetricHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Log().Debug().Msgf("GetMetricHandler: Request received  URL=%v", r.URL)
 	req, err := models.NewMetricRequest(chi.URLParam(r, "name"), chi.URLParam(r, "type"))
@@ -110,7 +236,15 @@ func (h *HTTPHandlers) GetMetricHandler(w http.ResponseWriter, r *http.Request)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	m, err := h.storage.GetOne(req)
+	if req.Labels, err = labelsFromQuery(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	storage, ok := h.store(w, r)
+	if !ok {
+		return
+	}
+	m, err := storage.GetOne(req)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrInvalidMetric):
@@ -137,15 +271,20 @@ func (h *HTTPHandlers) GetMetricHandler(w http.ResponseWriter, r *http.Request)
 // # Example
 //
 //	curl -X POST -i http://localhost:8080/value -d '{"id":"g1","type":"gauge"}'
+//	curl -X POST -i http://localhost:8080/value -d '{"id":"CPUutilization","type":"gauge","labels":{"cpu":"1"}}'
 func (h *HTTPHandlers) GetMetricJSONHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.MetricRequest
 	logger.Log().Debug().Msg("GetMetricJSONHandler: Request received: POST /value")
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		logger.Log().Warn().Err(err).Msg("GetMetricJSONHandler: unable to parse request JSON")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(decodeStatus(err))
 		return
 	}
-	m, err := h.storage.GetOne(req)
+	storage, ok := h.store(w, r)
+	if !ok {
+		return
+	}
+	m, err := storage.GetOne(req)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrInvalidMetric):
@@ -169,7 +308,7 @@ func (h *HTTPHandlers) GetMetricJSONHandler(w http.ResponseWriter, r *http.Reque
 }
 
 // UpdateMetricHandler creates new metric with value or updates value of existing metric.
-// Single metric is passed in url path
+// Single metric is passed in url path, optional metric labels are passed as url query params.
 //
 // # Responses
 //   - 200/OK on successful update
@@ -178,6 +317,8 @@ func (h *HTTPHandlers) GetMetricJSONHandler(w http.ResponseWriter, r *http.Reque
 // # Example
 //
 //	curl -X POST -i http://localhost:8080/update/gauge/g1/-1.75
+//	curl -X POST -i 'http://localhost:8080/update/gauge/CPUutilization/17.5?cpu=1'
+//	curl -X POST -i 'http://localhost:8080/update/histogram/latency/0.1:2,0.5:0,+Inf:1;1.25'
 func (h *HTTPHandlers) UpdateMetricHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Log().Debug().Msgf("UpdateMetricHandler: Request received  URL=%v", r.URL)
 	m, err := models.NewMetric(chi.URLParam(r, "name"), chi.URLParam(r, "type"), chi.URLParam(r, "value"))
@@ -185,7 +326,15 @@ func (h *HTTPHandlers) UpdateMetricHandler(w http.ResponseWriter, r *http.Reques
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	err = h.storage.UpdateOne(&m)
+	if m.Labels, err = labelsFromQuery(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	storage, ok := h.updateStore(w, r)
+	if !ok {
+		return
+	}
+	err = storage.UpdateOne(&m)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -205,14 +354,19 @@ func (h *HTTPHandlers) UpdateMetricHandler(w http.ResponseWriter, r *http.Reques
 // # Example
 //
 //	curl -X POST -i http://localhost:8080/update -d '{"id":"g2","type":"gauge","value":-1.75}'
+//	curl -X POST -i http://localhost:8080/update -d '{"id":"g2","type":"gauge","labels":{"host":"h1"},"value":-1.75}'
 func (h *HTTPHandlers) UpdateMetricJSONHandler(w http.ResponseWriter, r *http.Request) {
 	var m models.Metrics
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
 		logger.Log().Warn().Err(err).Msg("UpdateMetricJSONHandler: unable to parse request JSON")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(decodeStatus(err))
+		return
+	}
+	storage, ok := h.updateStore(w, r)
+	if !ok {
 		return
 	}
-	err := h.storage.UpdateOne(&m)
+	err := storage.UpdateOne(&m)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -229,32 +383,138 @@ func (h *HTTPHandlers) UpdateMetricJSONHandler(w http.ResponseWriter, r *http.Re
 // UpdateMetricsBatchHandler creates new metrics with values or updates values of existing metrics.
 // Multiple metrics are passed as JSON array in request body
 //
+// Optional `X-Batch-ID` header makes request idempotent: batch with the same id
+// is applied only once, replays are acknowledged without update.
+//
 // # Responses
 //   - 200/OK
 //   - 400/BadRequest if request is invalid
+//   - 413/RequestEntityTooLarge if request body or number of metrics exceeds limit
 //   - 500/InternalServerError if any other error occurred
 //
+// Batches rejected by handler itself (invalid or too large) have `X-Batch-Rejected: true` header
+// in 400 and 413 responses: such batch will never be accepted and should not be resent.
+//
 // # Example
 //
-//	curl -X POST -i http://localhost:8080/update -d '[{"id":"c101","type":"counter","delta":1},{"id":"g101","type":"gauge","value":-0.2}]'
+//	curl -X POST -i http://localhost:8080/updates -H 'X-Batch-ID: 5f0c9a' -d '[{"id":"c101","type":"counter","delta":1},{"id":"g101","type":"gauge","value":-0.2}]'
 func (h *HTTPHandlers) UpdateMetricsBatchHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Log().Debug().Msg("UpdateMetricsBatchHandler: request received")
 	metrics := make([]models.Metrics, 0)
 	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
 		logger.Log().Warn().Err(err).Msg("UpdateMetricsBatchHandler: unable to parse request JSON")
-		w.WriteHeader(http.StatusBadRequest)
+		rejectBatch(w, decodeStatus(err))
 		return
 	}
 	logger.Log().Debug().Msgf("Batch for update is: %v", metrics)
 	if len(metrics) == 0 {
-		w.WriteHeader(http.StatusBadRequest)
+		rejectBatch(w, http.StatusBadRequest)
+		return
+	}
+	if h.maxBatch > 0 && len(metrics) > h.maxBatch {
+		logger.Log().Warn().Msgf("UpdateMetricsBatchHandler: batch of %d metrics exceeds limit %d", len(metrics), h.maxBatch)
+		rejectBatch(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+	storage, ok := h.updateStore(w, r)
+	if !ok {
+		return
+	}
+	err := storage.UpdateBatch(r.Header.Get("X-Batch-ID"), metrics)
+	switch {
+	case err == nil, errors.Is(err, store.ErrBatchApplied):
+	case errors.Is(err, models.ErrInvalidMetric):
+		logger.Log().Warn().Err(err).Msg("UpdateMetricsBatchHandler: invalid batch")
+		rejectBatch(w, http.StatusBadRequest)
+		return
+	default:
+		logger.Log().Warn().Err(err).Msg("UpdateMetricsBatchHandler: unable to update metrics")
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	err := h.storage.UpdateMany(metrics)
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteMetricHandler removes metric from server.
+// Optional metric labels are passed as url query params.
+//
+// # Responses
+//   - 200/OK if metric is deleted
+//   - 400/BadRequest if request is invalid
+//   - 404/NotFound if metric does not exist on server
+//
+// # Example
+//
+//	curl -X DELETE -i http://localhost:8080/value/counter/c1
+//	curl -X DELETE -i 'http://localhost:8080/value/gauge/CPUutilization?cpu=1'
+func (h *HTTPHandlers) DeleteMetricHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msgf("DeleteMetricHandler: Request received  URL=%v", r.URL)
+	req, err := models.NewMetricRequest(chi.URLParam(r, "name"), chi.URLParam(r, "type"))
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if req.Labels, err = labelsFromQuery(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	storage, ok := h.store(w, r)
+	if !ok {
+		return
+	}
+	if err := storage.DeleteOne(req); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidMetric):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, store.ErrMetricNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteMetricsBatchHandler removes multiple metrics from server.
+// Metrics are passed as JSON array in request body. Existing metrics are deleted even if some of them are not found.
+//
+// # Responses
+//   - 200/OK if all metrics are deleted
+//   - 400/BadRequest if request is invalid, nothing is deleted
+//   - 404/NotFound if any of metrics does not exist on server
+//   - 500/InternalServerError if any other error occurred
+//
+// # Example
+//
+//	curl -X POST -i http://localhost:8080/delete -d '[{"id":"c1","type":"counter"},{"id":"CPUutilization","type":"gauge","labels":{"cpu":"1"}}]'
+func (h *HTTPHandlers) DeleteMetricsBatchHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msg("DeleteMetricsBatchHandler: request received")
+	requests := make([]models.MetricRequest, 0)
+	if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+		logger.Log().Warn().Err(err).Msg("DeleteMetricsBatchHandler: unable to parse request JSON")
+		w.WriteHeader(decodeStatus(err))
+		return
+	}
+	if len(requests) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	storage, ok := h.store(w, r)
+	if !ok {
+		return
+	}
+	if err := storage.DeleteMany(requests); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidMetric):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, store.ErrMetricNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -90,8 +90,10 @@ func TestHTTPHandlers_GetMetric(t *testing.T) {
 
 		mName       string
 		mType       string
-		counterVal  int64   // return int value
-		gaugeVal    float64 // return float value
+		query       string        // url query with labels
+		labels      models.Labels // labels in mock request
+		counterVal  int64         // return int value
+		gaugeVal    float64       // return float value
 		wantValue   string
 		wantCode    int
 		wantCall    int
@@ -117,6 +119,34 @@ func TestHTTPHandlers_GetMetric(t *testing.T) {
 			wantCode:  http.StatusOK,
 			wantCall:  1,
 		},
+		{
+			name:     "success labeled gauge",
+			mName:    "name",
+			mType:    "gauge",
+			query:    "?cpu=1&host=h1",
+			labels:   models.Labels{"cpu": "1", "host": "h1"},
+			gaugeVal: 0.119,
+
+			wantValue: "0.119",
+			wantCode:  http.StatusOK,
+			wantCall:  1,
+		},
+		{
+			name:     "invalid label",
+			mName:    "name",
+			mType:    "gauge",
+			query:    "?1cpu=1",
+			wantCode: http.StatusBadRequest,
+			wantCall: 0,
+		},
+		{
+			name:     "duplicate label",
+			mName:    "name",
+			mType:    "gauge",
+			query:    "?cpu=1&cpu=2",
+			wantCode: http.StatusBadRequest,
+			wantCall: 0,
+		},
 		{
 			name:     "invalid type",
 			wantCode: http.StatusBadRequest,
@@ -148,15 +178,16 @@ func TestHTTPHandlers_GetMetric(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/value/{type}/{name}", nil)
+			req := httptest.NewRequest(http.MethodGet, "/value/{type}/{name}"+tt.query, nil)
 			rctx := chi.NewRouteContext()
 			rctx.URLParams.Add("type", tt.mType)
 			rctx.URLParams.Add("name", tt.mName)
 			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
 			w := httptest.NewRecorder()
 			m.EXPECT().GetOne(models.MetricRequest{
-				Name: tt.mName,
-				Type: tt.mType,
+				Name:   tt.mName,
+				Type:   tt.mType,
+				Labels: tt.labels,
 			}).Times(tt.wantCall).DoAndReturn(func(req models.MetricRequest) (m models.Metrics, err error) {
 				return models.Metrics{
 					Type:   tt.mType,
@@ -286,9 +317,11 @@ func TestHTTPHandlers_UpdateMetric(t *testing.T) {
 
 		mName  string
 		mType  string
-		mValue string   // value in request
-		delta  *int64   // delta in mock request
-		value  *float64 // value in mock request
+		mValue string        // value in request
+		query  string        // url query with labels
+		labels models.Labels // labels in mock request
+		delta  *int64        // delta in mock request
+		value  *float64      // value in mock request
 
 		counterVal int64   // return int value
 		gaugeVal   float64 // return float value
@@ -323,6 +356,30 @@ func TestHTTPHandlers_UpdateMetric(t *testing.T) {
 			wantCode:  http.StatusOK,
 			wantCall:  1,
 		},
+		{
+			name:   "success labeled counter",
+			mName:  "name",
+			mType:  "counter",
+			mValue: "12",
+			query:  "?host=h1",
+			labels: models.Labels{"host": "h1"},
+			delta:  pointer(int64(12)),
+
+			counterVal: 10,
+			wantValue:  "10",
+
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:     "invalid label",
+			wantCode: http.StatusBadRequest,
+			mType:    "counter",
+			mName:    "name",
+			mValue:   "12",
+			query:    "?h-1=1",
+			wantCall: 0,
+		},
 		{
 			name:     "invalid type",
 			wantCode: http.StatusBadRequest,
@@ -356,7 +413,7 @@ func TestHTTPHandlers_UpdateMetric(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodPost, "/update/{type}/{name}/{value}", nil)
+			req := httptest.NewRequest(http.MethodPost, "/update/{type}/{name}/{value}"+tt.query, nil)
 			rctx := chi.NewRouteContext()
 			rctx.URLParams.Add("type", tt.mType)
 			rctx.URLParams.Add("name", tt.mName)
@@ -369,6 +426,7 @@ func TestHTTPHandlers_UpdateMetric(t *testing.T) {
 				DoAndReturn(func(metric *models.Metrics) error {
 					assert.Equal(t, tt.mName, metric.Name)
 					assert.Equal(t, tt.mType, metric.Type)
+					assert.Equal(t, tt.labels, metric.Labels)
 					if tt.delta != nil {
 						assert.Equal(t, *tt.delta, *metric.IValue)
 						*metric.IValue = tt.counterVal
@@ -507,12 +565,14 @@ func TestHTTPHandlers_UpdateMetricBatch(t *testing.T) {
 	defer mockController.Finish()
 	m := mocks.NewMockHTTPHandlerStorage(mockController)
 
-	h := NewHTTPHandlers(m)
+	h := NewHTTPHandlers(m, WithMaxBatch(2))
 
 	tests := []struct {
 		name string
 
 		rawRequest  string           // http request body
+		batchID     string           // X-Batch-ID header
+		maxBody     int64            // request body limit
 		wantRequest []models.Metrics // mock request
 
 		wantCode    int
@@ -532,6 +592,64 @@ func TestHTTPHandlers_UpdateMetricBatch(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantCall: 1,
 		},
+		{
+			name:       "success with batch id",
+			rawRequest: `[{"id":"name","type":"counter","delta":-10}]`,
+			batchID:    "batch1",
+			wantRequest: []models.Metrics{
+				{Name: "name", Type: "counter", IValue: pointer(int64(-10))},
+			},
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:       "batch replay",
+			rawRequest: `[{"id":"name","type":"counter","delta":-10}]`,
+			batchID:    "batch1",
+			wantRequest: []models.Metrics{
+				{Name: "name", Type: "counter", IValue: pointer(int64(-10))},
+			},
+			wantCode:    http.StatusOK,
+			wantCall:    1,
+			returnError: store.ErrBatchApplied,
+		},
+		{
+			name:       "update failed",
+			rawRequest: `[{"id":"name","type":"counter","delta":-10}]`,
+			batchID:    "batch2",
+			wantRequest: []models.Metrics{
+				{Name: "name", Type: "counter", IValue: pointer(int64(-10))},
+			},
+			wantCode:    http.StatusBadRequest,
+			wantCall:    1,
+			returnError: models.ErrInvalidMetric,
+		},
+		{
+			name:       "store failed",
+			rawRequest: `[{"id":"name","type":"counter","delta":-10}]`,
+			batchID:    "batch3",
+			wantRequest: []models.Metrics{
+				{Name: "name", Type: "counter", IValue: pointer(int64(-10))},
+			},
+			wantCode:    http.StatusInternalServerError,
+			wantCall:    1,
+			returnError: errors.New("connection refused"),
+		},
+		{
+			name: "batch exceeds limit",
+			rawRequest: `[
+				{"id":"c1","type":"counter","delta":1},
+				{"id":"c2","type":"counter","delta":1},
+				{"id":"c3","type":"counter","delta":1}
+			]`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "body exceeds limit",
+			rawRequest: `[{"id":"name","type":"counter","delta":-10}]`,
+			maxBody:    10,
+			wantCode:   http.StatusRequestEntityTooLarge,
+		},
 		{
 			name:       "empty body",
 			rawRequest: ``,
@@ -600,12 +718,19 @@ func TestHTTPHandlers_UpdateMetricBatch(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			reqBody := bytes.NewBuffer([]byte(tt.rawRequest))
 			req := httptest.NewRequest(http.MethodPost, "/updates", reqBody)
-
 			w := httptest.NewRecorder()
+			if tt.maxBody > 0 {
+				req.Body = http.MaxBytesReader(w, req.Body, tt.maxBody)
+			}
+			if tt.batchID != "" {
+				req.Header.Set("X-Batch-ID", tt.batchID)
+			}
+
 			m.EXPECT().
-				UpdateMany(gomock.Any()).
+				UpdateBatch(gomock.Any(), gomock.Any()).
 				Times(tt.wantCall).
-				DoAndReturn(func(metrics []models.Metrics) error {
+				DoAndReturn(func(id string, metrics []models.Metrics) error {
+					assert.Equal(t, tt.batchID, id)
 					assert.Equal(t, tt.wantRequest, metrics)
 					return tt.returnError
 				})
@@ -614,6 +739,9 @@ func TestHTTPHandlers_UpdateMetricBatch(t *testing.T) {
 			defer res.Body.Close()
 
 			require.Equal(t, tt.wantCode, res.StatusCode)
+			// every client error of batch handler is a batch rejection
+			wantRejected := tt.wantCode >= 400 && tt.wantCode < 500
+			assert.Equal(t, wantRejected, res.Header.Get("X-Batch-Rejected") == "true")
 		})
 	}
 }
@@ -662,3 +790,149 @@ func TestHTTPHandlers_UpdateMetricBatch(t *testing.T) {
 //	}
 //
 //}
+
+func TestHTTPHandlers_DeleteMetric(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+
+	h := NewHTTPHandlers(m)
+
+	tests := []struct {
+		name        string
+		mName       string
+		mType       string
+		query       string        // url query with labels
+		labels      models.Labels // labels in mock request
+		wantCode    int
+		wantCall    int
+		returnError error
+	}{
+		{
+			name:     "success",
+			mName:    "c1",
+			mType:    "counter",
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:     "success labeled",
+			mName:    "g1",
+			mType:    "gauge",
+			query:    "?host=h1",
+			labels:   models.Labels{"host": "h1"},
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:        "not found",
+			mName:       "c1",
+			mType:       "counter",
+			wantCode:    http.StatusNotFound,
+			wantCall:    1,
+			returnError: store.ErrMetricNotFound,
+		},
+		{
+			name:     "invalid type",
+			mName:    "c1",
+			mType:    "counter1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "no name",
+			mType:    "counter",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid label",
+			mName:    "g1",
+			mType:    "gauge",
+			query:    "?1host=h1",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/value/{type}/{name}"+tt.query, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("type", tt.mType)
+			rctx.URLParams.Add("name", tt.mName)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			m.EXPECT().DeleteOne(models.MetricRequest{
+				Name:   tt.mName,
+				Type:   tt.mType,
+				Labels: tt.labels,
+			}).Times(tt.wantCall).Return(tt.returnError)
+			h.DeleteMetricHandler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.wantCode, res.StatusCode)
+		})
+	}
+}
+
+func TestHTTPHandlers_DeleteMetricsBatch(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+
+	h := NewHTTPHandlers(m)
+
+	tests := []struct {
+		name        string
+		rawRequest  string                 // http request body
+		wantRequest []models.MetricRequest // mock request
+		wantCode    int
+		wantCall    int
+		returnError error
+	}{
+		{
+			name:       "success",
+			rawRequest: `[{"id":"c1","type":"counter"},{"id":"g1","type":"gauge","labels":{"host":"h1"}}]`,
+			wantRequest: []models.MetricRequest{
+				{Name: "c1", Type: "counter"},
+				{Name: "g1", Type: "gauge", Labels: models.Labels{"host": "h1"}},
+			},
+			wantCode: http.StatusOK,
+			wantCall: 1,
+		},
+		{
+			name:        "not found",
+			rawRequest:  `[{"id":"c1","type":"counter"}]`,
+			wantRequest: []models.MetricRequest{{Name: "c1", Type: "counter"}},
+			wantCode:    http.StatusNotFound,
+			wantCall:    1,
+			returnError: store.ErrMetricNotFound,
+		},
+		{
+			name:       "empty array",
+			rawRequest: `[]`,
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "invalid json",
+			rawRequest: `{name:value}`,
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "missing name",
+			rawRequest: `[{"id":"c1","type":"counter"},{"type":"counter"}]`,
+			wantCode:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/delete", bytes.NewBufferString(tt.rawRequest))
+			w := httptest.NewRecorder()
+			m.EXPECT().DeleteMany(tt.wantRequest).Times(tt.wantCall).Return(tt.returnError)
+			h.DeleteMetricsBatchHandler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.wantCode, res.StatusCode)
+		})
+	}
+}
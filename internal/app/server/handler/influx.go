@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/influx"
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+// WithInfluxIntegers sets type of metrics made of integer line protocol fields: counter (default) or gauge
+func WithInfluxIntegers(mType string) func(h *HTTPHandlers) {
+	return func(h *HTTPHandlers) {
+		h.influxInt = mType
+	}
+}
+
+// WriteHandler updates metrics from InfluxDB line protocol body, i.e. sent by Telegraf.
+// Every numeric or boolean field becomes metric `measurement_field` with tags as labels, string fields are skipped.
+// Floats and booleans are gauges, integers are counters (or gauges, see WithInfluxIntegers).
+// Timestamps and query params (db, precision) are accepted, but ignored.
+// All lines are applied as a single batch: any invalid line rejects the whole request.
+// Request body is not encrypted even if server has private keys, use TLS to protect it.
+//
+// # Responses
+//   - 204/NoContent if metrics are updated
+//   - 400/BadRequest if any line is invalid
+//   - 403/Forbidden if metric name is not allowed by API key prefix
+//   - 413/RequestEntityTooLarge if request body or number of metrics exceeds limit
+//
+// # Example
+//
+//	curl -i http://localhost:8080/write --data-binary 'cpu,host=h1,cpu=0 usage_idle=97.5,usage_user=1.2 1700000000000000000'
+func (h *HTTPHandlers) WriteHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msg("WriteHandler: request received")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("WriteHandler: unable to read request body")
+		w.WriteHeader(decodeStatus(err))
+		return
+	}
+	points, err := influx.Parse(body)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("WriteHandler: unable to parse line protocol")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	intType := h.influxInt
+	if intType == "" {
+		intType = models.Counter
+	}
+	prefix := apikey.Prefix(r.Context())
+	var metrics []models.Metrics
+	for _, p := range points {
+		set, err := p.Metrics(intType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, m := range set {
+			if !strings.HasPrefix(m.Name, prefix) {
+				logger.Log().Warn().Msgf("WriteHandler: metric %s is not allowed", m.Name)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if err := m.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		metrics = append(metrics, set...)
+	}
+	if h.maxBatch > 0 && len(metrics) > h.maxBatch {
+		logger.Log().Warn().Msgf("WriteHandler: batch of %d metrics exceeds limit %d", len(metrics), h.maxBatch)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(metrics) > 0 {
+		storage, ok := h.updateStore(w, r)
+		if !ok {
+			return
+		}
+		if err := storage.UpdateMany(metrics); err != nil {
+			logger.Log().Warn().Err(err).Msg("WriteHandler: unable to update metrics")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+func TestHTTPHandlers_WriteHandler(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+
+	tests := []struct {
+		name string
+
+		body    string
+		intType string
+		prefix  string // api key prefix
+		maxBody int64  // request body limit
+
+		wantRequest []models.Metrics // mock request, sorted by name
+		wantCode    int
+		wantCall    int
+		returnError error
+	}{
+		{
+			name: "counters",
+			body: "cpu,host=h1 idle=97.5,procs=12i 1700000000000000000\nmem used=1i\n",
+			wantRequest: []models.Metrics{
+				{Name: "cpu_idle", Type: models.Gauge, Labels: models.Labels{"host": "h1"}, FValue: pointer(97.5)},
+				{Name: "cpu_procs", Type: models.Counter, Labels: models.Labels{"host": "h1"}, IValue: pointer(int64(12))},
+				{Name: "mem_used", Type: models.Counter, IValue: pointer(int64(1))},
+			},
+			wantCode: http.StatusNoContent,
+			wantCall: 1,
+		},
+		{
+			name:    "integers as gauges",
+			body:    "mem used=1i",
+			intType: models.Gauge,
+			wantRequest: []models.Metrics{
+				{Name: "mem_used", Type: models.Gauge, FValue: pointer(1.0)},
+			},
+			wantCode: http.StatusNoContent,
+			wantCall: 1,
+		},
+		{
+			name:     "only strings",
+			body:     `log msg="hello"`,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "invalid line",
+			body:     "cpu idle=1\ncpu",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too many metrics",
+			body:     "cpu a=1,b=2,c=3,d=4",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "too large body",
+			body:     "cpu idle=1",
+			maxBody:  4,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "allowed prefix",
+			body:   "cpu idle=1",
+			prefix: "cpu_",
+			wantRequest: []models.Metrics{
+				{Name: "cpu_idle", Type: models.Gauge, FValue: pointer(1.0)},
+			},
+			wantCode: http.StatusNoContent,
+			wantCall: 1,
+		},
+		{
+			name:     "forbidden prefix",
+			body:     "cpu idle=1\nmem used=1",
+			prefix:   "cpu_",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "storage error",
+			body: "cpu idle=1",
+			wantRequest: []models.Metrics{
+				{Name: "cpu_idle", Type: models.Gauge, FValue: pointer(1.0)},
+			},
+			wantCode:    http.StatusBadRequest,
+			wantCall:    1,
+			returnError: errors.New("error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHTTPHandlers(m, WithMaxBatch(3), WithInfluxIntegers(tt.intType))
+			req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(tt.body))
+			if tt.prefix != "" {
+				req = req.WithContext(apikey.NewContext(context.Background(), &apikey.Key{Name: "k", Prefix: tt.prefix}))
+			}
+			w := httptest.NewRecorder()
+			if tt.maxBody > 0 {
+				req.Body = http.MaxBytesReader(w, req.Body, tt.maxBody)
+			}
+
+			m.EXPECT().
+				UpdateMany(gomock.Any()).
+				Times(tt.wantCall).
+				DoAndReturn(func(metrics []models.Metrics) error {
+					sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+					assert.Equal(t, tt.wantRequest, metrics)
+					return tt.returnError
+				})
+			h.WriteHandler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.wantCode, res.StatusCode)
+		})
+	}
+}
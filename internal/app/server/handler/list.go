@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const (
+	defaultListLimit = 1000
+	maxListLimit     = 10000
+)
+
+var errListParams = errors.New("invalid list params")
+
+// listKey is a metric sort key, it is unique for every metric series
+type listKey [3]string
+
+func (k listKey) less(o listKey) bool {
+	for i := range k {
+		if k[i] != o[i] {
+			return k[i] < o[i]
+		}
+	}
+	return false
+}
+
+// listParams are filters, sorting and pagination of metrics list
+type listParams struct {
+	mType  string
+	prefix string
+	glob   string
+	regex  *regexp.Regexp
+	byType bool // sort by type first, otherwise by name
+	desc   bool
+	limit  int
+	after  *listKey // cursor, return metrics after this key
+}
+
+// parseListParams parses list params from query values
+func parseListParams(q url.Values) (p listParams, err error) {
+	p.mType = q.Get("type")
+	switch p.mType {
+	case "", models.Counter, models.Gauge, models.Histogram:
+	default:
+		return p, errListParams
+	}
+	p.prefix = q.Get("prefix")
+	if p.glob = q.Get("match"); p.glob != "" {
+		if _, err = path.Match(p.glob, ""); err != nil {
+			return
+		}
+	}
+	if v := q.Get("regex"); v != "" {
+		if p.regex, err = regexp.Compile(v); err != nil {
+			return
+		}
+	}
+	switch q.Get("sort") {
+	case "", "name":
+	case "type":
+		p.byType = true
+	default:
+		return p, errListParams
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return p, errListParams
+	}
+	p.limit = defaultListLimit
+	if v := q.Get("limit"); v != "" {
+		if p.limit, err = strconv.Atoi(v); err != nil {
+			return
+		}
+		if p.limit <= 0 || p.limit > maxListLimit {
+			return p, errListParams
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		var b []byte
+		if b, err = base64.RawURLEncoding.DecodeString(v); err != nil {
+			return
+		}
+		p.after = new(listKey)
+		if err = json.Unmarshal(b, p.after); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// key returns metric sort key according to params
+func (p listParams) key(m models.Metrics) listKey {
+	if p.byType {
+		return listKey{m.Type, m.Name, m.Labels.String()}
+	}
+	return listKey{m.Name, m.Type, m.Labels.String()}
+}
+
+// match checks metric satisfies all filters
+func (p listParams) match(m models.Metrics) bool {
+	if p.mType != "" && m.Type != p.mType {
+		return false
+	}
+	if !strings.HasPrefix(m.Name, p.prefix) {
+		return false
+	}
+	if p.glob != "" {
+		if ok, _ := path.Match(p.glob, m.Name); !ok {
+			return false
+		}
+	}
+	if p.regex != nil && !p.regex.MatchString(m.Name) {
+		return false
+	}
+	return true
+}
+
+// pastCursor checks metric key follows cursor in sort order
+func (p listParams) pastCursor(k listKey) bool {
+	switch {
+	case p.after == nil:
+		return true
+	case p.desc:
+		return k.less(*p.after)
+	default:
+		return p.after.less(k)
+	}
+}
+
+// cursor returns opaque pagination cursor pointing to key
+func cursor(k listKey) string {
+	b, _ := json.Marshal(k)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// list filters, sorts and paginates metrics set, returns page and cursor of the next page
+func list(set []models.Metrics, p listParams) ([]models.Metrics, string) {
+	type item struct {
+		key    listKey
+		metric models.Metrics
+	}
+	items := make([]item, 0, len(set))
+	for _, m := range set {
+		if !p.match(m) {
+			continue
+		}
+		k := p.key(m)
+		if !p.pastCursor(k) {
+			continue
+		}
+		items = append(items, item{key: k, metric: m})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if p.desc {
+			return items[j].key.less(items[i].key)
+		}
+		return items[i].key.less(items[j].key)
+	})
+
+	var next string
+	if len(items) > p.limit {
+		items = items[:p.limit]
+		next = cursor(items[len(items)-1].key)
+	}
+	res := make([]models.Metrics, 0, len(items))
+	for _, v := range items {
+		res = append(res, v.metric)
+	}
+	return res, next
+}
+
+// ListMetricsHandler returns metrics as JSON `{"metrics":[...],"next_cursor":"..."}`.
+//
+// Query params:
+//   - type: metrics type
+//   - prefix: metrics name prefix
+//   - match: metrics name glob pattern, i.e. `cpu*`
+//   - regex: metrics name regular expression
+//   - sort: `name` (default) or `type`
+//   - order: `asc` (default) or `desc`
+//   - limit: page size, 1000 by default, 10000 max
+//   - cursor: `next_cursor` value of the previous page, it is empty on the last page
+//
+// # Responses
+//   - 200/OK and metrics in body
+//   - 400/BadRequest if request params are invalid
+//   - 500/InternalServerError if any other error occurred
+//
+// # Example
+//
+//	curl -i 'http://localhost:8080/values?type=gauge&prefix=CPU&limit=10'
+//	curl -i 'http://localhost:8080/values?regex=^(Heap|Stack)&sort=type&order=desc'
+func (h *HTTPHandlers) ListMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msgf("ListMetricsHandler: Request received  URL=%v", r.URL)
+	p, err := parseListParams(r.URL.Query())
+	if err != nil {
+		logger.Log().Debug().Err(err).Msg("ListMetricsHandler: invalid params")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	res := struct {
+		Metrics    []models.Metrics `json:"metrics"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+	}{}
+	set, ok := h.getAll(w, r)
+	if !ok {
+		return
+	}
+	res.Metrics, res.NextCursor = list(set, p)
+	body, err := json.Marshal(res)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("ListMetricsHandler: unable to marshal response JSON")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
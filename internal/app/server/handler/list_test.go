@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+func TestHTTPHandlers_ListMetrics(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+
+	h := NewHTTPHandlers(m)
+
+	set := []models.Metrics{
+		{Name: "HeapAlloc", Type: models.Gauge, FValue: pointer(1.0)},
+		{Name: "PollCount", Type: models.Counter, IValue: pointer(int64(5))},
+		{Name: "CPUutilization", Type: models.Gauge, Labels: models.Labels{"cpu": "2"}, FValue: pointer(0.2)},
+		{Name: "CPUutilization", Type: models.Gauge, Labels: models.Labels{"cpu": "1"}, FValue: pointer(0.1)},
+		{Name: "HeapInuse", Type: models.Gauge, FValue: pointer(2.0)},
+		{Name: "StackInuse", Type: models.Gauge, FValue: pointer(3.0)},
+	}
+	// series is identified by name and labels
+	id := func(m models.Metrics) string { return models.SeriesKey(m.Name, m.Labels) }
+
+	tests := []struct {
+		name     string
+		query    string
+		wantIDs  []string
+		wantNext bool
+		wantCode int
+	}{
+		{
+			name:     "all sorted by name",
+			wantIDs:  []string{`CPUutilization{cpu="1"}`, `CPUutilization{cpu="2"}`, "HeapAlloc", "HeapInuse", "PollCount", "StackInuse"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "type filter sorted desc",
+			query:    "?type=gauge&order=desc",
+			wantIDs:  []string{"StackInuse", "HeapInuse", "HeapAlloc", `CPUutilization{cpu="2"}`, `CPUutilization{cpu="1"}`},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "sort by type",
+			query:    "?sort=type&prefix=P",
+			wantIDs:  []string{"PollCount"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "prefix and glob",
+			query:    "?prefix=Heap&match=*Inuse",
+			wantIDs:  []string{"HeapInuse"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "regex",
+			query:    "?regex=" + url.QueryEscape("^(Heap|Stack)Inuse$"),
+			wantIDs:  []string{"HeapInuse", "StackInuse"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "first page",
+			query:    "?limit=2",
+			wantIDs:  []string{`CPUutilization{cpu="1"}`, `CPUutilization{cpu="2"}`},
+			wantNext: true,
+			wantCode: http.StatusOK,
+		},
+		{name: "invalid type", query: "?type=counter1", wantCode: http.StatusBadRequest},
+		{name: "invalid regex", query: "?regex=" + url.QueryEscape("(a"), wantCode: http.StatusBadRequest},
+		{name: "invalid glob", query: "?match=" + url.QueryEscape("[a"), wantCode: http.StatusBadRequest},
+		{name: "invalid sort", query: "?sort=value", wantCode: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=0", wantCode: http.StatusBadRequest},
+		{name: "invalid cursor", query: "?cursor=abc", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/values"+tt.query, nil)
+			w := httptest.NewRecorder()
+			wantCall := 0
+			if tt.wantCode == http.StatusOK {
+				wantCall = 1
+			}
+			m.EXPECT().GetAll().Times(wantCall).Return(set)
+			h.ListMetricsHandler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if res.StatusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			var body struct {
+				Metrics    []models.Metrics `json:"metrics"`
+				NextCursor string           `json:"next_cursor"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			ids := make([]string, 0, len(body.Metrics))
+			for _, m := range body.Metrics {
+				ids = append(ids, id(m))
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+			assert.Equal(t, tt.wantNext, body.NextCursor != "")
+		})
+	}
+
+	t.Run("pages cover all metrics", func(t *testing.T) {
+		var ids []string
+		next := ""
+		for page := 0; page < 10; page++ {
+			req := httptest.NewRequest(http.MethodGet, "/values?limit=4&order=desc&cursor="+next, nil)
+			w := httptest.NewRecorder()
+			m.EXPECT().GetAll().Times(1).Return(set)
+			h.ListMetricsHandler(w, req)
+			res := w.Result()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var body struct {
+				Metrics    []models.Metrics `json:"metrics"`
+				NextCursor string           `json:"next_cursor"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			res.Body.Close()
+			for _, m := range body.Metrics {
+				ids = append(ids, id(m))
+			}
+			if next = body.NextCursor; next == "" {
+				break
+			}
+		}
+		assert.Equal(t, []string{"StackInuse", "PollCount", "HeapInuse", "HeapAlloc", `CPUutilization{cpu="2"}`, `CPUutilization{cpu="1"}`}, ids)
+	})
+	t.Run("api key prefix restriction", func(t *testing.T) {
+		key := &apikey.Key{Name: "dash", Prefix: "Heap"}
+		req := httptest.NewRequest(http.MethodGet, "/values", nil)
+		req = req.WithContext(apikey.NewContext(req.Context(), key))
+		w := httptest.NewRecorder()
+		m.EXPECT().GetAll().Times(1).Return(set)
+		h.ListMetricsHandler(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var body struct {
+			Metrics []models.Metrics `json:"metrics"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		ids := make([]string, 0, len(body.Metrics))
+		for _, m := range body.Metrics {
+			ids = append(ids, id(m))
+		}
+		assert.Equal(t, []string{"HeapAlloc", "HeapInuse"}, ids)
+	})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/otlp"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+)
+
+var (
+	errNotAllowed = errors.New("metric is not allowed")
+	errTooLarge   = errors.New("too many metrics")
+)
+
+// WithOTLP sets converter of OTLP metrics, by default converter with default options is used
+func WithOTLP(c *otlp.Converter) func(h *HTTPHandlers) {
+	return func(h *HTTPHandlers) {
+		h.otlp = c
+	}
+}
+
+// OTLPHandler updates metrics from OpenTelemetry OTLP/HTTP export request in JSON encoding.
+// Gauges are gauges, sums are counters, cumulative sums are converted to deltas, see otlp.Converter.
+// Data points of unsupported types and invalid data points are rejected and reported in partialSuccess.
+// Request body is not encrypted even if server has private keys, use TLS to protect it.
+//
+// # Responses
+//   - 200/OK with JSON ExportMetricsServiceResponse if metrics are updated
+//   - 400/BadRequest if request is invalid or metrics update failed
+//   - 403/Forbidden if metric name is not allowed by API key prefix
+//   - 413/RequestEntityTooLarge if request body or number of metrics exceeds limit
+//   - 415/UnsupportedMediaType if request is not JSON, i.e. protobuf
+//   - 500/InternalServerError if any other error occurred
+//
+// # Example
+//
+//	curl -i http://localhost:8080/v1/metrics -H 'Content-Type: application/json' -d '{"resourceMetrics":[{
+//	  "resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+//	  "scopeMetrics":[{"metrics":[{"name":"queue.size","gauge":{"dataPoints":[{"asInt":"5"}]}}]}]}]}'
+func (h *HTTPHandlers) OTLPHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msg("OTLPHandler: request received")
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/json" {
+		logger.Log().Warn().Msgf("OTLPHandler: unsupported content type '%s'", ct)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("OTLPHandler: unable to read request body")
+		w.WriteHeader(decodeStatus(err))
+		return
+	}
+	var req otlp.ExportRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		logger.Log().Warn().Err(err).Msg("OTLPHandler: unable to parse request JSON")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	storage, ok := h.updateStore(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	prefix := apikey.Prefix(ctx)
+	partial, err := h.otlp.Convert(tenant.FromContext(ctx), &req, func(metrics []models.Metrics) error {
+		for _, m := range metrics {
+			if !strings.HasPrefix(m.Name, prefix) {
+				logger.Log().Warn().Msgf("OTLPHandler: metric %s is not allowed", m.Name)
+				return errNotAllowed
+			}
+		}
+		if h.maxBatch > 0 && len(metrics) > h.maxBatch {
+			logger.Log().Warn().Msgf("OTLPHandler: batch of %d metrics exceeds limit %d", len(metrics), h.maxBatch)
+			return errTooLarge
+		}
+		return storage.UpdateMany(metrics)
+	})
+	switch {
+	case errors.Is(err, errNotAllowed):
+		w.WriteHeader(http.StatusForbidden)
+		return
+	case errors.Is(err, errTooLarge):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		logger.Log().Warn().Err(err).Msg("OTLPHandler: unable to update metrics")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if partial != nil {
+		logger.Log().Debug().Msgf("OTLPHandler: %d data points rejected: %s", partial.RejectedDataPoints, partial.ErrorMessage)
+	}
+
+	body, err = json.Marshal(otlp.ExportResponse{PartialSuccess: partial})
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("OTLPHandler: unable to marshal response JSON")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+func TestHTTPHandlers_OTLPHandler(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	h := NewHTTPHandlers(m, WithMaxBatch(2))
+
+	const gauges = `{"resourceMetrics":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+		"scopeMetrics":[{"metrics":[
+			{"name":"queue.size","gauge":{"dataPoints":[{"asInt":"5"}]}},
+			{"name":"latency","histogram":{"dataPoints":[{}]}}
+		]}]
+	}]}`
+	labels := models.Labels{"service_name": "checkout"}
+
+	tests := []struct {
+		name string
+
+		body        string
+		contentType string
+		prefix      string // api key prefix
+
+		wantRequest []models.Metrics // mock request
+		wantCode    int
+		wantBody    string
+		wantCall    int
+		returnError error
+	}{
+		{
+			name:        "partial success",
+			body:        gauges,
+			contentType: "application/json; charset=utf-8",
+			wantRequest: []models.Metrics{
+				{Name: "queue.size", Type: models.Gauge, Labels: labels, FValue: pointer(5.0)},
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"partialSuccess":{"rejectedDataPoints":"1","errorMessage":"unsupported metric type: metric 'latency'"}}`,
+			wantCall: 1,
+		},
+		{
+			name:        "empty request",
+			body:        `{}`,
+			contentType: "application/json",
+			wantCode:    http.StatusOK,
+			wantBody:    `{}`,
+		},
+		{
+			name:        "protobuf",
+			body:        gauges,
+			contentType: "application/x-protobuf",
+			wantCode:    http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "invalid json",
+			body:        `{"resourceMetrics":`,
+			contentType: "application/json",
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "too many metrics",
+			body:        `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"g","gauge":{"dataPoints":[{"asInt":1},{"asInt":2},{"asInt":3}]}}]}]}]}`,
+			contentType: "application/json",
+			wantCode:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "forbidden prefix",
+			body:        gauges,
+			contentType: "application/json",
+			prefix:      "app_",
+			wantCode:    http.StatusForbidden,
+		},
+		{
+			name:        "storage error",
+			body:        gauges,
+			contentType: "application/json",
+			wantRequest: []models.Metrics{
+				{Name: "queue.size", Type: models.Gauge, Labels: labels, FValue: pointer(5.0)},
+			},
+			wantCode:    http.StatusBadRequest,
+			wantCall:    1,
+			returnError: errors.New("error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.prefix != "" {
+				req = req.WithContext(apikey.NewContext(context.Background(), &apikey.Key{Name: "k", Prefix: tt.prefix}))
+			}
+			w := httptest.NewRecorder()
+
+			m.EXPECT().
+				UpdateMany(gomock.Any()).
+				Times(tt.wantCall).
+				DoAndReturn(func(metrics []models.Metrics) error {
+					assert.Equal(t, tt.wantRequest, metrics)
+					return tt.returnError
+				})
+			h.OTLPHandler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.wantCode, res.StatusCode)
+			if tt.wantBody != "" {
+				body, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+				assert.JSONEq(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
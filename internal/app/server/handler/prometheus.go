@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+// promTypes maps metric types to prometheus types
+var promTypes = map[string]string{
+	models.Counter:   "counter",
+	models.Gauge:     "gauge",
+	models.Histogram: "histogram",
+}
+
+// promValue returns metric value in prometheus format
+func promValue(m models.Metrics) string {
+	switch m.Type {
+	case models.Counter:
+		return strconv.FormatInt(*m.IValue, 10)
+	case models.Gauge:
+		return strconv.FormatFloat(*m.FValue, 'g', -1, 64)
+	}
+	return ""
+}
+
+// writePromHistogram writes histogram as cumulative name_bucket series with le label, name_sum and name_count
+func writePromHistogram(bw *bufio.Writer, name string, m models.Metrics) {
+	h := m.HValue
+	labels := make(models.Labels, len(m.Labels)+1)
+	for k, v := range m.Labels {
+		labels[k] = v
+	}
+	var cumulative int64
+	for i, c := range h.Counts {
+		cumulative += c
+		if i < len(h.Bounds) {
+			labels["le"] = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		} else {
+			labels["le"] = "+Inf"
+		}
+		bw.WriteString(name + "_bucket" + labels.String() + " " + strconv.FormatInt(cumulative, 10) + "\n")
+	}
+	bw.WriteString(name + "_sum" + m.Labels.String() + " " + strconv.FormatFloat(h.Sum, 'g', -1, 64) + "\n")
+	bw.WriteString(name + "_count" + m.Labels.String() + " " + strconv.FormatInt(h.Count, 10) + "\n")
+}
+
+// PrometheusHandler returns all metrics in prometheus text exposition format.
+// Metric names are sanitized to match prometheus naming rules, metrics are sorted by name and labels.
+// Metrics with the same sanitized name and different types are skipped except the first type,
+// metrics of different names sanitized to the same name are skipped except the first name.
+// Histograms are exposed as cumulative `_bucket` series with `le` label, `_sum` and `_count`,
+// histograms having own `le` label are skipped.
+//
+// # Responses
+//   - 200/OK and metrics in body
+//
+// # Example
+//
+//	curl -i http://localhost:8080/metrics
+func (h *HTTPHandlers) PrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msgf("PrometheusHandler: Request received  URL=%v", r.URL)
+	type promMetric struct {
+		name   string
+		labels string
+		metric models.Metrics
+	}
+	set, ok := h.getAll(w, r)
+	if !ok {
+		return
+	}
+	pm := make([]promMetric, len(set))
+	for i := range set {
+		pm[i] = promMetric{name: models.MetricName(set[i].Name), labels: set[i].Labels.String(), metric: set[i]}
+	}
+	sort.Slice(pm, func(i, j int) bool {
+		switch {
+		case pm[i].name != pm[j].name:
+			return pm[i].name < pm[j].name
+		case pm[i].metric.Type != pm[j].metric.Type:
+			return pm[i].metric.Type < pm[j].metric.Type
+		case pm[i].metric.Name != pm[j].metric.Name:
+			return pm[i].metric.Name < pm[j].metric.Name
+		default:
+			return pm[i].labels < pm[j].labels
+		}
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	var lastName, lastType, lastOrig string
+	for _, v := range pm {
+		pType, ok := promTypes[v.metric.Type]
+		if !ok {
+			continue
+		}
+		if _, ok := v.metric.Labels["le"]; ok && v.metric.Type == models.Histogram {
+			logger.Log().Warn().Msgf("PrometheusHandler: skip histogram '%s%s', label 'le' conflicts with bucket label", v.metric.Name, v.labels)
+			continue
+		}
+		if v.name == lastName && v.metric.Type != lastType {
+			logger.Log().Warn().Msgf("PrometheusHandler: skip %s '%s', name conflicts with %s", v.metric.Type, v.metric.Name, lastType)
+			continue
+		}
+		if v.name == lastName && v.metric.Name != lastOrig {
+			logger.Log().Warn().Msgf("PrometheusHandler: skip %s '%s', name conflicts with '%s'", v.metric.Type, v.metric.Name, lastOrig)
+			continue
+		}
+		if v.name != lastName {
+			lastName, lastType, lastOrig = v.name, v.metric.Type, v.metric.Name
+			bw.WriteString("# TYPE " + v.name + " " + pType + "\n")
+		}
+		if v.metric.Type == models.Histogram {
+			writePromHistogram(bw, v.name, v.metric)
+			continue
+		}
+		bw.WriteString(v.name + v.labels + " " + promValue(v.metric) + "\n")
+	}
+	if err := bw.Flush(); err != nil {
+		logger.Log().Warn().Err(err).Msg("PrometheusHandler: unable to write response")
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+func TestHTTPHandlers_Prometheus(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+
+	h := NewHTTPHandlers(m)
+
+	m.EXPECT().GetAll().Times(1).Return([]models.Metrics{
+		{Name: "g.1", Type: models.Gauge, FValue: pointer(-0.5)},
+		{Name: "PollCount", Type: models.Counter, IValue: pointer(int64(12))},
+		{Name: "inf", Type: models.Gauge, FValue: pointer(math.Inf(1))},
+		{Name: "g_1", Type: models.Counter, IValue: pointer(int64(1))},
+		{Name: "cpu.load", Type: models.Gauge, FValue: pointer(1.0)},
+		{Name: "cpu-load", Type: models.Gauge, FValue: pointer(2.0)},
+		{Name: "cpu-load", Type: models.Gauge, Labels: models.Labels{"cpu": "1"}, FValue: pointer(3.0)},
+		{Name: "cpu", Type: models.Gauge, Labels: models.Labels{"cpu": "2"}, FValue: pointer(0.2)},
+		{Name: "cpu", Type: models.Gauge, Labels: models.Labels{"cpu": "1", "host": "a\"b"}, FValue: pointer(0.1)},
+		{Name: "latency", Type: models.Histogram, Labels: models.Labels{"path": "/"}, HValue: &models.HistogramValue{
+			Bounds: []float64{0.1, 0.5}, Counts: []int64{2, 0, 1}, Count: 3, Sum: 1.25,
+		}},
+		{Name: "latency", Type: models.Histogram, Labels: models.Labels{"le": "0.1", "path": "/a"}, HValue: &models.HistogramValue{
+			Bounds: []float64{1}, Counts: []int64{1, 0}, Count: 1, Sum: 0.5,
+		}},
+		{Name: "size", Type: models.Histogram, Labels: models.Labels{"le": "1"}, HValue: &models.HistogramValue{
+			Bounds: []float64{1}, Counts: []int64{1, 0}, Count: 1, Sum: 0.5,
+		}},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	h.PrometheusHandler(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	want := `# TYPE PollCount counter
+PollCount 12
+# TYPE cpu gauge
+cpu{cpu="1",host="a\"b"} 0.1
+cpu{cpu="2"} 0.2
+# TYPE cpu_load gauge
+cpu_load 2
+cpu_load{cpu="1"} 3
+# TYPE g_1 counter
+g_1 1
+# TYPE inf gauge
+inf +Inf
+# TYPE latency histogram
+latency_bucket{le="0.1",path="/"} 2
+latency_bucket{le="0.5",path="/"} 2
+latency_bucket{le="+Inf",path="/"} 3
+latency_sum{path="/"} 1.25
+latency_count{path="/"} 3
+`
+	assert.Equal(t, want, string(body))
+}
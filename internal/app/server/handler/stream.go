@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const defaultHeartbeat = 15 * time.Second
+
+// WithHeartbeat sets period of heartbeat comments sent to idle streams, default is 15s
+func WithHeartbeat(d time.Duration) func(h *HTTPHandlers) {
+	return func(h *HTTPHandlers) {
+		if d > 0 {
+			h.heartbeat = d
+		}
+	}
+}
+
+// StopStreams ends all active streams and rejects new ones, i.e. on server shutdown
+func (h *HTTPHandlers) StopStreams() {
+	h.stopOnce.Do(func() {
+		close(h.streams)
+	})
+}
+
+// streamFilter selects metrics with names and types, any if not set, which are allowed by API key prefix
+func streamFilter(names, types []string, prefix string) func(m models.Metrics) bool {
+	nameSet := make(map[string]bool, len(names))
+	for _, n := range names {
+		nameSet[n] = true
+	}
+	typeSet := make(map[string]bool, len(types))
+	for _, t := range types {
+		typeSet[t] = true
+	}
+	return func(m models.Metrics) bool {
+		return (len(nameSet) == 0 || nameSet[m.Name]) &&
+			(len(typeSet) == 0 || typeSet[m.Type]) &&
+			strings.HasPrefix(m.Name, prefix)
+	}
+}
+
+// StreamHandler streams updated metrics as Server-Sent Events.
+// Every update is an event `metric` with metric JSON with the new value.
+// Query params `name` and `type` select metrics to stream, they may be repeated.
+// Heartbeat comment is sent to idle stream. If client does not read updates fast enough,
+// they are dropped and event `dropped` with number of dropped updates is sent.
+//
+// # Responses
+//   - 200/OK with text/event-stream of updates
+//   - 400/BadRequest if requested type is invalid
+//   - 500/InternalServerError if response can not be streamed
+//   - 503/ServiceUnavailable if server is stopping
+//
+// # Example
+//
+//	curl -N 'http://localhost:8080/stream?type=counter&name=PollCount'
+//
+//	event: metric
+//	data: {"id":"PollCount","type":"counter","delta":42}
+func (h *HTTPHandlers) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msg("StreamHandler: request received")
+	query := r.URL.Query()
+	for _, t := range query["type"] {
+		if _, err := models.NewMetricRequest("type", t); err != nil {
+			logger.Log().Warn().Err(err).Msgf("StreamHandler: invalid type '%s'", t)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	select {
+	case <-h.streams:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	storage, ok := h.store(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	sub := storage.Subscribe(streamFilter(query["name"], query["type"], apikey.Prefix(ctx)))
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := rc.Flush(); err != nil {
+		logger.Log().Warn().Err(err).Msg("StreamHandler: response can not be streamed")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logger.Log().Debug().Msgf("StreamHandler: stream to %s started", r.RemoteAddr)
+	defer logger.Log().Debug().Msgf("StreamHandler: stream to %s stopped", r.RemoteAddr)
+
+	var dropped int64
+	send := func(format string, args ...any) bool {
+		// report dropped updates before the next event
+		if n := sub.Dropped(); n > dropped {
+			if _, err := fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", n-dropped); err != nil {
+				return false
+			}
+			dropped = n
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.streams:
+			return
+		case <-heartbeat.C:
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case m, ok := <-sub.Updates():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				logger.Log().Warn().Err(err).Msg("StreamHandler: unable to marshal metric JSON")
+				continue
+			}
+			if !send("event: metric\ndata: %s\n\n", data) {
+				return
+			}
+			heartbeat.Reset(h.heartbeat)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store/broker"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+// readEvent returns the next event lines without trailing empty line
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestHTTPHandlers_StreamHandler(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockHTTPHandlerStorage(mockController)
+	b := broker.New(1)
+	m.EXPECT().Subscribe(gomock.Any()).AnyTimes().DoAndReturn(b.Subscribe)
+
+	h := NewHTTPHandlers(m, WithHeartbeat(50*time.Millisecond))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := apikey.NewContext(r.Context(), &apikey.Key{Name: "k", Prefix: "app_"})
+		h.StreamHandler(w, r.WithContext(ctx))
+	}))
+	defer srv.Close()
+
+	t.Run("invalid type", func(t *testing.T) {
+		res, err := http.Get(srv.URL + "?type=summary")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?type=counter&name=app_c1&name=c2", nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+		require.Eventually(t, func() bool { return b.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+		r := bufio.NewReader(res.Body)
+		assert.Equal(t, []string{": heartbeat"}, readEvent(t, r))
+
+		v := int64(3)
+		// filtered out by type, name and api key prefix
+		b.Publish(models.Metrics{Name: "app_c1", Type: models.Gauge, FValue: new(float64)})
+		b.Publish(models.Metrics{Name: "app_c3", Type: models.Counter, IValue: &v})
+		b.Publish(models.Metrics{Name: "c2", Type: models.Counter, IValue: &v})
+		b.Publish(models.Metrics{Name: "app_c1", Type: models.Counter, IValue: &v})
+		assert.Equal(t, []string{"event: metric", `data: {"id":"app_c1","type":"counter","delta":3}`}, readEvent(t, r))
+		assert.Equal(t, []string{": heartbeat"}, readEvent(t, r))
+	})
+
+	t.Run("stop streams", func(t *testing.T) {
+		res, err := http.Get(srv.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		h.StopStreams()
+		// body ends when stream is stopped
+		_, err = io.Copy(io.Discard, res.Body)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return b.Len() == 0 }, time.Second, 10*time.Millisecond)
+
+		res, err = http.Get(srv.URL)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	})
+}
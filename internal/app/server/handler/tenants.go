@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+)
+
+// TenantStorage provides isolated storages of tenants
+type TenantStorage interface {
+	// Tenant returns storage of existing tenant, false if tenant does not exist
+	Tenant(name string) (HTTPHandlerStorage, bool)
+	// Create returns storage of tenant, tenant is created if it does not exist
+	Create(name string) (HTTPHandlerStorage, error)
+	// List returns names of all tenants
+	List() []string
+}
+
+// storeTenants adapts store.Tenants to TenantStorage
+type storeTenants struct {
+	*store.Tenants
+}
+
+func (t storeTenants) Tenant(name string) (HTTPHandlerStorage, bool) {
+	c, ok := t.Tenants.Tenant(name)
+	if !ok {
+		return nil, false
+	}
+	return c, true
+}
+
+func (t storeTenants) Create(name string) (HTTPHandlerStorage, error) {
+	c, err := t.Tenants.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// StoreTenants returns TenantStorage of store tenants
+func StoreTenants(t *store.Tenants) TenantStorage {
+	return storeTenants{t}
+}
+
+// WithTenants makes handlers use storage of request tenant, see tenant.FromContext
+func WithTenants(t TenantStorage) func(h *HTTPHandlers) {
+	return func(h *HTTPHandlers) {
+		h.tenants = t
+	}
+}
+
+// WithGRPCTenants makes gRPC handlers use storage of call tenant, see tenant.FromContext
+func WithGRPCTenants(t TenantStorage) func(h *GRPCHandlers) {
+	return func(h *GRPCHandlers) {
+		h.tenants = t
+	}
+}
+
+// tenantStorage returns storage of existing tenant from context, or default storage if tenants are not set
+func tenantStorage(ctx context.Context, storage HTTPHandlerStorage, tenants TenantStorage) (HTTPHandlerStorage, bool) {
+	if tenants == nil {
+		return storage, true
+	}
+	s, ok := tenants.Tenant(tenant.FromContext(ctx))
+	if !ok {
+		logger.Log().Warn().Msgf("unknown tenant '%s'", tenant.FromContext(ctx))
+	}
+	return s, ok
+}
+
+// updateStorage returns storage of tenant from context to be updated, tenant is created if it does not exist.
+// Default storage is returned if tenants are not set.
+func updateStorage(ctx context.Context, storage HTTPHandlerStorage, tenants TenantStorage) (HTTPHandlerStorage, error) {
+	if tenants == nil {
+		return storage, nil
+	}
+	s, err := tenants.Create(tenant.FromContext(ctx))
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("unable to create tenant")
+	}
+	return s, err
+}
+
+// TenantsHandler returns list of tenants
+//
+// # Responses
+//   - 200/OK with JSON array of tenants names
+//   - 404/NotFound if tenants are not enabled
+//   - 500/InternalServerError if any other error occurred
+//
+// # Example
+//
+//	GET /tenants
+//	["default","team1"]
+func (h *HTTPHandlers) TenantsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Log().Debug().Msgf("TenantsHandler: Request received  URL=%v", r.URL)
+	if h.tenants == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, err := json.Marshal(h.tenants.List())
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("TenantsHandler: unable to marshal response JSON")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
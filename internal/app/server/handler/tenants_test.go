@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+// testTenants is TenantStorage with fixed storages, new tenants may not be created
+type testTenants map[string]HTTPHandlerStorage
+
+func (t testTenants) Tenant(name string) (HTTPHandlerStorage, bool) {
+	s, ok := t[name]
+	return s, ok
+}
+
+func (t testTenants) Create(name string) (HTTPHandlerStorage, error) {
+	if s, ok := t[name]; ok {
+		return s, nil
+	}
+	return nil, store.ErrTenantNotAllowed
+}
+
+func (t testTenants) List() []string { return []string{tenant.Default, "team1"} }
+
+func TestHTTPHandlers_Tenants(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	def := mocks.NewMockHTTPHandlerStorage(mockController)
+	team1 := mocks.NewMockHTTPHandlerStorage(mockController)
+	h := NewHTTPHandlers(def, WithTenants(testTenants{tenant.Default: def, "team1": team1}))
+
+	t.Run("request uses tenant storage", func(t *testing.T) {
+		team1.EXPECT().GetAll().Times(1)
+		req := httptest.NewRequest(http.MethodGet, "/values", nil)
+		req = req.WithContext(tenant.NewContext(req.Context(), "team1"))
+		w := httptest.NewRecorder()
+		h.ListMetricsHandler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("request without tenant uses default storage", func(t *testing.T) {
+		def.EXPECT().GetAll().Times(1)
+		w := httptest.NewRecorder()
+		h.ListMetricsHandler(w, httptest.NewRequest(http.MethodGet, "/values", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("read of unknown tenant", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/values", nil)
+		req = req.WithContext(tenant.NewContext(req.Context(), "team2"))
+		w := httptest.NewRecorder()
+		h.ListMetricsHandler(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("update of not allowed tenant", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/update/gauge/g1/1", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("type", "gauge")
+		rctx.URLParams.Add("name", "g1")
+		rctx.URLParams.Add("value", "1")
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		req = req.WithContext(tenant.NewContext(ctx, "team2"))
+		w := httptest.NewRecorder()
+		h.UpdateMetricHandler(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("list tenants", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.TenantsHandler(w, httptest.NewRequest(http.MethodGet, "/tenants", nil))
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		body, _ := io.ReadAll(res.Body)
+		assert.JSONEq(t, `["default","team1"]`, string(body))
+	})
+
+	t.Run("tenants disabled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		NewHTTPHandlers(def).TenantsHandler(w, httptest.NewRequest(http.MethodGet, "/tenants", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -5,16 +5,27 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
 )
 
 type MetricsHTTPHandler interface {
-	IndexMetricHandler(w http.ResponseWriter, _ *http.Request)
+	IndexMetricHandler(w http.ResponseWriter, r *http.Request)
 	GetMetricHandler(w http.ResponseWriter, r *http.Request)
 	GetMetricJSONHandler(w http.ResponseWriter, r *http.Request)
 	UpdateMetricHandler(w http.ResponseWriter, r *http.Request)
 	UpdateMetricJSONHandler(w http.ResponseWriter, r *http.Request)
 	UpdateMetricsBatchHandler(w http.ResponseWriter, r *http.Request)
 	PingHandler(w http.ResponseWriter, r *http.Request)
+	PrometheusHandler(w http.ResponseWriter, r *http.Request)
+	HistoryHandler(w http.ResponseWriter, r *http.Request)
+	DeleteMetricHandler(w http.ResponseWriter, r *http.Request)
+	DeleteMetricsBatchHandler(w http.ResponseWriter, r *http.Request)
+	ListMetricsHandler(w http.ResponseWriter, r *http.Request)
+	TenantsHandler(w http.ResponseWriter, r *http.Request)
+	WriteHandler(w http.ResponseWriter, r *http.Request)
+	OTLPHandler(w http.ResponseWriter, r *http.Request)
+	StreamHandler(w http.ResponseWriter, r *http.Request)
 }
 
 type Middleware func(http.Handler) http.Handler
@@ -26,6 +37,12 @@ type Router struct {
 	log          Middleware
 	crypt        Middleware
 	sign         Middleware
+	tenant       Middleware
+	maxBody      Middleware
+	limit        Middleware   // applied to every route before access check
+	readPolicy   []Middleware // applied to read routes
+	writePolicy  []Middleware // applied to routes changing metrics
+	auth         func(scope string) func(http.Handler) http.Handler
 	profilerPath string
 }
 
@@ -59,6 +76,53 @@ func WithSign(mw Middleware) func(router *Router) {
 	}
 }
 
+// WithTenant sets middleware selecting tenant of request
+func WithTenant(mw Middleware) func(router *Router) {
+	return func(router *Router) {
+		router.tenant = mw
+	}
+}
+
+// WithMaxBody sets middleware limiting size of uncompressed request body
+func WithMaxBody(mw Middleware) func(router *Router) {
+	return func(router *Router) {
+		router.maxBody = mw
+	}
+}
+
+// WithRateLimit sets middleware limiting rate of client requests, it is applied to every route
+// after route policies and before access check to limit unauthorized requests too
+func WithRateLimit(mw Middleware) func(router *Router) {
+	return func(router *Router) {
+		router.limit = mw
+	}
+}
+
+// WithReadPolicy adds middleware applied only to read routes, i.e. required signature
+func WithReadPolicy(mw Middleware) func(router *Router) {
+	return func(router *Router) {
+		if mw != nil {
+			router.readPolicy = append(router.readPolicy, mw)
+		}
+	}
+}
+
+// WithWritePolicy adds middleware applied only to routes, which update or delete metrics
+func WithWritePolicy(mw Middleware) func(router *Router) {
+	return func(router *Router) {
+		if mw != nil {
+			router.writePolicy = append(router.writePolicy, mw)
+		}
+	}
+}
+
+// WithAuth sets middleware factory checking request has access scope, it is applied to every route
+func WithAuth(auth func(scope string) func(http.Handler) http.Handler) func(router *Router) {
+	return func(router *Router) {
+		router.auth = auth
+	}
+}
+
 func WithCrypt(mw Middleware) func(router *Router) {
 	return func(router *Router) {
 		router.crypt = mw
@@ -79,6 +143,40 @@ func New(opts ...func(router *Router)) http.Handler {
 	return router.create()
 }
 
+// plainPaths are routes of third-party protocols, which clients do not encrypt requests
+var plainPaths = map[string]bool{
+	"/write":      true,
+	"/v1/metrics": true,
+}
+
+// decrypt returns crypt middleware, which skips routes of third-party protocols, see plainPaths
+func (router Router) decrypt() Middleware {
+	if router.crypt == nil {
+		return nil
+	}
+	return func(next http.Handler) http.Handler {
+		decrypted := router.crypt(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if plainPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			decrypted.ServeHTTP(w, r)
+		})
+	}
+}
+
+// policy returns function wrapping route handler with middlewares
+func policy(mws []Middleware) func(http.HandlerFunc) http.Handler {
+	return func(h http.HandlerFunc) http.Handler {
+		var handler http.Handler = h
+		for i := len(mws) - 1; i >= 0; i-- {
+			handler = mws[i](handler)
+		}
+		return handler
+	}
+}
+
 func (router Router) create() http.Handler {
 	r := chi.NewRouter()
 	// adds middleware if not nil
@@ -90,26 +188,59 @@ func (router Router) create() http.Handler {
 	// middleware order is important
 	mw(router.log)
 	mw(router.gunzip)
+	mw(router.maxBody)
 	mw(router.gzip)
-	mw(router.crypt)
+	mw(router.decrypt())
 	mw(router.sign)
+	mw(router.tenant)
 
 	if router.profilerPath != "" {
-		r.Mount(router.profilerPath, middleware.Profiler())
+		if router.auth != nil {
+			r.With(router.auth(apikey.ScopeAdmin)).Mount(router.profilerPath, middleware.Profiler())
+		} else {
+			r.Mount(router.profilerPath, middleware.Profiler())
+		}
 	}
 
-	r.Get("/", router.handler.IndexMetricHandler)
+	// route policies, then client rate limit, access scope is checked the last
+	scoped := func(mws []Middleware, scope string) func(http.HandlerFunc) http.Handler {
+		mws = mws[:len(mws):len(mws)]
+		if router.limit != nil {
+			mws = append(mws, router.limit)
+		}
+		if router.auth != nil {
+			mws = append(mws, router.auth(scope))
+		}
+		return policy(mws)
+	}
+	read := scoped(router.readPolicy, apikey.ScopeRead)
+	write := scoped(router.writePolicy, apikey.ScopeWrite)
+	remove := scoped(router.writePolicy, apikey.ScopeDelete)
+	admin := scoped(router.readPolicy, apikey.ScopeAdmin)
+
+	r.Method(http.MethodGet, "/", read(router.handler.IndexMetricHandler))
 	r.Route("/update", func(r chi.Router) {
-		r.Post("/", router.handler.UpdateMetricJSONHandler)
-		r.Post("/{type}/{name}/{value}", router.handler.UpdateMetricHandler)
+		r.Method(http.MethodPost, "/", write(router.handler.UpdateMetricJSONHandler))
+		r.Method(http.MethodPost, "/{type}/{name}/{value}", write(router.handler.UpdateMetricHandler))
 	})
 	r.Route("/value", func(r chi.Router) {
-		r.Post("/", router.handler.GetMetricJSONHandler)
-		r.Get("/{type}/{name}", router.handler.GetMetricHandler)
+		r.Method(http.MethodPost, "/", read(router.handler.GetMetricJSONHandler))
+		r.Method(http.MethodGet, "/{type}/{name}", read(router.handler.GetMetricHandler))
+		r.Method(http.MethodDelete, "/{type}/{name}", remove(router.handler.DeleteMetricHandler))
 	})
-	r.Get("/ping", router.handler.PingHandler)
+	r.Method(http.MethodGet, "/values", read(router.handler.ListMetricsHandler))
+	r.Method(http.MethodGet, "/ping", read(router.handler.PingHandler))
+	r.Method(http.MethodGet, "/metrics", read(router.handler.PrometheusHandler))
+	r.Method(http.MethodGet, "/history/{type}/{name}", read(router.handler.HistoryHandler))
+	r.Method(http.MethodGet, "/stream", read(router.handler.StreamHandler))
+	r.Method(http.MethodGet, "/tenants", admin(router.handler.TenantsHandler))
 	r.Route("/updates", func(r chi.Router) {
-		r.Post("/", router.handler.UpdateMetricsBatchHandler)
+		r.Method(http.MethodPost, "/", write(router.handler.UpdateMetricsBatchHandler))
+	})
+	r.Method(http.MethodPost, "/write", write(router.handler.WriteHandler))
+	r.Method(http.MethodPost, "/v1/metrics", write(router.handler.OTLPHandler))
+	r.Route("/delete", func(r chi.Router) {
+		r.Method(http.MethodPost, "/", remove(router.handler.DeleteMetricsBatchHandler))
 	})
 
 	return r
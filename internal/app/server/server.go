@@ -2,23 +2,38 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"google.golang.org/grpc"
+
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
 )
 
 type Dumper interface {
-	Dump(metrics []models.Metrics) error
-	Restore() (metrics []models.Metrics, lastDump time.Time, err error)
+	Dump(metrics []models.TenantMetrics) error
+	Restore() (metrics []models.TenantMetrics, lastDump time.Time, err error)
 }
 
 type DumpStorage interface {
-	GetAll() []models.Metrics
-	RestoreLatest(metrics []models.Metrics, ts time.Time)
+	GetAll() []models.TenantMetrics
+	RestoreLatest(metrics []models.TenantMetrics, ts time.Time)
+}
+
+// StaleStorage removes metrics, which were not updated for a long time
+type StaleStorage interface {
+	ExpireStale() int
+}
+
+// Listener receives metrics over additional protocol, i.e. StatsD
+type Listener interface {
+	// Serve receives metrics until context is cancelled
+	Serve(ctx context.Context) error
 }
 
 // Server represents server application
@@ -29,6 +44,11 @@ type Server struct {
 	dumpInterval time.Duration
 	storage      DumpStorage
 	restore      bool
+	stale        StaleStorage
+	staleSweep   time.Duration
+	grpcServer   *grpc.Server
+	grpcAddress  string
+	listeners    []Listener
 }
 
 func NewServer(opts ...func(server *Server)) *Server {
@@ -77,6 +97,44 @@ func WithRestore(r bool) func(server *Server) {
 	}
 }
 
+// WithStaleSweep enables removal of stale metrics from storage every interval
+func WithStaleSweep(s StaleStorage, interval time.Duration) func(server *Server) {
+	return func(server *Server) {
+		server.stale = s
+		server.staleSweep = interval
+	}
+}
+
+// WithTLS makes http server serve TLS with configuration, nil keeps plain http
+func WithTLS(conf *tls.Config) func(server *Server) {
+	return func(server *Server) {
+		server.httpServer.TLSConfig = conf
+	}
+}
+
+// WithGRPC enables gRPC server listening on address, it runs along with http server
+func WithGRPC(s *grpc.Server, address string) func(server *Server) {
+	return func(server *Server) {
+		server.grpcServer = s
+		server.grpcAddress = address
+	}
+}
+
+// WithListener adds metrics listener, it runs along with http server
+func WithListener(l Listener) func(server *Server) {
+	return func(server *Server) {
+		server.listeners = append(server.listeners, l)
+	}
+}
+
+// WithShutdownHook adds function called on http server shutdown, i.e. to end long-lived responses,
+// which are not finished by graceful shutdown
+func WithShutdownHook(fn func()) func(server *Server) {
+	return func(server *Server) {
+		server.httpServer.RegisterOnShutdown(fn)
+	}
+}
+
 // New creates new server instance
 //func New(conf *config.Config) *Server {
 //	srv := &Server{conf: conf}
@@ -149,17 +207,73 @@ func (srv *Server) Run(ctx context.Context) error {
 		}
 	}
 
+	// stale metrics sweeper
+	if srv.stale != nil && srv.staleSweep > 0 {
+		logger.Log().Info().Msgf("start stale metrics sweep every %s", srv.staleSweep)
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			for {
+				select {
+				case <-time.After(srv.staleSweep):
+					if n := srv.stale.ExpireStale(); n > 0 {
+						logger.Log().Info().Msgf("removed %d stale metrics", n)
+					}
+				case <-ctx.Done():
+					logger.Log().Info().Msg("stop stale metrics sweep")
+					return
+				}
+			}
+		}()
+	}
+
 	// start http server
 	srv.wg.Add(1)
 	go func() {
 		defer srv.wg.Done()
-		logger.Log().Info().Msgf("starting http server at %s", srv.httpServer.Addr)
-		if err := srv.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if srv.httpServer.TLSConfig != nil {
+			// certificates are already in config
+			logger.Log().Info().Msgf("starting https server at %s", srv.httpServer.Addr)
+			err = srv.httpServer.ListenAndServeTLS("", "")
+		} else {
+			logger.Log().Info().Msgf("starting http server at %s", srv.httpServer.Addr)
+			err = srv.httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Log().Fatal().Err(err).Msg("unable to start http server")
 		}
 		logger.Log().Info().Msg("http server stopped acquiring new connections")
 	}()
 
+	// start grpc server
+	if srv.grpcServer != nil && srv.grpcAddress != "" {
+		listen, err := net.Listen("tcp", srv.grpcAddress)
+		if err != nil {
+			logger.Log().Fatal().Err(err).Msg("unable to start grpc server")
+		}
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			logger.Log().Info().Msgf("starting grpc server at %s", srv.grpcAddress)
+			if err := srv.grpcServer.Serve(listen); err != nil {
+				logger.Log().Fatal().Err(err).Msg("grpc server failed")
+			}
+			logger.Log().Info().Msg("grpc server stopped acquiring new connections")
+		}()
+	}
+
+	// start metrics listeners, they stop on context cancel
+	for _, l := range srv.listeners {
+		srv.wg.Add(1)
+		go func(l Listener) {
+			defer srv.wg.Done()
+			if err := l.Serve(ctx); err != nil {
+				logger.Log().Fatal().Err(err).Msg("unable to start metrics listener")
+			}
+		}(l)
+	}
+
 	time.Sleep(500 * time.Millisecond)
 	logger.Log().Info().Msg("server started")
 
@@ -179,7 +293,24 @@ func (srv *Server) Run(ctx context.Context) error {
 	}
 	logger.Log().Info().Msg("http server stopped")
 
-	// wait until tasks stopped
+	// gracefully stop grpc server
+	if srv.grpcServer != nil && srv.grpcAddress != "" {
+		logger.Log().Info().Msg("stopping grpc server")
+		stopped := make(chan struct{})
+		go func() {
+			srv.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-httpCtx.Done():
+			logger.Log().Error().Msg("failed to stop grpc server gracefully. force stop")
+			srv.grpcServer.Stop()
+		}
+		logger.Log().Info().Msg("grpc server stopped")
+	}
+
+	// wait until tasks and listeners stopped
 	srv.wg.Wait()
 
 	// shutdown tasks
@@ -0,0 +1,146 @@
+package statsd
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+)
+
+// series is a metric name with labels
+type series struct {
+	name   string
+	labels models.Labels
+}
+
+type counter struct {
+	series
+	value float64
+}
+
+type gauge struct {
+	series
+	value    float64
+	absolute bool // value is set, otherwise value is a change of stored gauge
+}
+
+type timing struct {
+	series
+	value models.HistogramValue
+}
+
+type set struct {
+	series
+	members map[string]struct{}
+}
+
+// aggregator accumulates samples between flushes
+type aggregator struct {
+	bounds   []float64
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	timings  map[string]*timing
+	sets     map[string]*set
+}
+
+func newAggregator(bounds []float64) *aggregator {
+	a := &aggregator{bounds: bounds}
+	a.reset()
+	return a
+}
+
+func (a *aggregator) reset() {
+	a.counters = make(map[string]*counter)
+	a.gauges = make(map[string]*gauge)
+	a.timings = make(map[string]*timing)
+	a.sets = make(map[string]*set)
+}
+
+// add accumulates sample. Sampled counters and timings are scaled with sample rate.
+func (a *aggregator) add(s sample) error {
+	key := models.SeriesKey(s.name, s.labels)
+	sr := series{name: s.name, labels: s.labels}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch s.mType {
+	case typeCounter:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counter{series: sr}
+			a.counters[key] = c
+		}
+		c.value += s.value / s.rate
+	case typeGauge:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gauge{series: sr}
+			a.gauges[key] = g
+		}
+		if s.relative {
+			g.value += s.value
+		} else {
+			g.value = s.value
+			g.absolute = true
+		}
+	case typeTiming, typeHistogram, typeDistribution:
+		t, ok := a.timings[key]
+		if !ok {
+			h, err := models.NewHistogram(a.bounds)
+			if err != nil {
+				return err
+			}
+			t = &timing{series: sr, value: h}
+		}
+		if err := t.value.ObserveN(s.value, int64(math.Max(1, math.Round(1/s.rate)))); err != nil {
+			return err
+		}
+		a.timings[key] = t
+	case typeSet:
+		st, ok := a.sets[key]
+		if !ok {
+			st = &set{series: sr, members: make(map[string]struct{})}
+			a.sets[key] = st
+		}
+		st.members[s.member] = struct{}{}
+	}
+	return nil
+}
+
+// flush moves accumulated values to storage: counters are incremented, timings are merged to histograms,
+// number of unique set members is a gauge. Relative gauges change stored gauge value.
+func (a *aggregator) flush(storage Storage) (n int) {
+	a.mu.Lock()
+	counters, gauges, timings, sets := a.counters, a.gauges, a.timings, a.sets
+	a.reset()
+	a.mu.Unlock()
+
+	for _, c := range counters {
+		storage.CollectCounter(c.name, c.labels, int64(math.Round(c.value)))
+	}
+	for _, g := range gauges {
+		value := g.value
+		if !g.absolute {
+			req := models.MetricRequest{Name: g.name, Type: models.Gauge, Labels: g.labels}
+			m, err := storage.GetOne(req)
+			switch {
+			case err == nil:
+				value += *m.FValue
+			case !errors.Is(err, store.ErrMetricNotFound):
+				logger.Log().Warn().Err(err).Msgf("unable to get gauge '%s'", models.SeriesKey(g.name, g.labels))
+				continue
+			}
+		}
+		storage.CollectGauge(g.name, g.labels, value)
+	}
+	for _, t := range timings {
+		storage.CollectHistogramValue(t.name, t.labels, t.value)
+	}
+	for _, s := range sets {
+		storage.CollectGauge(s.name, s.labels, float64(len(s.members)))
+	}
+	return len(counters) + len(gauges) + len(timings) + len(sets)
+}
@@ -0,0 +1,102 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+// StatsD metric types
+const (
+	typeCounter      = "c"
+	typeGauge        = "g"
+	typeTiming       = "ms"
+	typeHistogram    = "h"
+	typeDistribution = "d"
+	typeSet          = "s"
+)
+
+var (
+	ErrInvalidLine = errors.New("invalid statsd line")
+)
+
+// sample is a parsed StatsD line
+type sample struct {
+	name     string
+	labels   models.Labels
+	mType    string
+	value    float64
+	member   string // value of set
+	relative bool   // gauge value has sign and changes current value
+	rate     float64
+}
+
+// parseLine parses StatsD line `name:value|type[|@rate][|#tag:value,...]`.
+// Tags in DogStatsD format become metric labels.
+func parseLine(line string) (s sample, err error) {
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return s, fmt.Errorf("%w: missing type", ErrInvalidLine)
+	}
+	i := strings.LastIndexByte(parts[0], ':')
+	if i < 1 {
+		return s, fmt.Errorf("%w: missing name or value", ErrInvalidLine)
+	}
+	s.name = parts[0][:i]
+	value := parts[0][i+1:]
+	s.mType = parts[1]
+	s.rate = 1
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			if s.rate, err = strconv.ParseFloat(p[1:], 64); err != nil || !(s.rate > 0 && s.rate <= 1) {
+				return s, fmt.Errorf("%w: invalid sample rate '%s'", ErrInvalidLine, p)
+			}
+		case strings.HasPrefix(p, "#"):
+			if s.labels, err = parseTags(p[1:]); err != nil {
+				return s, err
+			}
+		}
+	}
+
+	switch s.mType {
+	case typeSet:
+		if value == "" {
+			return s, fmt.Errorf("%w: empty set value", ErrInvalidLine)
+		}
+		s.member = value
+		return s, nil
+	case typeGauge:
+		s.relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case typeCounter, typeTiming, typeHistogram, typeDistribution:
+	default:
+		return s, fmt.Errorf("%w: unknown type '%s'", ErrInvalidLine, s.mType)
+	}
+	if s.value, err = strconv.ParseFloat(value, 64); err != nil || math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+		return s, fmt.Errorf("%w: invalid value '%s'", ErrInvalidLine, value)
+	}
+	return s, nil
+}
+
+// parseTags parses comma separated tags `tag:value`, tag without value has empty value
+func parseTags(tags string) (models.Labels, error) {
+	labels := make(models.Labels)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		labels[name] = value
+	}
+	if err := labels.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidLine, err)
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
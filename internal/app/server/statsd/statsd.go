@@ -0,0 +1,248 @@
+// Package statsd implements StatsD listener, which aggregates received metrics and flushes them to storage.
+//
+// Supported types are counters `name:1|c`, gauges `name:3.2|g` (`name:+1|g` changes current value),
+// timings `name:320|ms` (also `h` and `d`), which are observed in histogram, and sets `name:uid|s`,
+// which are flushed as gauge with number of unique values. Counters and timings may have
+// sample rate `name:1|c|@0.1`, DogStatsD tags `name:1|c|#tag:value` become metric labels.
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	// maxDatagram is the max size of udp packet payload
+	maxDatagram = 65535
+)
+
+var (
+	// DefaultTimingBounds are histogram buckets bounds of timings in milliseconds
+	DefaultTimingBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+	ErrNoAddress = errors.New("no listen address")
+)
+
+// Storage receives aggregated metrics on flush
+type Storage interface {
+	CollectCounter(name string, labels models.Labels, val int64)
+	CollectGauge(name string, labels models.Labels, val float64)
+	CollectHistogramValue(name string, labels models.Labels, val models.HistogramValue)
+	GetOne(request models.MetricRequest) (models.Metrics, error)
+}
+
+// Listener accepts StatsD lines over udp and tcp
+type Listener struct {
+	udpAddress    string
+	tcpAddress    string
+	flushInterval time.Duration
+	bounds        []float64
+	storage       Storage
+	agg           *aggregator
+	wg            sync.WaitGroup
+	mu            sync.Mutex
+	conns         map[net.Conn]struct{}
+	closed        bool
+}
+
+// New creates StatsD listener flushing metrics to storage
+func New(storage Storage, opts ...func(l *Listener)) (*Listener, error) {
+	l := &Listener{
+		storage:       storage,
+		flushInterval: defaultFlushInterval,
+		bounds:        DefaultTimingBounds,
+		conns:         make(map[net.Conn]struct{}),
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.udpAddress == "" && l.tcpAddress == "" {
+		return nil, ErrNoAddress
+	}
+	if _, err := models.NewHistogram(l.bounds); err != nil {
+		return nil, fmt.Errorf("invalid timing bounds: %w", err)
+	}
+	l.agg = newAggregator(l.bounds)
+	return l, nil
+}
+
+// WithUDP sets udp listen address
+func WithUDP(address string) func(l *Listener) {
+	return func(l *Listener) {
+		l.udpAddress = address
+	}
+}
+
+// WithTCP sets tcp listen address, lines are separated by newline
+func WithTCP(address string) func(l *Listener) {
+	return func(l *Listener) {
+		l.tcpAddress = address
+	}
+}
+
+// WithFlushInterval sets period to aggregate metrics before flush to storage
+func WithFlushInterval(d time.Duration) func(l *Listener) {
+	return func(l *Listener) {
+		if d > 0 {
+			l.flushInterval = d
+		}
+	}
+}
+
+// WithTimingBounds sets histogram buckets bounds of timings
+func WithTimingBounds(bounds []float64) func(l *Listener) {
+	return func(l *Listener) {
+		if len(bounds) > 0 {
+			l.bounds = bounds
+		}
+	}
+}
+
+// Serve receives metrics until context is cancelled. Aggregated metrics are flushed on exit.
+func (l *Listener) Serve(ctx context.Context) error {
+	var closers []func() error
+	if l.udpAddress != "" {
+		pc, err := net.ListenPacket("udp", l.udpAddress)
+		if err != nil {
+			return err
+		}
+		closers = append(closers, pc.Close)
+		logger.Log().Info().Msgf("starting statsd udp listener at %s", pc.LocalAddr())
+		l.wg.Add(1)
+		go l.serveUDP(pc)
+	}
+	if l.tcpAddress != "" {
+		ln, err := net.Listen("tcp", l.tcpAddress)
+		if err != nil {
+			for _, c := range closers {
+				c()
+			}
+			return err
+		}
+		closers = append(closers, ln.Close)
+		logger.Log().Info().Msgf("starting statsd tcp listener at %s", ln.Addr())
+		l.wg.Add(1)
+		go l.serveTCP(ln)
+	}
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.Flush()
+		case <-ctx.Done():
+			logger.Log().Info().Msg("stopping statsd listener")
+			for _, c := range closers {
+				c()
+			}
+			l.mu.Lock()
+			l.closed = true
+			for conn := range l.conns {
+				conn.Close()
+			}
+			l.mu.Unlock()
+			l.wg.Wait()
+			l.Flush()
+			logger.Log().Info().Msg("statsd listener stopped")
+			return nil
+		}
+	}
+}
+
+// Flush moves aggregated metrics to storage
+func (l *Listener) Flush() {
+	if n := l.agg.flush(l.storage); n > 0 {
+		logger.Log().Debug().Msgf("statsd flushed %d metrics", n)
+	}
+}
+
+// Process parses and aggregates StatsD lines separated by newline
+func (l *Listener) Process(data []byte) {
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		l.processLine(string(line))
+	}
+}
+
+func (l *Listener) processLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	s, err := parseLine(line)
+	if err == nil {
+		err = l.agg.add(s)
+	}
+	if err != nil {
+		logger.Log().Debug().Err(err).Msgf("skip statsd line '%s'", line)
+	}
+}
+
+func (l *Listener) serveUDP(pc net.PacketConn) {
+	defer l.wg.Done()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Log().Warn().Err(err).Msg("statsd udp read failed")
+				continue
+			}
+			return
+		}
+		l.Process(buf[:n])
+	}
+}
+
+func (l *Listener) serveTCP(ln net.Listener) {
+	defer l.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Log().Warn().Err(err).Msg("statsd tcp accept failed")
+				continue
+			}
+			return
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+		go l.serveConn(conn)
+	}
+}
+
+func (l *Listener) serveConn(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxDatagram)
+	for scanner.Scan() {
+		l.processLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Log().Debug().Err(err).Msgf("statsd tcp connection %s failed", conn.RemoteAddr())
+	}
+}
@@ -0,0 +1,195 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store/memory"
+)
+
+func Test_parseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    sample
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "app.requests:1|c",
+			want: sample{name: "app.requests", mType: typeCounter, value: 1, rate: 1},
+		},
+		{
+			name: "sampled counter",
+			line: "app.requests:2|c|@0.1",
+			want: sample{name: "app.requests", mType: typeCounter, value: 2, rate: 0.1},
+		},
+		{
+			name: "gauge",
+			line: "cpu:3.2|g",
+			want: sample{name: "cpu", mType: typeGauge, value: 3.2, rate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "cpu:-1|g",
+			want: sample{name: "cpu", mType: typeGauge, value: -1, relative: true, rate: 1},
+		},
+		{
+			name: "timing with tags",
+			line: "db.query:320|ms|#host:h1,db:main",
+			want: sample{name: "db.query", mType: typeTiming, value: 320, rate: 1, labels: models.Labels{"host": "h1", "db": "main"}},
+		},
+		{
+			name: "set",
+			line: "users:u1|s",
+			want: sample{name: "users", mType: typeSet, member: "u1", rate: 1},
+		},
+		{name: "no type", line: "app.requests:1", wantErr: true},
+		{name: "no name", line: ":1|c", wantErr: true},
+		{name: "unknown type", line: "app.requests:1|x", wantErr: true},
+		{name: "invalid value", line: "app.requests:one|c", wantErr: true},
+		{name: "NaN value", line: "cpu:NaN|g", wantErr: true},
+		{name: "infinite value", line: "db.query:+Inf|ms", wantErr: true},
+		{name: "invalid rate", line: "app.requests:1|c|@2", wantErr: true},
+		{name: "NaN rate", line: "app.requests:1|c|@NaN", wantErr: true},
+		{name: "invalid tag", line: "app.requests:1|c|#host-name:h1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func newStorage() *store.Controller {
+	return store.NewStorageController(memory.NewMemoryStore())
+}
+
+func getValue(t *testing.T, s *store.Controller, name, mType string, labels models.Labels) models.Metrics {
+	t.Helper()
+	m, err := s.GetOne(models.MetricRequest{Name: name, Type: mType, Labels: labels})
+	require.NoError(t, err, "metric %s", name)
+	return m
+}
+
+func TestListener_Flush(t *testing.T) {
+	storage := newStorage()
+	l, err := New(storage, WithUDP(":0"), WithTimingBounds([]float64{100, 500}))
+	require.NoError(t, err)
+
+	l.Process([]byte("requests:1|c\nrequests:2|c|@0.5\nbad line\n" +
+		"cpu:3|g\ncpu:+2|g\nmem:+5|g\n" +
+		"query:50|ms\nquery:200|ms|@0.5\n" +
+		"users:u1|s\nusers:u2|s\nusers:u1|s\n" +
+		"requests:1|c|#host:h1"))
+	// nothing is stored before flush
+	_, err = storage.GetOne(models.MetricRequest{Name: "requests", Type: models.Counter})
+	require.ErrorIs(t, err, store.ErrMetricNotFound)
+
+	l.Flush()
+	assert.Equal(t, int64(5), *getValue(t, storage, "requests", models.Counter, nil).IValue)
+	assert.Equal(t, int64(1), *getValue(t, storage, "requests", models.Counter, models.Labels{"host": "h1"}).IValue)
+	assert.Equal(t, 5.0, *getValue(t, storage, "cpu", models.Gauge, nil).FValue)
+	assert.Equal(t, 5.0, *getValue(t, storage, "mem", models.Gauge, nil).FValue)
+	assert.Equal(t, 2.0, *getValue(t, storage, "users", models.Gauge, nil).FValue)
+	h := getValue(t, storage, "query", models.Histogram, nil).HValue
+	assert.Equal(t, []int64{1, 2, 0}, h.Counts)
+	assert.Equal(t, 450.0, h.Sum)
+
+	// counters are incremented, relative gauges change stored value
+	l.Process([]byte("requests:1|c\nmem:-2|g\nquery:1000|ms"))
+	l.Flush()
+	assert.Equal(t, int64(6), *getValue(t, storage, "requests", models.Counter, nil).IValue)
+	assert.Equal(t, 3.0, *getValue(t, storage, "mem", models.Gauge, nil).FValue)
+	assert.Equal(t, []int64{1, 2, 1}, getValue(t, storage, "query", models.Histogram, nil).HValue.Counts)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(newStorage())
+	assert.ErrorIs(t, err, ErrNoAddress)
+	_, err = New(newStorage(), WithUDP(":0"), WithTimingBounds([]float64{2, 1}))
+	assert.ErrorIs(t, err, models.ErrInvalidValue)
+}
+
+// freeAddress returns local address with free port of network
+func freeAddress(t *testing.T, network string) string {
+	t.Helper()
+	var addr string
+	switch network {
+	case "udp":
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr = pc.LocalAddr().String()
+		pc.Close()
+	default:
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr = ln.Addr().String()
+		ln.Close()
+	}
+	return addr
+}
+
+func TestListener_Serve(t *testing.T) {
+	storage := newStorage()
+	udpAddr, tcpAddr := freeAddress(t, "udp"), freeAddress(t, "tcp")
+	l, err := New(storage, WithUDP(udpAddr), WithTCP(tcpAddr), WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, l.Serve(ctx))
+	}()
+
+	// wait for listeners
+	var tcp net.Conn
+	require.Eventually(t, func() bool {
+		tcp, err = net.Dial("tcp", tcpAddr)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = fmt.Fprint(tcp, "tcp.requests:2|c\ntcp.requests:3|c\n")
+	require.NoError(t, err)
+	require.NoError(t, tcp.Close())
+
+	udp, err := net.Dial("udp", udpAddr)
+	require.NoError(t, err)
+	defer udp.Close()
+	require.Eventually(t, func() bool {
+		_, err = udp.Write([]byte("udp.requests:1|c"))
+		require.NoError(t, err)
+		l.Flush()
+		_, err := storage.GetOne(models.MetricRequest{Name: "udp.requests", Type: models.Counter})
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		l.Flush()
+		m, err := storage.GetOne(models.MetricRequest{Name: "tcp.requests", Type: models.Counter})
+		return err == nil && *m.IValue == 5
+	}, time.Second, 10*time.Millisecond)
+
+	// metrics are flushed on exit
+	_, err = udp.Write([]byte("last:1|g"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	assert.Equal(t, 1.0, *getValue(t, storage, "last", models.Gauge, nil).FValue)
+}
@@ -0,0 +1,287 @@
+// Package apikey implements bearer API keys with permission scopes.
+//
+// Every key has a name, a set of scopes and an optional metric name prefix,
+// which restricts metrics the key has access to. Keys are stored as sha256 hash of the secret,
+// see Hash. Key stores are a JSON file (FileStore) or a database table (PostgresStore).
+//
+// Client sends the key in `Authorization: Bearer <key>` header or `authorization` metadata for gRPC.
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+)
+
+// Key scopes
+const (
+	ScopeRead   = "read"   // get and list metrics
+	ScopeWrite  = "write"  // update metrics
+	ScopeDelete = "delete" // delete metrics
+	ScopeAdmin  = "admin"  // server administration, implies all other scopes
+)
+
+const (
+	Header      = "Authorization"
+	MetadataKey = "authorization"
+	bearer      = "Bearer "
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown api key")
+	ErrInvalidScope = errors.New("invalid api key scope")
+	ErrInvalidKey   = errors.New("invalid api key")
+	ErrTenant       = errors.New("tenant is not allowed")
+)
+
+// Key is an API key permissions
+type Key struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"` // hex encoded sha256 of key secret
+	Scopes []string `json:"scopes"`
+	Prefix string   `json:"prefix,omitempty"` // key has access only to metrics with names starting with prefix
+	Tenant string   `json:"tenant,omitempty"` // key has access only to tenant, admin keys may request other tenants
+}
+
+// Validate checks key has hash and valid scopes
+func (k *Key) Validate() error {
+	if k.Name == "" || len(k.Hash) != sha256.Size*2 {
+		return fmt.Errorf("%w %q", ErrInvalidKey, k.Name)
+	}
+	if k.Tenant != "" && !tenant.Valid(k.Tenant) {
+		return fmt.Errorf("%w %q of key %q", tenant.ErrInvalid, k.Tenant, k.Name)
+	}
+	for _, s := range k.Scopes {
+		switch s {
+		case ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin:
+		default:
+			return fmt.Errorf("%w %q of key %q", ErrInvalidScope, s, k.Name)
+		}
+	}
+	return nil
+}
+
+// Can checks key has scope
+func (k *Key) Can(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks key has access to metric name
+func (k *Key) Allows(name string) bool {
+	return strings.HasPrefix(name, k.Prefix)
+}
+
+// Store is a keys storage
+type Store interface {
+	// Lookup returns key by its hash or ErrUnknownKey
+	Lookup(ctx context.Context, hash string) (*Key, error)
+}
+
+// Hash returns hex encoded sha256 of key secret
+func Hash(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// Generate returns new random key secret
+func Generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "yap_" + hex.EncodeToString(b), nil
+}
+
+// Bearer returns authorization header value with key
+func Bearer(secret string) string {
+	return bearer + secret
+}
+
+// Token returns bearer token from authorization header value, empty if there is no token
+func Token(auth string) string {
+	if len(auth) > len(bearer) && strings.EqualFold(auth[:len(bearer)], bearer) {
+		return strings.TrimSpace(auth[len(bearer):])
+	}
+	return ""
+}
+
+type ctxKey struct{}
+
+// NewContext returns context with key
+func NewContext(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, ctxKey{}, k)
+}
+
+// FromContext returns key from context, nil if there is no key
+func FromContext(ctx context.Context) *Key {
+	k, _ := ctx.Value(ctxKey{}).(*Key)
+	return k
+}
+
+// Prefix returns metric name prefix of key from context, empty if there is no key or restriction
+func Prefix(ctx context.Context) string {
+	if k := FromContext(ctx); k != nil {
+		return k.Prefix
+	}
+	return ""
+}
+
+// tenantContext binds context to key tenant. Key bound to tenant has access only to it,
+// except admin keys, which may request any tenant.
+func tenantContext(ctx context.Context, k *Key) (context.Context, error) {
+	if k.Tenant == "" {
+		return ctx, nil
+	}
+	switch requested := tenant.Requested(ctx); {
+	case requested == "":
+		return tenant.NewContext(ctx, k.Tenant), nil
+	case requested == k.Tenant, k.Can(ScopeAdmin):
+		return ctx, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrTenant, requested)
+	}
+}
+
+// Authorizer checks requests API keys
+type Authorizer struct {
+	store Store
+}
+
+func NewAuthorizer(s Store) *Authorizer {
+	return &Authorizer{store: s}
+}
+
+// authorize returns key for token, which has scope, or error with http status code
+func (a *Authorizer) authorize(ctx context.Context, token, scope string) (*Key, int, error) {
+	if token == "" {
+		return nil, http.StatusUnauthorized, ErrUnknownKey
+	}
+	k, err := a.store.Lookup(ctx, Hash(token))
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		return nil, http.StatusUnauthorized, err
+	case err != nil:
+		return nil, http.StatusInternalServerError, err
+	case !k.Can(scope):
+		return k, http.StatusForbidden, fmt.Errorf("%w: no %s scope", ErrInvalidScope, scope)
+	}
+	return k, http.StatusOK, nil
+}
+
+// Require is a middleware, which allows only requests with API key having scope.
+// Missing or unknown key is rejected with 401/Unauthorized, key without scope with 403/Forbidden.
+// Requests with prefix restricted key are rejected with 403/Forbidden, if metric name
+// in route `{name}` param or JSON body is not allowed.
+// Requests with key bound to tenant are rejected with 403/Forbidden, if other tenant is requested.
+//
+// Key and its tenant are added to request context, see FromContext.
+//
+// # Example
+//
+//	a := apikey.NewAuthorizer(store)
+//	r.With(a.Require(apikey.ScopeWrite)).Post("/update/", handler)
+func (a *Authorizer) Require(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Log().With().
+				Str("remote", r.RemoteAddr).
+				Str("method", r.Method).
+				Str("url", r.URL.Path).
+				Logger()
+			k, code, err := a.authorize(r.Context(), Token(r.Header.Get(Header)), scope)
+			if err != nil {
+				if k != nil {
+					log = log.With().Str("key", k.Name).Logger()
+				}
+				log.Warn().Err(err).Msg("api key rejected")
+				if code == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				}
+				w.WriteHeader(code)
+				return
+			}
+			if k.Prefix != "" {
+				names, err := requestNames(r)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				for _, n := range names {
+					if !k.Allows(n) {
+						log.Warn().Str("key", k.Name).Msgf("metric %s is not allowed", n)
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+				}
+			}
+			ctx, err := tenantContext(r.Context(), k)
+			if err != nil {
+				log.Warn().Err(err).Str("key", k.Name).Msg("api key rejected")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(ctx, k)))
+		})
+	}
+}
+
+// requestNames returns metric names from request route param or JSON body.
+// Body may be single metric or array of metrics, it is restored to be read by handler.
+func requestNames(r *http.Request) ([]string, error) {
+	if name := chi.URLParam(r, "name"); name != "" {
+		return []string{name}, nil
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	type named struct {
+		Name string `json:"id"`
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var metrics []named
+	if body[0] == '[' {
+		err = json.Unmarshal(body, &metrics)
+	} else {
+		metrics = make([]named, 1)
+		err = json.Unmarshal(body, &metrics[0])
+	}
+	if err != nil {
+		// handler responds to invalid body
+		return nil, nil
+	}
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		// handler responds to metric without name, other JSON bodies have no names
+		if m.Name != "" {
+			names = append(names, m.Name)
+		}
+	}
+	return names, nil
+}
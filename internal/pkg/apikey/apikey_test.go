@@ -0,0 +1,232 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+)
+
+func TestKey(t *testing.T) {
+	k := Key{Name: "k", Hash: Hash("secret"), Scopes: []string{ScopeRead}, Prefix: "app_"}
+	require.NoError(t, k.Validate())
+	assert.True(t, k.Can(ScopeRead))
+	assert.False(t, k.Can(ScopeWrite))
+	assert.True(t, k.Allows("app_requests"))
+	assert.False(t, k.Allows("requests"))
+
+	admin := Key{Name: "admin", Hash: Hash("secret"), Scopes: []string{ScopeAdmin}}
+	for _, s := range []string{ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin} {
+		assert.True(t, admin.Can(s), s)
+	}
+	assert.True(t, admin.Allows("any"))
+
+	assert.ErrorIs(t, (&Key{Name: "k", Hash: "short"}).Validate(), ErrInvalidKey)
+	assert.ErrorIs(t, (&Key{Hash: Hash("secret")}).Validate(), ErrInvalidKey)
+	assert.ErrorIs(t, (&Key{Name: "k", Hash: Hash("secret"), Scopes: []string{"all"}}).Validate(), ErrInvalidScope)
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"name": "agent", "hash": "`+Hash("agent")+`", "scopes": ["write"]},
+		{"name": "dashboard", "hash": "`+Hash("dash")+`", "scopes": ["read"], "prefix": "app_"}
+	]`), 0o600))
+	fs, err := ReadFile(path)
+	require.NoError(t, err)
+	k, err := fs.Lookup(context.Background(), Hash("dash"))
+	require.NoError(t, err)
+	assert.Equal(t, "dashboard", k.Name)
+	assert.Equal(t, "app_", k.Prefix)
+	_, err = fs.Lookup(context.Background(), Hash("unknown"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "agent", "hash": "`+Hash("agent")+`", "scopes": ["all"]}]`), 0o600))
+	_, err = ReadFile(path)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestAuthorizer_Require_Tenant(t *testing.T) {
+	store, err := NewFileStore(
+		Key{Name: "team1", Hash: Hash("team1"), Scopes: []string{ScopeRead}, Tenant: "team1"},
+		Key{Name: "any", Hash: Hash("any"), Scopes: []string{ScopeRead}},
+		Key{Name: "admin", Hash: Hash("admin"), Scopes: []string{ScopeAdmin}, Tenant: "team1"},
+	)
+	require.NoError(t, err)
+	var got string
+	handler := tenant.Middleware(NewAuthorizer(store).Require(ScopeRead)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = tenant.FromContext(r.Context()) }),
+	))
+
+	tests := []struct {
+		name       string
+		auth       string
+		tenant     string
+		wantCode   int
+		wantTenant string
+	}{
+		{name: "key tenant", auth: "team1", wantCode: http.StatusOK, wantTenant: "team1"},
+		{name: "same tenant", auth: "team1", tenant: "team1", wantCode: http.StatusOK, wantTenant: "team1"},
+		{name: "other tenant", auth: "team1", tenant: "team2", wantCode: http.StatusForbidden},
+		{name: "key without tenant", auth: "any", tenant: "team2", wantCode: http.StatusOK, wantTenant: "team2"},
+		{name: "key without tenant default", auth: "any", wantCode: http.StatusOK, wantTenant: tenant.Default},
+		{name: "admin other tenant", auth: "admin", tenant: "team2", wantCode: http.StatusOK, wantTenant: "team2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(Header, Bearer(tt.auth))
+			if tt.tenant != "" {
+				req.Header.Set(tenant.Header, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantTenant, got)
+		})
+	}
+}
+
+func TestAuthorizer_Require(t *testing.T) {
+	store, err := NewFileStore(
+		Key{Name: "reader", Hash: Hash("reader"), Scopes: []string{ScopeRead}},
+		Key{Name: "writer", Hash: Hash("writer"), Scopes: []string{ScopeWrite}, Prefix: "app_"},
+		Key{Name: "admin", Hash: Hash("admin"), Scopes: []string{ScopeAdmin}},
+	)
+	require.NoError(t, err)
+	a := NewAuthorizer(store)
+
+	var gotKey *Key
+	handler := func(w http.ResponseWriter, r *http.Request) { gotKey = FromContext(r.Context()) }
+	r := chi.NewRouter()
+	r.With(a.Require(ScopeRead)).Get("/value/{type}/{name}", handler)
+	r.With(a.Require(ScopeWrite)).Post("/update/{type}/{name}/{value}", handler)
+	r.With(a.Require(ScopeWrite)).Post("/updates/", handler)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		auth     string
+		wantCode int
+		wantKey  string
+	}{
+		{
+			name:     "no key",
+			method:   http.MethodGet,
+			url:      "/value/gauge/g1",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "not bearer",
+			method:   http.MethodGet,
+			url:      "/value/gauge/g1",
+			auth:     "Basic reader",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown key",
+			method:   http.MethodGet,
+			url:      "/value/gauge/g1",
+			auth:     Bearer("unknown"),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "read",
+			method:   http.MethodGet,
+			url:      "/value/gauge/g1",
+			auth:     Bearer("reader"),
+			wantCode: http.StatusOK,
+			wantKey:  "reader",
+		},
+		{
+			name:     "no scope",
+			method:   http.MethodPost,
+			url:      "/update/gauge/g1/1",
+			auth:     Bearer("reader"),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "admin",
+			method:   http.MethodPost,
+			url:      "/update/gauge/g1/1",
+			auth:     "bearer admin",
+			wantCode: http.StatusOK,
+			wantKey:  "admin",
+		},
+		{
+			name:     "allowed name in url",
+			method:   http.MethodPost,
+			url:      "/update/gauge/app_g1/1",
+			auth:     Bearer("writer"),
+			wantCode: http.StatusOK,
+			wantKey:  "writer",
+		},
+		{
+			name:     "not allowed name in url",
+			method:   http.MethodPost,
+			url:      "/update/gauge/g1/1",
+			auth:     Bearer("writer"),
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "allowed names in body",
+			method:   http.MethodPost,
+			url:      "/updates/",
+			body:     `[{"id":"app_g1","type":"gauge","value":1},{"id":"app_c1","type":"counter","delta":1}]`,
+			auth:     Bearer("writer"),
+			wantCode: http.StatusOK,
+			wantKey:  "writer",
+		},
+		{
+			name:     "body without names",
+			method:   http.MethodPost,
+			url:      "/updates/",
+			body:     `{"resourceMetrics":[]}`,
+			auth:     Bearer("writer"),
+			wantCode: http.StatusOK,
+			wantKey:  "writer",
+		},
+		{
+			name:     "not allowed name in body",
+			method:   http.MethodPost,
+			url:      "/updates/",
+			body:     `[{"id":"app_g1","type":"gauge","value":1},{"id":"c1","type":"counter","delta":1}]`,
+			auth:     Bearer("writer"),
+			wantCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKey = nil
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set(Header, tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantKey != "" {
+				require.NotNil(t, gotKey)
+				assert.Equal(t, tt.wantKey, gotKey.Name)
+			} else {
+				assert.Nil(t, gotKey)
+			}
+			if w.Code == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
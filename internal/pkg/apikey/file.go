@@ -0,0 +1,55 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileStore is an in-memory keys store loaded from JSON file
+//
+// # Example
+//
+//	[
+//	  {"name": "agent", "hash": "<sha256 hex>", "scopes": ["write"]},
+//	  {"name": "dashboard", "hash": "<sha256 hex>", "scopes": ["read"], "prefix": "app_"}
+//	]
+type FileStore struct {
+	keys map[string]*Key
+}
+
+// NewFileStore creates store with keys, keys are validated
+func NewFileStore(keys ...Key) (*FileStore, error) {
+	fs := &FileStore{keys: make(map[string]*Key, len(keys))}
+	for i := range keys {
+		k := keys[i]
+		if err := k.Validate(); err != nil {
+			return nil, err
+		}
+		fs.keys[k.Hash] = &k
+	}
+	return fs, nil
+}
+
+// ReadFile loads keys store from JSON file
+func ReadFile(path string) (*FileStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("unable to parse api keys file %s: %w", path, err)
+	}
+	return NewFileStore(keys...)
+}
+
+// Lookup returns key by its hash
+func (fs *FileStore) Lookup(_ context.Context, hash string) (*Key, error) {
+	k, ok := fs.keys[hash]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return k, nil
+}
@@ -0,0 +1,126 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+)
+
+// grpcCodes maps authorization http status to grpc code
+var grpcCodes = map[int]codes.Code{
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// messageNames returns metric names of gRPC request message
+func messageNames(msg any) []string {
+	switch m := msg.(type) {
+	case *pb.UpdateRequest:
+		return []string{m.GetMetric().GetName()}
+	case *pb.GetRequest:
+		return []string{m.GetMetric().GetName()}
+	case *pb.UpdateBatchRequest:
+		names := make([]string, len(m.GetMetrics()))
+		for i, v := range m.GetMetrics() {
+			names[i] = v.GetName()
+		}
+		return names
+	}
+	return nil
+}
+
+// checkNames verifies key has access to all metrics of message
+func checkNames(k *Key, msg any) error {
+	if k.Prefix == "" {
+		return nil
+	}
+	for _, n := range messageNames(msg) {
+		if !k.Allows(n) {
+			logger.Log().Warn().Str("key", k.Name).Msgf("metric %s is not allowed", n)
+			return status.Errorf(codes.PermissionDenied, "metric %s is not allowed", n)
+		}
+	}
+	return nil
+}
+
+// authorizeCtx authorizes call by key from metadata, method scope is taken from scopes,
+// methods without scope require admin scope
+func (a *Authorizer) authorizeCtx(ctx context.Context, method string, scopes map[string]string) (*Key, error) {
+	var auth string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(MetadataKey); len(v) > 0 {
+			auth = v[0]
+		}
+	}
+	scope, ok := scopes[method]
+	if !ok {
+		scope = ScopeAdmin
+	}
+	k, code, err := a.authorize(ctx, Token(auth), scope)
+	if err != nil {
+		logger.Log().Warn().Err(err).Str("method", method).Msg("api key rejected")
+		return nil, status.Error(grpcCodes[code], err.Error())
+	}
+	return k, nil
+}
+
+// UnaryServerInterceptor allows only calls with API key having method scope.
+// Scopes map full method names to required scopes, other methods require admin scope.
+func (a *Authorizer) UnaryServerInterceptor(scopes map[string]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		k, err := a.authorizeCtx(ctx, info.FullMethod, scopes)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkNames(k, req); err != nil {
+			return nil, err
+		}
+		ctx, err = tenantContext(ctx, k)
+		if err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return handler(NewContext(ctx, k), req)
+	}
+}
+
+// StreamServerInterceptor allows only streams with API key having method scope.
+// Every received message is checked to have allowed metric names.
+func (a *Authorizer) StreamServerInterceptor(scopes map[string]string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		k, err := a.authorizeCtx(ss.Context(), info.FullMethod, scopes)
+		if err != nil {
+			return err
+		}
+		ctx, err := tenantContext(ss.Context(), k)
+		if err != nil {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return handler(srv, &keyStream{ServerStream: ss, key: k, ctx: NewContext(ctx, k)})
+	}
+}
+
+// keyStream is a server stream authorized with key
+type keyStream struct {
+	grpc.ServerStream
+	key *Key
+	ctx context.Context
+}
+
+func (s *keyStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *keyStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return checkNames(s.key, m)
+}
@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/pb"
+)
+
+func TestAuthorizer_UnaryServerInterceptor(t *testing.T) {
+	store, err := NewFileStore(
+		Key{Name: "reader", Hash: Hash("reader"), Scopes: []string{ScopeRead}},
+		Key{Name: "writer", Hash: Hash("writer"), Scopes: []string{ScopeWrite}, Prefix: "app_"},
+	)
+	require.NoError(t, err)
+	interceptor := NewAuthorizer(store).UnaryServerInterceptor(map[string]string{
+		pb.Metrics_Update_FullMethodName: ScopeWrite,
+		pb.Metrics_Get_FullMethodName:    ScopeRead,
+	})
+	handler := func(ctx context.Context, req any) (any, error) { return FromContext(ctx).Name, nil }
+	call := func(key, method string, req any) (any, error) {
+		ctx := context.Background()
+		if key != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(MetadataKey, Bearer(key)))
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+	update := func(name string) *pb.UpdateRequest {
+		return &pb.UpdateRequest{Metric: &pb.Metric{Name: name}}
+	}
+
+	_, err = call("", pb.Metrics_Get_FullMethodName, &pb.GetRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	res, err := call("reader", pb.Metrics_Get_FullMethodName, &pb.GetRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "reader", res)
+
+	_, err = call("reader", pb.Metrics_Update_FullMethodName, update("app_g1"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	res, err = call("writer", pb.Metrics_Update_FullMethodName, update("app_g1"))
+	require.NoError(t, err)
+	assert.Equal(t, "writer", res)
+
+	_, err = call("writer", pb.Metrics_Update_FullMethodName, update("g1"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// method without scope requires admin
+	_, err = call("writer", "/metrics.Metrics/Unknown", update("app_g1"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,82 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	qKeysTbl = `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			hash    VARCHAR PRIMARY KEY,
+			name    VARCHAR NOT NULL UNIQUE,
+			scopes  VARCHAR NOT NULL DEFAULT '',
+			prefix  VARCHAR NOT NULL DEFAULT '',
+			tenant  VARCHAR NOT NULL DEFAULT '',
+			created_ts TIMESTAMPTZ NOT NULL DEFAULT current_timestamp(3)
+		);
+	`
+	qKeysTenant = `
+		ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant VARCHAR NOT NULL DEFAULT '';
+	`
+	qKeyLookup = `
+		SELECT name, scopes, prefix, tenant FROM api_keys WHERE hash = $1;
+	`
+)
+
+// PostgresStore is a keys store in database table `api_keys`.
+// Scopes are stored comma separated, i.e.
+//
+//	INSERT INTO api_keys (hash, name, scopes, prefix, tenant) VALUES ('<sha256 hex>', 'dashboard', 'read', 'app_', 'team1');
+type PostgresStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+// NewPostgresStore connects to database and creates keys table if it does not exist
+func NewPostgresStore(uri string, timeout time.Duration) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", uri)
+	if err != nil {
+		return nil, err
+	}
+	ps := &PostgresStore{db: db, timeout: timeout}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, q := range []string{qKeysTbl, qKeysTenant} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return ps, nil
+}
+
+// Lookup returns key by its hash
+func (ps *PostgresStore) Lookup(ctx context.Context, hash string) (*Key, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.timeout)
+	defer cancel()
+	k := &Key{Hash: hash}
+	var scopes string
+	err := ps.db.QueryRowContext(ctx, qKeyLookup, hash).Scan(&k.Name, &scopes, &k.Prefix, &k.Tenant)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range strings.Split(scopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			k.Scopes = append(k.Scopes, s)
+		}
+	}
+	return k, nil
+}
+
+func (ps *PostgresStore) Close() error {
+	return ps.db.Close()
+}
@@ -1,5 +1,8 @@
 // Package crypt provides ability to encrypt client-server communication.
 // The encryption is one-way client to server and implemented with RSA keypair.
+//
+// Messages are encrypted with hybrid RSA + AES-GCM envelope, see Encrypt.
+// Decryption also accepts legacy format of block-wise RSA-OAEP encryption, see EncryptOAEP.
 package crypt
 
 import (
@@ -31,11 +34,11 @@ var (
 	useRand       = rand.Reader
 )
 
-// WritePair generates and writes RSA key pair into io.Writers
-func WritePair(pubOut, privOut io.Writer, n int) error {
+// WritePair generates and writes RSA key pair into io.Writers, returns key fingerprint
+func WritePair(pubOut, privOut io.Writer, n int) (string, error) {
 	key, err := rsa.GenerateKey(rand.Reader, n)
 	if err != nil {
-		return fmt.Errorf("%w (%w)", ErrGenerate, err)
+		return "", fmt.Errorf("%w (%w)", ErrGenerate, err)
 	}
 
 	err = pem.Encode(privOut, &pem.Block{
@@ -43,16 +46,16 @@ func WritePair(pubOut, privOut io.Writer, n int) error {
 		Bytes: x509.MarshalPKCS1PrivateKey(key),
 	})
 	if err != nil {
-		return fmt.Errorf("%w (%w)", ErrGenerate, err)
+		return "", fmt.Errorf("%w (%w)", ErrGenerate, err)
 	}
 	err = pem.Encode(pubOut, &pem.Block{
 		Type:  publicType,
 		Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey),
 	})
 	if err != nil {
-		return fmt.Errorf("%w (%w)", ErrGenerate, err)
+		return "", fmt.Errorf("%w (%w)", ErrGenerate, err)
 	}
-	return nil
+	return Fingerprint(&key.PublicKey), nil
 }
 
 // ReadPublicKey reads public key in PEM format
@@ -84,6 +87,7 @@ func ReadPrivateKey(in io.Reader) (*rsa.PrivateKey, error) {
 }
 
 // EncryptOAEP allows to make rsa encryption for long messages, splitting encryption into blocks.
+// It is a legacy format, which is slow for large messages, use Encrypt instead.
 func EncryptOAEP(pub *rsa.PublicKey, msg []byte) ([]byte, error) {
 	msgSize := len(msg)
 	blockSize := pub.Size() - 2*useHash.Size() - 2
@@ -122,10 +126,10 @@ func DecryptOAEP(priv *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
 	return decryptedBytes, nil
 }
 
-// EncryptBody tries to encrypt response body.
+// EncryptBody tries to encrypt request body into envelope.
 // Returns unencrypted body and error if failed.
 func EncryptBody(body *[]byte, pubKey *rsa.PublicKey) ([]byte, error) {
-	encrypted, err := EncryptOAEP(pubKey, *body)
+	encrypted, err := Encrypt(pubKey, *body)
 	if err != nil {
 		return *body, fmt.Errorf("%w (%w)", ErrEncrypt, err)
 	}
@@ -134,10 +138,13 @@ func EncryptBody(body *[]byte, pubKey *rsa.PublicKey) ([]byte, error) {
 
 }
 
-func DecryptMiddleware(privateKey *rsa.PrivateKey) func(next http.Handler) http.Handler {
+// DecryptMiddleware decrypts request body if key set is not empty.
+// Key is selected by `X-Key-ID` header, all keys are tried if header is missing.
+// Both envelope and legacy formats are accepted.
+func DecryptMiddleware(keys *KeySet) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		decMW := func(w http.ResponseWriter, r *http.Request) {
-			if privateKey != nil {
+			if keys.Len() > 0 {
 				reqBody, err := io.ReadAll(r.Body)
 				if err != nil {
 					logger.Log().Warn().Err(err).Msg("failed to read request body")
@@ -145,7 +152,7 @@ func DecryptMiddleware(privateKey *rsa.PrivateKey) func(next http.Handler) http.
 					return
 				}
 				defer r.Body.Close()
-				decrypted, err := DecryptOAEP(privateKey, reqBody)
+				decrypted, err := keys.Decrypt(r.Header.Get(KeyIDHeader), reqBody)
 				if err != nil {
 					logger.Log().Warn().Err(err).Msg("failed to decrypt request body")
 					w.WriteHeader(http.StatusBadRequest)
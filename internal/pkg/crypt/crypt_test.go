@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 const (
@@ -161,6 +162,7 @@ func TestDecryptMiddleware(t *testing.T) {
 		name     string
 		priv     *rsa.PrivateKey
 		pub      *rsa.PublicKey
+		legacy   bool
 		wantCode int
 	}{
 		{
@@ -169,6 +171,13 @@ func TestDecryptMiddleware(t *testing.T) {
 			pub:      &key.PublicKey,
 			wantCode: http.StatusOK,
 		},
+		{
+			name:     "legacy encrypted flow",
+			priv:     key,
+			pub:      &key.PublicKey,
+			legacy:   true,
+			wantCode: http.StatusOK,
+		},
 		{
 			name:     "server with key, client without key",
 			priv:     key,
@@ -192,7 +201,11 @@ func TestDecryptMiddleware(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			body := payload
-			if tt.pub != nil {
+			switch {
+			case tt.pub != nil && tt.legacy:
+				body, err = EncryptOAEP(tt.pub, body)
+				require.NoError(t, err, "Expect no error on encryption")
+			case tt.pub != nil:
 				body, err = EncryptBody(&body, tt.pub)
 				require.NoError(t, err, "Expect no error on encryption")
 			}
@@ -200,7 +213,7 @@ func TestDecryptMiddleware(t *testing.T) {
 			req := httptest.NewRequest(http.MethodPost, "/", reqBody)
 			// middlware
 			w := httptest.NewRecorder()
-			mw := DecryptMiddleware(tt.priv)
+			mw := DecryptMiddleware(NewKeySet(tt.priv))
 			handler := mw(testHandler)
 			handler.ServeHTTP(w, req)
 
@@ -208,3 +221,24 @@ func TestDecryptMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func Test_Codec(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	msg := wrapperspb.Bytes(make([]byte, 2000))
+	rand.Read(msg.Value)
+
+	client := NewClientCodec(&key.PublicKey)
+	data, err := client.Marshal(msg)
+	require.NoError(t, err)
+
+	// plain codec can't read encrypted message
+	got := new(wrapperspb.BytesValue)
+	err = NewServerCodec(nil).Unmarshal(data, got)
+	require.False(t, err == nil && bytes.Equal(msg.Value, got.Value))
+
+	got = new(wrapperspb.BytesValue)
+	require.NoError(t, NewServerCodec(NewKeySet(key)).Unmarshal(data, got))
+	require.Equal(t, msg.Value, got.Value)
+	require.Equal(t, "proto", client.Name())
+}
@@ -0,0 +1,116 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Envelope is a hybrid encryption format: message is encrypted with random AES-256-GCM key,
+// the key is encrypted with RSA-OAEP.
+//
+//	magic "YAPE" | version 1B | wrapped key length 2B (BE) | wrapped key | nonce 12B | GCM ciphertext with tag
+//
+// Header (magic and version) is authenticated as GCM additional data.
+const (
+	envelopeMagic   = "YAPE"
+	envelopeV1      = byte(1)
+	envelopeKeySize = 32
+	headerSize      = len(envelopeMagic) + 1
+)
+
+// IsEnvelope checks data starts with envelope header of known version
+func IsEnvelope(data []byte) bool {
+	return len(data) > headerSize && bytes.HasPrefix(data, []byte(envelopeMagic)) && data[len(envelopeMagic)] == envelopeV1
+}
+
+// Encrypt encrypts message into envelope with public key
+func Encrypt(pub *rsa.PublicKey, msg []byte) ([]byte, error) {
+	key := make([]byte, envelopeKeySize)
+	if _, err := io.ReadFull(useRand, key); err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrEncrypt, err)
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), useRand, pub, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrEncrypt, err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrEncrypt, err)
+	}
+
+	out := make([]byte, 0, headerSize+2+len(wrapped)+gcm.NonceSize()+len(msg)+gcm.Overhead())
+	out = append(out, envelopeMagic...)
+	out = append(out, envelopeV1)
+	header := out[:headerSize]
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrapped)))
+	out = append(out, wrapped...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrEncrypt, err)
+	}
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, msg, header), nil
+}
+
+// decryptEnvelope decrypts envelope with private key
+func decryptEnvelope(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if !IsEnvelope(data) {
+		return nil, fmt.Errorf("%w: not an envelope", ErrDecrypt)
+	}
+	header, rest := data[:headerSize], data[headerSize:]
+	if len(rest) < 2 {
+		return nil, fmt.Errorf("%w: envelope is too short", ErrDecrypt)
+	}
+	keyLen := int(binary.BigEndian.Uint16(rest))
+	rest = rest[2:]
+	if len(rest) < keyLen {
+		return nil, fmt.Errorf("%w: envelope is too short", ErrDecrypt)
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, priv, rest[:keyLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrDecrypt, err)
+	}
+	rest = rest[keyLen:]
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrDecrypt, err)
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: envelope is too short", ErrDecrypt)
+	}
+	msg, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", ErrDecrypt, err)
+	}
+	return msg, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Decrypt decrypts both envelope and legacy block-wise RSA-OAEP formats
+func Decrypt(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if IsEnvelope(data) {
+		msg, err := decryptEnvelope(priv, data)
+		if err == nil {
+			return msg, nil
+		}
+		// legacy ciphertext may start with envelope magic by chance
+		if len(data)%priv.PublicKey.Size() != 0 {
+			return nil, err
+		}
+	}
+	return DecryptOAEP(priv, data)
+}
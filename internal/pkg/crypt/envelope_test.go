@@ -0,0 +1,57 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	payload := make([]byte, 3000000)
+	rand.Read(payload)
+
+	encrypted, err := Encrypt(&key.PublicKey, payload)
+	require.NoError(t, err)
+	require.True(t, IsEnvelope(encrypted))
+	// envelope overhead is header, wrapped key, nonce and tag
+	assert.Equal(t, len(payload)+headerSize+2+key.Size()+12+16, len(encrypted))
+
+	decrypted, err := Decrypt(key, encrypted)
+	require.NoError(t, err)
+	require.Equal(t, payload, decrypted)
+
+	t.Run("wrong key", func(t *testing.T) {
+		_, err := Decrypt(otherKey, encrypted)
+		require.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		for _, pos := range []int{len(envelopeMagic) + 1 + 2 + key.Size() + 1, len(encrypted) - 1} {
+			tampered := append([]byte{}, encrypted...)
+			tampered[pos] ^= 1
+			_, err := Decrypt(key, tampered)
+			require.ErrorIs(t, err, ErrDecrypt)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := Decrypt(key, encrypted[:headerSize+1])
+		require.ErrorIs(t, err, ErrDecrypt)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		legacy, err := EncryptOAEP(&key.PublicKey, payload[:10000])
+		require.NoError(t, err)
+		require.False(t, IsEnvelope(legacy))
+		decrypted, err := Decrypt(key, legacy)
+		require.NoError(t, err)
+		require.Equal(t, payload[:10000], decrypted)
+	})
+}
@@ -0,0 +1,73 @@
+package crypt
+
+import (
+	"crypto/rsa"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+)
+
+// Codec is a gRPC protobuf codec with one-way encryption, the same as for HTTP:
+// client encrypts requests with public key, server decrypts them with private key.
+// Responses are not encrypted. Codec replaces default "proto" codec, so
+// interceptors always deal with decrypted messages.
+//
+// Codec has no access to call metadata, so server tries all keys of the set.
+type Codec struct {
+	publicKey *rsa.PublicKey
+	keys      *KeySet
+}
+
+// NewServerCodec returns codec decrypting received messages, empty key set disables decryption
+//
+// # Example
+//
+//	grpc.NewServer(grpc.ForceServerCodec(crypt.NewServerCodec(keys)))
+func NewServerCodec(keys *KeySet) *Codec {
+	return &Codec{keys: keys}
+}
+
+// NewClientCodec returns codec encrypting sent messages, nil key disables encryption
+//
+// # Example
+//
+//	grpc.Dial(address, grpc.WithDefaultCallOptions(grpc.ForceCodec(crypt.NewClientCodec(publicKey))))
+func NewClientCodec(publicKey *rsa.PublicKey) *Codec {
+	return &Codec{publicKey: publicKey}
+}
+
+// Marshal serializes message and encrypts it into envelope if public key is set
+func (c *Codec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a proto.Message", ErrEncrypt, v)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil || c.publicKey == nil {
+		return data, err
+	}
+	return Encrypt(c.publicKey, data)
+}
+
+// Unmarshal decrypts message if key set is not empty and deserializes it
+func (c *Codec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a proto.Message", ErrDecrypt, v)
+	}
+	if c.keys.Len() > 0 {
+		var err error
+		if data, err = c.keys.Decrypt("", data); err != nil {
+			return err
+		}
+		logger.Log().Debug().Msg("message decrypted")
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// Name returns codec name, it overrides default protobuf codec
+func (c *Codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,133 @@
+package crypt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+)
+
+// KeyIDHeader is HTTP header with fingerprint of public key used for encryption
+const KeyIDHeader = "X-Key-ID"
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key id")
+	ErrNoKeys     = errors.New("no private keys found")
+)
+
+// Fingerprint returns key id: hex encoded first 16 bytes of SHA-256 hash of PKCS1 public key
+func Fingerprint(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(pub))
+	return hex.EncodeToString(sum[:16])
+}
+
+// KeySet is a set of private keys identified by their public key fingerprints.
+// It allows to rotate keys: agents with old and new public keys are served at the same time.
+type KeySet struct {
+	keys  map[string]*rsa.PrivateKey
+	order []string // keys in order of adding
+}
+
+// NewKeySet returns set of keys, nil keys are skipped
+func NewKeySet(keys ...*rsa.PrivateKey) *KeySet {
+	ks := &KeySet{keys: make(map[string]*rsa.PrivateKey)}
+	for _, k := range keys {
+		ks.Add(k)
+	}
+	return ks
+}
+
+// ReadKeySet reads private keys from PEM files. Path may be a file or a directory,
+// files of directory which are not private keys are skipped.
+func ReadKeySet(paths ...string) (*KeySet, error) {
+	ks := NewKeySet()
+	readFile := func(path string) (*rsa.PrivateKey, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ReadPrivateKey(f)
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			key, err := readFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			ks.Add(key)
+			continue
+		}
+		files, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			key, err := readFile(filepath.Join(path, f.Name()))
+			if err != nil {
+				logger.Log().Debug().Err(err).Msgf("skip file %s", f.Name())
+				continue
+			}
+			ks.Add(key)
+		}
+	}
+	if ks.Len() == 0 {
+		return nil, ErrNoKeys
+	}
+	return ks, nil
+}
+
+// Add adds key to the set
+func (ks *KeySet) Add(key *rsa.PrivateKey) {
+	if key == nil {
+		return
+	}
+	id := Fingerprint(&key.PublicKey)
+	if _, ok := ks.keys[id]; ok {
+		return
+	}
+	ks.keys[id] = key
+	ks.order = append(ks.order, id)
+	logger.Log().Info().Msgf("loaded private key %s", id)
+}
+
+// Len returns number of keys in set, nil set is empty
+func (ks *KeySet) Len() int {
+	if ks == nil {
+		return 0
+	}
+	return len(ks.order)
+}
+
+// Decrypt decrypts data with key identified by id.
+// Empty id is sent by agents without key id support, then all keys are tried in order.
+func (ks *KeySet) Decrypt(id string, data []byte) ([]byte, error) {
+	if id != "" {
+		key, ok := ks.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+		}
+		return Decrypt(key, data)
+	}
+	err := ErrNoKeys
+	for _, id := range ks.order {
+		var msg []byte
+		if msg, err = Decrypt(ks.keys[id], data); err == nil {
+			return msg, nil
+		}
+	}
+	return nil, err
+}
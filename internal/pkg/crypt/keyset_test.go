@@ -0,0 +1,91 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	var ids []string
+	for _, name := range []string{"old", "new"} {
+		pub, err := os.Create(filepath.Join(dir, name+"-public.key"))
+		require.NoError(t, err)
+		priv, err := os.Create(filepath.Join(dir, name+"-private.key"))
+		require.NoError(t, err)
+		id, err := WritePair(pub, priv, 1024)
+		require.NoError(t, err)
+		ids = append(ids, id)
+		pub.Close()
+		priv.Close()
+	}
+
+	// public keys in dir are skipped
+	ks, err := ReadKeySet(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ks.Len())
+	assert.ElementsMatch(t, ids, ks.order)
+
+	// the same key is added once
+	ks, err = ReadKeySet(filepath.Join(dir, "old-private.key"), dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ks.Len())
+
+	_, err = ReadKeySet(filepath.Join(dir, "old-public.key"))
+	assert.ErrorIs(t, err, ErrInvalidPEM)
+	_, err = ReadKeySet(t.TempDir())
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
+
+func TestKeySet_DecryptMiddleware(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	ks := NewKeySet(oldKey, newKey)
+
+	payload := []byte("this is a request body")
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+		assert.Equal(t, payload, body.Bytes())
+	})
+
+	tests := []struct {
+		name     string
+		pub      *rsa.PublicKey
+		keyID    string
+		wantCode int
+	}{
+		{name: "old key", pub: &oldKey.PublicKey, keyID: Fingerprint(&oldKey.PublicKey), wantCode: http.StatusOK},
+		{name: "new key", pub: &newKey.PublicKey, keyID: Fingerprint(&newKey.PublicKey), wantCode: http.StatusOK},
+		{name: "no key id", pub: &newKey.PublicKey, wantCode: http.StatusOK},
+		{name: "wrong key id", pub: &newKey.PublicKey, keyID: Fingerprint(&oldKey.PublicKey), wantCode: http.StatusBadRequest},
+		{name: "unknown key", pub: &otherKey.PublicKey, keyID: Fingerprint(&otherKey.PublicKey), wantCode: http.StatusBadRequest},
+		{name: "unknown key without id", pub: &otherKey.PublicKey, wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := Encrypt(tt.pub, payload)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			if tt.keyID != "" {
+				req.Header.Set(KeyIDHeader, tt.keyID)
+			}
+			w := httptest.NewRecorder()
+			DecryptMiddleware(ks)(testHandler).ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
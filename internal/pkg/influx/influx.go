@@ -0,0 +1,211 @@
+// Package influx parses InfluxDB line protocol and converts points to metrics.
+//
+// Line format is `measurement[,tag=value...] field=value[,field=value...] [timestamp]`.
+// Every numeric or boolean field becomes metric `measurement_field` with tags as labels,
+// string fields are skipped.
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+var (
+	ErrInvalidLine = errors.New("invalid line protocol")
+)
+
+// Point is a parsed line
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any // int64, uint64, float64, bool or string
+	Timestamp   int64          // 0 if not set
+}
+
+// split splits s by unescaped sep, which is not inside double quotes if quoted is set
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	start, inQuotes := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"' && quoted:
+			inQuotes = !inQuotes
+		case c == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescape removes escaping backslashes
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// parseValue parses field value: `1i` is integer, `1u` is unsigned, quoted is string,
+// t/f/true/false in any case are booleans, others are floats
+func parseValue(v string) (any, error) {
+	if v == "" {
+		return nil, fmt.Errorf("%w: empty field value", ErrInvalidLine)
+	}
+	switch {
+	case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+		return unescape(v[1 : len(v)-1]), nil
+	case strings.HasSuffix(v, "i"):
+		return strconv.ParseInt(v[:len(v)-1], 10, 64)
+	case strings.HasSuffix(v, "u"):
+		return strconv.ParseUint(v[:len(v)-1], 10, 64)
+	}
+	switch strings.ToLower(v) {
+	case "t", "true":
+		return true, nil
+	case "f", "false":
+		return false, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		err = fmt.Errorf("%w: field value should be finite", ErrInvalidLine)
+	}
+	return f, err
+}
+
+// ParseLine parses line protocol line
+func ParseLine(line string) (p Point, err error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return p, fmt.Errorf("%w: expected measurement, fields and timestamp", ErrInvalidLine)
+	}
+
+	key := split(sections[0], ',', false)
+	p.Measurement = unescape(key[0])
+	if p.Measurement == "" {
+		return p, fmt.Errorf("%w: missing measurement", ErrInvalidLine)
+	}
+	if len(key) > 1 {
+		p.Tags = make(map[string]string, len(key)-1)
+	}
+	for _, tag := range key[1:] {
+		kv := split(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return p, fmt.Errorf("%w: invalid tag '%s'", ErrInvalidLine, tag)
+		}
+		p.Tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	fields := split(sections[1], ',', true)
+	p.Fields = make(map[string]any, len(fields))
+	for _, field := range fields {
+		kv := split(field, '=', true)
+		if len(kv) < 2 || kv[0] == "" {
+			return p, fmt.Errorf("%w: invalid field '%s'", ErrInvalidLine, field)
+		}
+		// unescaped equal sign is allowed in string value
+		value := strings.Join(kv[1:], "=")
+		v, err := parseValue(value)
+		if err != nil {
+			return p, fmt.Errorf("%w: invalid field '%s' value '%s'", ErrInvalidLine, kv[0], value)
+		}
+		p.Fields[unescape(kv[0])] = v
+	}
+
+	if len(sections) == 3 && sections[2] != "" {
+		if p.Timestamp, err = strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return p, fmt.Errorf("%w: invalid timestamp '%s'", ErrInvalidLine, sections[2])
+		}
+	}
+	return p, nil
+}
+
+// Parse parses lines separated by newline, empty lines and comments are skipped.
+// Error has number of invalid line.
+func Parse(data []byte) ([]Point, error) {
+	var points []Point
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 4096), len(data)+1)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		points = append(points, p)
+	}
+	return points, scanner.Err()
+}
+
+// Metrics converts point fields to metrics `measurement_field`. Floats and booleans (1 or 0) are gauges,
+// integers are metrics of intType: counters with field value as delta or gauges.
+// String fields are skipped.
+func (p Point) Metrics(intType string) ([]models.Metrics, error) {
+	var labels models.Labels
+	if len(p.Tags) > 0 {
+		labels = make(models.Labels, len(p.Tags))
+		for k, v := range p.Tags {
+			labels[models.LabelName(k)] = v
+		}
+	}
+	metrics := make([]models.Metrics, 0, len(p.Fields))
+	for field, value := range p.Fields {
+		m := models.Metrics{Name: p.Measurement + "_" + field, Type: models.Gauge, Labels: labels}
+		var i int64
+		switch v := value.(type) {
+		case float64:
+			m.FValue = &v
+		case bool:
+			f := 0.0
+			if v {
+				f = 1
+			}
+			m.FValue = &f
+		case int64:
+			i = v
+			m.Type = intType
+		case uint64:
+			if v > math.MaxInt64 {
+				return nil, fmt.Errorf("%w: field '%s' value overflows integer", ErrInvalidLine, field)
+			}
+			i = int64(v)
+			m.Type = intType
+		default:
+			continue
+		}
+		if m.FValue == nil {
+			switch intType {
+			case models.Counter:
+				m.IValue = &i
+			case models.Gauge:
+				f := float64(i)
+				m.FValue = &f
+			default:
+				return nil, fmt.Errorf("%w: integers should be gauges or counters", models.ErrInvalidType)
+			}
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
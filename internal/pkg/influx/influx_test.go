@@ -0,0 +1,111 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "fields of all types",
+			line: `cpu,host=h1,cpu=0 idle=97.5,procs=12i,big=3u,up=t,state="ok" 1700000000000000000`,
+			want: Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "h1", "cpu": "0"},
+				Fields:      map[string]any{"idle": 97.5, "procs": int64(12), "big": uint64(3), "up": true, "state": "ok"},
+				Timestamp:   1700000000000000000,
+			},
+		},
+		{
+			name: "no tags and timestamp",
+			line: `mem used=1e3`,
+			want: Point{Measurement: "mem", Fields: map[string]any{"used": 1000.0}},
+		},
+		{
+			name: "escaped",
+			line: `disk\ io,path=/var\,log read\ ops=1i,msg="a \"b\" c=d"`,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        map[string]string{"path": "/var,log"},
+				Fields:      map[string]any{"read ops": int64(1), "msg": `a "b" c=d`},
+			},
+		},
+		{name: "no fields", line: `cpu,host=h1`, wantErr: true},
+		{name: "empty measurement", line: `,host=h1 v=1`, wantErr: true},
+		{name: "invalid tag", line: `cpu,host v=1`, wantErr: true},
+		{name: "invalid field", line: `cpu v`, wantErr: true},
+		{name: "invalid integer", line: `cpu v=1.5i`, wantErr: true},
+		{name: "not finite", line: `cpu v=NaN`, wantErr: true},
+		{name: "invalid timestamp", line: `cpu v=1 now`, wantErr: true},
+		{name: "extra section", line: `cpu v=1 1 2`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	points, err := Parse([]byte("# comment\ncpu v=1\n\n  mem v=2i  \n"))
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, "cpu", points[0].Measurement)
+	assert.Equal(t, "mem", points[1].Measurement)
+
+	_, err = Parse([]byte("cpu v=1\nmem\n"))
+	assert.ErrorIs(t, err, ErrInvalidLine)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestPoint_Metrics(t *testing.T) {
+	p := Point{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "h1", "1-core": "0"},
+		Fields:      map[string]any{"idle": 97.5, "procs": int64(12), "up": true, "state": "ok"},
+	}
+	labels := models.Labels{"host": "h1", "_1_core": "0"}
+	byName := func(metrics []models.Metrics) map[string]models.Metrics {
+		res := make(map[string]models.Metrics, len(metrics))
+		for _, m := range metrics {
+			res[m.Name] = m
+		}
+		return res
+	}
+
+	metrics, err := p.Metrics(models.Counter)
+	require.NoError(t, err)
+	got := byName(metrics)
+	require.Len(t, got, 3)
+	idle, procs, up := 97.5, int64(12), 1.0
+	assert.Equal(t, models.Metrics{Name: "cpu_idle", Type: models.Gauge, Labels: labels, FValue: &idle}, got["cpu_idle"])
+	assert.Equal(t, models.Metrics{Name: "cpu_procs", Type: models.Counter, Labels: labels, IValue: &procs}, got["cpu_procs"])
+	assert.Equal(t, models.Metrics{Name: "cpu_up", Type: models.Gauge, Labels: labels, FValue: &up}, got["cpu_up"])
+
+	metrics, err = p.Metrics(models.Gauge)
+	require.NoError(t, err)
+	fprocs := 12.0
+	assert.Equal(t, models.Metrics{Name: "cpu_procs", Type: models.Gauge, Labels: labels, FValue: &fprocs}, byName(metrics)["cpu_procs"])
+
+	_, err = p.Metrics(models.Histogram)
+	assert.ErrorIs(t, err, models.ErrInvalidType)
+
+	_, err = Point{Measurement: "big", Fields: map[string]any{"v": uint64(1 << 63)}}.Metrics(models.Counter)
+	assert.ErrorIs(t, err, ErrInvalidLine)
+}
@@ -0,0 +1,178 @@
+// Package ipfilter restricts access to server by client address in trusted subnets.
+//
+// Client address is taken from `X-Real-IP` header (`x-real-ip` metadata for gRPC),
+// which agent fills with address of its outbound interface. Connection address is used if header is missing.
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+)
+
+const (
+	Header      = "X-Real-IP"
+	MetadataKey = "x-real-ip"
+)
+
+var (
+	ErrNoSubnets = errors.New("no trusted subnets")
+)
+
+// Filter is a list of trusted subnets
+type Filter struct {
+	subnets []*net.IPNet
+}
+
+// New parses trusted subnets in CIDR notation, single address is treated as /32 or /128 subnet
+func New(cidrs ...string) (*Filter, error) {
+	f := &Filter{}
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			if ip := net.ParseIP(c); ip != nil && ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, subnet, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted subnet %s: %w", c, err)
+		}
+		f.subnets = append(f.subnets, subnet)
+	}
+	if len(f.subnets) == 0 {
+		return nil, ErrNoSubnets
+	}
+	return f, nil
+}
+
+// Contains checks ip is in one of trusted subnets
+func (f *Filter) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, s := range f.subnets {
+		if s.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns address from header value or connection address if header is empty
+func ClientIP(realIP, remoteAddr string) net.IP {
+	if realIP != "" {
+		return net.ParseIP(strings.TrimSpace(realIP))
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// Middleware rejects requests from clients outside of trusted subnets with 403/Forbidden
+func (f *Filter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r.Header.Get(Header), r.RemoteAddr)
+		if !f.Contains(ip) {
+			logger.Log().Warn().
+				Str("ip", ip.String()).
+				Str("remote", r.RemoteAddr).
+				Str("method", r.Method).
+				Str("url", r.URL.Path).
+				Msg("request from untrusted address rejected")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check verifies grpc client address is trusted, if method is restricted
+func (f *Filter) check(ctx context.Context, method string, methods []string) error {
+	if len(methods) > 0 {
+		restricted := false
+		for _, m := range methods {
+			if m == method {
+				restricted = true
+				break
+			}
+		}
+		if !restricted {
+			return nil
+		}
+	}
+	var realIP, remoteAddr string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(MetadataKey); len(v) > 0 {
+			realIP = v[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	ip := ClientIP(realIP, remoteAddr)
+	if !f.Contains(ip) {
+		logger.Log().Warn().
+			Str("ip", ip.String()).
+			Str("remote", remoteAddr).
+			Str("method", method).
+			Msg("request from untrusted address rejected")
+		return status.Error(codes.PermissionDenied, "untrusted address")
+	}
+	return nil
+}
+
+// UnaryServerInterceptor rejects calls of methods from clients outside of trusted subnets
+// with PermissionDenied. All methods are restricted if none are set.
+func (f *Filter) UnaryServerInterceptor(methods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := f.check(ctx, info.FullMethod, methods); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rejects streams of methods from clients outside of trusted subnets
+// with PermissionDenied. All methods are restricted if none are set.
+func (f *Filter) StreamServerInterceptor(methods ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := f.check(ss.Context(), info.FullMethod, methods); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// OutboundIP returns local address of interface used to connect to address.
+// No packets are sent, route is resolved by udp socket connect.
+func OutboundIP(address string) (net.IP, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	addr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unexpected local address %s", conn.LocalAddr())
+	}
+	return addr.IP, nil
+}
@@ -0,0 +1,118 @@
+package ipfilter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New()
+	assert.ErrorIs(t, err, ErrNoSubnets)
+	_, err = New("", " ")
+	assert.ErrorIs(t, err, ErrNoSubnets)
+	_, err = New("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = New("host")
+	assert.Error(t, err)
+
+	f, err := New("10.0.0.0/8", " 192.168.1.1", "fd00::/8")
+	require.NoError(t, err)
+	assert.True(t, f.Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, f.Contains(net.ParseIP("192.168.1.1")))
+	assert.False(t, f.Contains(net.ParseIP("192.168.1.2")))
+	assert.True(t, f.Contains(net.ParseIP("fd00::1")))
+	assert.False(t, f.Contains(net.ParseIP("fe80::1")))
+	assert.False(t, f.Contains(nil))
+}
+
+func TestFilter_Middleware(t *testing.T) {
+	f, err := New("10.0.0.0/24")
+	require.NoError(t, err)
+	handler := f.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		realIP     string
+		remoteAddr string
+		wantCode   int
+	}{
+		{
+			name:       "trusted header",
+			realIP:     "10.0.0.5",
+			remoteAddr: "172.16.0.1:5000",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "untrusted header",
+			realIP:     "10.0.1.5",
+			remoteAddr: "10.0.0.1:5000",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "invalid header",
+			realIP:     "localhost",
+			remoteAddr: "10.0.0.1:5000",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "trusted connection",
+			remoteAddr: "10.0.0.1:5000",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "untrusted connection",
+			remoteAddr: "172.16.0.1:5000",
+			wantCode:   http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set(Header, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestFilter_UnaryServerInterceptor(t *testing.T) {
+	f, err := New("10.0.0.0/24")
+	require.NoError(t, err)
+	interceptor := f.UnaryServerInterceptor("/restricted")
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	untrusted := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("172.16.0.1"), Port: 5000}})
+
+	// not restricted method
+	_, err = interceptor(untrusted, nil, &grpc.UnaryServerInfo{FullMethod: "/open"}, handler)
+	assert.NoError(t, err)
+
+	// untrusted peer
+	_, err = interceptor(untrusted, nil, &grpc.UnaryServerInfo{FullMethod: "/restricted"}, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// trusted metadata
+	ctx := metadata.NewIncomingContext(untrusted, metadata.Pairs(MetadataKey, "10.0.0.7"))
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/restricted"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestOutboundIP(t *testing.T) {
+	ip, err := OutboundIP("127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.True(t, ip.IsLoopback())
+}
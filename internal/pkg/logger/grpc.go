@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerAddr returns remote address of grpc call
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// UnaryServerInterceptor logs grpc unary calls the same way as LogRequestResponse
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	tStart := time.Now()
+	resp, err := handler(ctx, req)
+	log.Info().
+		Str("peer", peerAddr(ctx)).
+		Str("method", info.FullMethod).
+		Dur("ms_served", time.Since(tStart)).
+		Str("code", status.Code(err).String()).
+		Msg("grpc request")
+	return resp, err
+}
+
+// StreamServerInterceptor logs grpc stream calls
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	tStart := time.Now()
+	err := handler(srv, ss)
+	log.Info().
+		Str("peer", peerAddr(ss.Context())).
+		Str("method", info.FullMethod).
+		Dur("ms_served", time.Since(tStart)).
+		Str("code", status.Code(err).String()).
+		Msg("grpc stream")
+	return err
+}
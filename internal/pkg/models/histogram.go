@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// HistogramValue is a value of histogram metric type.
+// Bounds are ascending upper bounds of buckets, +Inf bucket is implicit.
+// Counts are non-cumulative observations count per bucket, len(Counts) = len(Bounds)+1, the last one is +Inf bucket.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []int64   `json:"counts"`
+	Count  int64     `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// NewHistogram creates empty histogram with buckets bounds
+func NewHistogram(bounds []float64) (h HistogramValue, err error) {
+	h.Bounds = append(make([]float64, 0, len(bounds)), bounds...)
+	h.Counts = make([]int64, len(bounds)+1)
+	return h, h.Validate()
+}
+
+// Validate checks histogram consistency: bounds are finite and strictly ascending,
+// counts match bounds and are not negative, total count matches buckets counts.
+func (h *HistogramValue) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: buckets counts do not match bounds", ErrInvalidValue)
+	}
+	for i, b := range h.Bounds {
+		if math.IsInf(b, 0) || math.IsNaN(b) {
+			return fmt.Errorf("%w: bucket bound should be finite", ErrInvalidValue)
+		}
+		if i > 0 && b <= h.Bounds[i-1] {
+			return fmt.Errorf("%w: bucket bounds should be ascending", ErrInvalidValue)
+		}
+	}
+	var total int64
+	for _, c := range h.Counts {
+		if c < 0 {
+			return fmt.Errorf("%w: bucket count should not be negative", ErrInvalidValue)
+		}
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("%w: total count does not match buckets counts", ErrInvalidValue)
+	}
+	if math.IsInf(h.Sum, 0) || math.IsNaN(h.Sum) {
+		return fmt.Errorf("%w: sum should be finite", ErrInvalidValue)
+	}
+	return nil
+}
+
+// Observe adds value to histogram, returns ErrInvalidValue if value is not finite
+func (h *HistogramValue) Observe(v float64) error {
+	return h.ObserveN(v, 1)
+}
+
+// ObserveN adds value observed n times to histogram, i.e. sampled value.
+// Not finite value would make sum invalid, it is not added and ErrInvalidValue is returned.
+func (h *HistogramValue) ObserveN(v float64, n int64) error {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return fmt.Errorf("%w: observed value should be finite", ErrInvalidValue)
+	}
+	i := 0
+	for i < len(h.Bounds) && v > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i] += n
+	h.Count += n
+	h.Sum += v * float64(n)
+	return nil
+}
+
+// SameBuckets returns true if histograms have the same buckets bounds, so they may be merged
+func (h *HistogramValue) SameBuckets(other HistogramValue) bool {
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return false
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge adds other histogram buckets counts, count and sum. Buckets bounds should match.
+func (h *HistogramValue) Merge(other HistogramValue) error {
+	if !h.SameBuckets(other) {
+		return ErrBucketsMismatch
+	}
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	return nil
+}
+
+// Copy returns histogram copy not sharing buckets slices
+func (h *HistogramValue) Copy() HistogramValue {
+	return HistogramValue{
+		Bounds: append(make([]float64, 0, len(h.Bounds)), h.Bounds...),
+		Counts: append(make([]int64, 0, len(h.Counts)), h.Counts...),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// String returns histogram as `bound:count,...,+Inf:count;sum`, i.e. `0.1:2,0.5:0,+Inf:1;1.25`
+func (h *HistogramValue) String() string {
+	var sb strings.Builder
+	for i, c := range h.Counts {
+		if i < len(h.Bounds) {
+			sb.WriteString(strconv.FormatFloat(h.Bounds[i], 'f', -1, 64))
+		} else {
+			sb.WriteString("+Inf")
+		}
+		sb.WriteByte(':')
+		sb.WriteString(strconv.FormatInt(c, 10))
+		if i < len(h.Counts)-1 {
+			sb.WriteByte(',')
+		}
+	}
+	sb.WriteByte(';')
+	sb.WriteString(strconv.FormatFloat(h.Sum, 'f', -1, 64))
+	return sb.String()
+}
+
+// ParseHistogram parses histogram from string in format returned by HistogramValue.String
+func ParseHistogram(s string) (h HistogramValue, err error) {
+	buckets, sum, ok := strings.Cut(s, ";")
+	if !ok {
+		return h, fmt.Errorf("%w: missing histogram sum", ErrInvalidValue)
+	}
+	if h.Sum, err = strconv.ParseFloat(sum, 64); err != nil {
+		return h, fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+	list := strings.Split(buckets, ",")
+	for i, bucket := range list {
+		bound, count, ok := strings.Cut(bucket, ":")
+		if !ok {
+			return h, fmt.Errorf("%w: invalid histogram bucket '%s'", ErrInvalidValue, bucket)
+		}
+		c, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return h, fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+		h.Counts = append(h.Counts, c)
+		h.Count += c
+		// +Inf is the last bucket
+		if i == len(list)-1 {
+			if bound != "+Inf" {
+				return h, fmt.Errorf("%w: the last histogram bucket should be +Inf", ErrInvalidValue)
+			}
+			continue
+		}
+		b, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			return h, fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+		h.Bounds = append(h.Bounds, b)
+	}
+	return h, h.Validate()
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h, err := NewHistogram([]float64{0.1, 0.5})
+	require.NoError(t, err)
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		require.NoError(t, h.Observe(v))
+	}
+	assert.Equal(t, []int64{2, 1, 1}, h.Counts)
+	assert.Equal(t, int64(4), h.Count)
+	assert.InDelta(t, 2.45, h.Sum, 1e-9)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogram_ObserveN(t *testing.T) {
+	h, err := NewHistogram([]float64{1})
+	require.NoError(t, err)
+	require.NoError(t, h.ObserveN(0.5, 10))
+	require.NoError(t, h.ObserveN(2, 1))
+	assert.Equal(t, []int64{10, 1}, h.Counts)
+	assert.Equal(t, int64(11), h.Count)
+	assert.InDelta(t, 7.0, h.Sum, 1e-9)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogram_ObserveNotFinite(t *testing.T) {
+	h, err := NewHistogram([]float64{1})
+	require.NoError(t, err)
+	require.NoError(t, h.Observe(0.5))
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		assert.ErrorIs(t, h.Observe(v), ErrInvalidValue, "value %v", v)
+		assert.ErrorIs(t, h.ObserveN(v, 10), ErrInvalidValue, "value %v", v)
+	}
+	// histogram is not changed
+	assert.Equal(t, []int64{1, 0}, h.Counts)
+	assert.Equal(t, int64(1), h.Count)
+	assert.Equal(t, 0.5, h.Sum)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	h := HistogramValue{Bounds: []float64{1}, Counts: []int64{1, 2}, Count: 3, Sum: 5}
+	require.NoError(t, h.Merge(HistogramValue{Bounds: []float64{1}, Counts: []int64{2, 0}, Count: 2, Sum: 1}))
+	assert.Equal(t, HistogramValue{Bounds: []float64{1}, Counts: []int64{3, 2}, Count: 5, Sum: 6}, h)
+
+	err := h.Merge(HistogramValue{Bounds: []float64{2}, Counts: []int64{1, 0}, Count: 1, Sum: 1})
+	assert.ErrorIs(t, err, ErrBucketsMismatch)
+	err = h.Merge(HistogramValue{Counts: []int64{1}, Count: 1, Sum: 1})
+	assert.ErrorIs(t, err, ErrBucketsMismatch)
+}
+
+func TestHistogram_Copy(t *testing.T) {
+	h := HistogramValue{Bounds: []float64{1}, Counts: []int64{1, 2}, Count: 3, Sum: 5}
+	c := h.Copy()
+	c.Counts[0] = 10
+	assert.Equal(t, int64(1), h.Counts[0])
+}
+
+func TestHistogram_ParseString(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    HistogramValue
+		wantErr bool
+	}{
+		{
+			name:  "valid histogram",
+			value: "0.1:2,0.5:0,+Inf:1;1.25",
+			want:  HistogramValue{Bounds: []float64{0.1, 0.5}, Counts: []int64{2, 0, 1}, Count: 3, Sum: 1.25},
+		},
+		{
+			name:  "only +Inf bucket",
+			value: "+Inf:2;-3",
+			want:  HistogramValue{Counts: []int64{2}, Count: 2, Sum: -3},
+		},
+		{name: "no sum", value: "0.1:2,+Inf:1", wantErr: true},
+		{name: "no +Inf bucket", value: "0.1:2,0.5:1;1", wantErr: true},
+		{name: "descending bounds", value: "0.5:2,0.1:1,+Inf:0;1", wantErr: true},
+		{name: "negative count", value: "0.1:-2,+Inf:1;1", wantErr: true},
+		{name: "invalid bucket", value: "0.1,+Inf:1;1", wantErr: true},
+		{name: "invalid sum", value: "+Inf:1;abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := ParseHistogram(tt.value)
+			if tt.wantErr {
+				assert.Truef(t, errors.Is(err, ErrInvalidValue), "Expect error '%v', got '%v'", ErrInvalidValue, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, h)
+			assert.Equal(t, tt.value, h.String())
+		})
+	}
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       HistogramValue
+		wantErr bool
+	}{
+		{name: "valid", h: HistogramValue{Bounds: []float64{1}, Counts: []int64{1, 2}, Count: 3, Sum: 5}},
+		{name: "empty", h: HistogramValue{}, wantErr: true},
+		{name: "counts mismatch", h: HistogramValue{Bounds: []float64{1}, Counts: []int64{1}, Count: 1}, wantErr: true},
+		{name: "total mismatch", h: HistogramValue{Bounds: []float64{1}, Counts: []int64{1, 2}, Count: 4}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.h.Validate())
+			} else {
+				assert.NoError(t, tt.h.Validate())
+			}
+		})
+	}
+}
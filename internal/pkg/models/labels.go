@@ -0,0 +1,95 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Labels is an optional set of metric dimensions, i.e. {"cpu": "3"}.
+// Metric series is identified by name, type and labels.
+type Labels map[string]string
+
+// Validate checks that label names match [a-zA-Z_][a-zA-Z0-9_]*
+func (l Labels) Validate() error {
+	for name := range l {
+		if name == "" {
+			return ErrInvalidLabel
+		}
+		for i, r := range name {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			case r >= '0' && r <= '9' && i > 0:
+			default:
+				return ErrInvalidLabel
+			}
+		}
+	}
+	return nil
+}
+
+// LabelName converts name to valid label name, invalid characters are replaced with underscore,
+// i.e. `service.name` is `service_name`
+func LabelName(name string) string {
+	return sanitizeName(name, false)
+}
+
+// MetricName converts name to valid prometheus metric name [a-zA-Z_:][a-zA-Z0-9_:]*,
+// invalid characters are replaced with underscore the same way as in LabelName
+func MetricName(name string) string {
+	return sanitizeName(name, true)
+}
+
+// sanitizeName replaces invalid name characters with underscore, name starting with digit is
+// prefixed with underscore. Colon is valid only if allowed.
+func sanitizeName(name string, colon bool) string {
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', colon && r == ':':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// String returns labels in canonical form {k1="v1",k2="v2"} sorted by label name.
+// Values are escaped the same way as in prometheus text format.
+// Empty labels set returns empty string.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(labelValueEscaper.Replace(l[name]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// SeriesKey returns unique key of metric series with name and labels
+func SeriesKey(name string, labels Labels) string {
+	return name + labels.String()
+}
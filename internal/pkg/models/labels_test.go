@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  Labels
+		wantErr error
+	}{
+		{name: "nil labels"},
+		{name: "valid labels", labels: Labels{"cpu": "1", "_host": "h1", "Core2": ""}},
+		{name: "empty name", labels: Labels{"": "1"}, wantErr: ErrInvalidLabel},
+		{name: "starts with digit", labels: Labels{"1cpu": "1"}, wantErr: ErrInvalidLabel},
+		{name: "invalid char", labels: Labels{"cpu.core": "1"}, wantErr: ErrInvalidLabel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.labels.Validate()
+			if tt.wantErr != nil {
+				assert.Truef(t, errors.Is(err, tt.wantErr), "Expect error '%v', got '%v'", tt.wantErr, err)
+				assert.Truef(t, errors.Is(err, ErrInvalidMetric), "Expect error '%v', got '%v'", ErrInvalidMetric, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestLabels_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels Labels
+		want   string
+	}{
+		{name: "nil labels", want: ""},
+		{name: "empty labels", labels: Labels{}, want: ""},
+		{name: "sorted labels", labels: Labels{"host": "h1", "cpu": "1"}, want: `{cpu="1",host="h1"}`},
+		{name: "escaped value", labels: Labels{"path": "C:\\dir\n\"a\""}, want: `{path="C:\\dir\n\"a\""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.labels.String())
+		})
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	assert.Equal(t, "cpu", SeriesKey("cpu", nil))
+	assert.Equal(t, `cpu{core="1"}`, SeriesKey("cpu", Labels{"core": "1"}))
+	assert.NotEqual(t, SeriesKey("cpu", Labels{"core": "1"}), SeriesKey("cpu", Labels{"core": "2"}))
+}
+
+func TestLabelName(t *testing.T) {
+	assert.Equal(t, "cpu", LabelName("cpu"))
+	assert.Equal(t, "service_name", LabelName("service.name"))
+	assert.Equal(t, "_1_core", LabelName("1-core"))
+	assert.NoError(t, Labels{LabelName("9.k8s/pod-name"): ""}.Validate())
+	assert.Equal(t, "http_requests", LabelName("http:requests"))
+}
+
+func TestMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Alloc", want: "Alloc"},
+		{name: "http:requests_total", want: "http:requests_total"},
+		{name: "cpu.util-1", want: "cpu_util_1"},
+		{name: "1st", want: "_1st"},
+		{name: "имя", want: "___"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MetricName(tt.name))
+		})
+	}
+}
@@ -14,6 +14,8 @@ const (
 	Counter = "counter"
 	// Gauge metric type is an indicator that stores the last received value
 	Gauge = "gauge"
+	// Histogram metric type is a distribution of received values over buckets, that sums on every update
+	Histogram = "histogram"
 )
 
 var (
@@ -21,12 +23,16 @@ var (
 	ErrInvalidName   = fmt.Errorf("%w: missing metric name", ErrInvalidMetric)
 	ErrInvalidType   = fmt.Errorf("%w: invalid metric type", ErrInvalidMetric)
 	ErrInvalidValue  = fmt.Errorf("%w: invalid metric value", ErrInvalidMetric)
+	ErrInvalidLabel  = fmt.Errorf("%w: invalid label name", ErrInvalidMetric)
+
+	ErrBucketsMismatch = fmt.Errorf("%w: histogram buckets mismatch", ErrInvalidMetric)
 )
 
 // MetricRequest is a struct for metrics requests
 type MetricRequest struct {
-	Name string `json:"id"`
-	Type string `json:"type"`
+	Name   string `json:"id"`
+	Type   string `json:"type"`
+	Labels Labels `json:"labels,omitempty"`
 }
 
 // NewMetricRequest is used to create MetricRequest struct from string values
@@ -41,6 +47,8 @@ func NewMetricRequest(n, t string) (m MetricRequest, err error) {
 		m.Type = Counter
 	case Gauge:
 		m.Type = Gauge
+	case Histogram:
+		m.Type = Histogram
 	default:
 		err = ErrInvalidType
 	}
@@ -61,20 +69,29 @@ func (m *MetricRequest) UnmarshalJSON(b []byte) error {
 	if _, err := NewMetricRequest(m.Name, m.Type); err != nil {
 		return err
 	}
-	return nil
+	return m.Labels.Validate()
 }
 
 // Metrics is universal struct for all supported metric types.
 // Should be used in updates and responses.
 type Metrics struct {
-	Name   string   `json:"id"`
-	Type   string   `json:"type"`
-	FValue *float64 `json:"value,omitempty"` // stores Gauge value
-	IValue *int64   `json:"delta,omitempty"` // stores Counter value
+	Name   string          `json:"id"`
+	Type   string          `json:"type"`
+	Labels Labels          `json:"labels,omitempty"`
+	FValue *float64        `json:"value,omitempty"`     // stores Gauge value
+	IValue *int64          `json:"delta,omitempty"`     // stores Counter value
+	HValue *HistogramValue `json:"histogram,omitempty"` // stores Histogram value
+}
+
+// TenantMetrics is a metric of tenant, it is used when metrics of many tenants are mixed, i.e. in dump.
+// Metrics of default tenant have empty tenant.
+type TenantMetrics struct {
+	Metrics
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // NewMetric is used to create Metrics struct from string values. Should be used in update requests.
-// Correct value is required.
+// Correct value is required. Histogram value format is described in HistogramValue.String.
 func NewMetric(n, t, v string) (m Metrics, err error) {
 	if _, err := NewMetricRequest(n, t); err != nil {
 		return m, err
@@ -95,6 +112,12 @@ func NewMetric(n, t, v string) (m Metrics, err error) {
 		} else {
 			m.FValue = &f
 		}
+	case Histogram:
+		if h, err := ParseHistogram(v); err != nil {
+			return m, err
+		} else {
+			m.HValue = &h
+		}
 	default:
 		err = ErrInvalidType
 	}
@@ -112,6 +135,10 @@ func (m *Metrics) StringVal() string {
 		if m.FValue != nil {
 			return strconv.FormatFloat(*m.FValue, 'f', -1, 64)
 		}
+	case Histogram:
+		if m.HValue != nil {
+			return m.HValue.String()
+		}
 	}
 	return ""
 }
@@ -127,18 +154,46 @@ func (m *Metrics) UnmarshalJSON(b []byte) error {
 	if err := json.Unmarshal(b, _m); err != nil {
 		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
 	}
+	return m.Validate()
+}
+
+// UnmarshalJSON validates metric data and reads its tenant
+func (m *TenantMetrics) UnmarshalJSON(b []byte) error {
+	if err := m.Metrics.UnmarshalJSON(b); err != nil {
+		return err
+	}
+	owner := struct {
+		Tenant string `json:"tenant"`
+	}{}
+	if err := json.Unmarshal(b, &owner); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMetric, err)
+	}
+	m.Tenant = owner.Tenant
+	return nil
+}
+
+// Validate checks metric has valid name, type, labels and the only value matching its type.
+func (m *Metrics) Validate() error {
 	if _, err := NewMetricRequest(m.Name, m.Type); err != nil {
 		return err
 	}
+	if err := m.Labels.Validate(); err != nil {
+		return err
+	}
 	switch m.Type {
 	case Counter:
-		if m.IValue == nil || m.FValue != nil {
+		if m.IValue == nil || m.FValue != nil || m.HValue != nil {
 			return ErrInvalidMetric
 		}
 	case Gauge:
-		if m.FValue == nil || m.IValue != nil {
+		if m.FValue == nil || m.IValue != nil || m.HValue != nil {
+			return ErrInvalidMetric
+		}
+	case Histogram:
+		if m.HValue == nil || m.IValue != nil || m.FValue != nil {
 			return ErrInvalidMetric
 		}
+		return m.HValue.Validate()
 	default:
 		return ErrInvalidType
 	}
@@ -268,6 +268,24 @@ func TestMetrics_UnmarshalJSON_Metrics(t *testing.T) {
 			wantType: Gauge,
 			wantErr:  ErrInvalidMetric,
 		},
+		{
+			name:     "histogram",
+			raw:      []byte(`{"id":"m","type":"histogram","histogram":{"bounds":[0.1],"counts":[1,2],"count":3,"sum":4.5}}`),
+			wantName: "m",
+			wantType: Histogram,
+			wantVal:  "0.1:1,+Inf:2;4.5",
+			wantErr:  nil,
+		},
+		{
+			name:    "histogram with invalid count",
+			raw:     []byte(`{"id":"m","type":"histogram","histogram":{"bounds":[0.1],"counts":[1,2],"count":2,"sum":4.5}}`),
+			wantErr: ErrInvalidMetric,
+		},
+		{
+			name:    "histogram with value",
+			raw:     []byte(`{"id":"m","type":"histogram","value":1}`),
+			wantErr: ErrInvalidMetric,
+		},
 
 		{
 			name:    "no name",
@@ -299,6 +317,24 @@ func TestMetrics_UnmarshalJSON_Metrics(t *testing.T) {
 			raw:     []byte(`{"id":"m","type":"counter","value":"asd"}`),
 			wantErr: ErrInvalidMetric,
 		},
+		{
+			name:     "gauge with labels",
+			raw:      []byte(`{"id":"m","type":"gauge","labels":{"cpu":"1"},"value":-0.119}`),
+			wantName: "m",
+			wantType: Gauge,
+			wantVal:  "-0.119",
+			wantErr:  nil,
+		},
+		{
+			name:    "invalid label name",
+			raw:     []byte(`{"id":"m","type":"gauge","labels":{"cpu-1":"1"},"value":-0.119}`),
+			wantErr: ErrInvalidLabel,
+		},
+		{
+			name:    "invalid label value",
+			raw:     []byte(`{"id":"m","type":"gauge","labels":{"cpu":1},"value":-0.119}`),
+			wantErr: ErrInvalidMetric,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -318,3 +354,23 @@ func TestMetrics_UnmarshalJSON_Metrics(t *testing.T) {
 		})
 	}
 }
+
+func TestTenantMetrics_JSON(t *testing.T) {
+	v := int64(10)
+	m := TenantMetrics{Metrics: Metrics{Name: "m", Type: Counter, IValue: &v}, Tenant: "team1"}
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"m","type":"counter","delta":10,"tenant":"team1"}`, string(b))
+
+	var got TenantMetrics
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, m, got)
+
+	// tenant of metric update is ignored
+	var update Metrics
+	require.NoError(t, json.Unmarshal(b, &update))
+	assert.Equal(t, m.Metrics, update)
+
+	var invalid TenantMetrics
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"id":"m","type":"counter","tenant":"team1"}`), &invalid), ErrInvalidMetric)
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Sample is a metric value at a point of time, used for metrics history
+type Sample struct {
+	TS    time.Time `json:"ts"`
+	Value float64   `json:"value"`
+}
+
+// SeriesUpdate is the last update time of metric series
+type SeriesUpdate struct {
+	MetricRequest
+	TS time.Time
+}
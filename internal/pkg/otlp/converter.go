@@ -0,0 +1,327 @@
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+const defaultStreamTTL = time.Hour
+
+var (
+	// DefaultResourceLabels are resource attributes, which become metrics labels
+	DefaultResourceLabels = []string{"service.name", "service.namespace"}
+
+	ErrUnsupported  = errors.New("unsupported metric type")
+	ErrInvalidPoint = errors.New("invalid data point")
+	ErrOutOfOrder   = errors.New("out of order data point")
+)
+
+// stream is a state of cumulative sum
+type stream struct {
+	start int64   // sum start time
+	time  int64   // time of the last point
+	value float64 // the last value
+	seen  time.Time
+}
+
+// resource is a prepared resource of request
+type resource struct {
+	labels   models.Labels // attributes to be labels
+	identity string        // all attributes, which identify streams
+	prefix   string        // metric name prefix
+}
+
+// Converter converts export requests to metrics.
+//
+// Cumulative sums are converted to deltas per stream. Stream is identified by tenant, metric name,
+// all resource attributes and data point attributes, it keeps the last value. The first point
+// of stream is a baseline: nothing is added to counter, unless stream start time is after converter
+// creation, then the whole value is a delta. Value decrease or start time change is a counter reset,
+// then the whole value is a delta. Streams, which are not updated for ttl, are forgotten.
+type Converter struct {
+	resourceLabels map[string]bool
+	nameAttribute  string
+	ttl            time.Duration
+	created        time.Time
+	mu             sync.Mutex
+	streams        map[string]stream
+	swept          time.Time
+}
+
+// NewConverter creates converter, by default DefaultResourceLabels are labels
+func NewConverter(opts ...func(c *Converter)) *Converter {
+	c := &Converter{
+		ttl:     defaultStreamTTL,
+		created: time.Now(),
+		streams: make(map[string]stream),
+	}
+	c.swept = c.created
+	WithResourceLabels(DefaultResourceLabels...)(c)
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// WithResourceLabels sets resource attributes, which become metrics labels, i.e. `service.name` is `service_name` label.
+// Other resource attributes only identify cumulative streams.
+func WithResourceLabels(keys ...string) func(c *Converter) {
+	return func(c *Converter) {
+		c.resourceLabels = make(map[string]bool, len(keys))
+		for _, k := range keys {
+			c.resourceLabels[k] = true
+		}
+	}
+}
+
+// WithNameAttribute sets resource attribute, which value prefixes metric names,
+// i.e. `checkout.http.server.requests` with `service.name`. The attribute is not a label then.
+func WithNameAttribute(key string) func(c *Converter) {
+	return func(c *Converter) {
+		c.nameAttribute = key
+	}
+}
+
+// WithStreamTTL sets period to keep state of cumulative streams after the last point
+func WithStreamTTL(d time.Duration) func(c *Converter) {
+	return func(c *Converter) {
+		if d > 0 {
+			c.ttl = d
+		}
+	}
+}
+
+// Len returns number of known cumulative streams
+func (c *Converter) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.streams)
+}
+
+// Convert converts request of tenant to metrics and passes them to update. Cumulative streams states
+// are changed only if update succeeds, so failed request may be retried. Converts are serialized.
+// Data points, which are not converted, are reported in PartialSuccess, it is nil if all points are converted.
+func (c *Converter) Convert(tenant string, req *ExportRequest, update func([]models.Metrics) error) (*PartialSuccess, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.sweep(now)
+
+	b := &batch{c: c, tenant: tenant, now: now, pending: make(map[string]stream)}
+	for _, rm := range req.ResourceMetrics {
+		res := c.resource(rm.Resource)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				b.add(res, m)
+			}
+		}
+	}
+	if len(b.metrics) > 0 {
+		if err := update(b.metrics); err != nil {
+			return nil, err
+		}
+	}
+	for k, s := range b.pending {
+		c.streams[k] = s
+	}
+	if b.rejected == 0 {
+		return nil, nil
+	}
+	return &PartialSuccess{RejectedDataPoints: b.rejected, ErrorMessage: b.err.Error()}, nil
+}
+
+// sweep forgets expired streams
+func (c *Converter) sweep(now time.Time) {
+	if now.Sub(c.swept) < c.ttl {
+		return
+	}
+	c.swept = now
+	for k, s := range c.streams {
+		if now.Sub(s.seen) >= c.ttl {
+			delete(c.streams, k)
+		}
+	}
+}
+
+func (c *Converter) resource(r Resource) resource {
+	var res resource
+	identity := make(models.Labels, len(r.Attributes))
+	for _, kv := range r.Attributes {
+		v, ok := kv.Value.Text()
+		if !ok {
+			continue
+		}
+		identity[kv.Key] = v
+		switch {
+		case kv.Key == c.nameAttribute:
+			res.prefix = v + "."
+		case c.resourceLabels[kv.Key]:
+			if res.labels == nil {
+				res.labels = make(models.Labels)
+			}
+			res.labels[models.LabelName(kv.Key)] = v
+		}
+	}
+	res.identity = identity.String()
+	return res
+}
+
+// batch is a result of single request conversion
+type batch struct {
+	c        *Converter
+	tenant   string
+	now      time.Time
+	metrics  []models.Metrics
+	pending  map[string]stream // changed streams
+	rejected int64
+	err      error // the first rejection reason
+}
+
+func (b *batch) reject(n int, err error) {
+	if n == 0 {
+		return
+	}
+	b.rejected += int64(n)
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// pointFunc converts valid data point value of stream with key
+type pointFunc func(key, name string, labels models.Labels, p NumberDataPoint, v float64) error
+
+func (b *batch) add(res resource, m Metric) {
+	if m.Name == "" {
+		b.reject(m.points(), fmt.Errorf("%w: missing metric name", ErrInvalidPoint))
+		return
+	}
+	name := res.prefix + m.Name
+	var (
+		points []NumberDataPoint
+		fn     pointFunc
+	)
+	switch {
+	case m.Gauge != nil:
+		points, fn = m.Gauge.DataPoints, b.gauge
+	case m.Sum != nil && m.Sum.AggregationTemporality == TemporalityDelta:
+		points, fn = m.Sum.DataPoints, b.delta(m.Sum.IsMonotonic)
+	case m.Sum != nil && m.Sum.AggregationTemporality == TemporalityCumulative:
+		points, fn = m.Sum.DataPoints, b.gauge
+		if m.Sum.IsMonotonic {
+			fn = b.cumulative
+		}
+	case m.Sum != nil:
+		b.reject(m.points(), fmt.Errorf("%w: metric '%s' sum has no aggregation temporality", ErrInvalidPoint, name))
+		return
+	default:
+		b.reject(m.points(), fmt.Errorf("%w: metric '%s'", ErrUnsupported, name))
+		return
+	}
+	for _, p := range points {
+		if err := b.point(res, name, p, fn); err != nil {
+			b.reject(1, err)
+		}
+	}
+}
+
+// point validates data point and converts it with fn
+func (b *batch) point(res resource, name string, p NumberDataPoint, fn pointFunc) error {
+	v, ok := p.Value()
+	if !ok {
+		return fmt.Errorf("%w: metric '%s' point has no value", ErrInvalidPoint, name)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%w: metric '%s' point value should be finite", ErrInvalidPoint, name)
+	}
+	var labels models.Labels
+	if len(res.labels)+len(p.Attributes) > 0 {
+		labels = make(models.Labels, len(res.labels)+len(p.Attributes))
+		for k, v := range res.labels {
+			labels[k] = v
+		}
+		for _, kv := range p.Attributes {
+			if v, ok := kv.Value.Text(); ok {
+				labels[models.LabelName(kv.Key)] = v
+			}
+		}
+	}
+	key := b.tenant + "\x00" + res.identity + "\x00" + models.SeriesKey(name, labels)
+	return fn(key, name, labels, p, v)
+}
+
+func (b *batch) gauge(_, name string, labels models.Labels, _ NumberDataPoint, v float64) error {
+	b.metrics = append(b.metrics, models.Metrics{Name: name, Type: models.Gauge, Labels: labels, FValue: &v})
+	return nil
+}
+
+// delta applies delta sum, monotonic sum should not be negative
+func (b *batch) delta(monotonic bool) pointFunc {
+	return func(_, name string, labels models.Labels, _ NumberDataPoint, v float64) error {
+		if monotonic && v < 0 {
+			return fmt.Errorf("%w: metric '%s' monotonic sum is negative", ErrInvalidPoint, name)
+		}
+		return b.counter(name, labels, v)
+	}
+}
+
+// cumulative converts cumulative sum to delta with the stream state
+func (b *batch) cumulative(key, name string, labels models.Labels, p NumberDataPoint, v float64) error {
+	if v < 0 {
+		return fmt.Errorf("%w: metric '%s' monotonic sum is negative", ErrInvalidPoint, name)
+	}
+	prev, ok := b.pending[key]
+	if !ok {
+		prev, ok = b.c.streams[key]
+	}
+	start, t := int64(p.StartTimeUnixNano), int64(p.TimeUnixNano)
+	var delta float64
+	switch {
+	case !ok:
+		if start > 0 && start >= b.c.created.UnixNano() {
+			delta = v
+		}
+	case t < prev.time:
+		return fmt.Errorf("%w: metric '%s'", ErrOutOfOrder, name)
+	case start != prev.start || v < prev.value:
+		delta = v
+	default:
+		// deltas of rounded values do not accumulate rounding error
+		delta = math.Round(v) - math.Round(prev.value)
+	}
+	if err := b.counter(name, labels, delta); err != nil {
+		return err
+	}
+	b.pending[key] = stream{start: start, time: t, value: v, seen: b.now}
+	return nil
+}
+
+func (b *batch) counter(name string, labels models.Labels, v float64) error {
+	if math.Abs(v) >= math.MaxInt64 {
+		return fmt.Errorf("%w: metric '%s' value overflows counter", ErrInvalidPoint, name)
+	}
+	delta := int64(math.Round(v))
+	b.metrics = append(b.metrics, models.Metrics{Name: name, Type: models.Counter, Labels: labels, IValue: &delta})
+	return nil
+}
+
+// points returns number of metric data points
+func (m Metric) points() int {
+	switch {
+	case m.Gauge != nil:
+		return len(m.Gauge.DataPoints)
+	case m.Sum != nil:
+		return len(m.Sum.DataPoints)
+	case m.Histogram != nil:
+		return len(m.Histogram.DataPoints)
+	case m.ExponentialHistogram != nil:
+		return len(m.ExponentialHistogram.DataPoints)
+	case m.Summary != nil:
+		return len(m.Summary.DataPoints)
+	}
+	return 0
+}
@@ -0,0 +1,180 @@
+package otlp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+// sumRequest returns request with single monotonic sum data point
+func sumRequest(t *testing.T, temporality string, start, ts int64, value string) *ExportRequest {
+	t.Helper()
+	data := fmt.Sprintf(`{"resourceMetrics":[{
+		"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"checkout"}},
+			{"key":"service.instance.id","value":{"stringValue":"i1"}}
+		]},
+		"scopeMetrics":[{"metrics":[{"name":"http.requests","sum":{
+			"aggregationTemporality":%q,"isMonotonic":true,
+			"dataPoints":[{"attributes":[{"key":"http.method","value":{"stringValue":"GET"}}],
+				"startTimeUnixNano":"%d","timeUnixNano":"%d","asInt":%s}]
+		}}]}]
+	}]}`, temporality, start, ts, value)
+	var req ExportRequest
+	require.NoError(t, json.Unmarshal([]byte(data), &req))
+	return &req
+}
+
+// convert returns metrics passed to update
+func convert(t *testing.T, c *Converter, tenant string, req *ExportRequest) ([]models.Metrics, *PartialSuccess) {
+	t.Helper()
+	var got []models.Metrics
+	partial, err := c.Convert(tenant, req, func(metrics []models.Metrics) error {
+		got = metrics
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+	return got, partial
+}
+
+// deltas returns counters deltas
+func deltas(metrics []models.Metrics) []int64 {
+	res := make([]int64, 0, len(metrics))
+	for _, m := range metrics {
+		res = append(res, *m.IValue)
+	}
+	return res
+}
+
+func TestConverter_Convert_Types(t *testing.T) {
+	data := `{"resourceMetrics":[{
+		"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"checkout"}},
+			{"key":"host.name","value":{"stringValue":"h1"}}
+		]},
+		"scopeMetrics":[{"metrics":[
+			{"name":"queue.size","gauge":{"dataPoints":[{"asInt":"5","attributes":[{"key":"queue","value":{"stringValue":"q1"}}]}]}},
+			{"name":"cpu.load","gauge":{"dataPoints":[{"asDouble":0.5}]}},
+			{"name":"sent.bytes","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":1024}]}},
+			{"name":"inflight","sum":{"aggregationTemporality":"AGGREGATION_TEMPORALITY_DELTA","dataPoints":[{"asDouble":-2}]}},
+			{"name":"connections","sum":{"aggregationTemporality":2,"dataPoints":[{"asInt":"7"}]}},
+			{"name":"latency","histogram":{"dataPoints":[{},{}]}},
+			{"name":"bad.gauge","gauge":{"dataPoints":[{"asDouble":"NaN"},{}]}},
+			{"name":"bad.sum","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":-1}]}}
+		]}]
+	}]}`
+	var req ExportRequest
+	require.NoError(t, json.Unmarshal([]byte(data), &req))
+
+	c := NewConverter(WithNameAttribute("service.name"), WithResourceLabels("host.name"))
+	got, partial := convert(t, c, "", &req)
+
+	labels := models.Labels{"host_name": "h1"}
+	want := []models.Metrics{
+		{Name: "checkout.connections", Type: models.Gauge, Labels: labels, FValue: pointer(7.0)},
+		{Name: "checkout.cpu.load", Type: models.Gauge, Labels: labels, FValue: pointer(0.5)},
+		{Name: "checkout.inflight", Type: models.Counter, Labels: labels, IValue: pointer(int64(-2))},
+		{Name: "checkout.queue.size", Type: models.Gauge, Labels: models.Labels{"host_name": "h1", "queue": "q1"}, FValue: pointer(5.0)},
+		{Name: "checkout.sent.bytes", Type: models.Counter, Labels: labels, IValue: pointer(int64(1024))},
+	}
+	assert.Equal(t, want, got)
+	require.NotNil(t, partial)
+	assert.Equal(t, int64(5), partial.RejectedDataPoints)
+	assert.Contains(t, partial.ErrorMessage, ErrUnsupported.Error())
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestConverter_Convert_Cumulative(t *testing.T) {
+	c := NewConverter()
+	before := time.Now().Add(-time.Hour).UnixNano()
+	labels := models.Labels{"service_name": "checkout", "http_method": "GET"}
+
+	// the first point of stream started before converter is a baseline
+	got, partial := convert(t, c, "", sumRequest(t, "AGGREGATION_TEMPORALITY_CUMULATIVE", before, 10, "100"))
+	assert.Nil(t, partial)
+	require.Len(t, got, 1)
+	assert.Equal(t, models.Metrics{Name: "http.requests", Type: models.Counter, Labels: labels, IValue: pointer(int64(0))}, got[0])
+	assert.Equal(t, 1, c.Len())
+
+	tests := []struct {
+		name    string
+		tenant  string
+		start   int64
+		time    int64
+		value   string
+		want    []int64
+		wantErr error
+	}{
+		{name: "increase", start: before, time: 20, value: "130", want: []int64{30}},
+		{name: "same value", start: before, time: 30, value: "130", want: []int64{0}},
+		{name: "out of order", start: before, time: 25, value: "120", want: []int64{}, wantErr: ErrOutOfOrder},
+		{name: "reset by value", start: before, time: 40, value: "5", want: []int64{5}},
+		{name: "reset by start", start: before + 1, time: 50, value: "8", want: []int64{8}},
+		{name: "increase after reset", start: before + 1, time: 60, value: "10", want: []int64{2}},
+		{name: "other tenant baseline", tenant: "t1", start: before, time: 60, value: "50", want: []int64{0}},
+		{name: "stream started after converter", tenant: "t2", start: time.Now().UnixNano(), time: 60, value: "50", want: []int64{50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, partial := convert(t, c, tt.tenant, sumRequest(t, "AGGREGATION_TEMPORALITY_CUMULATIVE", tt.start, tt.time, tt.value))
+			assert.Equal(t, tt.want, deltas(got))
+			if tt.wantErr != nil {
+				require.NotNil(t, partial)
+				assert.Contains(t, partial.ErrorMessage, tt.wantErr.Error())
+			} else {
+				assert.Nil(t, partial)
+			}
+		})
+	}
+}
+
+func TestConverter_Convert_UpdateFailed(t *testing.T) {
+	c := NewConverter()
+	start := time.Now().UnixNano()
+
+	_, err := c.Convert("", sumRequest(t, "AGGREGATION_TEMPORALITY_CUMULATIVE", start, 10, "100"), func([]models.Metrics) error {
+		return errors.New("error")
+	})
+	require.Error(t, err)
+	assert.Equal(t, 0, c.Len())
+
+	// retry is applied as the first point
+	got, _ := convert(t, c, "", sumRequest(t, "AGGREGATION_TEMPORALITY_CUMULATIVE", start, 10, "100"))
+	assert.Equal(t, []int64{100}, deltas(got))
+}
+
+func TestUnmarshal(t *testing.T) {
+	var p NumberDataPoint
+	require.NoError(t, json.Unmarshal([]byte(`{"timeUnixNano":"1700000000000000000","asDouble":"-Infinity"}`), &p))
+	assert.Equal(t, Int64(1700000000000000000), p.TimeUnixNano)
+	v, ok := p.Value()
+	assert.True(t, ok)
+	assert.Less(t, v, 0.0)
+
+	var s Sum
+	assert.Error(t, json.Unmarshal([]byte(`{"aggregationTemporality":"UNKNOWN"}`), &s))
+	assert.Error(t, json.Unmarshal([]byte(`{"dataPoints":[{"asInt":"1.5"}]}`), &s))
+
+	var kv KeyValue
+	require.NoError(t, json.Unmarshal([]byte(`{"key":"k","value":{"intValue":"42"}}`), &kv))
+	text, ok := kv.Value.Text()
+	assert.True(t, ok)
+	assert.Equal(t, "42", text)
+
+	b, err := json.Marshal(ExportResponse{PartialSuccess: &PartialSuccess{RejectedDataPoints: 2, ErrorMessage: "e"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"partialSuccess":{"rejectedDataPoints":"2","errorMessage":"e"}}`, string(b))
+}
+
+func pointer[T any](val T) *T {
+	return &val
+}
@@ -0,0 +1,190 @@
+// Package otlp converts OpenTelemetry metrics received over OTLP/HTTP in JSON encoding to metrics.
+//
+// Gauges are gauges, monotonic sums are counters: delta sums are applied as is,
+// cumulative sums are converted to deltas per stream, see Converter.
+// Non-monotonic cumulative sums are gauges, non-monotonic delta sums are counters.
+// Other metric types are not supported, their data points are rejected.
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Temporality is a sum aggregation temporality
+type Temporality int
+
+const (
+	TemporalityUnspecified Temporality = iota
+	TemporalityDelta
+	TemporalityCumulative
+)
+
+var temporalityNames = map[string]Temporality{
+	"AGGREGATION_TEMPORALITY_UNSPECIFIED": TemporalityUnspecified,
+	"AGGREGATION_TEMPORALITY_DELTA":       TemporalityDelta,
+	"AGGREGATION_TEMPORALITY_CUMULATIVE":  TemporalityCumulative,
+}
+
+// UnmarshalJSON accepts enum number or name
+func (t *Temporality) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var name string
+		if err := json.Unmarshal(b, &name); err != nil {
+			return err
+		}
+		v, ok := temporalityNames[name]
+		if !ok {
+			return fmt.Errorf("unknown aggregation temporality '%s'", name)
+		}
+		*t = v
+		return nil
+	}
+	var v int
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = Temporality(v)
+	return nil
+}
+
+// Int64 is a 64-bit integer, which is encoded as string in JSON, but number is accepted too
+type Int64 int64
+
+// UnmarshalJSON accepts quoted or unquoted integer
+func (i *Int64) UnmarshalJSON(b []byte) error {
+	v, err := strconv.ParseInt(string(bytes.Trim(b, `"`)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", b)
+	}
+	*i = Int64(v)
+	return nil
+}
+
+// Double is a float, which may be encoded as string in JSON: "NaN", "Infinity" and "-Infinity"
+type Double float64
+
+// UnmarshalJSON accepts number or quoted float
+func (d *Double) UnmarshalJSON(b []byte) error {
+	s := string(bytes.Trim(b, `"`))
+	switch s {
+	case "NaN":
+		*d = Double(math.NaN())
+	case "Infinity":
+		*d = Double(math.Inf(1))
+	case "-Infinity":
+		*d = Double(math.Inf(-1))
+	default:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid double %s", b)
+		}
+		*d = Double(v)
+	}
+	return nil
+}
+
+// ExportRequest is an ExportMetricsServiceRequest
+type ExportRequest struct {
+	ResourceMetrics []ResourceMetrics `json:"resourceMetrics"`
+}
+
+// ExportResponse is an ExportMetricsServiceResponse
+type ExportResponse struct {
+	PartialSuccess *PartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+// PartialSuccess reports number of rejected data points
+type PartialSuccess struct {
+	RejectedDataPoints int64  `json:"rejectedDataPoints,string"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+type ResourceMetrics struct {
+	Resource     Resource       `json:"resource"`
+	ScopeMetrics []ScopeMetrics `json:"scopeMetrics"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeMetrics struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+// Metric has one of data types set
+type Metric struct {
+	Name                 string      `json:"name"`
+	Gauge                *Gauge      `json:"gauge,omitempty"`
+	Sum                  *Sum        `json:"sum,omitempty"`
+	Histogram            *dataPoints `json:"histogram,omitempty"`
+	ExponentialHistogram *dataPoints `json:"exponentialHistogram,omitempty"`
+	Summary              *dataPoints `json:"summary,omitempty"`
+}
+
+type Gauge struct {
+	DataPoints []NumberDataPoint `json:"dataPoints"`
+}
+
+type Sum struct {
+	DataPoints             []NumberDataPoint `json:"dataPoints"`
+	AggregationTemporality Temporality       `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+// dataPoints of unsupported types are only counted
+type dataPoints struct {
+	DataPoints []json.RawMessage `json:"dataPoints"`
+}
+
+// NumberDataPoint has either AsDouble or AsInt value
+type NumberDataPoint struct {
+	Attributes        []KeyValue `json:"attributes"`
+	StartTimeUnixNano Int64      `json:"startTimeUnixNano"`
+	TimeUnixNano      Int64      `json:"timeUnixNano"`
+	AsDouble          *Double    `json:"asDouble,omitempty"`
+	AsInt             *Int64     `json:"asInt,omitempty"`
+}
+
+// Value returns data point value as float
+func (p NumberDataPoint) Value() (float64, bool) {
+	switch {
+	case p.AsDouble != nil:
+		return float64(*p.AsDouble), true
+	case p.AsInt != nil:
+		return float64(*p.AsInt), true
+	}
+	return 0, false
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue has one of scalar values set, arrays and maps are not supported
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *Int64  `json:"intValue,omitempty"`
+	DoubleValue *Double `json:"doubleValue,omitempty"`
+}
+
+// Text returns value as string, false if value is not a scalar
+func (v AnyValue) Text() (string, bool) {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue, true
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue), true
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10), true
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(float64(*v.DoubleValue), 'g', -1, 64), true
+	}
+	return "", false
+}
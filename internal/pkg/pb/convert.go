@@ -0,0 +1,111 @@
+package pb
+
+import (
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+// FromType converts models metric type to protobuf Type
+func FromType(t string) Type {
+	switch t {
+	case models.Counter:
+		return Type_TYPE_COUNTER
+	case models.Gauge:
+		return Type_TYPE_GAUGE
+	case models.Histogram:
+		return Type_TYPE_HISTOGRAM
+	default:
+		return Type_TYPE_UNSPECIFIED
+	}
+}
+
+// ToType converts protobuf Type to models metric type, unspecified type is an empty string
+func ToType(t Type) string {
+	switch t {
+	case Type_TYPE_COUNTER:
+		return models.Counter
+	case Type_TYPE_GAUGE:
+		return models.Gauge
+	case Type_TYPE_HISTOGRAM:
+		return models.Histogram
+	default:
+		return ""
+	}
+}
+
+// FromMetrics converts models.Metrics to protobuf Metric
+func FromMetrics(m models.Metrics) *Metric {
+	res := &Metric{
+		Name:   m.Name,
+		Type:   FromType(m.Type),
+		Labels: m.Labels,
+	}
+	switch {
+	case m.IValue != nil:
+		res.Value = &Metric_Delta{Delta: *m.IValue}
+	case m.FValue != nil:
+		res.Value = &Metric_Gauge{Gauge: *m.FValue}
+	case m.HValue != nil:
+		res.Value = &Metric_Histogram{Histogram: &Histogram{
+			Bounds: m.HValue.Bounds,
+			Counts: m.HValue.Counts,
+			Count:  m.HValue.Count,
+			Sum:    m.HValue.Sum,
+		}}
+	}
+	return res
+}
+
+// ToMetrics converts and validates protobuf Metric the same way as models.Metrics JSON is validated
+func ToMetrics(m *Metric) (models.Metrics, error) {
+	if m == nil {
+		return models.Metrics{}, models.ErrInvalidMetric
+	}
+	res := models.Metrics{
+		Name: m.GetName(),
+		Type: ToType(m.GetType()),
+	}
+	if len(m.GetLabels()) > 0 {
+		res.Labels = m.GetLabels()
+	}
+	switch v := m.GetValue().(type) {
+	case *Metric_Delta:
+		res.IValue = &v.Delta
+	case *Metric_Gauge:
+		res.FValue = &v.Gauge
+	case *Metric_Histogram:
+		if v.Histogram != nil {
+			res.HValue = &models.HistogramValue{
+				Bounds: v.Histogram.GetBounds(),
+				Counts: v.Histogram.GetCounts(),
+				Count:  v.Histogram.GetCount(),
+				Sum:    v.Histogram.GetSum(),
+			}
+		}
+	}
+	return res, res.Validate()
+}
+
+// ToMetricsSlice converts and validates slice of protobuf Metric
+func ToMetricsSlice(mm []*Metric) ([]models.Metrics, error) {
+	res := make([]models.Metrics, 0, len(mm))
+	for _, m := range mm {
+		metric, err := ToMetrics(m)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, metric)
+	}
+	return res, nil
+}
+
+// ToMetricRequest converts and validates protobuf MetricRequest
+func ToMetricRequest(r *MetricRequest) (models.MetricRequest, error) {
+	req, err := models.NewMetricRequest(r.GetName(), ToType(r.GetType()))
+	if err != nil {
+		return req, err
+	}
+	if len(r.GetLabels()) > 0 {
+		req.Labels = r.GetLabels()
+	}
+	return req, req.Labels.Validate()
+}
@@ -0,0 +1,51 @@
+package pb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+func TestMetricsConversion(t *testing.T) {
+	delta, value := int64(3), -0.5
+	tests := []struct {
+		name   string
+		metric models.Metrics
+	}{
+		{name: "counter", metric: models.Metrics{Name: "c1", Type: models.Counter, IValue: &delta}},
+		{name: "gauge", metric: models.Metrics{Name: "g1", Type: models.Gauge, Labels: models.Labels{"cpu": "1"}, FValue: &value}},
+		{name: "histogram", metric: models.Metrics{Name: "h1", Type: models.Histogram, HValue: &models.HistogramValue{
+			Bounds: []float64{0.1, 1}, Counts: []int64{1, 2, 0}, Count: 3, Sum: 1.2,
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToMetrics(FromMetrics(tt.metric))
+			require.NoError(t, err)
+			assert.Equal(t, tt.metric, got)
+		})
+	}
+}
+
+func TestToMetrics_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric *Metric
+	}{
+		{name: "nil"},
+		{name: "no name", metric: &Metric{Type: Type_TYPE_COUNTER, Value: &Metric_Delta{Delta: 1}}},
+		{name: "no type", metric: &Metric{Name: "m", Value: &Metric_Delta{Delta: 1}}},
+		{name: "no value", metric: &Metric{Name: "m", Type: Type_TYPE_GAUGE}},
+		{name: "value mismatch", metric: &Metric{Name: "m", Type: Type_TYPE_GAUGE, Value: &Metric_Delta{Delta: 1}}},
+		{name: "invalid label", metric: &Metric{Name: "m", Type: Type_TYPE_COUNTER, Labels: map[string]string{"1a": ""}, Value: &Metric_Delta{Delta: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ToMetrics(tt.metric)
+			assert.ErrorIs(t, err, models.ErrInvalidMetric)
+		})
+	}
+}
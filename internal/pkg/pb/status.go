@@ -0,0 +1,34 @@
+package pb
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BatchRejected is a reason of ErrorInfo detail of batch rejected by server handler
+const BatchRejected = "BATCH_REJECTED"
+
+// RejectBatch returns InvalidArgument error marked with BatchRejected detail:
+// batch will never be accepted and should not be resent
+func RejectBatch(msg string) error {
+	s, err := status.New(codes.InvalidArgument, msg).WithDetails(&errdetails.ErrorInfo{Reason: BatchRejected})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	return s.Err()
+}
+
+// IsBatchRejected checks error is returned by RejectBatch
+func IsBatchRejected(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.InvalidArgument {
+		return false
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetReason() == BatchRejected {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+// Package ratelimit limits rate of client requests with token buckets and size of request bodies.
+//
+// Client is identified by API key, then by agent id from `X-Agent-ID` header (`x-agent-id` metadata
+// for gRPC), so agents behind the same NAT have their own limits. Clients without both are identified
+// by connection address, IPv6 clients by /64 network. Limiter should be applied before authorization
+// to limit unauthorized requests too, so API key is not verified yet: request with unknown key is limited
+// by its own bucket and rejected by authorization.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+)
+
+const (
+	AgentHeader      = "X-Agent-ID"
+	AgentMetadataKey = "x-agent-id"
+	// sweepInterval is a period to forget buckets of idle clients
+	sweepInterval = time.Minute
+	// maxClients is a number of tracked clients, when reached the most idle client is forgotten
+	maxClients = 1 << 16
+)
+
+var (
+	ErrInvalidRate = errors.New("invalid rate limit")
+)
+
+// bucket is a token bucket of client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a set of token buckets per client. Bucket holds up to burst tokens
+// and refills with rate tokens per second, every request takes one token.
+type Limiter struct {
+	rate       float64
+	burst      float64
+	maxClients int
+	now        func() time.Time
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	lastSweep  time.Time
+}
+
+// New creates limiter allowing rate requests per second with bursts up to burst requests.
+// Burst is at least 1.
+func New(rate float64, burst int) (*Limiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRate, rate)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:       rate,
+		burst:      float64(burst),
+		maxClients: maxClients,
+		now:        time.Now,
+		buckets:    make(map[string]*bucket),
+	}, nil
+}
+
+// Allow takes token from client bucket. If bucket is empty, returns false and period to wait for the next token.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= l.maxClients {
+			l.evict(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets buckets, which are full again: they are the same as new ones
+func (l *Limiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// evict makes room for a new client: forgets full buckets, and if there are none, the most idle one
+func (l *Limiter) evict(now time.Time) {
+	l.sweep(now)
+	if len(l.buckets) < l.maxClients {
+		return
+	}
+	var idle string
+	var last time.Time
+	for client, b := range l.buckets {
+		if idle == "" || b.last.Before(last) {
+			idle, last = client, b.last
+		}
+	}
+	delete(l.buckets, idle)
+}
+
+// Len returns number of tracked clients
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// retryAfter returns wait period in whole seconds, at least 1
+func retryAfter(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
+
+// clientID identifies client by API key from authorization header value, agent id or connection address.
+// API key is identified by its hash not to keep secrets in memory.
+func clientID(auth, agentID, remoteAddr string) string {
+	if t := apikey.Token(auth); t != "" {
+		return "key:" + apikey.Hash(t)
+	}
+	if agentID != "" {
+		return "agent:" + agentID
+	}
+	return addrID(remoteAddr)
+}
+
+// addrID identifies client by connection address, IPv6 address by its /64 network
+func addrID(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return remoteAddr
+	}
+	if ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return ip.String()
+}
+
+// ClientID returns identity of request client
+func ClientID(r *http.Request) string {
+	return clientID(r.Header.Get(apikey.Header), r.Header.Get(AgentHeader), r.RemoteAddr)
+}
+
+// Middleware rejects requests of clients exceeded rate limit with 429/TooManyRequests.
+// `Retry-After` header tells client when the next request is allowed.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := ClientID(r)
+		if ok, wait := l.Allow(client); !ok {
+			logger.Log().Warn().
+				Str("client", client).
+				Str("remote", r.RemoteAddr).
+				Str("method", r.Method).
+				Str("url", r.URL.Path).
+				Msg("request rate limit exceeded")
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter(wait)))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check verifies grpc client has not exceeded rate limit
+func (l *Limiter) check(ctx context.Context, method string) error {
+	var auth, agentID, remoteAddr string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(apikey.MetadataKey); len(v) > 0 {
+			auth = v[0]
+		}
+		if v := md.Get(AgentMetadataKey); len(v) > 0 {
+			agentID = v[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	client := clientID(auth, agentID, remoteAddr)
+	if ok, wait := l.Allow(client); !ok {
+		logger.Log().Warn().
+			Str("client", client).
+			Str("remote", remoteAddr).
+			Str("method", method).
+			Msg("request rate limit exceeded")
+		return limitError(retryAfter(wait))
+	}
+	return nil
+}
+
+// limitError returns ResourceExhausted error with RetryInfo detail to tell client when the next call
+// is allowed. Detail distinguishes rate limit from other ResourceExhausted errors, i.e. message size limit.
+func limitError(sec int) error {
+	msg := fmt.Sprintf("rate limit exceeded, retry after %ds", sec)
+	s, err := status.New(codes.ResourceExhausted, msg).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Duration(sec) * time.Second),
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return s.Err()
+}
+
+// UnaryServerInterceptor rejects calls of clients exceeded rate limit with ResourceExhausted.
+// Error has RetryInfo detail with period to wait for the next call.
+func (l *Limiter) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := l.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor rejects streams of clients exceeded rate limit with ResourceExhausted.
+// Error has RetryInfo detail with period to wait for the next call.
+func (l *Limiter) StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// MaxBytes returns middleware limiting request body size to n bytes.
+// Requests with larger `Content-Length` are rejected with 413/RequestEntityTooLarge,
+// reading of larger body fails with *http.MaxBytesError.
+// Being applied after decompression it limits uncompressed body.
+func MaxBytes(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
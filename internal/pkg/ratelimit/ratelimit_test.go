@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/apikey"
+	"github.com/freepaddler/yap-metrics/internal/pkg/ipfilter"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(0, 1)
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	_, err = New(-1, 1)
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	l, err := New(1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, l.burst)
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	l, err := New(2, 3)
+	require.NoError(t, err)
+	l.now = func() time.Time { return now }
+
+	// burst is allowed
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("c1")
+		require.True(t, ok, "request %d", i)
+	}
+	ok, wait := l.Allow("c1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other clients have own buckets
+	ok, _ = l.Allow("c2")
+	assert.True(t, ok)
+
+	// bucket refills with rate
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("c1")
+	assert.True(t, ok)
+	ok, _ = l.Allow("c1")
+	assert.False(t, ok)
+
+	// full buckets are forgotten
+	assert.Equal(t, 2, l.Len())
+	now = now.Add(2 * sweepInterval)
+	ok, _ = l.Allow("c3")
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	l, err := New(0.1, 1)
+	require.NoError(t, err)
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	newReq := func(remote string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		r.RemoteAddr = remote
+		return r
+	}
+
+	assert.Equal(t, http.StatusOK, send(newReq("10.0.0.1:1000")).Code)
+	w := send(newReq("10.0.0.1:1001"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+
+	// real ip header does not change identity
+	r := newReq("10.0.0.1:1002")
+	r.Header.Set(ipfilter.Header, "10.0.0.2")
+	assert.Equal(t, http.StatusTooManyRequests, send(r).Code)
+	assert.Equal(t, http.StatusOK, send(newReq("10.0.0.2:1000")).Code)
+
+	// agents behind the same address have their own limits
+	agent := func(id string) *http.Request {
+		r := newReq("10.0.0.1:1003")
+		r.Header.Set(AgentHeader, id)
+		return r
+	}
+	assert.Equal(t, http.StatusOK, send(agent("agent1")).Code)
+	assert.Equal(t, http.StatusOK, send(agent("agent2")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(agent("agent1")).Code)
+}
+
+func TestClientID(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", clientID("", "", "10.0.0.1:1000"))
+	assert.Equal(t, "2001:db8:1:2::/64", clientID("", "", "[2001:db8:1:2:3:4:5:6]:1000"))
+	assert.Equal(t, clientID("", "", "[2001:db8:1:2::1]:1000"), clientID("", "", "[2001:db8:1:2::2]:1001"))
+	assert.Equal(t, "pipe", clientID("", "", "pipe"))
+	assert.Equal(t, "agent:agent1", clientID("", "agent1", "10.0.0.1:1000"))
+	// API key takes precedence, secret is not kept
+	id := clientID(apikey.Bearer("secret"), "agent1", "10.0.0.1:1000")
+	assert.Equal(t, "key:"+apikey.Hash("secret"), id)
+	assert.NotContains(t, id, "secret")
+	assert.Equal(t, id, clientID(apikey.Bearer("secret"), "agent2", "10.0.0.2:1000"))
+	// not bearer authorization is ignored
+	assert.Equal(t, "10.0.0.1", clientID("Basic dXNlcg==", "", "10.0.0.1:1000"))
+}
+
+func TestLimiter_evict(t *testing.T) {
+	now := time.Now()
+	l, err := New(1, 2)
+	require.NoError(t, err)
+	l.now = func() time.Time { return now }
+	l.maxClients = 2
+
+	l.Allow("c1")
+	now = now.Add(time.Millisecond)
+	l.Allow("c2")
+	l.Allow("c2")
+	// the most idle client is forgotten
+	now = now.Add(time.Millisecond)
+	l.Allow("c3")
+	assert.Equal(t, 2, l.Len())
+	assert.Contains(t, l.buckets, "c2")
+	assert.Contains(t, l.buckets, "c3")
+
+	// full buckets are forgotten first
+	now = now.Add(1500 * time.Millisecond)
+	l.Allow("c4")
+	assert.Equal(t, 2, l.Len())
+	assert.Contains(t, l.buckets, "c2")
+	assert.Contains(t, l.buckets, "c4")
+}
+
+func TestLimiter_UnaryServerInterceptor(t *testing.T) {
+	l, err := New(0.1, 1)
+	require.NoError(t, err)
+	handler := func(ctx context.Context, _ any) (any, error) { return nil, nil }
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	_, err = l.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	// agent has its own limit
+	agentCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(AgentMetadataKey, "agent1"))
+	_, err = l.UnaryServerInterceptor(agentCtx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	_, err = l.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	s := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, s.Code())
+	require.Len(t, s.Details(), 1)
+	info, ok := s.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok, "RetryInfo detail expected")
+	assert.Equal(t, 10*time.Second, info.GetRetryDelay().AsDuration())
+}
+
+func TestMaxBytes(t *testing.T) {
+	var readErr error
+	handler := MaxBytes(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantCode      int
+		wantErr       bool
+	}{
+		{name: "small body", body: "0123456789", contentLength: 10, wantCode: http.StatusOK},
+		{name: "large content length", body: "0123456789a", contentLength: 11, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "large body", body: "0123456789a", contentLength: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readErr = nil
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if tt.wantErr {
+				var maxErr *http.MaxBytesError
+				assert.ErrorAs(t, readErr, &maxErr)
+			} else {
+				assert.NoError(t, readErr)
+				assert.Equal(t, tt.wantCode, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package sign
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+)
+
+const (
+	// MetadataKey is gRPC metadata key for message signature
+	MetadataKey = "hashsha256"
+	// TimestampMetadataKey is gRPC metadata key for call unix time in seconds, see TimestampHeader
+	TimestampMetadataKey = "x-sign-timestamp"
+	// NonceMetadataKey is gRPC metadata key for random call id, see NonceHeader
+	NonceMetadataKey = "x-sign-nonce"
+)
+
+// marshal serializes protobuf message deterministically
+func marshal(msg any) ([]byte, error) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "%T is not a proto.Message", msg)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+// GetMessage returns signature of protobuf message, message is serialized deterministically
+func GetMessage(msg any, key string) (string, error) {
+	data, err := marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return Get(data, key), nil
+}
+
+// GetStampedMessage returns signature of protobuf message with timestamp and nonce, see GetStamped.
+// Stamp is sent in `x-sign-timestamp` and `x-sign-nonce` metadata.
+func GetStampedMessage(msg any, ts, nonce, key string) (string, error) {
+	data, err := marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return GetStamped(data, ts, nonce, key), nil
+}
+
+// callStamp returns timestamp and nonce of call from metadata
+func callStamp(md metadata.MD) (ts, nonce string) {
+	if v := md.Get(TimestampMetadataKey); len(v) > 0 {
+		ts = v[0]
+	}
+	if v := md.Get(NonceMetadataKey); len(v) > 0 {
+		nonce = v[0]
+	}
+	return ts, nonce
+}
+
+// callError returns status error of rejected call
+func callError(reason string) error {
+	switch reason {
+	case ReasonBusy:
+		return status.Error(codes.Unavailable, "unable to check signature nonce")
+	case ReasonMissing:
+		return status.Error(codes.Unauthenticated, "missing signature")
+	default:
+		return status.Errorf(codes.Unauthenticated, "invalid signature: %s", reason)
+	}
+}
+
+// rejectCall logs rejected gRPC call and calls reject hook
+func (v *Verifier) rejectCall(ctx context.Context, method, reason string) {
+	l := logger.Log().Warn().Str("reason", reason).Str("method", method)
+	if p, ok := peer.FromContext(ctx); ok {
+		l = l.Str("remote", p.Addr.String())
+	}
+	l.Msg("signed call rejected")
+	if v.onReject != nil {
+		v.onReject(reason)
+	}
+}
+
+// UnaryServerInterceptor checks signature of request and signs response the same way as Middleware.
+// Signature is verified only if key is set and request has `hashsha256` metadata.
+// Stamped calls are checked to be in allowed time skew and not replayed, calls are rejected
+// with Unauthenticated, or Unavailable if nonce cache is full.
+// Response signature is sent in `hashsha256` header.
+//
+// # Example
+//
+//	grpc.NewServer(grpc.ChainUnaryInterceptor(sign.UnaryServerInterceptor(key)))
+func UnaryServerInterceptor(key string) grpc.UnaryServerInterceptor {
+	return NewVerifier(key).UnaryServerInterceptor
+}
+
+// UnaryServerInterceptor checks signature of request and signs response
+func (v *Verifier) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	reqSign := md.Get(MetadataKey)
+	if v.key == "" || len(reqSign) == 0 {
+		return handler(ctx, req)
+	}
+	data, err := marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ts, nonce := callStamp(md)
+	reason := v.verifySign(reqSign[0], ts, nonce, data)
+	if reason == "" {
+		reason = v.useNonce(ts, nonce)
+	}
+	if reason != "" {
+		v.rejectCall(ctx, info.FullMethod, reason)
+		return nil, callError(reason)
+	}
+	logger.Log().Debug().Msg("signature validated")
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if respSign, err := GetMessage(resp, v.key); err == nil {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, respSign)); err != nil {
+			logger.Log().Warn().Err(err).Msg("unable to set signature header")
+		}
+	}
+	return resp, nil
+}
+
+// signedStream verifies every received message with signatures and stamp from stream metadata
+type signedStream struct {
+	grpc.ServerStream
+	v         *Verifier
+	method    string
+	signs     []string
+	ts, nonce string
+	n         int
+}
+
+// RecvMsg receives message and verifies it with the next signature in order
+func (s *signedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.n >= len(s.signs) {
+		s.v.rejectCall(s.Context(), s.method, ReasonMissing)
+		return callError(ReasonMissing)
+	}
+	data, err := marshal(m)
+	if err != nil {
+		return err
+	}
+	reason := s.v.verifySign(s.signs[s.n], s.ts, s.nonce, data)
+	// stream nonce is used once with the first message
+	if reason == "" && s.n == 0 {
+		reason = s.v.useNonce(s.ts, s.nonce)
+	}
+	if reason != "" {
+		s.v.rejectCall(s.Context(), s.method, reason)
+		return callError(reason)
+	}
+	s.n++
+	return nil
+}
+
+// SendMsg signs response in `hashsha256` header
+func (s *signedStream) SendMsg(m any) error {
+	if respSign, err := GetMessage(m, s.v.key); err == nil {
+		if err := s.SetHeader(metadata.Pairs(MetadataKey, respSign)); err != nil {
+			logger.Log().Warn().Err(err).Msg("unable to set signature header")
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// StreamServerInterceptor checks signatures of client stream messages.
+// Stream `hashsha256` metadata should have a signature for every message in the order they are sent,
+// so client has to prepare all messages before opening stream. All messages are signed with the same stamp
+// from stream metadata, stamp is checked the same way as by UnaryServerInterceptor.
+// Signatures are verified only if key is set and stream has `hashsha256` metadata.
+//
+// # Example
+//
+//	grpc.NewServer(grpc.ChainStreamInterceptor(sign.StreamServerInterceptor(key)))
+func StreamServerInterceptor(key string) grpc.StreamServerInterceptor {
+	return NewVerifier(key).StreamServerInterceptor
+}
+
+// StreamServerInterceptor checks signatures of client stream messages
+func (v *Verifier) StreamServerInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	signs := md.Get(MetadataKey)
+	if v.key == "" || len(signs) == 0 {
+		return handler(srv, ss)
+	}
+	ts, nonce := callStamp(md)
+	return handler(srv, &signedStream{ServerStream: ss, v: v, method: info.FullMethod, signs: signs, ts: ts, nonce: nonce})
+}
+
+// requireCall rejects unsigned call of method if key is set and method is restricted
+func (v *Verifier) requireCall(ctx context.Context, method string, methods []string) error {
+	if v.key == "" {
+		return nil
+	}
+	if len(methods) > 0 {
+		restricted := false
+		for _, m := range methods {
+			if m == method {
+				restricted = true
+				break
+			}
+		}
+		if !restricted {
+			return nil
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get(MetadataKey)) == 0 {
+		v.rejectCall(ctx, method, ReasonMissing)
+		return callError(ReasonMissing)
+	}
+	return nil
+}
+
+// RequireUnaryServerInterceptor rejects unsigned calls of methods with Unauthenticated if key is set,
+// the same way as Require. All methods are restricted if none are set.
+// Signature itself is checked by UnaryServerInterceptor.
+//
+// # Example
+//
+//	v := sign.NewVerifier(key)
+//	grpc.NewServer(grpc.ChainUnaryInterceptor(v.RequireUnaryServerInterceptor(pb.Metrics_Update_FullMethodName), v.UnaryServerInterceptor))
+func (v *Verifier) RequireUnaryServerInterceptor(methods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := v.requireCall(ctx, info.FullMethod, methods); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RequireStreamServerInterceptor rejects unsigned streams of methods with Unauthenticated if key is set.
+// All methods are restricted if none are set.
+func (v *Verifier) RequireStreamServerInterceptor(methods ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := v.requireCall(ss.Context(), info.FullMethod, methods); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,263 @@
+package sign
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	req := wrapperspb.String("this is a request")
+	key1, key2 := "key1", "key2"
+	sign1, err := GetMessage(req, key1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		serverKey string
+		md        metadata.MD
+		wantCode  codes.Code
+		wantCall  bool
+	}{
+		{name: "no key no sign", wantCode: codes.OK, wantCall: true},
+		{name: "key without sign", serverKey: key1, wantCode: codes.OK, wantCall: true},
+		{name: "sign without key", md: metadata.Pairs(MetadataKey, sign1), wantCode: codes.OK, wantCall: true},
+		{name: "valid sign", serverKey: key1, md: metadata.Pairs(MetadataKey, sign1), wantCode: codes.OK, wantCall: true},
+		{name: "invalid sign", serverKey: key2, md: metadata.Pairs(MetadataKey, sign1), wantCode: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			called := false
+			handler := func(ctx context.Context, req any) (any, error) {
+				called = true
+				return req, nil
+			}
+			_, err := UnaryServerInterceptor(tt.serverKey)(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCall, called)
+		})
+	}
+}
+
+func TestVerifier_UnaryServerInterceptorStamp(t *testing.T) {
+	req := wrapperspb.String("this is a request")
+	key := "key"
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	stamped := func(ts, nonce string) metadata.MD {
+		s, err := GetStampedMessage(req, ts, nonce, key)
+		require.NoError(t, err)
+		return metadata.Pairs(MetadataKey, s, TimestampMetadataKey, ts, NonceMetadataKey, nonce)
+	}
+	unsigned, err := GetMessage(req, key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		md         metadata.MD
+		wantCode   codes.Code
+		wantReject string
+	}{
+		{name: "stamped", md: stamped(ts, "n1"), wantCode: codes.OK},
+		{name: "replay", md: stamped(ts, "n1"), wantCode: codes.Unauthenticated, wantReject: ReasonReplay},
+		{name: "stale", md: stamped(strconv.FormatInt(now.Add(-time.Hour).Unix(), 10), "n2"), wantCode: codes.Unauthenticated, wantReject: ReasonStale},
+		{name: "stamp not signed", md: metadata.Join(metadata.Pairs(MetadataKey, unsigned), metadata.Pairs(TimestampMetadataKey, ts, NonceMetadataKey, "n3")), wantCode: codes.Unauthenticated, wantReject: ReasonInvalid},
+		{name: "no stamp", md: metadata.Pairs(MetadataKey, unsigned), wantCode: codes.Unauthenticated, wantReject: ReasonNoStamp},
+		{name: "cache is full", md: stamped(ts, "n4"), wantCode: codes.Unavailable, wantReject: ReasonBusy},
+	}
+	var rejected string
+	v := NewVerifier(key, WithRequireStamp(true), WithNonceCache(1), WithRejectHook(func(reason string) { rejected = reason }))
+	v.now = func() time.Time { return now }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected = ""
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+			_, err := v.UnaryServerInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantReject, rejected)
+		})
+	}
+}
+
+// testStream is a server stream returning messages in order
+type testStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	msgs   []string
+	header metadata.MD
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func (s *testStream) RecvMsg(m any) error {
+	m.(*wrapperspb.StringValue).Value = s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+func (s *testStream) SendMsg(any) error { return nil }
+
+func (s *testStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	key := "key"
+	msgs := []string{"msg1", "msg2"}
+	signs := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		s, err := GetMessage(wrapperspb.String(m), key)
+		require.NoError(t, err)
+		signs = append(signs, s)
+	}
+
+	tests := []struct {
+		name     string
+		signs    []string
+		wantCode codes.Code
+	}{
+		{name: "all signed", signs: signs, wantCode: codes.OK},
+		{name: "not signed", wantCode: codes.OK},
+		{name: "missing sign", signs: signs[:1], wantCode: codes.Unauthenticated},
+		{name: "wrong order", signs: []string{signs[1], signs[0]}, wantCode: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if len(tt.signs) > 0 {
+				md.Append(MetadataKey, tt.signs...)
+			}
+			ss := &testStream{ctx: metadata.NewIncomingContext(context.Background(), md), msgs: msgs}
+			handler := func(_ any, stream grpc.ServerStream) error {
+				for range msgs {
+					if err := stream.RecvMsg(new(wrapperspb.StringValue)); err != nil {
+						return err
+					}
+				}
+				return stream.SendMsg(wrapperspb.String("response"))
+			}
+			err := StreamServerInterceptor(key)(nil, ss, &grpc.StreamServerInfo{FullMethod: "/test"}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK && len(tt.signs) > 0 {
+				respSign, _ := GetMessage(wrapperspb.String("response"), key)
+				assert.Equal(t, []string{respSign}, ss.header.Get(MetadataKey))
+			}
+		})
+	}
+}
+
+func TestVerifier_StreamServerInterceptorStamp(t *testing.T) {
+	key := "key"
+	msgs := []string{"msg1", "msg2"}
+	ts, nonce := NewStamp()
+	md := metadata.Pairs(TimestampMetadataKey, ts, NonceMetadataKey, nonce)
+	for _, m := range msgs {
+		s, err := GetStampedMessage(wrapperspb.String(m), ts, nonce, key)
+		require.NoError(t, err)
+		md.Append(MetadataKey, s)
+	}
+	v := NewVerifier(key)
+	handler := func(_ any, stream grpc.ServerStream) error {
+		for range msgs {
+			if err := stream.RecvMsg(new(wrapperspb.StringValue)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	call := func() error {
+		ss := &testStream{ctx: metadata.NewIncomingContext(context.Background(), md), msgs: msgs}
+		return v.StreamServerInterceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: "/test"}, handler)
+	}
+	require.NoError(t, call())
+	// stream replay is rejected
+	assert.Equal(t, codes.Unauthenticated, status.Code(call()))
+}
+
+func TestVerifier_RequireUnaryServerInterceptor(t *testing.T) {
+	req := wrapperspb.String("this is a request")
+	key := "key"
+	signed, err := GetMessage(req, key)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		serverKey  string
+		method     string
+		md         metadata.MD
+		wantCode   codes.Code
+		wantReject string
+	}{
+		{name: "no key", method: "/write", wantCode: codes.OK},
+		{name: "signed", serverKey: key, method: "/write", md: metadata.Pairs(MetadataKey, signed), wantCode: codes.OK},
+		{name: "unsigned", serverKey: key, method: "/write", wantCode: codes.Unauthenticated, wantReject: ReasonMissing},
+		{name: "unsigned not restricted", serverKey: key, method: "/read", wantCode: codes.OK},
+		{name: "invalid sign", serverKey: key, method: "/write", md: metadata.Pairs(MetadataKey, "invalid"), wantCode: codes.Unauthenticated, wantReject: ReasonInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rejected string
+			v := NewVerifier(tt.serverKey, WithRejectHook(func(reason string) { rejected = reason }))
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			handler := func(ctx context.Context, req any) (any, error) {
+				return req, nil
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+			// signature is checked after requirement, as in server interceptors chain
+			_, err := v.RequireUnaryServerInterceptor("/write")(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return v.UnaryServerInterceptor(ctx, req, info, handler)
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantReject, rejected)
+		})
+	}
+}
+
+func TestVerifier_RequireStreamServerInterceptor(t *testing.T) {
+	v := NewVerifier("key")
+	handler := func(any, grpc.ServerStream) error { return nil }
+	ss := &testStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.MD{})}
+
+	err := v.RequireStreamServerInterceptor("/push")(nil, ss, &grpc.StreamServerInfo{FullMethod: "/push"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	err = v.RequireStreamServerInterceptor("/push")(nil, ss, &grpc.StreamServerInfo{FullMethod: "/list"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestMissingSignatureCode(t *testing.T) {
+	key := "key"
+	v := NewVerifier(key)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+
+	// unsigned call rejected by Require interceptor
+	handler := func(ctx context.Context, req any) (any, error) { return req, nil }
+	_, requireErr := v.RequireUnaryServerInterceptor()(ctx, wrapperspb.String("msg"), &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+
+	// stream message without signature rejected by verifying interceptor
+	sign1, err := GetMessage(wrapperspb.String("msg1"), key)
+	require.NoError(t, err)
+	ss := &testStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, sign1)), msgs: []string{"msg1", "msg2"}}
+	verifyErr := v.StreamServerInterceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: "/test"}, func(_ any, stream grpc.ServerStream) error {
+		for i := 0; i < 2; i++ {
+			if err := stream.RecvMsg(new(wrapperspb.StringValue)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(requireErr))
+	assert.Equal(t, codes.Unauthenticated, status.Code(verifyErr))
+}
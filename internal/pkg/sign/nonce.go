@@ -0,0 +1,85 @@
+package sign
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNonceUsed      = errors.New("nonce was already used")
+	ErrNonceCacheFull = errors.New("nonce cache is full")
+)
+
+// NonceCache remembers request nonces until they expire. Cache size is limited:
+// if it is full of not expired nonces, new nonces are not accepted, evicting them would allow replays.
+// Size should be at least the rate of stamped requests multiplied by the period nonces are kept.
+type NonceCache struct {
+	mu    sync.Mutex
+	size  int
+	seen  map[string]time.Time
+	queue []nonceEntry // nonces in order of adding
+}
+
+type nonceEntry struct {
+	nonce  string
+	expire time.Time
+}
+
+// NewNonceCache returns cache of size nonces
+func NewNonceCache(size int) *NonceCache {
+	if size < 1 {
+		size = 1
+	}
+	return &NonceCache{
+		size: size,
+		seen: make(map[string]time.Time, size),
+	}
+}
+
+// Add adds nonce valid until expire. Returns ErrNonceUsed if nonce is already in cache
+// and ErrNonceCacheFull if there is no room for nonce.
+func (c *NonceCache) Add(nonce string, now, expire time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// evict expired nonces in order of adding
+	for len(c.queue) > 0 && !c.queue[0].expire.After(now) {
+		c.evict(c.queue[0])
+		c.queue = c.queue[1:]
+	}
+	if exp, ok := c.seen[nonce]; ok && exp.After(now) {
+		return ErrNonceUsed
+	}
+	if len(c.queue) >= c.size {
+		// nonces expire out of adding order, look for all expired ones
+		live := c.queue[:0]
+		for _, e := range c.queue {
+			if e.expire.After(now) {
+				live = append(live, e)
+			} else {
+				c.evict(e)
+			}
+		}
+		c.queue = live
+		if len(c.queue) >= c.size {
+			return ErrNonceCacheFull
+		}
+	}
+	c.seen[nonce] = expire
+	c.queue = append(c.queue, nonceEntry{nonce: nonce, expire: expire})
+	return nil
+}
+
+// evict forgets nonce of entry, unless it was added again with other expiration
+func (c *NonceCache) evict(e nonceEntry) {
+	if c.seen[e.nonce].Equal(e.expire) {
+		delete(c.seen, e.nonce)
+	}
+}
+
+// Len returns number of nonces in cache
+func (c *NonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
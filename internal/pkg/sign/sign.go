@@ -1,19 +1,37 @@
 // Package sign implements methods to sign and validate http requests and responses.
 // Response or request bodies are signed with HMAC SHA-256 hash with symmetric key.
 // Hash is placed to HTTP header `HashSHA256`.
+//
+// To protect from replays, request may be stamped with timestamp and random nonce headers,
+// which are signed together with body, see GetStamped.
 package sign
 
 import (
 	"bytes"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 )
 
+const (
+	// TimestampHeader is a request unix time in seconds
+	TimestampHeader = "X-Sign-Timestamp"
+	// NonceHeader is a random request id
+	NonceHeader = "X-Sign-Nonce"
+
+	defaultSkew       = 5 * time.Minute
+	defaultNonceCache = 100000
+)
+
 // Get returns base64 encoded HMAC SHA-256 hash from []byte
 func Get(data []byte, key string) string {
 	hash := hmac.New(sha256.New, []byte(key))
@@ -21,6 +39,156 @@ func Get(data []byte, key string) string {
 	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
 }
 
+// GetStamped returns base64 encoded HMAC SHA-256 hash of timestamp, nonce and data
+func GetStamped(data []byte, ts, nonce, key string) string {
+	hash := hmac.New(sha256.New, []byte(key))
+	hash.Write([]byte(ts + "\n" + nonce + "\n"))
+	hash.Write(data)
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
+
+// NewStamp returns current timestamp and random nonce for request
+func NewStamp() (ts, nonce string) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(b)
+}
+
+// Request reject reasons
+const (
+	ReasonMissing = "missing"  // request is not signed
+	ReasonInvalid = "invalid"  // signature mismatch
+	ReasonNoStamp = "no_stamp" // signed request has no required timestamp and nonce
+	ReasonStale   = "stale"    // request timestamp is out of allowed skew
+	ReasonReplay  = "replay"   // request nonce was already used
+	ReasonBusy    = "busy"     // nonce cache is full, request nonce can't be checked
+)
+
+// Verifier is a request signature verification settings
+type Verifier struct {
+	key          string
+	skew         time.Duration
+	requireStamp bool
+	nonces       *NonceCache
+	now          func() time.Time
+	onReject     func(reason string)
+}
+
+// NewVerifier creates request signature verifier with key
+func NewVerifier(key string, opts ...func(*Verifier)) *Verifier {
+	v := &Verifier{
+		key:  key,
+		skew: defaultSkew,
+		now:  time.Now,
+	}
+	for _, o := range opts {
+		o(v)
+	}
+	if v.nonces == nil {
+		v.nonces = NewNonceCache(defaultNonceCache)
+	}
+	return v
+}
+
+// WithRejectHook sets function called on every rejected HTTP request or gRPC call with reject reason,
+// i.e. to count rejected requests
+func WithRejectHook(fn func(reason string)) func(*Verifier) {
+	return func(v *Verifier) {
+		v.onReject = fn
+	}
+}
+
+// reject logs rejected request and calls reject hook
+func (v *Verifier) reject(r *http.Request, reason string) {
+	logger.Log().Warn().
+		Str("reason", reason).
+		Str("remote", r.RemoteAddr).
+		Str("method", r.Method).
+		Str("url", r.URL.Path).
+		Msg("signed request rejected")
+	if v.onReject != nil {
+		v.onReject(reason)
+	}
+}
+
+// WithSkew sets allowed difference between request timestamp and server time
+func WithSkew(d time.Duration) func(*Verifier) {
+	return func(v *Verifier) {
+		if d > 0 {
+			v.skew = d
+		}
+	}
+}
+
+// WithNonceCache sets number of remembered nonces. Stamped requests are rejected if cache is full,
+// so size should be at least the rate of stamped requests per second multiplied by 2*skew in seconds.
+func WithNonceCache(size int) func(*Verifier) {
+	return func(v *Verifier) {
+		if size > 0 {
+			v.nonces = NewNonceCache(size)
+		}
+	}
+}
+
+// WithRequireStamp rejects signed requests without timestamp and nonce
+func WithRequireStamp(require bool) func(*Verifier) {
+	return func(v *Verifier) {
+		v.requireStamp = require
+	}
+}
+
+// verify checks request signature and stamp, returns reject reason or empty string if request is valid
+func (v *Verifier) verify(h http.Header, body []byte) string {
+	ts, nonce := h.Get(TimestampHeader), h.Get(NonceHeader)
+	if reason := v.verifySign(h.Get("HashSHA256"), ts, nonce, body); reason != "" {
+		return reason
+	}
+	return v.useNonce(ts, nonce)
+}
+
+// verifySign checks signature of data and timestamp of stamped signature,
+// returns reject reason or empty string if signature is valid. Nonce is not checked, see useNonce.
+func (v *Verifier) verifySign(reqSign, ts, nonce string, data []byte) string {
+	if ts == "" && nonce == "" {
+		if v.requireStamp {
+			return ReasonNoStamp
+		}
+		if !hmac.Equal([]byte(reqSign), []byte(Get(data, v.key))) {
+			return ReasonInvalid
+		}
+		return ""
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || nonce == "" {
+		return ReasonInvalid
+	}
+	now := v.now()
+	reqTime := time.Unix(unix, 0)
+	if reqTime.Before(now.Add(-v.skew)) || reqTime.After(now.Add(v.skew)) {
+		return ReasonStale
+	}
+	if !hmac.Equal([]byte(reqSign), []byte(GetStamped(data, ts, nonce, v.key))) {
+		return ReasonInvalid
+	}
+	return ""
+}
+
+// useNonce remembers nonce of stamp with valid signature, returns reject reason if nonce was already used.
+// Nonce is not needed after timestamp is out of skew. Unstamped requests are not checked.
+func (v *Verifier) useNonce(ts, nonce string) string {
+	if ts == "" && nonce == "" {
+		return ""
+	}
+	unix, _ := strconv.ParseInt(ts, 10, 64)
+	switch err := v.nonces.Add(nonce, v.now(), time.Unix(unix, 0).Add(v.skew)); {
+	case errors.Is(err, ErrNonceCacheFull):
+		return ReasonBusy
+	case err != nil:
+		return ReasonReplay
+	}
+	return ""
+}
+
 // RespWrapper replaces http ResponseWriter Write method
 type RespWrapper struct {
 	http.ResponseWriter
@@ -43,48 +211,82 @@ func (rw RespWrapper) Write(b []byte) (int, error) {
 	return rw.ResponseWriter.Write(b)
 }
 
-// Middleware to check signature of request and add signature of response
+// Unwrap returns original ResponseWriter, i.e. to be flushed with http.ResponseController
+func (rw RespWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Require rejects unsigned requests with 401/Unauthorized if key is set.
+// Signature itself is checked by Middleware, so Require should be used after it,
+// i.e. for routes which require signature.
+//
+// # Example
+//
+//	v := sign.NewVerifier(key)
+//	r.Use(v.Middleware)
+//	r.With(v.Require).Post("/update/", handler)
+func (v *Verifier) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.key != "" && r.Header.Get("HashSHA256") == "" {
+			v.reject(r, ReasonMissing)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware to check signature of request and add signature of response.
+// Stamped requests are checked to be in allowed time skew and not replayed.
+// Invalid requests are rejected with 401/Unauthorized, stamped requests are rejected
+// with 503/ServiceUnavailable if nonce cache is full.
+// Unsigned requests are passed, use Verifier.Require to reject them.
 //
 // # Example
 //
 //	r := chi.NewRouter()
-//	r.Use(sign.Middleware(key))
+//	r.Use(sign.Middleware(key, sign.WithSkew(time.Minute), sign.WithRequireStamp(true)))
 //	r...
-func Middleware(key string) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		sigmw := func(w http.ResponseWriter, r *http.Request) {
-
-			// wrapped response writer to proceed with
-			ww := w
-
-			// proceed request if key is set and exists in header
-			reqSign := r.Header.Get("HashSHA256")
-			if key != "" && reqSign != "" {
-				logger.Log().Debug().Msgf("sign: key '%s', HashSHA256 '%s'", key, reqSign)
-				reqBody, err := io.ReadAll(r.Body)
-				if err != nil {
-					logger.Log().Warn().Err(err).Msg("failed to read request body")
-					w.WriteHeader(http.StatusBadRequest)
-					return
-				}
-				defer r.Body.Close()
-				bodySign := Get(reqBody, key)
-				logger.Log().Debug().Msgf("signed body is '%s'", bodySign)
-				if reqSign != bodySign {
-					logger.Log().Warn().Err(err).Msg("invalid HashSHA256 signature")
-					w.WriteHeader(http.StatusBadRequest)
-					return
+func Middleware(key string, opts ...func(*Verifier)) func(next http.Handler) http.Handler {
+	return NewVerifier(key, opts...).Middleware
+}
+
+// Middleware checks signature of request and adds signature of response
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	sigmw := func(w http.ResponseWriter, r *http.Request) {
+
+		// wrapped response writer to proceed with
+		ww := w
+
+		// proceed request if key is set and exists in header
+		reqSign := r.Header.Get("HashSHA256")
+		if v.key != "" && reqSign != "" {
+			logger.Log().Debug().Msgf("sign: HashSHA256 '%s'", reqSign)
+			reqBody, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.Log().Warn().Err(err).Msg("failed to read request body")
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer r.Body.Close()
+			if reason := v.verify(r.Header, reqBody); reason != "" {
+				v.reject(r, reason)
+				if reason == ReasonBusy {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				} else {
+					w.WriteHeader(http.StatusUnauthorized)
 				}
-				// return body to be read from handler
-				r.Body = io.NopCloser(bytes.NewBuffer(reqBody))
-				// key is set, we need to work with response
-				ww = NewRespWrapper(w, key)
-				logger.Log().Debug().Msg("signature validated")
+				return
 			}
+			// return body to be read from handler
+			r.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+			// key is set, we need to work with response
+			ww = NewRespWrapper(w, v.key)
+			logger.Log().Debug().Msg("signature validated")
+		}
 
-			next.ServeHTTP(ww, r)
+		next.ServeHTTP(ww, r)
 
-		}
-		return http.HandlerFunc(sigmw)
 	}
+	return http.HandlerFunc(sigmw)
 }
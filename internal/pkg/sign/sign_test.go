@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -53,7 +55,7 @@ func TestSign(t *testing.T) {
 		},
 		{
 			name:      "different keys",
-			resCode:   http.StatusBadRequest,
+			resCode:   http.StatusUnauthorized,
 			clientKey: key1,
 			serverKey: key2,
 		},
@@ -104,3 +106,187 @@ func TestSign(t *testing.T) {
 		})
 	}
 }
+
+func TestMiddleware_Stamp(t *testing.T) {
+	key := "key"
+	body := []byte("this is a request body")
+	now := time.Now()
+	stamp := func(ts time.Time) string { return strconv.FormatInt(ts.Unix(), 10) }
+	testHandler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+
+	type request struct {
+		ts, nonce string
+		signTS    string // timestamp used for signature, ts if empty
+		wantCode  int
+	}
+	tests := []struct {
+		name         string
+		requireStamp bool
+		nonceCache   int
+		requests     []request
+	}{
+		{
+			name: "stamped request",
+			requests: []request{
+				{ts: stamp(now), nonce: "n1", wantCode: http.StatusOK},
+			},
+		},
+		{
+			name: "replay",
+			requests: []request{
+				{ts: stamp(now), nonce: "n1", wantCode: http.StatusOK},
+				{ts: stamp(now), nonce: "n1", wantCode: http.StatusUnauthorized},
+				{ts: stamp(now), nonce: "n2", wantCode: http.StatusOK},
+			},
+		},
+		{
+			name: "out of skew",
+			requests: []request{
+				{ts: stamp(now.Add(-2 * time.Minute)), nonce: "n1", wantCode: http.StatusUnauthorized},
+				{ts: stamp(now.Add(2 * time.Minute)), nonce: "n2", wantCode: http.StatusUnauthorized},
+				{ts: stamp(now.Add(-50 * time.Second)), nonce: "n3", wantCode: http.StatusOK},
+			},
+		},
+		{
+			name: "tampered timestamp",
+			requests: []request{
+				{ts: stamp(now), signTS: stamp(now.Add(-time.Hour)), nonce: "n1", wantCode: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "invalid stamp",
+			requests: []request{
+				{ts: "now", nonce: "n1", wantCode: http.StatusUnauthorized},
+				{ts: stamp(now), wantCode: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "not stamped allowed",
+			requests: []request{
+				{wantCode: http.StatusOK},
+			},
+		},
+		{
+			name:       "nonce cache is full",
+			nonceCache: 1,
+			requests: []request{
+				{ts: stamp(now), nonce: "n1", wantCode: http.StatusOK},
+				{ts: stamp(now), nonce: "n2", wantCode: http.StatusServiceUnavailable},
+				{ts: stamp(now), nonce: "n1", wantCode: http.StatusUnauthorized},
+			},
+		},
+		{
+			name:         "not stamped rejected",
+			requireStamp: true,
+			requests: []request{
+				{wantCode: http.StatusUnauthorized},
+				{ts: stamp(now), nonce: "n1", wantCode: http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(key,
+				WithSkew(time.Minute),
+				WithRequireStamp(tt.requireStamp),
+				WithNonceCache(tt.nonceCache),
+				func(v *Verifier) { v.now = func() time.Time { return now } },
+			)(testHandler)
+			for i, r := range tt.requests {
+				req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+				if r.ts == "" && r.nonce == "" {
+					req.Header.Set("HashSHA256", Get(body, key))
+				} else {
+					signTS := r.signTS
+					if signTS == "" {
+						signTS = r.ts
+					}
+					req.Header.Set("HashSHA256", GetStamped(body, signTS, r.nonce, key))
+					req.Header.Set(TimestampHeader, r.ts)
+					req.Header.Set(NonceHeader, r.nonce)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				assert.Equal(t, r.wantCode, w.Code, "request %d", i)
+			}
+		})
+	}
+}
+
+func TestVerifier_Require(t *testing.T) {
+	key := "key"
+	body := []byte("this is a request body")
+	testHandler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		serverKey  string
+		sign       string
+		wantCode   int
+		wantReason string
+	}{
+		{
+			name:      "signed",
+			serverKey: key,
+			sign:      Get(body, key),
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:       "unsigned",
+			serverKey:  key,
+			wantCode:   http.StatusUnauthorized,
+			wantReason: ReasonMissing,
+		},
+		{
+			name:       "invalid sign",
+			serverKey:  key,
+			sign:       Get(body, "wrong"),
+			wantCode:   http.StatusUnauthorized,
+			wantReason: ReasonInvalid,
+		},
+		{
+			name:     "no server key",
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasons []string
+			v := NewVerifier(tt.serverKey, WithRejectHook(func(reason string) {
+				reasons = append(reasons, reason)
+			}))
+			handler := v.Middleware(v.Require(testHandler))
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			if tt.sign != "" {
+				req.Header.Set("HashSHA256", tt.sign)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantReason == "" {
+				assert.Empty(t, reasons)
+			} else {
+				assert.Equal(t, []string{tt.wantReason}, reasons)
+			}
+		})
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Now()
+	c := NewNonceCache(2)
+	assert.NoError(t, c.Add("n1", now, now.Add(2*time.Minute)))
+	assert.ErrorIs(t, c.Add("n1", now, now.Add(2*time.Minute)), ErrNonceUsed)
+	assert.NoError(t, c.Add("n2", now, now.Add(time.Minute)))
+	// cache is full of live nonces, they are not evicted
+	assert.ErrorIs(t, c.Add("n3", now, now.Add(time.Minute)), ErrNonceCacheFull)
+	assert.Equal(t, 2, c.Len())
+	assert.ErrorIs(t, c.Add("n1", now, now.Add(time.Minute)), ErrNonceUsed)
+	// expired are evicted, even out of adding order
+	later := now.Add(90 * time.Second)
+	assert.NoError(t, c.Add("n3", later, later.Add(time.Minute)))
+	assert.Equal(t, 2, c.Len())
+	assert.ErrorIs(t, c.Add("n1", later, later.Add(time.Minute)), ErrNonceUsed)
+	assert.NoError(t, c.Add("n2", now.Add(3*time.Minute), now.Add(4*time.Minute)))
+	assert.Equal(t, 1, c.Len())
+}
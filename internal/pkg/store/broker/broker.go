@@ -0,0 +1,100 @@
+// Package broker implements fan-out of updated metrics to subscribers, which never blocks publisher.
+package broker
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+// DefaultBuffer is number of updates buffered for every subscriber by default
+const DefaultBuffer = 256
+
+// Subscription receives updated metrics, which match its filter.
+// Updates are dropped if subscriber does not read them fast enough and buffer is full.
+type Subscription struct {
+	ch      chan models.Metrics
+	filter  func(m models.Metrics) bool
+	dropped atomic.Int64
+	broker  *Broker
+	once    sync.Once
+}
+
+// Updates returns channel of updated metrics, it is closed when subscription is closed
+func (s *Subscription) Updates() <-chan models.Metrics {
+	return s.ch
+}
+
+// Dropped returns number of updates dropped because of full buffer
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes from updates
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.unsubscribe(s)
+	})
+}
+
+// Broker fans out published metrics to subscribers without blocking publisher
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	buffer int
+}
+
+// New creates broker, every subscriber buffers up to buffer updates
+func New(buffer int) *Broker {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	return &Broker{
+		subs:   make(map[*Subscription]struct{}),
+		buffer: buffer,
+	}
+}
+
+// Subscribe returns subscription to metrics matching filter, nil filter matches all
+func (b *Broker) Subscribe(filter func(m models.Metrics) bool) *Subscription {
+	s := &Subscription{
+		ch:     make(chan models.Metrics, b.buffer),
+		filter: filter,
+		broker: b,
+	}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	delete(b.subs, s)
+	b.mu.Unlock()
+	close(s.ch)
+}
+
+// Publish sends metric to every matching subscriber, which has free buffer space
+func (b *Broker) Publish(m models.Metrics) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(m) {
+			continue
+		}
+		select {
+		case s.ch <- m:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Len returns number of subscribers
+func (b *Broker) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
@@ -0,0 +1,49 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+)
+
+func TestBroker(t *testing.T) {
+	b := New(2)
+	all := b.Subscribe(nil)
+	gauges := b.Subscribe(func(m models.Metrics) bool { return m.Type == models.Gauge })
+	assert.Equal(t, 2, b.Len())
+
+	g := models.Metrics{Name: "g", Type: models.Gauge}
+	c := models.Metrics{Name: "c", Type: models.Counter}
+	b.Publish(g)
+	b.Publish(c)
+	// buffer is full, update is dropped, publish is not blocked
+	b.Publish(g)
+
+	assert.Equal(t, g, <-all.Updates())
+	assert.Equal(t, c, <-all.Updates())
+	assert.Equal(t, int64(1), all.Dropped())
+
+	assert.Equal(t, g, <-gauges.Updates())
+	assert.Equal(t, g, <-gauges.Updates())
+	assert.Equal(t, int64(0), gauges.Dropped())
+
+	all.Close()
+	all.Close()
+	_, ok := <-all.Updates()
+	assert.False(t, ok, "closed subscription channel should be closed")
+	assert.Equal(t, 1, b.Len())
+
+	b.Publish(g)
+	require.Len(t, gauges.Updates(), 1)
+	gauges.Close()
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestNew_DefaultBuffer(t *testing.T) {
+	s := New(0).Subscribe(nil)
+	defer s.Close()
+	assert.Equal(t, DefaultBuffer, cap(s.Updates()))
+}
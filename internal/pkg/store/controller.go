@@ -6,45 +6,173 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store/broker"
+)
+
+const (
+	defaultBatchWindow = 10 * time.Minute
 )
 
 var (
 	ErrMetricNotFound = errors.New("metric not found in store")
+	ErrBatchApplied   = errors.New("batch is already applied")
+	ErrNoHistory      = errors.New("store does not keep metrics history")
 )
 
+// seriesID identifies metric series of any type
+type seriesID struct {
+	mType  string
+	series string // models.SeriesKey
+}
+
+// seriesTS is the last update time of metric series
+type seriesTS struct {
+	name   string
+	labels models.Labels
+	ts     time.Time
+}
+
 // Controller implements high level functions over basic store implementation
 type Controller struct {
-	store    Store
-	mu       sync.RWMutex
-	gaugesTS map[string]time.Time // timestamps of gauges updates
+	store       Store
+	mu          sync.RWMutex // read lock for updates, write lock for restore and deletion
+	tsMu        sync.Mutex
+	updated     map[seriesID]seriesTS    // last update time of every metric series
+	histMu      sync.Mutex               // histograms are merged with read-modify-write
+	ttl         map[string]time.Duration // metrics time to live after the last update by type
+	ttlTracked  bool                     // metrics existing in store are tracked for expiration
+	batchMu     sync.Mutex
+	batchWindow time.Duration  // how long applied batches ids are remembered
+	batchPurged time.Time      // last time outdated batches ids were purged
+	broker      *broker.Broker // updated metrics subscribers
 }
 
 // NewStorageController is a Controller constructor
-func NewStorageController(store Store) *Controller {
-	return &Controller{
-		store:    store,
-		gaugesTS: make(map[string]time.Time),
+func NewStorageController(store Store, opts ...func(c *Controller)) *Controller {
+	c := &Controller{
+		store:       store,
+		updated:     make(map[seriesID]seriesTS),
+		ttl:         make(map[string]time.Duration),
+		batchWindow: defaultBatchWindow,
+		broker:      broker.New(broker.DefaultBuffer),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// WithSubscriberBuffer sets number of updates buffered for every subscriber, see Subscribe
+func WithSubscriberBuffer(n int) func(c *Controller) {
+	return func(c *Controller) {
+		c.broker = broker.New(n)
+	}
+}
+
+// WithBatchWindow sets period of time to remember applied batches ids.
+// Zero or negative value disables batches deduplication.
+func WithBatchWindow(d time.Duration) func(c *Controller) {
+	return func(c *Controller) {
+		c.batchWindow = d
+	}
+}
+
+// WithTTL sets period of time after the last update, when metrics of type are expired.
+// Zero value disables expiration.
+func WithTTL(mType string, ttl time.Duration) func(c *Controller) {
+	return func(c *Controller) {
+		if ttl > 0 {
+			c.ttl[mType] = ttl
+		}
 	}
 }
 
+// touch sets series last update time, update time never goes back
+func (c *Controller) touch(mType, name string, labels models.Labels, ts time.Time) {
+	id := seriesID{mType: mType, series: models.SeriesKey(name, labels)}
+	c.tsMu.Lock()
+	defer c.tsMu.Unlock()
+	if v, ok := c.updated[id]; ok && v.ts.After(ts) {
+		return
+	}
+	c.updated[id] = seriesTS{name: name, labels: labels, ts: ts}
+}
+
+// lastUpdate returns series last update time
+func (c *Controller) lastUpdate(mType, name string, labels models.Labels) time.Time {
+	c.tsMu.Lock()
+	defer c.tsMu.Unlock()
+	return c.updated[seriesID{mType: mType, series: models.SeriesKey(name, labels)}].ts
+}
+
+// untouch forgets series last update time
+func (c *Controller) untouch(mType, name string, labels models.Labels) {
+	c.tsMu.Lock()
+	defer c.tsMu.Unlock()
+	delete(c.updated, seriesID{mType: mType, series: models.SeriesKey(name, labels)})
+}
+
 // Collector methods
 
 // CollectCounter creates or updates counter value in store
-func (c *Controller) CollectCounter(name string, val int64) {
-	c.store.IncCounter(name, val)
+func (c *Controller) CollectCounter(name string, labels models.Labels, val int64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.store.IncCounter(name, labels, val)
+	c.touch(models.Counter, name, labels, time.Now())
 }
 
 // CollectGauge creates or updates gauge value in store
-func (c *Controller) CollectGauge(name string, val float64) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.store.SetGauge(name, val)
-	c.gaugesTS[name] = time.Now()
+func (c *Controller) CollectGauge(name string, labels models.Labels, val float64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.store.SetGauge(name, labels, val)
+	c.touch(models.Gauge, name, labels, time.Now())
+}
+
+// CollectHistogram observes value in histogram with buckets bounds, histogram is created if not exists
+func (c *Controller) CollectHistogram(name string, labels models.Labels, bounds []float64, val float64) {
+	h, err := models.NewHistogram(bounds)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msgf("unable to collect histogram '%s'", models.SeriesKey(name, labels))
+		return
+	}
+	if err := h.Observe(val); err != nil {
+		logger.Log().Warn().Err(err).Msgf("unable to collect histogram '%s'", models.SeriesKey(name, labels))
+		return
+	}
+	c.CollectHistogramValue(name, labels, h)
+}
+
+// CollectHistogramValue merges observations of histogram value to stored histogram, i.e. aggregated observations.
+// Histogram is created if not exists.
+func (c *Controller) CollectHistogramValue(name string, labels models.Labels, val models.HistogramValue) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, err := c.mergeHistogram(name, labels, val); err != nil {
+		logger.Log().Warn().Err(err).Msgf("unable to collect histogram '%s'", models.SeriesKey(name, labels))
+		return
+	}
+	c.touch(models.Histogram, name, labels, time.Now())
+}
+
+// mergeHistogram adds histogram value to stored one, returns merged value
+func (c *Controller) mergeHistogram(name string, labels models.Labels, value models.HistogramValue) (models.HistogramValue, error) {
+	c.histMu.Lock()
+	defer c.histMu.Unlock()
+	if v, ok := c.store.GetHistogram(name, labels); ok {
+		if err := v.Merge(value); err != nil {
+			return v, err
+		}
+		value = v
+	}
+	return c.store.SetHistogram(name, labels, value), nil
 }
 
 // Reporter methods
@@ -56,7 +184,7 @@ func (c *Controller) ReportAll() ([]models.Metrics, time.Time) {
 }
 
 // RestoreLatest restores metrics in case of reporting failed.
-// Counter values are always incremented, not to lose data.
+// Counter and histogram values are always incremented, not to lose data.
 // Gauges values are restored if there was no update. Gauge should always have the latest value.
 func (c *Controller) RestoreLatest(metrics []models.Metrics, ts time.Time) {
 	logger.Log().Debug().Msg("restoring metrics to store")
@@ -66,15 +194,23 @@ func (c *Controller) RestoreLatest(metrics []models.Metrics, ts time.Time) {
 		switch v.Type {
 		case models.Gauge:
 			// gauge value should always be latest
-			if ts.After(c.gaugesTS[v.Name]) || ts.Equal(c.gaugesTS[v.Name]) {
-				c.store.SetGauge(v.Name, *v.FValue)
-				c.gaugesTS[v.Name] = ts
+			if !ts.Before(c.lastUpdate(models.Gauge, v.Name, v.Labels)) {
+				c.store.SetGauge(v.Name, v.Labels, *v.FValue)
+				c.touch(models.Gauge, v.Name, v.Labels, ts)
 			} else {
-				logger.Log().Debug().Msgf("skip gauge '%s' restore, have newer value", v.Name)
+				logger.Log().Debug().Msgf("skip gauge '%s' restore, have newer value", models.SeriesKey(v.Name, v.Labels))
 			}
 		case models.Counter:
 			// counter always increments
-			c.store.IncCounter(v.Name, *v.IValue)
+			c.store.IncCounter(v.Name, v.Labels, *v.IValue)
+			c.touch(models.Counter, v.Name, v.Labels, ts)
+		case models.Histogram:
+			// histogram always merges
+			if _, err := c.mergeHistogram(v.Name, v.Labels, *v.HValue); err != nil {
+				logger.Log().Warn().Err(err).Msgf("unable to restore histogram '%s'", models.SeriesKey(v.Name, v.Labels))
+				continue
+			}
+			c.touch(models.Histogram, v.Name, v.Labels, ts)
 		}
 	}
 }
@@ -90,66 +226,325 @@ func (c *Controller) GetAll() []models.Metrics {
 func (c *Controller) GetOne(request models.MetricRequest) (m models.Metrics, err error) {
 	switch request.Type {
 	case models.Counter:
-		v, ok := c.store.GetCounter(request.Name)
+		v, ok := c.store.GetCounter(request.Name, request.Labels)
 		if !ok {
 			err = ErrMetricNotFound
 			return
 		}
 		m.IValue = &v
 	case models.Gauge:
-		v, ok := c.store.GetGauge(request.Name)
+		v, ok := c.store.GetGauge(request.Name, request.Labels)
 		if !ok {
 			err = ErrMetricNotFound
 			return
 		}
 		m.FValue = &v
+	case models.Histogram:
+		v, ok := c.store.GetHistogram(request.Name, request.Labels)
+		if !ok {
+			err = ErrMetricNotFound
+			return
+		}
+		m.HValue = &v
 	default:
 		err = models.ErrInvalidMetric
 	}
 	if err == nil {
 		m.Name = request.Name
 		m.Type = request.Type
+		m.Labels = request.Labels
 	}
 	return
 }
 
 // updateMetric creates or updates metric in store, set new value to requested metric.
-// It is a helper function to be called from public methods. It is not write safe.
+// It is a helper function to be called from public methods under read lock.
 func (c *Controller) updateMetric(metric *models.Metrics) error {
 	switch metric.Type {
 	case models.Counter:
 		if metric.IValue == nil {
 			return models.ErrInvalidMetric
 		}
-		v := c.store.IncCounter(metric.Name, *metric.IValue)
+		v := c.store.IncCounter(metric.Name, metric.Labels, *metric.IValue)
 		metric.IValue = &v
 	case models.Gauge:
 		if metric.FValue == nil {
 			return models.ErrInvalidMetric
 		}
-		v := c.store.SetGauge(metric.Name, *metric.FValue)
+		v := c.store.SetGauge(metric.Name, metric.Labels, *metric.FValue)
 		metric.FValue = &v
+	case models.Histogram:
+		if metric.HValue == nil {
+			return models.ErrInvalidMetric
+		}
+		if err := metric.HValue.Validate(); err != nil {
+			return err
+		}
+		v, err := c.mergeHistogram(metric.Name, metric.Labels, *metric.HValue)
+		if err != nil {
+			return err
+		}
+		metric.HValue = &v
 	default:
 		return models.ErrInvalidMetric
 	}
+	c.touch(metric.Type, metric.Name, metric.Labels, time.Now())
+	c.broker.Publish(*metric)
 	return nil
 }
 
 // UpdateOne updates one metric in store, set new value to requested metric.
 func (c *Controller) UpdateOne(metric *models.Metrics) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.updateMetric(metric)
 }
 
 // UpdateMany updates batch of metric in store, set new value to requested metrics.
+// Batch is validated before update, so invalid batch is not applied at all.
 func (c *Controller) UpdateMany(metrics []models.Metrics) error {
-	for _, v := range metrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.validateBatch(metrics); err != nil {
+		return err
+	}
+	_, err := c.updateMany(metrics)
+	return err
+}
+
+// updateMany updates batch of validated metrics, returns number of applied metrics.
+// It is a helper function to be called from public methods under read lock.
+func (c *Controller) updateMany(metrics []models.Metrics) (int, error) {
+	for i, v := range metrics {
 		if err := c.updateMetric(&v); err != nil {
-			return err
+			return i, err
+		}
+	}
+	return len(metrics), nil
+}
+
+// validateBatch checks that every metric of batch may be applied: metric is valid
+// and histogram buckets match the stored histogram and other histograms of the same series in batch.
+func (c *Controller) validateBatch(metrics []models.Metrics) error {
+	histograms := make(map[string]models.HistogramValue)
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("metric '%s': %w", m.Name, err)
+		}
+		if m.Type != models.Histogram {
+			continue
+		}
+		key := models.SeriesKey(m.Name, m.Labels)
+		h, ok := histograms[key]
+		if !ok {
+			if h, ok = c.store.GetHistogram(m.Name, m.Labels); !ok {
+				h = *m.HValue
+			}
+			histograms[key] = h
+		}
+		if !h.SameBuckets(*m.HValue) {
+			return fmt.Errorf("metric '%s': %w", key, models.ErrBucketsMismatch)
 		}
 	}
 	return nil
 }
 
+// UpdateBatch updates batch of metrics identified by unique id, set new value to requested metrics.
+// Batch is applied only once during batch window, replays are skipped with ErrBatchApplied.
+// Empty id means batch without identity, it is always applied.
+// Invalid batch is not applied and may be sent again after fix. If batch is applied partially,
+// i.e. on store failure, its id is kept, so resent batch does not apply the same values twice.
+func (c *Controller) UpdateBatch(id string, metrics []models.Metrics) error {
+	if id == "" || c.batchWindow <= 0 {
+		return c.UpdateMany(metrics)
+	}
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.validateBatch(metrics); err != nil {
+		return err
+	}
+	now := time.Now()
+	// purge outdated ids not too often
+	if now.Sub(c.batchPurged) > c.batchWindow/10 {
+		c.store.PurgeBatches(now.Add(-c.batchWindow))
+		c.batchPurged = now
+	}
+	if bu, ok := c.store.(BatchUpdater); ok {
+		return c.updateBatchTx(bu, id, now, metrics)
+	}
+	added, err := c.store.AddBatch(id, now)
+	if err != nil {
+		return fmt.Errorf("unable to register batch '%s': %w", id, err)
+	}
+	if !added {
+		logger.Log().Info().Msgf("batch '%s' is already applied, skipping", id)
+		return ErrBatchApplied
+	}
+	if applied, err := c.updateMany(metrics); err != nil {
+		if applied == 0 {
+			// nothing is applied, batch may be sent again
+			c.store.DelBatch(id)
+		}
+		return err
+	}
+	return nil
+}
+
+// updateBatchTx applies batch with store transaction, batch id is registered only with applied metrics.
+// It is a helper function to be called from UpdateBatch under read lock.
+func (c *Controller) updateBatchTx(bu BatchUpdater, id string, ts time.Time, metrics []models.Metrics) error {
+	// stored histograms are merged in transaction
+	c.histMu.Lock()
+	updated, err := bu.UpdateBatch(id, ts, metrics)
+	c.histMu.Unlock()
+	if errors.Is(err, ErrBatchApplied) {
+		logger.Log().Info().Msgf("batch '%s' is already applied, skipping", id)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("unable to apply batch '%s': %w", id, err)
+	}
+	for _, m := range updated {
+		c.touch(m.Type, m.Name, m.Labels, ts)
+		c.broker.Publish(m)
+	}
+	return nil
+}
+
+// deleteMetric removes metric from store, returns ErrMetricNotFound if metric does not exist.
+// It is a helper function to be called from public methods under write lock.
+func (c *Controller) deleteMetric(request models.MetricRequest) error {
+	switch request.Type {
+	case models.Counter:
+		if _, ok := c.store.GetCounter(request.Name, request.Labels); !ok {
+			return ErrMetricNotFound
+		}
+		c.store.DelCounter(request.Name, request.Labels)
+	case models.Gauge:
+		if _, ok := c.store.GetGauge(request.Name, request.Labels); !ok {
+			return ErrMetricNotFound
+		}
+		c.store.DelGauge(request.Name, request.Labels)
+	case models.Histogram:
+		if _, ok := c.store.GetHistogram(request.Name, request.Labels); !ok {
+			return ErrMetricNotFound
+		}
+		c.store.DelHistogram(request.Name, request.Labels)
+	default:
+		return models.ErrInvalidMetric
+	}
+	c.untouch(request.Type, request.Name, request.Labels)
+	return nil
+}
+
+// DeleteOne removes metric from store
+func (c *Controller) DeleteOne(request models.MetricRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deleteMetric(request)
+}
+
+// DeleteMany removes metrics from store. All requests are validated before deletion.
+// Existing metrics are removed even if some of requested are not found, ErrMetricNotFound is returned then.
+func (c *Controller) DeleteMany(requests []models.MetricRequest) error {
+	for _, r := range requests {
+		switch r.Type {
+		case models.Counter, models.Gauge, models.Histogram:
+		default:
+			return models.ErrInvalidMetric
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for _, r := range requests {
+		if e := c.deleteMetric(r); e != nil {
+			logger.Log().Debug().Err(e).Msgf("unable to delete %s '%s'", r.Type, models.SeriesKey(r.Name, r.Labels))
+			err = e
+		}
+	}
+	return err
+}
+
+// ExpireStale removes metrics, which were not updated longer than TTL of their type.
+// Metrics existing in store before the first call, i.e. restored from database, are expired by update time
+// kept by store, see UpdateTimes, or as updated at the first call. Returns number of removed metrics.
+func (c *Controller) ExpireStale() (expired int) {
+	if len(c.ttl) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if !c.ttlTracked {
+		c.trackStored(now)
+		c.ttlTracked = true
+	}
+	stale := make([]models.MetricRequest, 0)
+	c.tsMu.Lock()
+	for id, v := range c.updated {
+		if ttl := c.ttl[id.mType]; ttl > 0 && now.Sub(v.ts) > ttl {
+			stale = append(stale, models.MetricRequest{Name: v.name, Type: id.mType, Labels: v.labels})
+		}
+	}
+	c.tsMu.Unlock()
+	for _, r := range stale {
+		if err := c.deleteMetric(r); err != nil {
+			// metric may be already gone, i.e. flushed by report
+			c.untouch(r.Type, r.Name, r.Labels)
+			continue
+		}
+		logger.Log().Debug().Msgf("expired stale %s '%s'", r.Type, models.SeriesKey(r.Name, r.Labels))
+		expired++
+	}
+	return
+}
+
+// trackStored tracks update time of metrics existing in store for expiration.
+// Update time is taken from store if it is kept, otherwise metrics are tracked as updated now.
+func (c *Controller) trackStored(now time.Time) {
+	if ut, ok := c.store.(UpdateTimes); ok {
+		updates, err := ut.UpdateTimes()
+		if err != nil {
+			logger.Log().Warn().Err(err).Msg("unable to get stored metrics update time")
+		}
+		for _, u := range updates {
+			if c.lastUpdate(u.Type, u.Name, u.Labels).IsZero() {
+				c.touch(u.Type, u.Name, u.Labels, u.TS)
+			}
+		}
+	}
+	for _, m := range c.store.Snapshot(false) {
+		if c.lastUpdate(m.Type, m.Name, m.Labels).IsZero() {
+			c.touch(m.Type, m.Name, m.Labels, now)
+		}
+	}
+}
+
+// History returns metric values history for period [from, to) downsampled to one sample per step.
+// Returns ErrNoHistory if store does not keep history.
+func (c *Controller) History(request models.MetricRequest, from, to time.Time, step time.Duration) ([]models.Sample, error) {
+	h, ok := c.store.(History)
+	if !ok {
+		return nil, ErrNoHistory
+	}
+	switch request.Type {
+	case models.Counter, models.Gauge:
+	default:
+		return nil, models.ErrInvalidMetric
+	}
+	return h.History(request.Name, request.Type, request.Labels, from, to, step)
+}
+
+// Subscribe returns subscription to metrics updated by UpdateOne, UpdateMany and UpdateBatch with new values.
+// Filter selects metrics to receive, nil filter receives all. Subscription should be closed after use.
+// Updates are never blocked by subscribers: update is dropped if subscriber buffer is full.
+func (c *Controller) Subscribe(filter func(m models.Metrics) bool) *broker.Subscription {
+	return c.broker.Subscribe(filter)
+}
+
 // Ping is used to check store accessibility
 func (c *Controller) Ping() error {
 	return c.store.Ping()
@@ -2,6 +2,7 @@ package store
 
 import (
 	"errors"
+	"math"
 	"testing"
 	"time"
 
@@ -23,8 +24,8 @@ func TestMetricsController_CollectCounter(t *testing.T) {
 
 	c := NewStorageController(m)
 
-	m.EXPECT().IncCounter(name, value).Times(1)
-	c.CollectCounter(name, value)
+	m.EXPECT().IncCounter(name, nil, value).Times(1)
+	c.CollectCounter(name, nil, value)
 }
 
 func TestMetricsController_CollectGauge(t *testing.T) {
@@ -37,13 +38,44 @@ func TestMetricsController_CollectGauge(t *testing.T) {
 
 	c := NewStorageController(m)
 
-	m.EXPECT().SetGauge(name, value).Times(2)
+	labels := models.Labels{"host": "h1"}
+	m.EXPECT().SetGauge(name, labels, value).Times(2)
 	tStart := time.Now()
-	c.CollectGauge(name, value)
-	require.WithinRange(t, c.gaugesTS[name], tStart, time.Now(), "Invalid timestamp in map")
+	c.CollectGauge(name, labels, value)
+	require.WithinRange(t, c.lastUpdate(models.Gauge, name, labels), tStart, time.Now(), "Invalid timestamp in map")
 	tStart = time.Now()
-	c.CollectGauge(name, value)
-	require.WithinRange(t, c.gaugesTS[name], tStart, time.Now(), "Invalid timestamp in map")
+	c.CollectGauge(name, labels, value)
+	require.WithinRange(t, c.lastUpdate(models.Gauge, name, labels), tStart, time.Now(), "Invalid timestamp in map")
+}
+
+func TestMetricsController_CollectHistogram(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockStore(mockController)
+
+	c := NewStorageController(m)
+
+	name := "latency"
+	bounds := []float64{0.1, 0.5}
+	stored := models.HistogramValue{Bounds: bounds, Counts: []int64{1, 0, 0}, Count: 1, Sum: 0.05}
+	want := models.HistogramValue{Bounds: bounds, Counts: []int64{1, 1, 0}, Count: 2, Sum: 0.35}
+
+	gomock.InOrder(
+		m.EXPECT().GetHistogram(name, nil).Return(stored, true),
+		m.EXPECT().SetHistogram(name, nil, want).Return(want),
+	)
+	c.CollectHistogram(name, nil, bounds, 0.3)
+
+	// buckets mismatch is not stored
+	m.EXPECT().GetHistogram(name, nil).Return(stored, true)
+	c.CollectHistogram(name, nil, []float64{1}, 0.3)
+
+	// invalid bounds are not stored
+	c.CollectHistogram(name, nil, []float64{1, 0.5}, 0.3)
+
+	// not finite values are not stored
+	c.CollectHistogram(name, nil, bounds, math.NaN())
+	c.CollectHistogram(name, nil, bounds, math.Inf(1))
 }
 
 func TestMetricsController_ReportAll(t *testing.T) {
@@ -85,10 +117,10 @@ func TestMetricsController_RestoreReport(t *testing.T) {
 		c := NewStorageController(m)
 		ts := time.Now().Add(-1 * time.Second)
 		// both metrics should be updated
-		m.EXPECT().IncCounter(counter.Name, *counter.IValue).Times(1)
-		m.EXPECT().SetGauge(gauge.Name, *gauge.FValue).Times(1)
+		m.EXPECT().IncCounter(counter.Name, nil, *counter.IValue).Times(1)
+		m.EXPECT().SetGauge(gauge.Name, nil, *gauge.FValue).Times(1)
 		c.RestoreLatest(report, ts)
-		require.Equal(t, ts, c.gaugesTS[gauge.Name], "Expect '%t' in gaugesTs map, got '%t'", ts, c.gaugesTS[gauge.Name])
+		require.Equal(t, ts, c.lastUpdate(models.Gauge, gauge.Name, nil), "Expect '%t' in update times map, got '%t'", ts, c.lastUpdate(models.Gauge, gauge.Name, nil))
 	})
 
 	t.Run("Restore to updated store", func(t *testing.T) {
@@ -97,17 +129,17 @@ func TestMetricsController_RestoreReport(t *testing.T) {
 		m.EXPECT().Snapshot(true).Return(report).Times(1)
 		r, reportTS := c.ReportAll()
 
-		m.EXPECT().IncCounter(gomock.Any(), gomock.Any())
-		m.EXPECT().SetGauge(gomock.Any(), gomock.Any())
-		c.CollectGauge("g1", 1)
-		c.CollectCounter("c1", 1)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any())
+		m.EXPECT().SetGauge(gomock.Any(), gomock.Any(), gomock.Any())
+		c.CollectGauge("g1", nil, 1)
+		c.CollectCounter("c1", nil, 1)
 
 		// only counter should be updated
-		m.EXPECT().IncCounter(counter.Name, *counter.IValue).Times(1)
+		m.EXPECT().IncCounter(counter.Name, nil, *counter.IValue).Times(1)
 		c.RestoreLatest(r, reportTS)
 
 		// gauge timestamp should not be changed
-		require.True(t, c.gaugesTS[gauge.Name].After(reportTS), "Expect time in gaugesTs map later than report time")
+		require.True(t, c.lastUpdate(models.Gauge, gauge.Name, nil).After(reportTS), "Expect time in update times map later than report time")
 	})
 }
 
@@ -180,6 +212,17 @@ func Test_GetOne(t *testing.T) {
 			wantGaugeCall: 1,
 			wantErr:       ErrMetricNotFound,
 		},
+		{
+			name: "labeled gauge found",
+			req: models.MetricRequest{
+				Name:   "g1",
+				Type:   "gauge",
+				Labels: models.Labels{"cpu": "1"},
+			},
+			wantFloat:     1.5,
+			wantFound:     true,
+			wantGaugeCall: 1,
+		},
 		{
 			name: "invalid type",
 			req: models.MetricRequest{
@@ -191,8 +234,8 @@ func Test_GetOne(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m.EXPECT().GetCounter(tt.req.Name).Times(tt.wantCounterCall).Return(tt.wantInt, tt.wantFound)
-			m.EXPECT().GetGauge(tt.req.Name).Times(tt.wantGaugeCall).Return(tt.wantFloat, tt.wantFound)
+			m.EXPECT().GetCounter(tt.req.Name, tt.req.Labels).Times(tt.wantCounterCall).Return(tt.wantInt, tt.wantFound)
+			m.EXPECT().GetGauge(tt.req.Name, tt.req.Labels).Times(tt.wantGaugeCall).Return(tt.wantFloat, tt.wantFound)
 			got, err := c.GetOne(tt.req)
 			if tt.wantErr != nil {
 				require.True(t, errors.Is(err, tt.wantErr))
@@ -200,6 +243,7 @@ func Test_GetOne(t *testing.T) {
 				require.NoError(t, err)
 				assert.Equal(t, tt.req.Name, got.Name)
 				assert.Equal(t, tt.req.Type, got.Type)
+				assert.Equal(t, tt.req.Labels, got.Labels)
 				if tt.wantCounterCall > 0 {
 					assert.Equal(t, tt.wantInt, *got.IValue)
 				}
@@ -254,8 +298,8 @@ func Test_UpdateOne(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			metric := models.Metrics{Name: tt.mName, Type: tt.mType, IValue: &tt.sendInt, FValue: &tt.wantFloat}
-			m.EXPECT().IncCounter(tt.mName, tt.sendInt).Times(tt.wantCounter).Return(tt.wantInt)
-			m.EXPECT().SetGauge(tt.mName, tt.wantFloat).Times(tt.wantGauge).Return(tt.wantFloat)
+			m.EXPECT().IncCounter(tt.mName, nil, tt.sendInt).Times(tt.wantCounter).Return(tt.wantInt)
+			m.EXPECT().SetGauge(tt.mName, nil, tt.wantFloat).Times(tt.wantGauge).Return(tt.wantFloat)
 			err := c.UpdateOne(&metric)
 			if tt.wantErr != nil {
 				require.True(t, errors.Is(err, tt.wantErr))
@@ -306,12 +350,303 @@ func Test_UpdateMany(t *testing.T) {
 			FValue: new(float64),
 		},
 	}
-	m.EXPECT().IncCounter(gomock.Any(), gomock.Any()).Times(3)
-	m.EXPECT().SetGauge(gomock.Any(), gomock.Any()).Times(2)
+	m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
+	m.EXPECT().SetGauge(gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
 	err := c.UpdateMany(metrics)
 	require.NoError(t, err)
 }
 
+func TestController_Subscribe(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockStore(mockController)
+
+	c := NewStorageController(m, WithSubscriberBuffer(1))
+	sub := c.Subscribe(func(m models.Metrics) bool { return m.Type == models.Counter })
+	defer sub.Close()
+
+	delta, gauge, total := int64(2), 1.5, int64(5)
+	m.EXPECT().IncCounter("c1", nil, delta).Return(total).Times(2)
+	m.EXPECT().SetGauge("g1", nil, gauge).Return(gauge)
+	err := c.UpdateMany([]models.Metrics{
+		{Name: "c1", Type: models.Counter, IValue: &delta},
+		{Name: "g1", Type: models.Gauge, FValue: &gauge},
+		{Name: "c1", Type: models.Counter, IValue: &delta},
+	})
+	require.NoError(t, err)
+
+	// subscriber receives new value, update over buffer size is dropped
+	require.Len(t, sub.Updates(), 1)
+	assert.Equal(t, models.Metrics{Name: "c1", Type: models.Counter, IValue: &total}, <-sub.Updates())
+	assert.Equal(t, int64(1), sub.Dropped())
+}
+
+// batchUpdaterStore is a store, which applies batches in transaction
+type batchUpdaterStore struct {
+	*mocks.MockStore
+	*mocks.MockBatchUpdater
+}
+
+func Test_UpdateBatch(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockStore(mockController)
+
+	metrics := []models.Metrics{
+		{
+			Name:   "c1",
+			Type:   models.Counter,
+			IValue: new(int64),
+		},
+	}
+
+	t.Run("without id", func(t *testing.T) {
+		c := NewStorageController(m)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		err := c.UpdateBatch("", metrics)
+		require.NoError(t, err)
+	})
+
+	t.Run("new batch", func(t *testing.T) {
+		c := NewStorageController(m)
+		m.EXPECT().PurgeBatches(gomock.Any()).Times(1)
+		m.EXPECT().AddBatch("b1", gomock.Any()).Times(1).Return(true, nil)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		err := c.UpdateBatch("b1", metrics)
+		require.NoError(t, err)
+	})
+
+	t.Run("replayed batch", func(t *testing.T) {
+		c := NewStorageController(m)
+		m.EXPECT().PurgeBatches(gomock.Any()).Times(1)
+		m.EXPECT().AddBatch("b1", gomock.Any()).Times(1).Return(false, nil)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		err := c.UpdateBatch("b1", metrics)
+		require.ErrorIs(t, err, ErrBatchApplied)
+	})
+
+	t.Run("invalid batch is not applied", func(t *testing.T) {
+		c := NewStorageController(m)
+		m.EXPECT().AddBatch(gomock.Any(), gomock.Any()).Times(0)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		err := c.UpdateBatch("b2", append(metrics, models.Metrics{Name: "c2", Type: models.Counter}))
+		require.ErrorIs(t, err, models.ErrInvalidMetric)
+	})
+
+	t.Run("histogram buckets mismatch", func(t *testing.T) {
+		c := NewStorageController(m)
+		m.EXPECT().GetHistogram("h1", gomock.Any()).Times(1).Return(models.HistogramValue{Bounds: []float64{1}, Counts: []int64{0, 0}}, true)
+		m.EXPECT().AddBatch(gomock.Any(), gomock.Any()).Times(0)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		h := models.HistogramValue{Bounds: []float64{2}, Counts: []int64{1, 0}, Count: 1, Sum: 1}
+		err := c.UpdateBatch("b2", append(metrics, models.Metrics{Name: "h1", Type: models.Histogram, HValue: &h}))
+		require.ErrorIs(t, err, models.ErrBucketsMismatch)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		c := NewStorageController(m)
+		m.EXPECT().PurgeBatches(gomock.Any()).Times(1)
+		m.EXPECT().AddBatch("b2", gomock.Any()).Times(1).Return(false, errors.New("connection refused"))
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		err := c.UpdateBatch("b2", metrics)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrBatchApplied)
+	})
+
+	t.Run("partially applied batch is kept", func(t *testing.T) {
+		c := NewStorageController(m)
+		h := models.HistogramValue{Bounds: []float64{1}, Counts: []int64{1, 0}, Count: 1, Sum: 1}
+		gomock.InOrder(
+			m.EXPECT().GetHistogram("h1", gomock.Any()).Return(models.HistogramValue{}, false),
+			m.EXPECT().PurgeBatches(gomock.Any()),
+			m.EXPECT().AddBatch("b3", gomock.Any()).Return(true, nil),
+			m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()),
+			// histogram with other buckets is created after validation
+			m.EXPECT().GetHistogram("h1", gomock.Any()).Return(models.HistogramValue{Bounds: []float64{2}, Counts: []int64{0, 0}}, true),
+		)
+		m.EXPECT().DelBatch(gomock.Any()).Times(0)
+		err := c.UpdateBatch("b3", append(metrics, models.Metrics{Name: "h1", Type: models.Histogram, HValue: &h}))
+		require.ErrorIs(t, err, models.ErrBucketsMismatch)
+	})
+
+	t.Run("batch updater", func(t *testing.T) {
+		bu := mocks.NewMockBatchUpdater(mockController)
+		c := NewStorageController(batchUpdaterStore{MockStore: m, MockBatchUpdater: bu})
+		sub := c.Subscribe(nil)
+		defer sub.Close()
+		total := int64(5)
+		m.EXPECT().PurgeBatches(gomock.Any()).Times(1)
+		m.EXPECT().AddBatch(gomock.Any(), gomock.Any()).Times(0)
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+		bu.EXPECT().UpdateBatch("b4", gomock.Any(), metrics).Times(1).
+			Return([]models.Metrics{{Name: "c1", Type: models.Counter, IValue: &total}}, nil)
+		require.NoError(t, c.UpdateBatch("b4", metrics))
+		assert.Equal(t, models.Metrics{Name: "c1", Type: models.Counter, IValue: &total}, <-sub.Updates())
+
+		bu.EXPECT().UpdateBatch("b4", gomock.Any(), metrics).Times(1).Return(nil, ErrBatchApplied)
+		require.ErrorIs(t, c.UpdateBatch("b4", metrics), ErrBatchApplied)
+	})
+
+	t.Run("deduplication disabled", func(t *testing.T) {
+		c := NewStorageController(m, WithBatchWindow(0))
+		m.EXPECT().IncCounter(gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		err := c.UpdateBatch("b1", metrics)
+		require.NoError(t, err)
+	})
+}
+
+func Test_DeleteOne(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockStore(mockController)
+
+	c := NewStorageController(m)
+	labels := models.Labels{"host": "h1"}
+
+	m.EXPECT().GetGauge("g1", labels).Times(1).Return(1.5, true)
+	m.EXPECT().DelGauge("g1", labels).Times(1)
+	c.touch(models.Gauge, "g1", labels, time.Now())
+	require.NoError(t, c.DeleteOne(models.MetricRequest{Name: "g1", Type: models.Gauge, Labels: labels}))
+	assert.True(t, c.lastUpdate(models.Gauge, "g1", labels).IsZero(), "deleted gauge update time should be forgotten")
+
+	m.EXPECT().GetCounter("c1", nil).Times(1).Return(int64(0), false)
+	m.EXPECT().DelCounter(gomock.Any(), gomock.Any()).Times(0)
+	require.ErrorIs(t, c.DeleteOne(models.MetricRequest{Name: "c1", Type: models.Counter}), ErrMetricNotFound)
+
+	m.EXPECT().GetHistogram("h1", nil).Times(1).Return(models.HistogramValue{}, true)
+	m.EXPECT().DelHistogram("h1", nil).Times(1)
+	require.NoError(t, c.DeleteOne(models.MetricRequest{Name: "h1", Type: models.Histogram}))
+
+	require.ErrorIs(t, c.DeleteOne(models.MetricRequest{Name: "x1", Type: "unknown"}), models.ErrInvalidMetric)
+}
+
+func Test_DeleteMany(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockStore(mockController)
+
+	c := NewStorageController(m)
+
+	t.Run("invalid request deletes nothing", func(t *testing.T) {
+		err := c.DeleteMany([]models.MetricRequest{
+			{Name: "c1", Type: models.Counter},
+			{Name: "x1", Type: "unknown"},
+		})
+		require.ErrorIs(t, err, models.ErrInvalidMetric)
+	})
+
+	t.Run("not found does not stop deletion", func(t *testing.T) {
+		m.EXPECT().GetCounter("c1", nil).Times(1).Return(int64(0), false)
+		m.EXPECT().GetGauge("g1", nil).Times(1).Return(1.5, true)
+		m.EXPECT().DelGauge("g1", nil).Times(1)
+		err := c.DeleteMany([]models.MetricRequest{
+			{Name: "c1", Type: models.Counter},
+			{Name: "g1", Type: models.Gauge},
+		})
+		require.ErrorIs(t, err, ErrMetricNotFound)
+	})
+
+	t.Run("all deleted", func(t *testing.T) {
+		m.EXPECT().GetCounter("c1", nil).Times(1).Return(int64(1), true)
+		m.EXPECT().DelCounter("c1", nil).Times(1)
+		err := c.DeleteMany([]models.MetricRequest{{Name: "c1", Type: models.Counter}})
+		require.NoError(t, err)
+	})
+}
+
+func TestController_ExpireStale(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	m := mocks.NewMockStore(mockController)
+
+	t.Run("expiration disabled", func(t *testing.T) {
+		c := NewStorageController(m, WithTTL(models.Gauge, 0))
+		m.EXPECT().Snapshot(gomock.Any()).Times(0)
+		assert.Equal(t, 0, c.ExpireStale())
+	})
+
+	t.Run("expire by type ttl", func(t *testing.T) {
+		c := NewStorageController(m, WithTTL(models.Gauge, time.Minute))
+		labels := models.Labels{"host": "h1"}
+		old := time.Now().Add(-2 * time.Minute)
+
+		// g3 exists in store before the first sweep
+		m.EXPECT().Snapshot(false).Times(1).Return([]models.Metrics{
+			{Name: "g1", Type: models.Gauge, Labels: labels},
+			{Name: "g3", Type: models.Gauge},
+		})
+		c.touch(models.Gauge, "g1", labels, old)
+		c.touch(models.Gauge, "g2", nil, time.Now())
+		c.touch(models.Counter, "c1", nil, old)
+
+		m.EXPECT().GetGauge("g1", labels).Times(1).Return(1.0, true)
+		m.EXPECT().DelGauge("g1", labels).Times(1)
+		assert.Equal(t, 1, c.ExpireStale())
+		assert.True(t, c.lastUpdate(models.Gauge, "g1", labels).IsZero())
+		assert.False(t, c.lastUpdate(models.Gauge, "g3", nil).IsZero(), "existing gauge should be tracked")
+
+		// store is scanned only once, metric gone from store is forgotten
+		c.untouch(models.Gauge, "g2", nil)
+		c.touch(models.Gauge, "g2", nil, old)
+		m.EXPECT().GetGauge("g2", nil).Times(1).Return(0.0, false)
+		assert.Equal(t, 0, c.ExpireStale())
+		assert.True(t, c.lastUpdate(models.Gauge, "g2", nil).IsZero())
+	})
+
+	t.Run("store keeps update time", func(t *testing.T) {
+		ut := mocks.NewMockUpdateTimes(mockController)
+		c := NewStorageController(struct {
+			*mocks.MockStore
+			*mocks.MockUpdateTimes
+		}{m, ut}, WithTTL(models.Gauge, time.Minute))
+		old := time.Now().Add(-2 * time.Minute)
+
+		// g1 is stale after restart, g2 has no stored update time
+		ut.EXPECT().UpdateTimes().Times(1).Return([]models.SeriesUpdate{
+			{MetricRequest: models.MetricRequest{Name: "g1", Type: models.Gauge}, TS: old},
+		}, nil)
+		m.EXPECT().Snapshot(false).Times(1).Return([]models.Metrics{
+			{Name: "g1", Type: models.Gauge},
+			{Name: "g2", Type: models.Gauge},
+		})
+		m.EXPECT().GetGauge("g1", nil).Times(1).Return(1.0, true)
+		m.EXPECT().DelGauge("g1", nil).Times(1)
+		assert.Equal(t, 1, c.ExpireStale())
+		assert.False(t, c.lastUpdate(models.Gauge, "g2", nil).IsZero(), "existing gauge should be tracked")
+	})
+}
+
+func TestController_History(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	req := models.MetricRequest{Name: "g1", Type: models.Gauge, Labels: models.Labels{"cpu": "1"}}
+
+	t.Run("store without history", func(t *testing.T) {
+		c := NewStorageController(mocks.NewMockStore(mockController))
+		_, err := c.History(req, from, to, time.Minute)
+		require.ErrorIs(t, err, ErrNoHistory)
+	})
+
+	t.Run("store with history", func(t *testing.T) {
+		h := mocks.NewMockHistory(mockController)
+		c := NewStorageController(struct {
+			*mocks.MockStore
+			*mocks.MockHistory
+		}{mocks.NewMockStore(mockController), h})
+		want := []models.Sample{{TS: from, Value: 1}}
+		h.EXPECT().History("g1", models.Gauge, req.Labels, from, to, time.Minute).Times(1).Return(want, nil)
+		samples, err := c.History(req, from, to, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, want, samples)
+
+		_, err = c.History(models.MetricRequest{Name: "h1", Type: models.Histogram}, from, to, time.Minute)
+		require.ErrorIs(t, err, models.ErrInvalidMetric)
+	})
+}
+
 func TestController_Ping(t *testing.T) {
 	var mockController = gomock.NewController(t)
 	defer mockController.Finish()
@@ -47,7 +47,7 @@ func NewFileDump(f *os.File) *FileDump {
 	}
 }
 
-func (fd *FileDump) Dump(metrics []models.Metrics) error {
+func (fd *FileDump) Dump(metrics []models.TenantMetrics) error {
 	if len(metrics) == 0 {
 		return ErrEmpty
 	}
@@ -65,7 +65,7 @@ func (fd *FileDump) Dump(metrics []models.Metrics) error {
 	return nil
 }
 
-func (fd *FileDump) Restore() (metrics []models.Metrics, lastDump time.Time, err error) {
+func (fd *FileDump) Restore() (metrics []models.TenantMetrics, lastDump time.Time, err error) {
 	if fd.restored {
 		err = ErrRestoreDenied
 		return
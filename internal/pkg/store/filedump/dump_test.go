@@ -12,6 +12,15 @@ import (
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
 )
 
+// owned returns metrics of tenant
+func owned(tenant string, metrics ...models.Metrics) []models.TenantMetrics {
+	res := make([]models.TenantMetrics, 0, len(metrics))
+	for _, m := range metrics {
+		res = append(res, models.TenantMetrics{Metrics: m, Tenant: tenant})
+	}
+	return res
+}
+
 func TestFileDump_RestoreOnce(t *testing.T) {
 	tempFile := fmt.Sprintf("%s/metric_dump", os.TempDir())
 	defer os.Remove(tempFile)
@@ -21,7 +30,7 @@ func TestFileDump_RestoreOnce(t *testing.T) {
 	require.NoError(t, err)
 	c1, _ := models.NewMetric("c1", models.Counter, "10")
 	fd := NewFileDump(f)
-	fd.Dump([]models.Metrics{c1})
+	fd.Dump(owned("", c1))
 	f.Close()
 
 	// twice restore
@@ -44,7 +53,7 @@ func TestFileDump_NoRestoreAfterDump(t *testing.T) {
 	require.NoError(t, err)
 	c1, _ := models.NewMetric("c1", models.Counter, "10")
 	fd := NewFileDump(f)
-	fd.Dump([]models.Metrics{c1})
+	fd.Dump(owned("", c1))
 
 	_, _, err = fd.Restore()
 	require.ErrorIs(t, ErrRestoreDenied, err)
@@ -63,38 +72,41 @@ func TestFileDump_DumpRestore(t *testing.T) {
 	g1over, _ := models.NewMetric("g1", models.Gauge, "-0.117")
 	g2, _ := models.NewMetric("g2", models.Gauge, "192.345")
 	g3, _ := models.NewMetric("g3", models.Gauge, "0")
+	g4, _ := models.NewMetric("g4", models.Gauge, "1.5")
+	g4.Labels = models.Labels{"cpu": "1"}
+	h1, _ := models.NewMetric("h1", models.Histogram, "0.1:2,+Inf:1;1.25")
 
 	tests := []struct {
 		name        string
 		runOrder    func() time.Time
-		wantRestore []models.Metrics
+		wantRestore []models.TenantMetrics
 	}{
 		{
 			name:        "one dump",
-			wantRestore: []models.Metrics{c1, g1, c3},
+			wantRestore: owned("", c1, g1, c3),
 			runOrder: func() time.Time {
 				f, err := os.OpenFile(tempFile, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
 				require.NoError(t, err)
 				fd := NewFileDump(f)
 				tBefore := time.Now()
 				time.Sleep(time.Millisecond)
-				fd.Dump([]models.Metrics{c1, g1, c3})
+				fd.Dump(owned("", c1, g1, c3))
 				f.Close()
 				return tBefore
 			},
 		},
 		{
 			name:        "multiple dumps",
-			wantRestore: []models.Metrics{c1over, g1over, c3, g3},
+			wantRestore: append(owned("", c1over, g1over, c3, g3), owned("team1", g4, h1)...),
 			runOrder: func() time.Time {
 				f, err := os.OpenFile(tempFile, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
 				require.NoError(t, err)
 				fd := NewFileDump(f)
-				fd.Dump([]models.Metrics{c1, g1, c2, g2})
-				fd.Dump([]models.Metrics{c3, c1, c2})
+				fd.Dump(owned("", c1, g1, c2, g2))
+				fd.Dump(owned("", c3, c1, c2))
 				tBefore := time.Now()
 				time.Sleep(time.Millisecond)
-				fd.Dump([]models.Metrics{c1over, g1over, c3, g3})
+				fd.Dump(append(owned("", c1over, g1over, c3, g3), owned("team1", g4, h1)...))
 				f.Close()
 				return tBefore
 			},
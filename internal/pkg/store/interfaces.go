@@ -3,35 +3,82 @@ package store
 //go:generate mockgen -source $GOFILE -package=mocks -destination ../../../mocks/Store_mock.go
 
 import (
+	"time"
+
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
 )
 
-// Gauge implements basic operations on metrics with type gauge
+// Gauge implements basic operations on metrics with type gauge.
+// Gauge series is identified by name and labels.
 type Gauge interface {
 	// SetGauge sets Gauge_old value
-	SetGauge(name string, value float64) float64
+	SetGauge(name string, labels models.Labels, value float64) float64
 	// GetGauge returns Gauge_old value
-	GetGauge(name string) (float64, bool)
+	GetGauge(name string, labels models.Labels) (float64, bool)
 	// DelGauge deletes Gauage
-	DelGauge(name string)
+	DelGauge(name string, labels models.Labels)
 }
 
-// Counter implements basic operations on metric with type counter
+// Counter implements basic operations on metric with type counter.
+// Counter series is identified by name and labels.
 type Counter interface {
 	// IncCounter increases Counter_old on passed value and returns increased one
-	IncCounter(name string, value int64) int64
+	IncCounter(name string, labels models.Labels, value int64) int64
 	// GetCounter returns Counter_old value
-	GetCounter(name string) (int64, bool)
+	GetCounter(name string, labels models.Labels) (int64, bool)
 	// DelCounter deletes Counter_old
-	DelCounter(name string)
+	DelCounter(name string, labels models.Labels)
+}
+
+// Histogram implements basic operations on metric with type histogram.
+// Histogram series is identified by name and labels.
+type Histogram interface {
+	// SetHistogram sets Histogram value
+	SetHistogram(name string, labels models.Labels, value models.HistogramValue) models.HistogramValue
+	// GetHistogram returns Histogram value
+	GetHistogram(name string, labels models.Labels) (models.HistogramValue, bool)
+	// DelHistogram deletes Histogram
+	DelHistogram(name string, labels models.Labels)
+}
+
+// Batch keeps identifiers of already applied update batches
+type Batch interface {
+	// AddBatch registers batch id applied at ts, returns false if id is already registered.
+	// Error means it is unknown whether id is registered, batch should not be applied.
+	AddBatch(id string, ts time.Time) (bool, error)
+	// DelBatch removes batch id
+	DelBatch(id string)
+	// PurgeBatches removes all batches registered before ts
+	PurgeBatches(before time.Time)
 }
 
 // Store defines methods that should be implemented by any store.
 type Store interface {
 	Gauge
 	Counter
+	Histogram
+	Batch
 	// Snapshot creates storage snapshot and returns it
 	// if flush is true, stored metrics are deleted
 	Snapshot(flush bool) []models.Metrics
 	Ping() error
 }
+
+// History is optionally implemented by stores, which keep history of metrics values
+type History interface {
+	// History returns metric values for period [from, to) downsampled to one sample per step
+	History(name string, mType string, labels models.Labels, from, to time.Time, step time.Duration) ([]models.Sample, error)
+}
+
+// BatchUpdater is optionally implemented by stores, which register batch id and apply its metrics atomically
+type BatchUpdater interface {
+	// UpdateBatch registers batch id applied at ts and applies metrics in one transaction, returns metrics with new values.
+	// ErrBatchApplied is returned if id is already registered. Nothing is applied on error.
+	UpdateBatch(id string, ts time.Time, metrics []models.Metrics) ([]models.Metrics, error)
+}
+
+// UpdateTimes is optionally implemented by stores, which keep the last update time of metrics
+type UpdateTimes interface {
+	// UpdateTimes returns the last update time of every stored metric series
+	UpdateTimes() ([]models.SeriesUpdate, error)
+}
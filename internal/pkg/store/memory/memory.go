@@ -5,107 +5,200 @@ package memory
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
 	"github.com/freepaddler/yap-metrics/internal/pkg/store"
 )
 
+// counterSeries is a counter series with value
+type counterSeries struct {
+	name   string
+	labels models.Labels
+	value  int64
+}
+
+// gaugeSeries is a gauge series with value
+type gaugeSeries struct {
+	name   string
+	labels models.Labels
+	value  float64
+}
+
+// histogramSeries is a histogram series with value
+type histogramSeries struct {
+	name   string
+	labels models.Labels
+	value  models.HistogramValue
+}
+
 // Store is in-memory metric store structure
 type Store struct {
-	mu       sync.RWMutex
-	counters map[string]int64   // metrics of type counter
-	gauges   map[string]float64 // metrics of type gauge
+	mu         sync.RWMutex
+	counters   map[string]counterSeries   // metrics of type counter by series key
+	gauges     map[string]gaugeSeries     // metrics of type gauge by series key
+	histograms map[string]histogramSeries // metrics of type histogram by series key
+	batches    map[string]time.Time       // applied batches ids
 }
 
 // NewMemoryStore is a constructor for Store
 func NewMemoryStore() *Store {
 	ms := new(Store)
-	ms.counters = make(map[string]int64)
-	ms.gauges = make(map[string]float64)
+	ms.counters = make(map[string]counterSeries)
+	ms.gauges = make(map[string]gaugeSeries)
+	ms.histograms = make(map[string]histogramSeries)
+	ms.batches = make(map[string]time.Time)
 	return ms
 }
 
 // Gauge_old interface implementation
 var _ store.Gauge = (*Store)(nil)
 
-// SetGauge creates or updates gauge metric value in storage by its name
-func (ms *Store) SetGauge(name string, fValue float64) float64 {
+// SetGauge creates or updates gauge metric value in storage by its name and labels
+func (ms *Store) SetGauge(name string, labels models.Labels, fValue float64) float64 {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	ms.gauges[name] = fValue
-	logger.Log().Debug().Msgf("SetGauge: store value %f for gauge %s", fValue, name)
+	ms.gauges[models.SeriesKey(name, labels)] = gaugeSeries{name: name, labels: labels, value: fValue}
+	logger.Log().Debug().Msgf("SetGauge: store value %f for gauge %s%s", fValue, name, labels)
 	return fValue
 
 }
 
-// GetGauge returns gauge metric value and existence flag by its name
-func (ms *Store) GetGauge(name string) (float64, bool) {
+// GetGauge returns gauge metric value and existence flag by its name and labels
+func (ms *Store) GetGauge(name string, labels models.Labels) (float64, bool) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
-	v, ok := ms.gauges[name]
-	return v, ok
+	v, ok := ms.gauges[models.SeriesKey(name, labels)]
+	return v.value, ok
 }
 
-// DelGauge removes gauge metric from storage by its name
-func (ms *Store) DelGauge(name string) {
+// DelGauge removes gauge metric from storage by its name and labels
+func (ms *Store) DelGauge(name string, labels models.Labels) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	delete(ms.gauges, name)
+	delete(ms.gauges, models.SeriesKey(name, labels))
 }
 
 // Counter_old interface implementation
 var _ store.Counter = (*Store)(nil)
 
-// IncCounter creates new or increments counter metric value in storage by its name
-func (ms *Store) IncCounter(name string, iValue int64) int64 {
+// IncCounter creates new or increments counter metric value in storage by its name and labels
+func (ms *Store) IncCounter(name string, labels models.Labels, iValue int64) int64 {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	key := models.SeriesKey(name, labels)
+	c, ok := ms.counters[key]
+	if !ok {
+		c = counterSeries{name: name, labels: labels}
+	}
+	c.value += iValue
+	ms.counters[key] = c
+	logger.Log().Debug().Msgf("IncCounter: add increment %d for counter %s%s", iValue, name, labels)
+	return c.value
+}
+
+// GetCounter returns counter metric value and existence flag by its name and labels
+func (ms *Store) GetCounter(name string, labels models.Labels) (int64, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	v, ok := ms.counters[models.SeriesKey(name, labels)]
+	return v.value, ok
+}
+
+// DelCounter removes gauge metric from storage by its name and labels
+func (ms *Store) DelCounter(name string, labels models.Labels) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	ms.counters[name] += iValue
-	logger.Log().Debug().Msgf("IncCounter: add increment %d for counter %s", iValue, name)
-	// pointer to map will not work
-	v := ms.counters[name]
-	return v
+	delete(ms.counters, models.SeriesKey(name, labels))
 }
 
-// GetCounter returns counter metric value and existence flag by its name
-func (ms *Store) GetCounter(name string) (int64, bool) {
+// Histogram interface implementation
+var _ store.Histogram = (*Store)(nil)
+
+// SetHistogram creates or updates histogram metric value in storage by its name and labels
+func (ms *Store) SetHistogram(name string, labels models.Labels, hValue models.HistogramValue) models.HistogramValue {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.histograms[models.SeriesKey(name, labels)] = histogramSeries{name: name, labels: labels, value: hValue.Copy()}
+	logger.Log().Debug().Msgf("SetHistogram: store value %s for histogram %s%s", hValue.String(), name, labels)
+	return hValue
+}
+
+// GetHistogram returns histogram metric value and existence flag by its name and labels
+func (ms *Store) GetHistogram(name string, labels models.Labels) (models.HistogramValue, bool) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
-	v, ok := ms.counters[name]
-	return v, ok
+	v, ok := ms.histograms[models.SeriesKey(name, labels)]
+	return v.value.Copy(), ok
 }
 
-// DelCounter removes gauge metric from storage by its name
-func (ms *Store) DelCounter(name string) {
+// DelHistogram removes histogram metric from storage by its name and labels
+func (ms *Store) DelHistogram(name string, labels models.Labels) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	delete(ms.counters, name)
+	delete(ms.histograms, models.SeriesKey(name, labels))
+}
+
+// Batch interface implementation
+var _ store.Batch = (*Store)(nil)
+
+// AddBatch registers batch id, returns false if batch is already registered
+func (ms *Store) AddBatch(id string, ts time.Time) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.batches[id]; ok {
+		return false, nil
+	}
+	ms.batches[id] = ts
+	return true, nil
+}
+
+// DelBatch removes batch id from storage
+func (ms *Store) DelBatch(id string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.batches, id)
+}
+
+// PurgeBatches removes all batches registered before ts
+func (ms *Store) PurgeBatches(before time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for id, ts := range ms.batches {
+		if ts.Before(before) {
+			delete(ms.batches, id)
+		}
+	}
 }
 
 // Store interface implementation
 var _ store.Store = (*Store)(nil)
 
-// Snapshot returns all current memory store metrics in sorted by name slice
+// Snapshot returns all current memory store metrics
 func (ms *Store) Snapshot(flush bool) []models.Metrics {
-	ms.mu.RLock()
-	defer ms.mu.RUnlock()
-	// arrays of snapshot values (not pointers)
-	counterV := make([]int64, len(ms.counters))
-	gaugesV := make([]float64, len(ms.gauges))
-	set := make([]models.Metrics, 0, len(ms.counters)+len(ms.gauges))
-	for name, value := range ms.counters {
-		counterV = append(counterV, value)
-		set = append(set, models.Metrics{Type: models.Counter, Name: name, IValue: &counterV[len(counterV)-1]})
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	set := make([]models.Metrics, 0, len(ms.counters)+len(ms.gauges)+len(ms.histograms))
+	for key, c := range ms.counters {
+		value := c.value
+		set = append(set, models.Metrics{Type: models.Counter, Name: c.name, Labels: c.labels, IValue: &value})
+		if flush {
+			delete(ms.counters, key)
+		}
+	}
+	for key, g := range ms.gauges {
+		value := g.value
+		set = append(set, models.Metrics{Type: models.Gauge, Name: g.name, Labels: g.labels, FValue: &value})
 		if flush {
-			delete(ms.counters, name)
+			delete(ms.gauges, key)
 		}
 	}
-	for name, value := range ms.gauges {
-		gaugesV = append(gaugesV, value)
-		set = append(set, models.Metrics{Type: models.Gauge, Name: name, FValue: &gaugesV[len(gaugesV)-1]})
+	for key, h := range ms.histograms {
+		value := h.value.Copy()
+		set = append(set, models.Metrics{Type: models.Histogram, Name: h.name, Labels: h.labels, HValue: &value})
 		if flush {
-			delete(ms.gauges, name)
+			delete(ms.histograms, key)
 		}
 	}
 	return set
@@ -3,6 +3,7 @@ package memory
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -82,10 +83,10 @@ func PrepareTestStorage() (*Store, []gauge, []counter) {
 		},
 	}
 	for _, v := range counters {
-		s.IncCounter(v.Name, v.IValue)
+		s.IncCounter(v.Name, nil, v.IValue)
 	}
 	for _, v := range gauges {
-		s.SetGauge(v.Name, v.FValue)
+		s.SetGauge(v.Name, nil, v.FValue)
 	}
 	return s, gauges, counters
 }
@@ -123,7 +124,7 @@ func Test_IncCounter(t *testing.T) {
 	s := NewMemoryStore()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			v := s.IncCounter(tt.mName, tt.iValue)
+			v := s.IncCounter(tt.mName, nil, tt.iValue)
 			assert.Equal(t, tt.wantValue, v)
 		})
 	}
@@ -151,7 +152,7 @@ func Test_GetCounter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run("GetCounter: "+tt.name, func(t *testing.T) {
-			v, ok := s.GetCounter(tt.mName)
+			v, ok := s.GetCounter(tt.mName, nil)
 			require.Equal(t, tt.wantOk, ok)
 			if ok {
 				assert.Equal(t, tt.wantValue, v)
@@ -164,11 +165,11 @@ func Test_GetCounter(t *testing.T) {
 func Test_DelCounter(t *testing.T) {
 	s, _, _ := PrepareTestStorage()
 	// check that counter exists in storage before deletion
-	_, ok := s.GetCounter(eCounter2)
+	_, ok := s.GetCounter(eCounter2, nil)
 	require.Truef(t, ok, "Prepared set failed, counter should exist")
 	// check that counter deleted form storage
-	s.DelCounter(eCounter2)
-	_, ok = s.GetCounter(eCounter2)
+	s.DelCounter(eCounter2, nil)
+	_, ok = s.GetCounter(eCounter2, nil)
 	assert.Falsef(t, ok, "counter exists, but should be deleted")
 }
 
@@ -205,8 +206,8 @@ func Test_SetGauge(t *testing.T) {
 	s := NewMemoryStore()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s.SetGauge(tt.mName, tt.fValue)
-			v, ok := s.GetGauge(tt.mName)
+			s.SetGauge(tt.mName, nil, tt.fValue)
+			v, ok := s.GetGauge(tt.mName, nil)
 			require.Equal(t, tt.wantOk, ok)
 			assert.Equal(t, tt.wantValue, v)
 		})
@@ -235,7 +236,7 @@ func Test_GetGauge(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			v, ok := s.GetGauge(tt.mName)
+			v, ok := s.GetGauge(tt.mName, nil)
 			require.Equal(t, tt.wantOk, ok)
 			if ok {
 				assert.Equal(t, tt.wantValue, v)
@@ -248,11 +249,11 @@ func Test_GetGauge(t *testing.T) {
 func Test_DelGauge(t *testing.T) {
 	s, _, _ := PrepareTestStorage()
 	// check that gauge exists in storage before deletion
-	_, ok := s.GetGauge(eGauge2)
+	_, ok := s.GetGauge(eGauge2, nil)
 	require.Truef(t, ok, "Prepared set failed, gauge should exist")
 	// check that gauge deleted form storage
-	s.DelGauge(eGauge2)
-	_, ok = s.GetGauge(eGauge2)
+	s.DelGauge(eGauge2, nil)
+	_, ok = s.GetGauge(eGauge2, nil)
 	assert.Falsef(t, ok, "gauge exists, but should be deleted")
 }
 
@@ -285,3 +286,94 @@ func Test_Snapshot(t *testing.T) {
 
 	})
 }
+
+func Test_Batches(t *testing.T) {
+	s := NewMemoryStore()
+	ts := time.Now()
+	add := func(id string, ts time.Time) bool {
+		added, err := s.AddBatch(id, ts)
+		require.NoError(t, err)
+		return added
+	}
+
+	require.True(t, add("b1", ts.Add(-time.Minute)), "new batch should be added")
+	require.False(t, add("b1", ts), "existing batch should not be added")
+	require.True(t, add("b2", ts), "new batch should be added")
+
+	s.DelBatch("b2")
+	require.True(t, add("b2", ts), "deleted batch should be added again")
+
+	s.PurgeBatches(ts)
+	assert.True(t, add("b1", ts), "purged batch should be added again")
+	assert.False(t, add("b2", ts), "batch should not be purged")
+}
+
+func Test_Labels(t *testing.T) {
+	s := NewMemoryStore()
+	cpu1 := models.Labels{"cpu": "1"}
+	cpu2 := models.Labels{"cpu": "2"}
+
+	s.SetGauge("cpu", cpu1, 1)
+	s.SetGauge("cpu", cpu2, 2)
+	s.SetGauge("cpu", nil, 3)
+	s.IncCounter("cpu", cpu1, 4)
+
+	v, ok := s.GetGauge("cpu", models.Labels{"cpu": "1"})
+	require.True(t, ok)
+	assert.Equal(t, float64(1), v)
+	v, ok = s.GetGauge("cpu", cpu2)
+	require.True(t, ok)
+	assert.Equal(t, float64(2), v)
+	v, ok = s.GetGauge("cpu", nil)
+	require.True(t, ok)
+	assert.Equal(t, float64(3), v)
+	_, ok = s.GetGauge("cpu", models.Labels{"cpu": "3"})
+	assert.False(t, ok)
+
+	s.DelGauge("cpu", cpu1)
+	_, ok = s.GetGauge("cpu", cpu1)
+	assert.False(t, ok)
+	_, ok = s.GetCounter("cpu", cpu1)
+	assert.True(t, ok)
+
+	m := s.Snapshot(false)
+	assert.ElementsMatch(t, []models.Metrics{
+		{Name: "cpu", Type: models.Gauge, Labels: cpu2, FValue: pointer(float64(2))},
+		{Name: "cpu", Type: models.Gauge, FValue: pointer(float64(3))},
+		{Name: "cpu", Type: models.Counter, Labels: cpu1, IValue: pointer(int64(4))},
+	}, m)
+}
+
+func Test_Histogram(t *testing.T) {
+	s := NewMemoryStore()
+	labels := models.Labels{"path": "/"}
+	h := models.HistogramValue{Bounds: []float64{0.5}, Counts: []int64{1, 1}, Count: 2, Sum: 1.2}
+
+	_, ok := s.GetHistogram("latency", labels)
+	require.False(t, ok)
+
+	assert.Equal(t, h, s.SetHistogram("latency", labels, h))
+	// stored value should not share buckets with the argument
+	h.Counts[0] = 10
+	v, ok := s.GetHistogram("latency", labels)
+	require.True(t, ok)
+	assert.Equal(t, []int64{1, 1}, v.Counts)
+
+	m := s.Snapshot(true)
+	require.Len(t, m, 1)
+	assert.Equal(t, models.Histogram, m[0].Type)
+	assert.Equal(t, labels, m[0].Labels)
+	assert.Equal(t, v, *m[0].HValue)
+
+	_, ok = s.GetHistogram("latency", labels)
+	assert.False(t, ok, "histogram should be flushed")
+
+	s.SetHistogram("latency", nil, v)
+	s.DelHistogram("latency", nil)
+	_, ok = s.GetHistogram("latency", nil)
+	assert.False(t, ok)
+}
+
+func pointer[T any](val T) *T {
+	return &val
+}
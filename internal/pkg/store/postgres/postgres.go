@@ -3,7 +3,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgerrcode"
@@ -12,6 +14,8 @@ import (
 
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/store"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
 	"github.com/freepaddler/yap-metrics/pkg/retry"
 )
 
@@ -26,16 +30,113 @@ const (
 			i_value BIGINT
 		);	
 	`
+	qMetricsLabels = `
+		ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+	`
+	qMetricsHistogram = `
+		ALTER TABLE metrics ADD COLUMN IF NOT EXISTS h_value JSONB;
+	`
+	qMetricsOldIdx = `
+		DROP INDEX IF EXISTS idx_metrics_name_type;
+	`
+	qSamplesTbl = `
+		CREATE TABLE IF NOT EXISTS samples 	(
+			ts      TIMESTAMPTZ NOT NULL,
+			name    VARCHAR NOT NULL,
+			type    VARCHAR NOT NULL,
+			labels  JSONB NOT NULL DEFAULT '{}'::jsonb,
+			f_value DOUBLE PRECISION,
+			i_value BIGINT
+		);
+	`
+	qSamplesTSIdx = `
+		CREATE INDEX IF NOT EXISTS idx_samples_ts ON samples (ts);
+	`
+	qBatchesTbl = `
+		CREATE TABLE IF NOT EXISTS batches 	(
+			id         VARCHAR PRIMARY KEY,
+			applied_ts TIMESTAMPTZ NOT NULL DEFAULT current_timestamp(3)
+		);
+	`
+	// tenants isolation: tenant is a part of metric series, history sample and batch identity
+	qMetricsTenant = `
+		ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant VARCHAR NOT NULL DEFAULT 'default';
+	`
 	qMetricsIdx = `
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_name_type
-			ON metrics (name, type);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_tenant_name_type_labels
+			ON metrics (tenant, name, type, labels);
+	`
+	qMetricsLabelsIdxDrop = `
+		DROP INDEX IF EXISTS idx_metrics_name_type_labels;
+	`
+	qSamplesTenant = `
+		ALTER TABLE samples ADD COLUMN IF NOT EXISTS tenant VARCHAR NOT NULL DEFAULT 'default';
+	`
+	qSamplesIdx = `
+		CREATE INDEX IF NOT EXISTS idx_samples_tenant_name_type_labels_ts
+			ON samples (tenant, name, type, labels, ts);
+	`
+	qSamplesIdxDrop = `
+		DROP INDEX IF EXISTS idx_samples_name_type_labels;
+	`
+	qBatchesTenant = `
+		ALTER TABLE batches ADD COLUMN IF NOT EXISTS tenant VARCHAR NOT NULL DEFAULT 'default';
+	`
+	qBatchesPKeyDrop = `
+		ALTER TABLE batches DROP CONSTRAINT IF EXISTS batches_pkey;
+	`
+	qBatchesTenantIdx = `
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_batches_tenant_id ON batches (tenant, id);
+	`
+	// metrics updates, gauge and counter updates are recorded to history samples
+	qSetGauge = `
+		WITH m AS (
+			INSERT INTO metrics (name,type,labels,f_value,updated_ts,tenant) VALUES ($1,$2,$3::jsonb,$4,$5,$6)
+			ON CONFLICT (tenant,name,type,labels)
+				DO UPDATE SET f_value = excluded.f_value, updated_ts = excluded.updated_ts
+			RETURNING f_value
+		), s AS (
+			INSERT INTO samples (ts,name,type,labels,f_value,tenant) SELECT $5,$1,$2,$3::jsonb,f_value,$6 FROM m
+		)
+		SELECT f_value FROM m
+	`
+	qIncCounter = `
+		WITH m AS (
+			INSERT INTO metrics (name,type,labels,i_value,updated_ts,tenant) VALUES ($1,$2,$3::jsonb,$4,$5,$6)
+			ON CONFLICT (tenant,name,type,labels)
+				DO UPDATE SET i_value = excluded.i_value + metrics.i_value, updated_ts = excluded.updated_ts
+			RETURNING i_value
+		), s AS (
+			INSERT INTO samples (ts,name,type,labels,i_value,tenant) SELECT $5,$1,$2,$3::jsonb,i_value,$6 FROM m
+		)
+		SELECT i_value FROM m
+	`
+	qSetHistogram = `
+		INSERT INTO metrics (name,type,labels,h_value,updated_ts,tenant) VALUES ($1,$2,$3::jsonb,$4::jsonb,$5,$6)
+		ON CONFLICT (tenant,name,type,labels)
+			DO UPDATE SET h_value = excluded.h_value, updated_ts = excluded.updated_ts
+		RETURNING h_value
+	`
+	qAddBatch = `
+		INSERT INTO batches (id,applied_ts,tenant) VALUES ($1,$2,$3)
+		ON CONFLICT (tenant,id) DO NOTHING
 	`
 )
 
+// PostgresStore keeps metrics of tenant in database, see Tenant
 type PostgresStore struct {
+	*conn
+	tenant string
+}
+
+// conn is a database connection shared by all tenants stores
+type conn struct {
 	db        *sql.DB
 	dbTimeout time.Duration
 	retry     []int
+	retention time.Duration // how long samples history is kept, 0 keeps forever
+	stop      chan struct{}
+	wg        sync.WaitGroup
 }
 
 func WithTimeout(to time.Duration) func(ps *PostgresStore) {
@@ -50,9 +151,19 @@ func WithRetry(retries ...int) func(ps *PostgresStore) {
 	}
 }
 
+// WithRetention sets period to keep metrics history samples. Zero value keeps history forever.
+func WithRetention(d time.Duration) func(ps *PostgresStore) {
+	return func(ps *PostgresStore) {
+		ps.retention = d
+	}
+}
+
 // NewPostgresStorage connects to database and returns Store in case of success
 func NewPostgresStorage(uri string, opts ...func(store *PostgresStore)) (*PostgresStore, error) {
-	ps := &PostgresStore{dbTimeout: time.Second}
+	ps := &PostgresStore{
+		conn:   &conn{dbTimeout: time.Second, stop: make(chan struct{})},
+		tenant: tenant.Default,
+	}
 	for _, o := range opts {
 		o(ps)
 	}
@@ -69,14 +180,23 @@ func NewPostgresStorage(uri string, opts ...func(store *PostgresStore)) (*Postgr
 		logger.Log().Error().Err(err).Msg("unable to init database")
 		return nil, err
 	}
+	if ps.retention > 0 {
+		ps.wg.Add(1)
+		go ps.pruneLoop()
+	}
 	return ps, nil
 }
 
 // initDB creates necessary database entities: tables, indexes, etc...
-func (ps *PostgresStore) initDB() (err error) {
-	for _, q := range []string{qMetricsTbl, qMetricsIdx} {
+// Stops on the first failed query, as the next ones depend on it.
+func (ps *PostgresStore) initDB() error {
+	for _, q := range []string{
+		qMetricsTbl, qMetricsLabels, qMetricsHistogram, qMetricsTenant, qMetricsOldIdx, qMetricsLabelsIdxDrop, qMetricsIdx,
+		qSamplesTbl, qSamplesTenant, qSamplesIdxDrop, qSamplesIdx, qSamplesTSIdx,
+		qBatchesTbl, qBatchesTenant, qBatchesPKeyDrop, qBatchesTenantIdx,
+	} {
 		logger.Log().Debug().Msgf("run db init %s", q)
-		err = retry.WithStrategy(context.TODO(),
+		err := retry.WithStrategy(context.TODO(),
 			func(ctx context.Context) error {
 				ctxDB, ctxDBCancel := context.WithTimeout(ctx, ps.dbTimeout)
 				defer ctxDBCancel()
@@ -85,22 +205,71 @@ func (ps *PostgresStore) initDB() (err error) {
 			},
 			isRetryErr,
 			1, 3, 5)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tenant returns store of tenant metrics, it shares database connection with ps
+func (ps *PostgresStore) Tenant(name string) store.Store {
+	return &PostgresStore{conn: ps.conn, tenant: name}
+}
+
+// Tenants returns names of tenants having metrics in database
+func (ps *PostgresStore) Tenants() (tenants []string) {
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			tenants = tenants[:0]
+			rows, err := ps.db.QueryContext(ctx, `SELECT DISTINCT tenant FROM metrics ORDER BY tenant`)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var t string
+				if err := rows.Scan(&t); err != nil {
+					return err
+				}
+				tenants = append(tenants, t)
+			}
+			return rows.Err()
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("Tenants: failed")
 	}
 	return
 }
 
-func (ps *PostgresStore) SetGauge(name string, value float64) (res float64) {
-	logger.Log().Debug().Msgf("SetGauge: store value %f for gauge %s", value, name)
+// HasTenant checks tenant has metrics in database
+func (ps *PostgresStore) HasTenant(name string) (exists bool) {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
 			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
 			defer cancel()
-			return ps.db.QueryRowContext(ctx, `
-				INSERT INTO metrics (name,type,f_value,updated_ts) VALUES ($1,$2,$3,$4)
-				ON CONFLICT (name,type)
-					DO UPDATE SET f_value = excluded.f_value
-				RETURNING f_value`,
-				name, models.Gauge, value, time.Now()).Scan(&res)
+			return ps.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM metrics WHERE tenant=$1)`, name).Scan(&exists)
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("HasTenant: failed")
+	}
+	return
+}
+
+func (ps *PostgresStore) SetGauge(name string, labels models.Labels, value float64) (res float64) {
+	logger.Log().Debug().Msgf("SetGauge: store value %f for gauge %s%s", value, name, labels)
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			return ps.db.QueryRowContext(ctx, qSetGauge,
+				name, models.Gauge, labelsJSON(labels), value, time.Now(), ps.tenant).Scan(&res)
 		},
 		isRetryErr,
 		1, 3, 5)
@@ -110,14 +279,14 @@ func (ps *PostgresStore) SetGauge(name string, value float64) (res float64) {
 	return
 }
 
-func (ps *PostgresStore) GetGauge(name string) (res float64, found bool) {
+func (ps *PostgresStore) GetGauge(name string, labels models.Labels) (res float64, found bool) {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
 			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
 			defer cancel()
 			return ps.db.QueryRowContext(ctx, `
-				SELECT f_value FROM metrics WHERE name=$1 and type=$2`,
-				name, models.Gauge).Scan(&res)
+				SELECT f_value FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4`,
+				name, models.Gauge, labelsJSON(labels), ps.tenant).Scan(&res)
 		},
 		isRetryErr,
 		1, 3, 5)
@@ -130,14 +299,14 @@ func (ps *PostgresStore) GetGauge(name string) (res float64, found bool) {
 	found = true
 	return
 }
-func (ps *PostgresStore) DelGauge(name string) {
+func (ps *PostgresStore) DelGauge(name string, labels models.Labels) {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
 			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
 			defer cancel()
 			_, err := ps.db.ExecContext(ctx, `
-				DELETE FROM metrics WHERE name=$1 and type=$2`,
-				name, models.Gauge)
+				DELETE FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4`,
+				name, models.Gauge, labelsJSON(labels), ps.tenant)
 			return err
 		},
 		isRetryErr,
@@ -147,18 +316,14 @@ func (ps *PostgresStore) DelGauge(name string) {
 	}
 }
 
-func (ps *PostgresStore) IncCounter(name string, value int64) (res int64) {
-	logger.Log().Debug().Msgf("IncCounter: add increment %d for counter %s", value, name)
+func (ps *PostgresStore) IncCounter(name string, labels models.Labels, value int64) (res int64) {
+	logger.Log().Debug().Msgf("IncCounter: add increment %d for counter %s%s", value, name, labels)
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
 			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
 			defer cancel()
-			return ps.db.QueryRowContext(ctx, `
-				INSERT INTO metrics (name,type,i_value,updated_ts) VALUES ($1,$2,$3,$4)
-				ON CONFLICT (name,type)
-					DO UPDATE SET i_value = excluded.i_value + metrics.i_value
-				RETURNING i_value`,
-				name, models.Counter, value, time.Now()).Scan(&res)
+			return ps.db.QueryRowContext(ctx, qIncCounter,
+				name, models.Counter, labelsJSON(labels), value, time.Now(), ps.tenant).Scan(&res)
 		},
 		isRetryErr,
 		1, 3, 5)
@@ -168,14 +333,14 @@ func (ps *PostgresStore) IncCounter(name string, value int64) (res int64) {
 	return
 }
 
-func (ps *PostgresStore) GetCounter(name string) (res int64, found bool) {
+func (ps *PostgresStore) GetCounter(name string, labels models.Labels) (res int64, found bool) {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
 			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
 			defer cancel()
 			return ps.db.QueryRowContext(ctx, `
-				SELECT i_value FROM metrics WHERE name=$1 and type=$2`,
-				name, models.Counter).Scan(&res)
+				SELECT i_value FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4`,
+				name, models.Counter, labelsJSON(labels), ps.tenant).Scan(&res)
 		},
 		isRetryErr,
 		1, 3, 5)
@@ -189,14 +354,14 @@ func (ps *PostgresStore) GetCounter(name string) (res int64, found bool) {
 	return
 }
 
-func (ps *PostgresStore) DelCounter(name string) {
+func (ps *PostgresStore) DelCounter(name string, labels models.Labels) {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
 			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
 			defer cancel()
 			_, err := ps.db.ExecContext(ctx, `
-				DELETE FROM metrics WHERE name=$1 and type=$2`,
-				name, models.Counter)
+				DELETE FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4`,
+				name, models.Counter, labelsJSON(labels), ps.tenant)
 			return err
 		},
 		isRetryErr,
@@ -206,6 +371,238 @@ func (ps *PostgresStore) DelCounter(name string) {
 	}
 }
 
+// SetHistogram creates or updates histogram metric value by its name and labels
+func (ps *PostgresStore) SetHistogram(name string, labels models.Labels, value models.HistogramValue) (res models.HistogramValue) {
+	logger.Log().Debug().Msgf("SetHistogram: store value %s for histogram %s%s", value.String(), name, labels)
+	hValue, err := json.Marshal(value)
+	if err != nil {
+		logger.Log().Err(err).Msg("SetHistogram: failed")
+		return
+	}
+	err = retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			var b []byte
+			if err := ps.db.QueryRowContext(ctx, qSetHistogram,
+				name, models.Histogram, labelsJSON(labels), string(hValue), time.Now(), ps.tenant).Scan(&b); err != nil {
+				return err
+			}
+			return json.Unmarshal(b, &res)
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("SetHistogram: failed")
+	}
+	return
+}
+
+// GetHistogram returns histogram metric value and existence flag by its name and labels
+func (ps *PostgresStore) GetHistogram(name string, labels models.Labels) (res models.HistogramValue, found bool) {
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			var b []byte
+			if err := ps.db.QueryRowContext(ctx, `
+				SELECT h_value FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4`,
+				name, models.Histogram, labelsJSON(labels), ps.tenant).Scan(&b); err != nil {
+				return err
+			}
+			return json.Unmarshal(b, &res)
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		logger.Log().Err(err).Msg("GetHistogram: failed")
+	}
+	found = true
+	return
+}
+
+// DelHistogram removes histogram metric by its name and labels
+func (ps *PostgresStore) DelHistogram(name string, labels models.Labels) {
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			_, err := ps.db.ExecContext(ctx, `
+				DELETE FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4`,
+				name, models.Histogram, labelsJSON(labels), ps.tenant)
+			return err
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("DelHistogram: failed")
+	}
+}
+
+// AddBatch registers batch id, returns false if batch is already registered
+func (ps *PostgresStore) AddBatch(id string, ts time.Time) (added bool, err error) {
+	err = retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			res, err := ps.db.ExecContext(ctx, qAddBatch, id, ts, ps.tenant)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			added = n > 0
+			return nil
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("AddBatch: failed")
+	}
+	return
+}
+
+// BatchUpdater interface implementation
+var _ store.BatchUpdater = (*PostgresStore)(nil)
+
+// UpdateBatch registers batch id and applies metrics in one transaction, returns metrics with new values.
+// Returns store.ErrBatchApplied if batch is already registered.
+func (ps *PostgresStore) UpdateBatch(id string, ts time.Time, metrics []models.Metrics) (updated []models.Metrics, err error) {
+	logger.Log().Debug().Msgf("UpdateBatch: apply batch '%s' of %d metrics", id, len(metrics))
+	err = retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			tx, err := ps.db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			res, err := tx.ExecContext(ctx, qAddBatch, id, ts, ps.tenant)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return store.ErrBatchApplied
+			}
+			updated = make([]models.Metrics, 0, len(metrics))
+			for _, m := range metrics {
+				if err := ps.updateTx(ctx, tx, &m, ts); err != nil {
+					return err
+				}
+				updated = append(updated, m)
+			}
+			return tx.Commit()
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		updated = nil
+		if !errors.Is(err, store.ErrBatchApplied) {
+			logger.Log().Err(err).Msg("UpdateBatch: failed")
+		}
+	}
+	return
+}
+
+// updateTx updates metric in transaction, sets new value to metric
+func (ps *PostgresStore) updateTx(ctx context.Context, tx *sql.Tx, m *models.Metrics, ts time.Time) error {
+	labels := labelsJSON(m.Labels)
+	switch m.Type {
+	case models.Counter:
+		var v int64
+		if err := tx.QueryRowContext(ctx, qIncCounter, m.Name, m.Type, labels, *m.IValue, ts, ps.tenant).Scan(&v); err != nil {
+			return err
+		}
+		m.IValue = &v
+	case models.Gauge:
+		var v float64
+		if err := tx.QueryRowContext(ctx, qSetGauge, m.Name, m.Type, labels, *m.FValue, ts, ps.tenant).Scan(&v); err != nil {
+			return err
+		}
+		m.FValue = &v
+	case models.Histogram:
+		// stored value is locked till the end of transaction
+		v := m.HValue.Copy()
+		var b []byte
+		err := tx.QueryRowContext(ctx, `
+			SELECT h_value FROM metrics WHERE name=$1 and type=$2 and labels=$3::jsonb and tenant=$4 FOR UPDATE`,
+			m.Name, m.Type, labels, ps.tenant).Scan(&b)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			var stored models.HistogramValue
+			if err := json.Unmarshal(b, &stored); err != nil {
+				return err
+			}
+			if err := stored.Merge(v); err != nil {
+				return err
+			}
+			v = stored
+		}
+		hValue, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, qSetHistogram, m.Name, m.Type, labels, string(hValue), ts, ps.tenant).Scan(&b); err != nil {
+			return err
+		}
+		v = models.HistogramValue{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		m.HValue = &v
+	default:
+		return models.ErrInvalidType
+	}
+	return nil
+}
+
+// DelBatch removes batch id
+func (ps *PostgresStore) DelBatch(id string) {
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			_, err := ps.db.ExecContext(ctx, `
+				DELETE FROM batches WHERE id=$1 and tenant=$2`,
+				id, ps.tenant)
+			return err
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("DelBatch: failed")
+	}
+}
+
+// PurgeBatches removes all batches registered before ts
+func (ps *PostgresStore) PurgeBatches(before time.Time) {
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			_, err := ps.db.ExecContext(ctx, `
+				DELETE FROM batches WHERE applied_ts < $1 and tenant=$2`,
+				before, ps.tenant)
+			return err
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("PurgeBatches: failed")
+	}
+}
+
 func (ps *PostgresStore) Snapshot(flush bool) (metrics []models.Metrics) {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
@@ -216,7 +613,7 @@ func (ps *PostgresStore) Snapshot(flush bool) (metrics []models.Metrics) {
 				return err
 			}
 			defer tx.Rollback()
-			rows, err := tx.QueryContext(ctx, `SELECT name,type,i_value,f_value FROM metrics`)
+			rows, err := tx.QueryContext(ctx, `SELECT name,type,labels,i_value,f_value,h_value FROM metrics WHERE tenant=$1`, ps.tenant)
 			if err != nil {
 				if errors.Is(err, sql.ErrNoRows) {
 					return nil
@@ -225,14 +622,27 @@ func (ps *PostgresStore) Snapshot(flush bool) (metrics []models.Metrics) {
 			}
 			for rows.Next() {
 				var m models.Metrics
-				if err := rows.Scan(&m.Name, &m.Type, &m.IValue, &m.FValue); err != nil {
+				var labels, hValue []byte
+				if err := rows.Scan(&m.Name, &m.Type, &labels, &m.IValue, &m.FValue, &hValue); err != nil {
+					return err
+				}
+				if err := json.Unmarshal(labels, &m.Labels); err != nil {
 					return err
 				}
+				if len(m.Labels) == 0 {
+					m.Labels = nil
+				}
 				switch m.Type {
 				case models.Gauge:
 					m.IValue = nil
 				case models.Counter:
 					m.FValue = nil
+				case models.Histogram:
+					m.IValue, m.FValue = nil, nil
+					m.HValue = new(models.HistogramValue)
+					if err := json.Unmarshal(hValue, m.HValue); err != nil {
+						return err
+					}
 				}
 				metrics = append(metrics, m)
 			}
@@ -243,7 +653,7 @@ func (ps *PostgresStore) Snapshot(flush bool) (metrics []models.Metrics) {
 				return err
 			}
 			if flush {
-				tx.ExecContext(ctx, `TRUNCATE TABLE metrics`)
+				tx.ExecContext(ctx, `DELETE FROM metrics WHERE tenant=$1`, ps.tenant)
 			}
 			return tx.Commit()
 		},
@@ -255,6 +665,44 @@ func (ps *PostgresStore) Snapshot(flush bool) (metrics []models.Metrics) {
 	return
 }
 
+var _ store.UpdateTimes = (*PostgresStore)(nil)
+
+// UpdateTimes returns the last update time of every stored metric series of tenant
+func (ps *PostgresStore) UpdateTimes() (updates []models.SeriesUpdate, err error) {
+	err = retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			updates = updates[:0]
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			rows, err := ps.db.QueryContext(ctx, `SELECT name,type,labels,updated_ts FROM metrics WHERE tenant=$1`, ps.tenant)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var u models.SeriesUpdate
+				var labels []byte
+				if err := rows.Scan(&u.Name, &u.Type, &labels, &u.TS); err != nil {
+					return err
+				}
+				if err := json.Unmarshal(labels, &u.Labels); err != nil {
+					return err
+				}
+				if len(u.Labels) == 0 {
+					u.Labels = nil
+				}
+				updates = append(updates, u)
+			}
+			return rows.Err()
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("UpdateTimes: failed")
+	}
+	return
+}
+
 func (ps *PostgresStore) Ping() error {
 	err := retry.WithStrategy(context.TODO(),
 		func(ctx context.Context) error {
@@ -267,9 +715,101 @@ func (ps *PostgresStore) Ping() error {
 	return err
 }
 
-// Close closes database connection
+// History returns metric values for period [from, to) downsampled to one sample per step.
+// Sample timestamp is the beginning of step. Gauge sample is an average value within step,
+// counter sample is the last value within step.
+func (ps *PostgresStore) History(name string, mType string, labels models.Labels, from, to time.Time, step time.Duration) (samples []models.Sample, err error) {
+	var agg string
+	switch mType {
+	case models.Gauge:
+		agg = "avg(f_value)"
+	case models.Counter:
+		agg = "(array_agg(i_value ORDER BY ts DESC))[1]"
+	default:
+		return nil, models.ErrInvalidType
+	}
+	err = retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			samples = samples[:0]
+			rows, err := ps.db.QueryContext(ctx, `
+				SELECT to_timestamp(floor(extract(epoch FROM ts) / $6::float8) * $6::float8) AS step_ts, `+agg+`::double precision
+				FROM samples
+				WHERE name=$1 and type=$2 and labels=$3::jsonb and ts >= $4 and ts < $5 and tenant=$7
+				GROUP BY step_ts
+				ORDER BY step_ts`,
+				name, mType, labelsJSON(labels), from, to, step.Seconds(), ps.tenant)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var s models.Sample
+				if err := rows.Scan(&s.TS, &s.Value); err != nil {
+					return err
+				}
+				samples = append(samples, s)
+			}
+			return rows.Err()
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("History: failed")
+	}
+	return
+}
+
+// pruneHistory removes samples older than before
+func (ps *PostgresStore) pruneHistory(before time.Time) {
+	err := retry.WithStrategy(context.TODO(),
+		func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, ps.dbTimeout)
+			defer cancel()
+			res, err := ps.db.ExecContext(ctx, `DELETE FROM samples WHERE ts < $1`, before)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				logger.Log().Debug().Msgf("pruned %d history samples", n)
+			}
+			return nil
+		},
+		isRetryErr,
+		1, 3, 5)
+	if err != nil {
+		logger.Log().Err(err).Msg("pruneHistory: failed")
+	}
+}
+
+// pruneLoop periodically removes samples older than retention period until store is closed
+func (ps *PostgresStore) pruneLoop() {
+	defer ps.wg.Done()
+	interval := ps.retention / 10
+	switch {
+	case interval > time.Hour:
+		interval = time.Hour
+	case interval < time.Second:
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ps.pruneHistory(time.Now().Add(-ps.retention))
+		select {
+		case <-ticker.C:
+		case <-ps.stop:
+			return
+		}
+	}
+}
+
+// Close stops history pruning and closes database connection
 func (ps *PostgresStore) Close() {
 	logger.Log().Debug().Msg("closing database connection")
+	close(ps.stop)
+	ps.wg.Wait()
 	if ps.db == nil {
 		return
 	}
@@ -278,6 +818,19 @@ func (ps *PostgresStore) Close() {
 	}
 }
 
+// labelsJSON returns labels as JSON object to be used as jsonb query param
+func labelsJSON(labels models.Labels) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		logger.Log().Warn().Err(err).Msg("unable to marshal labels")
+		return "{}"
+	}
+	return string(b)
+}
+
 // isRetryErr returns true, when error is retryable regarding postgres requests
 func isRetryErr(err error) bool {
 	if retry.IsNetErr(err) || errors.Is(err, context.DeadlineExceeded) {
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+)
+
+// TenantFactory provides isolated stores of tenants
+type TenantFactory interface {
+	// Tenant returns store of tenant metrics
+	Tenant(name string) Store
+	// Tenants returns names of tenants, which already have metrics in storage
+	Tenants() []string
+	// HasTenant checks tenant already has metrics in storage
+	HasTenant(name string) bool
+}
+
+// NewStoreFunc is a TenantFactory, which creates separate store for every tenant, i.e. memory store
+type NewStoreFunc func() Store
+
+func (f NewStoreFunc) Tenant(string) Store { return f() }
+
+func (f NewStoreFunc) Tenants() []string { return nil }
+
+func (f NewStoreFunc) HasTenant(string) bool { return false }
+
+// ErrTenantNotAllowed is returned on attempt to create tenant, which is not allowed
+var ErrTenantNotAllowed = errors.New("tenant is not allowed")
+
+// Tenants keeps storage controllers of tenants. Tenant exists if it was created or has metrics in storage,
+// default tenant always exists. Tenants are created on update of their metrics, creation may be
+// restricted with the list of allowed tenants.
+type Tenants struct {
+	factory     TenantFactory
+	opts        []func(c *Controller)
+	mu          sync.RWMutex
+	controllers map[string]*Controller
+	allowed     map[string]bool // tenants, which may be created, any if nil
+}
+
+// NewTenants creates tenants storage, controllers options are applied to every tenant controller
+func NewTenants(factory TenantFactory, opts ...func(c *Controller)) *Tenants {
+	return &Tenants{
+		factory:     factory,
+		opts:        opts,
+		controllers: make(map[string]*Controller),
+	}
+}
+
+// Restrict allows to create only tenants with names, tenants existing in storage are not restricted.
+// Empty names list allows any tenant.
+func (t *Tenants) Restrict(names ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(names) == 0 {
+		t.allowed = nil
+		return
+	}
+	t.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		t.allowed[name] = true
+	}
+}
+
+// Default returns storage controller of default tenant
+func (t *Tenants) Default() *Controller {
+	return t.controller(tenant.Default)
+}
+
+// Tenant returns storage controller of existing tenant, empty name is a default tenant.
+// Returns false if tenant does not exist.
+func (t *Tenants) Tenant(name string) (*Controller, bool) {
+	if name == "" || name == tenant.Default {
+		return t.Default(), true
+	}
+	t.mu.RLock()
+	c, ok := t.controllers[name]
+	t.mu.RUnlock()
+	if ok {
+		return c, true
+	}
+	if !t.stored(name) {
+		return nil, false
+	}
+	return t.controller(name), true
+}
+
+// Create returns storage controller of tenant, tenant is created if it does not exist.
+// Returns ErrTenantNotAllowed if tenant does not exist and may not be created.
+func (t *Tenants) Create(name string) (*Controller, error) {
+	if c, ok := t.Tenant(name); ok {
+		return c, nil
+	}
+	t.mu.RLock()
+	allowed := t.allowed == nil || t.allowed[name]
+	t.mu.RUnlock()
+	if !allowed {
+		return nil, fmt.Errorf("%w: '%s'", ErrTenantNotAllowed, name)
+	}
+	return t.controller(name), nil
+}
+
+// stored returns true if tenant has metrics in storage
+func (t *Tenants) stored(name string) bool {
+	return t.factory.HasTenant(name)
+}
+
+// controller returns storage controller of tenant, it is created on the first access
+func (t *Tenants) controller(name string) *Controller {
+	t.mu.RLock()
+	c, ok := t.controllers[name]
+	t.mu.RUnlock()
+	if ok {
+		return c
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok = t.controllers[name]; !ok {
+		c = NewStorageController(t.factory.Tenant(name), t.opts...)
+		t.controllers[name] = c
+	}
+	return c
+}
+
+// List returns sorted names of all existing tenants
+func (t *Tenants) List() []string {
+	names := map[string]struct{}{tenant.Default: {}}
+	for _, name := range t.factory.Tenants() {
+		names[name] = struct{}{}
+	}
+	t.mu.RLock()
+	for name := range t.controllers {
+		names[name] = struct{}{}
+	}
+	t.mu.RUnlock()
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// GetAll returns metrics of all tenants, metrics of not default tenants have tenant set
+func (t *Tenants) GetAll() []models.TenantMetrics {
+	var metrics []models.TenantMetrics
+	for _, name := range t.List() {
+		owner := name
+		if name == tenant.Default {
+			owner = ""
+		}
+		for _, m := range t.controller(name).GetAll() {
+			metrics = append(metrics, models.TenantMetrics{Metrics: m, Tenant: owner})
+		}
+	}
+	return metrics
+}
+
+// RestoreLatest restores metrics to their tenants, see Controller.RestoreLatest.
+// Tenants of restored metrics are created regardless of restriction.
+func (t *Tenants) RestoreLatest(metrics []models.TenantMetrics, ts time.Time) {
+	byTenant := make(map[string][]models.Metrics)
+	for _, m := range metrics {
+		name := m.Tenant
+		if name == "" {
+			name = tenant.Default
+		}
+		byTenant[name] = append(byTenant[name], m.Metrics)
+	}
+	for name, set := range byTenant {
+		t.controller(name).RestoreLatest(set, ts)
+	}
+}
+
+// ExpireStale removes stale metrics of all tenants, see Controller.ExpireStale
+func (t *Tenants) ExpireStale() (expired int) {
+	for _, name := range t.List() {
+		expired += t.controller(name).ExpireStale()
+	}
+	return
+}
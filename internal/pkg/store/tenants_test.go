@@ -0,0 +1,109 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/models"
+	"github.com/freepaddler/yap-metrics/internal/pkg/tenant"
+	"github.com/freepaddler/yap-metrics/mocks"
+)
+
+// storedTenants is a factory of tenants stores, which have metrics in storage
+type storedTenants struct {
+	NewStoreFunc
+	names []string
+}
+
+func (f storedTenants) Tenants() []string { return f.names }
+
+func (f storedTenants) HasTenant(name string) bool {
+	for _, n := range f.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTenants(t *testing.T) {
+	var mockController = gomock.NewController(t)
+	defer mockController.Finish()
+	stores := make(map[string]*mocks.MockStore)
+	var created []*mocks.MockStore
+	tenants := NewTenants(storedTenants{
+		NewStoreFunc: func() Store {
+			m := mocks.NewMockStore(mockController)
+			created = append(created, m)
+			return m
+		},
+		names: []string{"stored"},
+	})
+
+	// controllers are created once on the first access, empty name is default tenant
+	def, ok := tenants.Tenant("")
+	require.True(t, ok, "default tenant should exist")
+	assert.Same(t, def, tenants.Default())
+	stores[tenant.Default] = created[0]
+
+	// unknown tenant is not created on access, only on update
+	_, ok = tenants.Tenant("team1")
+	assert.False(t, ok, "unknown tenant should not exist")
+	require.Len(t, created, 1)
+	team1, err := tenants.Create("team1")
+	require.NoError(t, err)
+	stores["team1"] = created[1]
+	got, ok := tenants.Tenant("team1")
+	require.True(t, ok, "created tenant should exist")
+	assert.Same(t, team1, got)
+
+	// tenant with metrics in storage exists
+	_, ok = tenants.Tenant("stored")
+	assert.True(t, ok, "stored tenant should exist")
+	stores["stored"] = created[2]
+	assert.Equal(t, []string{tenant.Default, "stored", "team1"}, tenants.List())
+
+	// restricted tenants
+	tenants.Restrict("team2")
+	_, err = tenants.Create("team3")
+	assert.ErrorIs(t, err, ErrTenantNotAllowed)
+	_, err = tenants.Create("team2")
+	assert.NoError(t, err)
+	stores["team2"] = created[3]
+	_, err = tenants.Create("team1")
+	assert.NoError(t, err, "existing tenant should not be restricted")
+	require.Len(t, created, 4)
+
+	// metrics of tenants are isolated
+	v1, v2 := int64(1), int64(2)
+	stores["team1"].EXPECT().IncCounter("c1", nil, v1).Times(1)
+	team1.CollectCounter("c1", nil, v1)
+
+	// dump has tenant of not default tenant metrics
+	stores[tenant.Default].EXPECT().Snapshot(false).Times(1).Return([]models.Metrics{{Name: "c1", Type: models.Counter, IValue: &v2}})
+	stores["team1"].EXPECT().Snapshot(false).Times(1).Return([]models.Metrics{{Name: "c1", Type: models.Counter, IValue: &v1}})
+	stores["team2"].EXPECT().Snapshot(false).Times(1)
+	stores["stored"].EXPECT().Snapshot(false).Times(1)
+	all := tenants.GetAll()
+	require.Len(t, all, 2)
+	assert.Equal(t, "", all[0].Tenant)
+	assert.Equal(t, "team1", all[1].Tenant)
+
+	// metrics are restored to their tenants, regardless of restriction
+	v3 := int64(3)
+	all = append(all, models.TenantMetrics{Metrics: models.Metrics{Name: "c1", Type: models.Counter, IValue: &v3}, Tenant: "team3"})
+	stores[tenant.Default].EXPECT().IncCounter("c1", nil, v2).Times(1)
+	stores["team1"].EXPECT().IncCounter("c1", nil, v1).Times(1)
+	var restored *mocks.MockStore
+	tenants.factory = storedTenants{NewStoreFunc: func() Store {
+		restored = mocks.NewMockStore(mockController)
+		restored.EXPECT().IncCounter("c1", nil, v3).Times(1)
+		return restored
+	}}
+	tenants.RestoreLatest(all, time.Now())
+	require.NotNil(t, restored, "tenant of restored metrics should be created")
+}
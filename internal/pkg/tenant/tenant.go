@@ -0,0 +1,119 @@
+// Package tenant passes metrics tenant (namespace) of request.
+//
+// Tenant is taken from `X-Tenant` header (`x-tenant` metadata for gRPC) and may be overridden
+// by API key bound to tenant. Requests without tenant belong to default tenant.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
+)
+
+const (
+	Header      = "X-Tenant"
+	MetadataKey = "x-tenant"
+	// Default is a tenant of requests without tenant
+	Default = "default"
+)
+
+var (
+	ErrInvalid = errors.New("invalid tenant name")
+	validName  = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+)
+
+// Valid checks tenant name: up to 64 letters, digits, dots, dashes and underscores
+func Valid(name string) bool {
+	return validName.MatchString(name)
+}
+
+type ctxKey struct{}
+
+// NewContext returns context with tenant
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, name)
+}
+
+// FromContext returns tenant from context, Default if context has no tenant
+func FromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(ctxKey{}).(string); ok && name != "" {
+		return name
+	}
+	return Default
+}
+
+// Requested returns tenant explicitly set in context, empty if there is no tenant
+func Requested(ctx context.Context) string {
+	name, _ := ctx.Value(ctxKey{}).(string)
+	return name
+}
+
+// Middleware adds tenant from `X-Tenant` header to request context.
+// Request with invalid tenant name is rejected with 403/Forbidden.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(Header)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !Valid(name) {
+			logger.Log().Warn().Msgf("invalid tenant '%s'", name)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), name)))
+	})
+}
+
+// fromMetadata adds tenant from `x-tenant` metadata to context
+func fromMetadata(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	v := md.Get(MetadataKey)
+	if len(v) == 0 || v[0] == "" {
+		return ctx, nil
+	}
+	if !Valid(v[0]) {
+		return nil, status.Errorf(codes.PermissionDenied, "%s '%s'", ErrInvalid, v[0])
+	}
+	return NewContext(ctx, v[0]), nil
+}
+
+// UnaryServerInterceptor adds tenant from `x-tenant` metadata to call context
+func UnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := fromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor adds tenant from `x-tenant` metadata to stream context
+func StreamServerInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := fromMetadata(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &stream{ServerStream: ss, ctx: ctx})
+}
+
+// stream is a server stream with tenant context
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
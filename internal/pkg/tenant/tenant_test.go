@@ -0,0 +1,75 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestValid(t *testing.T) {
+	for _, name := range []string{"default", "team-1", "a.b_c", "0"} {
+		assert.True(t, Valid(name), name)
+	}
+	for _, name := range []string{"", "-team", "team 1", "team/1", string(make([]byte, 65))} {
+		assert.False(t, Valid(name), name)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantCode   int
+		wantTenant string
+	}{
+		{name: "no tenant", wantCode: http.StatusOK, wantTenant: Default},
+		{name: "tenant", header: "team1", wantCode: http.StatusOK, wantTenant: "team1"},
+		{name: "invalid tenant", header: "team/1", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = FromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantTenant, got)
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var got string
+	handler := func(ctx context.Context, _ any) (any, error) {
+		got = Requested(ctx)
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{}
+
+	_, err := UnaryServerInterceptor(context.Background(), nil, info, handler)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "team1"))
+	_, err = UnaryServerInterceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "team1", got)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "team 1"))
+	_, err = UnaryServerInterceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
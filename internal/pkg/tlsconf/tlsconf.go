@@ -0,0 +1,85 @@
+// Package tlsconf builds TLS configurations of server and client from PEM files.
+//
+// Server may require client certificates signed by CA (mutual TLS),
+// client may verify server with its own CA and present client certificate.
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrNoCert = errors.New("certificate and key files are required")
+	ErrCA     = errors.New("no certificates found in CA file")
+)
+
+// Server returns server TLS configuration with certificate and key files.
+// If clientCAFile is set, clients are required to present certificate signed by CA from the file.
+func Server(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, ErrNoCert
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load server certificate: %w", err)
+	}
+	conf := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if clientCAFile != "" {
+		pool, err := readCA(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// Client returns client TLS configuration.
+// Server certificate is verified with CA from caFile or with system CAs if caFile is empty.
+// Client certificate is presented to server if certFile and keyFile are set.
+// Non-empty serverName overrides the name to verify server certificate against.
+func Client(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+	if caFile != "" {
+		pool, err := readCA(caFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, ErrNoCert
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// readCA reads certificates pool from PEM file
+func readCA(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w %s", ErrCA, path)
+	}
+	return pool, nil
+}
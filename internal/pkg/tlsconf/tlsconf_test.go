@@ -0,0 +1,153 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// certFiles is a set of PEM files of a certificate
+type certFiles struct {
+	cert, key string
+}
+
+// issue creates certificate signed by parent, self-signed if parent is nil, and writes it to dir
+func issue(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, certFiles) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:         isCA,
+
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := certFiles{cert: filepath.Join(dir, name+".crt"), key: filepath.Join(dir, name+".key")}
+	require.NoError(t, os.WriteFile(files.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(files.key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert, key, files
+}
+
+func TestServerClient(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFiles := issue(t, dir, "ca", nil, nil, true)
+	_, _, srvFiles := issue(t, dir, "metrics.local", ca, caKey, false)
+	_, _, clientFiles := issue(t, dir, "agent", ca, caKey, false)
+	_, _, otherFiles := issue(t, dir, "other", nil, nil, false)
+
+	tests := []struct {
+		name       string
+		clientCA   string
+		caFile     string
+		clientCert certFiles
+		serverName string
+		wantErr    bool
+	}{
+		{
+			name:   "tls",
+			caFile: caFiles.cert,
+		},
+		{
+			name:       "tls with server name",
+			caFile:     caFiles.cert,
+			serverName: "metrics.local",
+		},
+		{
+			name:       "wrong server name",
+			caFile:     caFiles.cert,
+			serverName: "other.local",
+			wantErr:    true,
+		},
+		{
+			name:    "unknown server CA",
+			caFile:  otherFiles.cert,
+			wantErr: true,
+		},
+		{
+			name:       "mutual tls",
+			clientCA:   caFiles.cert,
+			caFile:     caFiles.cert,
+			clientCert: clientFiles,
+		},
+		{
+			name:     "mutual tls without client cert",
+			clientCA: caFiles.cert,
+			caFile:   caFiles.cert,
+			wantErr:  true,
+		},
+		{
+			name:       "mutual tls with untrusted client cert",
+			clientCA:   caFiles.cert,
+			caFile:     caFiles.cert,
+			clientCert: otherFiles,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srvConf, err := Server(srvFiles.cert, srvFiles.key, tt.clientCA)
+			require.NoError(t, err)
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.TLS = srvConf
+			srv.StartTLS()
+			defer srv.Close()
+
+			clientConf, err := Client(tt.caFile, tt.clientCert.cert, tt.clientCert.key, tt.serverName)
+			require.NoError(t, err)
+			client := http.Client{Transport: &http.Transport{TLSClientConfig: clientConf}}
+			resp, err := client.Get(srv.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, _, files := issue(t, dir, "server", nil, nil, false)
+
+	_, err := Server("", files.key, "")
+	assert.ErrorIs(t, err, ErrNoCert)
+	_, err = Server(files.cert, files.key, files.key)
+	assert.ErrorIs(t, err, ErrCA)
+	_, err = Client("", files.cert, "", "")
+	assert.ErrorIs(t, err, ErrNoCert)
+	_, err = Client(filepath.Join(dir, "missing"), "", "", "")
+	assert.Error(t, err)
+}
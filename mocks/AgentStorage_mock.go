@@ -36,27 +36,39 @@ func (m *MockCollectorStorage) EXPECT() *MockCollectorStorageMockRecorder {
 }
 
 // CollectCounter mocks base method.
-func (m *MockCollectorStorage) CollectCounter(name string, val int64) {
+func (m *MockCollectorStorage) CollectCounter(name string, labels models.Labels, val int64) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "CollectCounter", name, val)
+	m.ctrl.Call(m, "CollectCounter", name, labels, val)
 }
 
 // CollectCounter indicates an expected call of CollectCounter.
-func (mr *MockCollectorStorageMockRecorder) CollectCounter(name, val interface{}) *gomock.Call {
+func (mr *MockCollectorStorageMockRecorder) CollectCounter(name, labels, val interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectCounter", reflect.TypeOf((*MockCollectorStorage)(nil).CollectCounter), name, val)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectCounter", reflect.TypeOf((*MockCollectorStorage)(nil).CollectCounter), name, labels, val)
 }
 
 // CollectGauge mocks base method.
-func (m *MockCollectorStorage) CollectGauge(name string, val float64) {
+func (m *MockCollectorStorage) CollectGauge(name string, labels models.Labels, val float64) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "CollectGauge", name, val)
+	m.ctrl.Call(m, "CollectGauge", name, labels, val)
 }
 
 // CollectGauge indicates an expected call of CollectGauge.
-func (mr *MockCollectorStorageMockRecorder) CollectGauge(name, val interface{}) *gomock.Call {
+func (mr *MockCollectorStorageMockRecorder) CollectGauge(name, labels, val interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGauge", reflect.TypeOf((*MockCollectorStorage)(nil).CollectGauge), name, val)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGauge", reflect.TypeOf((*MockCollectorStorage)(nil).CollectGauge), name, labels, val)
+}
+
+// CollectHistogram mocks base method.
+func (m *MockCollectorStorage) CollectHistogram(name string, labels models.Labels, bounds []float64, val float64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "CollectHistogram", name, labels, bounds, val)
+}
+
+// CollectHistogram indicates an expected call of CollectHistogram.
+func (mr *MockCollectorStorageMockRecorder) CollectHistogram(name, labels, bounds, val interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectHistogram", reflect.TypeOf((*MockCollectorStorage)(nil).CollectHistogram), name, labels, bounds, val)
 }
 
 // MockReporterStorage is a mock of ReporterStorage interface.
@@ -133,17 +145,68 @@ func (m *MockReporter) EXPECT() *MockReporterMockRecorder {
 }
 
 // Send mocks base method.
-func (m *MockReporter) Send(arg0 []models.Metrics) error {
+func (m *MockReporter) Send(id string, metrics []models.Metrics) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Send", arg0)
+	ret := m.ctrl.Call(m, "Send", id, metrics)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Send indicates an expected call of Send.
-func (mr *MockReporterMockRecorder) Send(arg0 interface{}) *gomock.Call {
+func (mr *MockReporterMockRecorder) Send(id, metrics interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockReporter)(nil).Send), id, metrics)
+}
+
+// MockSpool is a mock of Spool interface.
+type MockSpool struct {
+	ctrl     *gomock.Controller
+	recorder *MockSpoolMockRecorder
+}
+
+// MockSpoolMockRecorder is the mock recorder for MockSpool.
+type MockSpoolMockRecorder struct {
+	mock *MockSpool
+}
+
+// NewMockSpool creates a new mock instance.
+func NewMockSpool(ctrl *gomock.Controller) *MockSpool {
+	mock := &MockSpool{ctrl: ctrl}
+	mock.recorder = &MockSpoolMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSpool) EXPECT() *MockSpoolMockRecorder {
+	return m.recorder
+}
+
+// Push mocks base method.
+func (m *MockSpool) Push(id string, ts time.Time, metrics []models.Metrics) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Push", id, ts, metrics)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Push indicates an expected call of Push.
+func (mr *MockSpoolMockRecorder) Push(id, ts, metrics interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockSpool)(nil).Push), id, ts, metrics)
+}
+
+// Replay mocks base method.
+func (m *MockSpool) Replay(send func(string, time.Time, []models.Metrics) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Replay", send)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Replay indicates an expected call of Replay.
+func (mr *MockSpoolMockRecorder) Replay(send interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockReporter)(nil).Send), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replay", reflect.TypeOf((*MockSpool)(nil).Replay), send)
 }
 
 // MockAgentStorage is a mock of AgentStorage interface.
@@ -170,27 +233,39 @@ func (m *MockAgentStorage) EXPECT() *MockAgentStorageMockRecorder {
 }
 
 // CollectCounter mocks base method.
-func (m *MockAgentStorage) CollectCounter(name string, val int64) {
+func (m *MockAgentStorage) CollectCounter(name string, labels models.Labels, val int64) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "CollectCounter", name, val)
+	m.ctrl.Call(m, "CollectCounter", name, labels, val)
 }
 
 // CollectCounter indicates an expected call of CollectCounter.
-func (mr *MockAgentStorageMockRecorder) CollectCounter(name, val interface{}) *gomock.Call {
+func (mr *MockAgentStorageMockRecorder) CollectCounter(name, labels, val interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectCounter", reflect.TypeOf((*MockAgentStorage)(nil).CollectCounter), name, val)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectCounter", reflect.TypeOf((*MockAgentStorage)(nil).CollectCounter), name, labels, val)
 }
 
 // CollectGauge mocks base method.
-func (m *MockAgentStorage) CollectGauge(name string, val float64) {
+func (m *MockAgentStorage) CollectGauge(name string, labels models.Labels, val float64) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "CollectGauge", name, val)
+	m.ctrl.Call(m, "CollectGauge", name, labels, val)
 }
 
 // CollectGauge indicates an expected call of CollectGauge.
-func (mr *MockAgentStorageMockRecorder) CollectGauge(name, val interface{}) *gomock.Call {
+func (mr *MockAgentStorageMockRecorder) CollectGauge(name, labels, val interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGauge", reflect.TypeOf((*MockAgentStorage)(nil).CollectGauge), name, labels, val)
+}
+
+// CollectHistogram mocks base method.
+func (m *MockAgentStorage) CollectHistogram(name string, labels models.Labels, bounds []float64, val float64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "CollectHistogram", name, labels, bounds, val)
+}
+
+// CollectHistogram indicates an expected call of CollectHistogram.
+func (mr *MockAgentStorageMockRecorder) CollectHistogram(name, labels, bounds, val interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectGauge", reflect.TypeOf((*MockAgentStorage)(nil).CollectGauge), name, val)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectHistogram", reflect.TypeOf((*MockAgentStorage)(nil).CollectHistogram), name, labels, bounds, val)
 }
 
 // ReportAll mocks base method.
@@ -6,8 +6,10 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	models "github.com/freepaddler/yap-metrics/internal/pkg/models"
+	broker "github.com/freepaddler/yap-metrics/internal/pkg/store/broker"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -34,6 +36,34 @@ func (m *MockHTTPHandlerStorage) EXPECT() *MockHTTPHandlerStorageMockRecorder {
 	return m.recorder
 }
 
+// DeleteMany mocks base method.
+func (m *MockHTTPHandlerStorage) DeleteMany(requests []models.MetricRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMany", requests)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMany indicates an expected call of DeleteMany.
+func (mr *MockHTTPHandlerStorageMockRecorder) DeleteMany(requests interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMany", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).DeleteMany), requests)
+}
+
+// DeleteOne mocks base method.
+func (m *MockHTTPHandlerStorage) DeleteOne(request models.MetricRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOne", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOne indicates an expected call of DeleteOne.
+func (mr *MockHTTPHandlerStorageMockRecorder) DeleteOne(request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOne", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).DeleteOne), request)
+}
+
 // GetAll mocks base method.
 func (m *MockHTTPHandlerStorage) GetAll() []models.Metrics {
 	m.ctrl.T.Helper()
@@ -63,6 +93,21 @@ func (mr *MockHTTPHandlerStorageMockRecorder) GetOne(request interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOne", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).GetOne), request)
 }
 
+// History mocks base method.
+func (m *MockHTTPHandlerStorage) History(request models.MetricRequest, from, to time.Time, step time.Duration) ([]models.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", request, from, to, step)
+	ret0, _ := ret[0].([]models.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockHTTPHandlerStorageMockRecorder) History(request, from, to, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).History), request, from, to, step)
+}
+
 // Ping mocks base method.
 func (m *MockHTTPHandlerStorage) Ping() error {
 	m.ctrl.T.Helper()
@@ -77,6 +122,34 @@ func (mr *MockHTTPHandlerStorageMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).Ping))
 }
 
+// Subscribe mocks base method.
+func (m *MockHTTPHandlerStorage) Subscribe(filter func(models.Metrics) bool) *broker.Subscription {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", filter)
+	ret0, _ := ret[0].(*broker.Subscription)
+	return ret0
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockHTTPHandlerStorageMockRecorder) Subscribe(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).Subscribe), filter)
+}
+
+// UpdateBatch mocks base method.
+func (m *MockHTTPHandlerStorage) UpdateBatch(id string, metrics []models.Metrics) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBatch", id, metrics)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBatch indicates an expected call of UpdateBatch.
+func (mr *MockHTTPHandlerStorageMockRecorder) UpdateBatch(id, metrics interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBatch", reflect.TypeOf((*MockHTTPHandlerStorage)(nil).UpdateBatch), id, metrics)
+}
+
 // UpdateMany mocks base method.
 func (m *MockHTTPHandlerStorage) UpdateMany(metrics []models.Metrics) error {
 	m.ctrl.T.Helper()
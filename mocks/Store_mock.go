@@ -6,6 +6,7 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	models "github.com/freepaddler/yap-metrics/internal/pkg/models"
 	gomock "github.com/golang/mock/gomock"
@@ -35,44 +36,44 @@ func (m *MockGauge) EXPECT() *MockGaugeMockRecorder {
 }
 
 // DelGauge mocks base method.
-func (m *MockGauge) DelGauge(name string) {
+func (m *MockGauge) DelGauge(name string, labels models.Labels) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "DelGauge", name)
+	m.ctrl.Call(m, "DelGauge", name, labels)
 }
 
 // DelGauge indicates an expected call of DelGauge.
-func (mr *MockGaugeMockRecorder) DelGauge(name interface{}) *gomock.Call {
+func (mr *MockGaugeMockRecorder) DelGauge(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelGauge", reflect.TypeOf((*MockGauge)(nil).DelGauge), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelGauge", reflect.TypeOf((*MockGauge)(nil).DelGauge), name, labels)
 }
 
 // GetGauge mocks base method.
-func (m *MockGauge) GetGauge(name string) (float64, bool) {
+func (m *MockGauge) GetGauge(name string, labels models.Labels) (float64, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGauge", name)
+	ret := m.ctrl.Call(m, "GetGauge", name, labels)
 	ret0, _ := ret[0].(float64)
 	ret1, _ := ret[1].(bool)
 	return ret0, ret1
 }
 
 // GetGauge indicates an expected call of GetGauge.
-func (mr *MockGaugeMockRecorder) GetGauge(name interface{}) *gomock.Call {
+func (mr *MockGaugeMockRecorder) GetGauge(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockGauge)(nil).GetGauge), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockGauge)(nil).GetGauge), name, labels)
 }
 
 // SetGauge mocks base method.
-func (m *MockGauge) SetGauge(name string, value float64) float64 {
+func (m *MockGauge) SetGauge(name string, labels models.Labels, value float64) float64 {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetGauge", name, value)
+	ret := m.ctrl.Call(m, "SetGauge", name, labels, value)
 	ret0, _ := ret[0].(float64)
 	return ret0
 }
 
 // SetGauge indicates an expected call of SetGauge.
-func (mr *MockGaugeMockRecorder) SetGauge(name, value interface{}) *gomock.Call {
+func (mr *MockGaugeMockRecorder) SetGauge(name, labels, value interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGauge", reflect.TypeOf((*MockGauge)(nil).SetGauge), name, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGauge", reflect.TypeOf((*MockGauge)(nil).SetGauge), name, labels, value)
 }
 
 // MockCounter is a mock of Counter interface.
@@ -99,44 +100,170 @@ func (m *MockCounter) EXPECT() *MockCounterMockRecorder {
 }
 
 // DelCounter mocks base method.
-func (m *MockCounter) DelCounter(name string) {
+func (m *MockCounter) DelCounter(name string, labels models.Labels) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "DelCounter", name)
+	m.ctrl.Call(m, "DelCounter", name, labels)
 }
 
 // DelCounter indicates an expected call of DelCounter.
-func (mr *MockCounterMockRecorder) DelCounter(name interface{}) *gomock.Call {
+func (mr *MockCounterMockRecorder) DelCounter(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelCounter", reflect.TypeOf((*MockCounter)(nil).DelCounter), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelCounter", reflect.TypeOf((*MockCounter)(nil).DelCounter), name, labels)
 }
 
 // GetCounter mocks base method.
-func (m *MockCounter) GetCounter(name string) (int64, bool) {
+func (m *MockCounter) GetCounter(name string, labels models.Labels) (int64, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCounter", name)
+	ret := m.ctrl.Call(m, "GetCounter", name, labels)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(bool)
 	return ret0, ret1
 }
 
 // GetCounter indicates an expected call of GetCounter.
-func (mr *MockCounterMockRecorder) GetCounter(name interface{}) *gomock.Call {
+func (mr *MockCounterMockRecorder) GetCounter(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounter", reflect.TypeOf((*MockCounter)(nil).GetCounter), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounter", reflect.TypeOf((*MockCounter)(nil).GetCounter), name, labels)
 }
 
 // IncCounter mocks base method.
-func (m *MockCounter) IncCounter(name string, value int64) int64 {
+func (m *MockCounter) IncCounter(name string, labels models.Labels, value int64) int64 {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IncCounter", name, value)
+	ret := m.ctrl.Call(m, "IncCounter", name, labels, value)
 	ret0, _ := ret[0].(int64)
 	return ret0
 }
 
 // IncCounter indicates an expected call of IncCounter.
-func (mr *MockCounterMockRecorder) IncCounter(name, value interface{}) *gomock.Call {
+func (mr *MockCounterMockRecorder) IncCounter(name, labels, value interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncCounter", reflect.TypeOf((*MockCounter)(nil).IncCounter), name, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncCounter", reflect.TypeOf((*MockCounter)(nil).IncCounter), name, labels, value)
+}
+
+// MockHistogram is a mock of Histogram interface.
+type MockHistogram struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistogramMockRecorder
+}
+
+// MockHistogramMockRecorder is the mock recorder for MockHistogram.
+type MockHistogramMockRecorder struct {
+	mock *MockHistogram
+}
+
+// NewMockHistogram creates a new mock instance.
+func NewMockHistogram(ctrl *gomock.Controller) *MockHistogram {
+	mock := &MockHistogram{ctrl: ctrl}
+	mock.recorder = &MockHistogramMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistogram) EXPECT() *MockHistogramMockRecorder {
+	return m.recorder
+}
+
+// DelHistogram mocks base method.
+func (m *MockHistogram) DelHistogram(name string, labels models.Labels) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DelHistogram", name, labels)
+}
+
+// DelHistogram indicates an expected call of DelHistogram.
+func (mr *MockHistogramMockRecorder) DelHistogram(name, labels interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelHistogram", reflect.TypeOf((*MockHistogram)(nil).DelHistogram), name, labels)
+}
+
+// GetHistogram mocks base method.
+func (m *MockHistogram) GetHistogram(name string, labels models.Labels) (models.HistogramValue, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", name, labels)
+	ret0, _ := ret[0].(models.HistogramValue)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockHistogramMockRecorder) GetHistogram(name, labels interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockHistogram)(nil).GetHistogram), name, labels)
+}
+
+// SetHistogram mocks base method.
+func (m *MockHistogram) SetHistogram(name string, labels models.Labels, value models.HistogramValue) models.HistogramValue {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHistogram", name, labels, value)
+	ret0, _ := ret[0].(models.HistogramValue)
+	return ret0
+}
+
+// SetHistogram indicates an expected call of SetHistogram.
+func (mr *MockHistogramMockRecorder) SetHistogram(name, labels, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHistogram", reflect.TypeOf((*MockHistogram)(nil).SetHistogram), name, labels, value)
+}
+
+// MockBatch is a mock of Batch interface.
+type MockBatch struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchMockRecorder
+}
+
+// MockBatchMockRecorder is the mock recorder for MockBatch.
+type MockBatchMockRecorder struct {
+	mock *MockBatch
+}
+
+// NewMockBatch creates a new mock instance.
+func NewMockBatch(ctrl *gomock.Controller) *MockBatch {
+	mock := &MockBatch{ctrl: ctrl}
+	mock.recorder = &MockBatchMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatch) EXPECT() *MockBatchMockRecorder {
+	return m.recorder
+}
+
+// AddBatch mocks base method.
+func (m *MockBatch) AddBatch(id string, ts time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBatch", id, ts)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBatch indicates an expected call of AddBatch.
+func (mr *MockBatchMockRecorder) AddBatch(id, ts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBatch", reflect.TypeOf((*MockBatch)(nil).AddBatch), id, ts)
+}
+
+// DelBatch mocks base method.
+func (m *MockBatch) DelBatch(id string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DelBatch", id)
+}
+
+// DelBatch indicates an expected call of DelBatch.
+func (mr *MockBatchMockRecorder) DelBatch(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelBatch", reflect.TypeOf((*MockBatch)(nil).DelBatch), id)
+}
+
+// PurgeBatches mocks base method.
+func (m *MockBatch) PurgeBatches(before time.Time) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PurgeBatches", before)
+}
+
+// PurgeBatches indicates an expected call of PurgeBatches.
+func (mr *MockBatchMockRecorder) PurgeBatches(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeBatches", reflect.TypeOf((*MockBatch)(nil).PurgeBatches), before)
 }
 
 // MockStore is a mock of Store interface.
@@ -162,72 +289,126 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// AddBatch mocks base method.
+func (m *MockStore) AddBatch(id string, ts time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBatch", id, ts)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddBatch indicates an expected call of AddBatch.
+func (mr *MockStoreMockRecorder) AddBatch(id, ts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBatch", reflect.TypeOf((*MockStore)(nil).AddBatch), id, ts)
+}
+
+// DelBatch mocks base method.
+func (m *MockStore) DelBatch(id string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DelBatch", id)
+}
+
+// DelBatch indicates an expected call of DelBatch.
+func (mr *MockStoreMockRecorder) DelBatch(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelBatch", reflect.TypeOf((*MockStore)(nil).DelBatch), id)
+}
+
 // DelCounter mocks base method.
-func (m *MockStore) DelCounter(name string) {
+func (m *MockStore) DelCounter(name string, labels models.Labels) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "DelCounter", name)
+	m.ctrl.Call(m, "DelCounter", name, labels)
 }
 
 // DelCounter indicates an expected call of DelCounter.
-func (mr *MockStoreMockRecorder) DelCounter(name interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) DelCounter(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelCounter", reflect.TypeOf((*MockStore)(nil).DelCounter), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelCounter", reflect.TypeOf((*MockStore)(nil).DelCounter), name, labels)
 }
 
 // DelGauge mocks base method.
-func (m *MockStore) DelGauge(name string) {
+func (m *MockStore) DelGauge(name string, labels models.Labels) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "DelGauge", name)
+	m.ctrl.Call(m, "DelGauge", name, labels)
 }
 
 // DelGauge indicates an expected call of DelGauge.
-func (mr *MockStoreMockRecorder) DelGauge(name interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) DelGauge(name, labels interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelGauge", reflect.TypeOf((*MockStore)(nil).DelGauge), name, labels)
+}
+
+// DelHistogram mocks base method.
+func (m *MockStore) DelHistogram(name string, labels models.Labels) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DelHistogram", name, labels)
+}
+
+// DelHistogram indicates an expected call of DelHistogram.
+func (mr *MockStoreMockRecorder) DelHistogram(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelGauge", reflect.TypeOf((*MockStore)(nil).DelGauge), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelHistogram", reflect.TypeOf((*MockStore)(nil).DelHistogram), name, labels)
 }
 
 // GetCounter mocks base method.
-func (m *MockStore) GetCounter(name string) (int64, bool) {
+func (m *MockStore) GetCounter(name string, labels models.Labels) (int64, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCounter", name)
+	ret := m.ctrl.Call(m, "GetCounter", name, labels)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(bool)
 	return ret0, ret1
 }
 
 // GetCounter indicates an expected call of GetCounter.
-func (mr *MockStoreMockRecorder) GetCounter(name interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetCounter(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounter", reflect.TypeOf((*MockStore)(nil).GetCounter), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounter", reflect.TypeOf((*MockStore)(nil).GetCounter), name, labels)
 }
 
 // GetGauge mocks base method.
-func (m *MockStore) GetGauge(name string) (float64, bool) {
+func (m *MockStore) GetGauge(name string, labels models.Labels) (float64, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetGauge", name)
+	ret := m.ctrl.Call(m, "GetGauge", name, labels)
 	ret0, _ := ret[0].(float64)
 	ret1, _ := ret[1].(bool)
 	return ret0, ret1
 }
 
 // GetGauge indicates an expected call of GetGauge.
-func (mr *MockStoreMockRecorder) GetGauge(name interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetGauge(name, labels interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockStore)(nil).GetGauge), name)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockStore)(nil).GetGauge), name, labels)
+}
+
+// GetHistogram mocks base method.
+func (m *MockStore) GetHistogram(name string, labels models.Labels) (models.HistogramValue, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", name, labels)
+	ret0, _ := ret[0].(models.HistogramValue)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockStoreMockRecorder) GetHistogram(name, labels interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockStore)(nil).GetHistogram), name, labels)
 }
 
 // IncCounter mocks base method.
-func (m *MockStore) IncCounter(name string, value int64) int64 {
+func (m *MockStore) IncCounter(name string, labels models.Labels, value int64) int64 {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IncCounter", name, value)
+	ret := m.ctrl.Call(m, "IncCounter", name, labels, value)
 	ret0, _ := ret[0].(int64)
 	return ret0
 }
 
 // IncCounter indicates an expected call of IncCounter.
-func (mr *MockStoreMockRecorder) IncCounter(name, value interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) IncCounter(name, labels, value interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncCounter", reflect.TypeOf((*MockStore)(nil).IncCounter), name, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncCounter", reflect.TypeOf((*MockStore)(nil).IncCounter), name, labels, value)
 }
 
 // Ping mocks base method.
@@ -244,18 +425,44 @@ func (mr *MockStoreMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStore)(nil).Ping))
 }
 
+// PurgeBatches mocks base method.
+func (m *MockStore) PurgeBatches(before time.Time) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PurgeBatches", before)
+}
+
+// PurgeBatches indicates an expected call of PurgeBatches.
+func (mr *MockStoreMockRecorder) PurgeBatches(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeBatches", reflect.TypeOf((*MockStore)(nil).PurgeBatches), before)
+}
+
 // SetGauge mocks base method.
-func (m *MockStore) SetGauge(name string, value float64) float64 {
+func (m *MockStore) SetGauge(name string, labels models.Labels, value float64) float64 {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetGauge", name, value)
+	ret := m.ctrl.Call(m, "SetGauge", name, labels, value)
 	ret0, _ := ret[0].(float64)
 	return ret0
 }
 
 // SetGauge indicates an expected call of SetGauge.
-func (mr *MockStoreMockRecorder) SetGauge(name, value interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) SetGauge(name, labels, value interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGauge", reflect.TypeOf((*MockStore)(nil).SetGauge), name, value)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGauge", reflect.TypeOf((*MockStore)(nil).SetGauge), name, labels, value)
+}
+
+// SetHistogram mocks base method.
+func (m *MockStore) SetHistogram(name string, labels models.Labels, value models.HistogramValue) models.HistogramValue {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHistogram", name, labels, value)
+	ret0, _ := ret[0].(models.HistogramValue)
+	return ret0
+}
+
+// SetHistogram indicates an expected call of SetHistogram.
+func (mr *MockStoreMockRecorder) SetHistogram(name, labels, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHistogram", reflect.TypeOf((*MockStore)(nil).SetHistogram), name, labels, value)
 }
 
 // Snapshot mocks base method.
@@ -271,3 +478,117 @@ func (mr *MockStoreMockRecorder) Snapshot(flush interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockStore)(nil).Snapshot), flush)
 }
+
+// MockHistory is a mock of History interface.
+type MockHistory struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistoryMockRecorder
+}
+
+// MockHistoryMockRecorder is the mock recorder for MockHistory.
+type MockHistoryMockRecorder struct {
+	mock *MockHistory
+}
+
+// NewMockHistory creates a new mock instance.
+func NewMockHistory(ctrl *gomock.Controller) *MockHistory {
+	mock := &MockHistory{ctrl: ctrl}
+	mock.recorder = &MockHistoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistory) EXPECT() *MockHistoryMockRecorder {
+	return m.recorder
+}
+
+// History mocks base method.
+func (m *MockHistory) History(name, mType string, labels models.Labels, from, to time.Time, step time.Duration) ([]models.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "History", name, mType, labels, from, to, step)
+	ret0, _ := ret[0].([]models.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// History indicates an expected call of History.
+func (mr *MockHistoryMockRecorder) History(name, mType, labels, from, to, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "History", reflect.TypeOf((*MockHistory)(nil).History), name, mType, labels, from, to, step)
+}
+
+// MockBatchUpdater is a mock of BatchUpdater interface.
+type MockBatchUpdater struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchUpdaterMockRecorder
+}
+
+// MockBatchUpdaterMockRecorder is the mock recorder for MockBatchUpdater.
+type MockBatchUpdaterMockRecorder struct {
+	mock *MockBatchUpdater
+}
+
+// NewMockBatchUpdater creates a new mock instance.
+func NewMockBatchUpdater(ctrl *gomock.Controller) *MockBatchUpdater {
+	mock := &MockBatchUpdater{ctrl: ctrl}
+	mock.recorder = &MockBatchUpdaterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchUpdater) EXPECT() *MockBatchUpdaterMockRecorder {
+	return m.recorder
+}
+
+// UpdateBatch mocks base method.
+func (m *MockBatchUpdater) UpdateBatch(id string, ts time.Time, metrics []models.Metrics) ([]models.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBatch", id, ts, metrics)
+	ret0, _ := ret[0].([]models.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateBatch indicates an expected call of UpdateBatch.
+func (mr *MockBatchUpdaterMockRecorder) UpdateBatch(id, ts, metrics interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBatch", reflect.TypeOf((*MockBatchUpdater)(nil).UpdateBatch), id, ts, metrics)
+}
+
+// MockUpdateTimes is a mock of UpdateTimes interface.
+type MockUpdateTimes struct {
+	ctrl     *gomock.Controller
+	recorder *MockUpdateTimesMockRecorder
+}
+
+// MockUpdateTimesMockRecorder is the mock recorder for MockUpdateTimes.
+type MockUpdateTimesMockRecorder struct {
+	mock *MockUpdateTimes
+}
+
+// NewMockUpdateTimes creates a new mock instance.
+func NewMockUpdateTimes(ctrl *gomock.Controller) *MockUpdateTimes {
+	mock := &MockUpdateTimes{ctrl: ctrl}
+	mock.recorder = &MockUpdateTimesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUpdateTimes) EXPECT() *MockUpdateTimesMockRecorder {
+	return m.recorder
+}
+
+// UpdateTimes mocks base method.
+func (m *MockUpdateTimes) UpdateTimes() ([]models.SeriesUpdate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTimes")
+	ret0, _ := ret[0].([]models.SeriesUpdate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateTimes indicates an expected call of UpdateTimes.
+func (mr *MockUpdateTimesMockRecorder) UpdateTimes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTimes", reflect.TypeOf((*MockUpdateTimes)(nil).UpdateTimes))
+}
@@ -12,6 +12,26 @@ import (
 	"github.com/freepaddler/yap-metrics/internal/pkg/logger"
 )
 
+// DefaultMaxDelay is the longest delay requested by error (see After), which WithStrategy waits
+// for, unless other limit is set with WithMaxDelay
+const DefaultMaxDelay = time.Minute
+
+type maxDelayKey struct{}
+
+// WithMaxDelay returns context limiting delay requested by error (see After) to d,
+// i.e. server `Retry-After` should not delay retry beyond the next scheduled call
+func WithMaxDelay(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, maxDelayKey{}, d)
+}
+
+// maxDelay returns limit of delay requested by error
+func maxDelay(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(maxDelayKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+	return DefaultMaxDelay
+}
+
 // WithStrategy executes `try` function with the following retry strategy:
 // If `try` execution result has error, this error is checked with isRetryError function.
 // If resulted error requires retry, then next `try` execution delays on the interval (in seconds)
@@ -20,6 +40,9 @@ import (
 //   - number of retries exceeded
 //   - `try` function returned error is not retryable (isRetryError(err)!=true)
 //   - context cancellation/expiration/timeout
+//
+// If error tells to wait longer before retry (see After), then delay is extended up to
+// DefaultMaxDelay or limit set with WithMaxDelay.
 func WithStrategy(
 	ctx context.Context,
 	try func(ctx context.Context) error,
@@ -41,8 +64,17 @@ func WithStrategy(
 			logger.Log().Warn().Err(err).Msg("WithStrategy: not retryable error")
 			return
 		}
+		delay := time.Duration(retries[i]) * time.Second
+		if d, ok := After(err); ok && d > delay {
+			if limit := maxDelay(ctx); d > limit {
+				logger.Log().Warn().Msgf("WithStrategy: requested delay %s exceeds limit %s", d, limit)
+				d = limit
+			}
+			logger.Log().Debug().Msgf("WithStrategy: retry delayed for %s", d)
+			delay = d
+		}
 		select {
-		case <-time.After(time.Duration(retries[i]) * time.Second):
+		case <-time.After(delay):
 		case <-ctx.Done():
 			return ctx.Err()
 		}
@@ -50,6 +82,20 @@ func WithStrategy(
 	return
 }
 
+// Delayer is an error, which tells period to wait before retry, i.e. server `Retry-After` response
+type Delayer interface {
+	RetryAfter() time.Duration
+}
+
+// After returns period to wait before retry, if error or any error in its chain is Delayer
+func After(err error) (time.Duration, bool) {
+	var d Delayer
+	if errors.As(err, &d) {
+		return d.RetryAfter(), true
+	}
+	return 0, false
+}
+
 // IsNetErr checks network timeout and connection refused errors
 // may be used as isRetryError function for WithStrategy function
 func IsNetErr(err error) bool {
@@ -3,6 +3,7 @@ package retry
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -104,3 +105,56 @@ func TestWithStrategy(t *testing.T) {
 		})
 	}
 }
+
+// delayedErr is an error with retry delay
+type delayedErr time.Duration
+
+func (e delayedErr) Error() string { return "delayed" }
+
+func (e delayedErr) RetryAfter() time.Duration { return time.Duration(e) }
+
+func TestWithStrategy_Delayer(t *testing.T) {
+	n := 0
+	startTime := time.Now()
+	err := WithStrategy(
+		context.Background(),
+		func(ctx context.Context) error {
+			n++
+			if n == 1 {
+				return fmt.Errorf("wrapped: %w", delayedErr(time.Second))
+			}
+			return nil
+		},
+		func(err error) bool { return true },
+		0,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.GreaterOrEqual(t, time.Since(startTime), time.Second, "retry should wait for error delay")
+
+	// requested delay is limited
+	n = 0
+	startTime = time.Now()
+	err = WithStrategy(
+		WithMaxDelay(context.Background(), 100*time.Millisecond),
+		func(ctx context.Context) error {
+			n++
+			if n == 1 {
+				return delayedErr(time.Hour)
+			}
+			return nil
+		},
+		func(err error) bool { return true },
+		0,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Less(t, time.Since(startTime), time.Second, "retry should not wait longer than limit")
+	assert.Equal(t, DefaultMaxDelay, maxDelay(context.Background()))
+
+	d, ok := After(fmt.Errorf("wrapped: %w", delayedErr(time.Minute)))
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+	_, ok = After(errors.New("plain"))
+	assert.False(t, ok)
+}